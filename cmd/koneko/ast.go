@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/cvanloo/blog-go/markup"
+	"github.com/cvanloo/blog-go/markup/diagnostic"
+	"github.com/cvanloo/blog-go/markup/format"
+	"github.com/cvanloo/blog-go/markup/lexer"
+	"github.com/cvanloo/blog-go/markup/parser"
+)
+
+// printAST prints the syntax tree of a source as JSON, see parser.JSONVersion,
+// or with -decode the source of a tree printed before.
+// Without a file, it reads from stdin.
+func printAST() int {
+	argSet := flag.NewFlagSet("ast", flag.ExitOnError)
+	resolve := argSet.Bool("resolve", false, "Include files and resolve the references like the generator does, which fills in sidenotes, numbers footnotes and finds abbreviations.")
+	decode := argSet.Bool("decode", false, "Read a tree as JSON, and print it as source.")
+	argSet.Parse(os.Args[2:])
+	if argSet.NArg() > 1 {
+		log.Println("expected a single file")
+		return -1
+	}
+
+	filename := "<stdin>"
+	var (
+		src []byte
+		err error
+	)
+	if argSet.NArg() == 1 {
+		filename = argSet.Arg(0)
+		src, err = os.ReadFile(filename)
+	} else {
+		src, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	if *decode {
+		var blog parser.Blog
+		if err := json.Unmarshal(src, &blog); err != nil {
+			log.Printf("%s: %v", filename, err)
+			return 1
+		}
+		if err := format.Fprint(os.Stdout, &blog); err != nil {
+			log.Println(err)
+			return 1
+		}
+		return 0
+	}
+
+	blog, err := parseSource(filename, src, *resolve)
+	if err != nil {
+		if printErr := diagnostic.Fprint(os.Stderr, diagnostic.Collect(err), diagnostic.Files()); printErr != nil {
+			log.Println(printErr)
+		}
+		return 1
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(blog); err != nil {
+		log.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// parseSource lexes and parses a single source.
+// If asked to resolve it, the code blocks with an include attribute are filled
+// in relative to the directory of the source, and the references are resolved,
+// like the generator does.
+func parseSource(filename string, src []byte, resolve bool) (*parser.Blog, error) {
+	lx := lexer.New()
+	lx.LexSource(filename, string(src))
+	if len(lx.Errors) > 0 {
+		return nil, errors.Join(lx.Errors...)
+	}
+	blog, err := parser.Parse(lx)
+	if err != nil {
+		return nil, err
+	}
+	if resolve {
+		includer := &markup.IncludeVisitor{Dir: filepath.Dir(filename)}
+		blog.Accept(includer)
+		if includer.Err != nil {
+			return nil, includer.Err
+		}
+		refFixer := &parser.FixReferencesVisitor{}
+		blog.Accept(refFixer)
+		if refFixer.Errors != nil {
+			return nil, refFixer.Errors
+		}
+	}
+	return blog, nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cvanloo/blog-go/markup/diagnostic"
+	"github.com/cvanloo/blog-go/markup/lexer"
+	"github.com/cvanloo/blog-go/markup/parser"
+	"github.com/cvanloo/blog-go/page"
+)
+
+// debug prints what the stages of the generator make of a single source:
+//
+//	koneko debug lex FILE    the tokens of the lexer
+//	koneko debug parse FILE  the transitions of the parser, and the tree it builds
+//	koneko debug data FILE   the template data of the post
+func debug() int {
+	if len(os.Args) < 3 {
+		log.Println("expected one of: lex, parse, data")
+		return -1
+	}
+	stage := os.Args[2]
+	argSet := flag.NewFlagSet("debug "+stage, flag.ExitOnError)
+	argSet.Parse(os.Args[3:])
+	if argSet.NArg() != 1 {
+		log.Println("expected a single file")
+		return -1
+	}
+	filename := argSet.Arg(0)
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	var warnings []diagnostic.Diagnostic
+	switch stage {
+	case "lex":
+		err = debugLex(os.Stdout, filename, src)
+	case "parse":
+		warnings, err = debugParse(os.Stdout, filename, src)
+	case "data":
+		warnings, err = debugData(os.Stdout, filename, src)
+	default:
+		log.Printf("unknown stage: %s, expected one of: lex, parse, data", stage)
+		return -1
+	}
+	if ds := append(warnings, diagnostic.Collect(err)...); len(ds) > 0 {
+		if printErr := diagnostic.Fprint(os.Stderr, ds, diagnostic.Files()); printErr != nil {
+			log.Println(printErr)
+		}
+	}
+	if err != nil {
+		return 1
+	}
+	return 0
+}
+
+// debugLex prints every token with its span and its text, with whitespace
+// made visible.
+// The tokens are printed even if lexing fails, up to where it failed.
+func debugLex(w io.Writer, filename string, src []byte) error {
+	lx := lexer.New()
+	lx.LexSource(filename, string(src))
+	for t := range lx.Tokens() {
+		fmt.Fprintf(w, "%-13s %-28s `%s`\n", spanRange(t.Span), t.Type, lexer.WhiteSpaceToVisible(t.Text))
+	}
+	return errors.Join(lx.Errors...)
+}
+
+// debugParse prints the transitions of the parser while parsing, followed by
+// the tree it built, and returns the warnings of the parser.
+func debugParse(w io.Writer, filename string, src []byte) ([]diagnostic.Diagnostic, error) {
+	lx := lexer.New()
+	lx.LexSource(filename, string(src))
+	if len(lx.Errors) > 0 {
+		return nil, errors.Join(lx.Errors...)
+	}
+	blog, err := parser.ParseTrace(lx, func(t parser.Transition) {
+		fmt.Fprintf(w, "%-13s %-28s %s -> %s\n", spanRange(t.Token.Span), t.Token.Type, t.From, t.To)
+	})
+	if blog == nil {
+		return nil, err
+	}
+	fmt.Fprintln(w)
+	dump(w, reflect.ValueOf(blog), 0)
+	return blog.Warnings, err
+}
+
+// debugData prints the template data of a post, as the generator hands it to
+// the template, and returns the warnings of the parser.
+func debugData(w io.Writer, filename string, src []byte) ([]diagnostic.Diagnostic, error) {
+	blog, err := parseSource(filename, src, true)
+	if err != nil {
+		return nil, err
+	}
+	data := page.Post{}
+	makeGen := &page.MakeGenVisitor{TemplateData: &data}
+	blog.Accept(makeGen)
+	dump(w, reflect.ValueOf(data), 0)
+	return blog.Warnings, makeGen.Errors
+}
+
+func spanRange(s diagnostic.Span) string {
+	return fmt.Sprintf("%s-%s", s.Start, s.End)
+}
+
+var (
+	spanType    = reflect.TypeFor[diagnostic.Span]()
+	locatedType = reflect.TypeFor[parser.Located]()
+	timeType    = reflect.TypeFor[time.Time]()
+)
+
+// dump prints a value with its type, one field per line, indented by depth.
+// Fields that are zero are left out, and so are unexported ones.
+// The location of a node is printed next to its type.
+func dump(w io.Writer, v reflect.Value, depth int) {
+	indent := strings.Repeat("  ", depth)
+	switch v.Type() {
+	case spanType:
+		fmt.Fprintln(w, spanRange(v.Interface().(diagnostic.Span)))
+		return
+	case timeType:
+		fmt.Fprintln(w, v.Interface().(time.Time).Format(time.RFC3339))
+		return
+	}
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			fmt.Fprintln(w, "nil")
+			return
+		}
+		dump(w, v.Elem(), depth)
+	case reflect.Pointer:
+		if v.IsNil() {
+			fmt.Fprintln(w, "nil")
+			return
+		}
+		fmt.Fprint(w, "&")
+		dump(w, v.Elem(), depth)
+	case reflect.Struct:
+		fmt.Fprint(w, v.Type())
+		var fields []int
+		for i := range v.NumField() {
+			f := v.Type().Field(i)
+			switch {
+			case f.Type == locatedType && f.Anonymous:
+				if span := v.Field(i).Field(0); !span.IsZero() {
+					fmt.Fprintf(w, " @ %s ", spanRange(span.Interface().(diagnostic.Span)))
+				}
+			case f.IsExported() && !v.Field(i).IsZero():
+				fields = append(fields, i)
+			}
+		}
+		if len(fields) == 0 {
+			fmt.Fprintln(w, "{}")
+			return
+		}
+		fmt.Fprintln(w, "{")
+		for _, i := range fields {
+			fmt.Fprintf(w, "%s  %s: ", indent, v.Type().Field(i).Name)
+			dump(w, v.Field(i), depth+1)
+		}
+		fmt.Fprintf(w, "%s}\n", indent)
+	case reflect.Slice, reflect.Array:
+		fmt.Fprint(w, v.Type())
+		if v.Len() == 0 {
+			fmt.Fprintln(w, "{}")
+			return
+		}
+		fmt.Fprintln(w, "{")
+		for i := range v.Len() {
+			fmt.Fprintf(w, "%s  ", indent)
+			dump(w, v.Index(i), depth+1)
+		}
+		fmt.Fprintf(w, "%s}\n", indent)
+	case reflect.Map:
+		fmt.Fprint(w, v.Type())
+		if v.Len() == 0 {
+			fmt.Fprintln(w, "{}")
+			return
+		}
+		fmt.Fprintln(w, "{")
+		keys := v.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int {
+			return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+		})
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s  %v: ", indent, key)
+			dump(w, v.MapIndex(key), depth+1)
+		}
+		fmt.Fprintf(w, "%s}\n", indent)
+	case reflect.String:
+		if v.Type().Name() == "string" {
+			fmt.Fprintln(w, strconv.Quote(v.String()))
+			return
+		}
+		fmt.Fprintf(w, "%s(%s)\n", v.Type(), strconv.Quote(v.String()))
+	case reflect.Func, reflect.Chan:
+		fmt.Fprintln(w, v.Type())
+	default:
+		if v.Type().PkgPath() == "" {
+			fmt.Fprintf(w, "%v\n", v)
+			return
+		}
+		fmt.Fprintf(w, "%s(%v)\n", v.Type(), v)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// edit of a single line, ' ' keeps, '-' removes, and '+' inserts it.
+type edit struct {
+	op   byte
+	line string
+}
+
+// unifiedDiff of two texts, in the format of diff -u.
+// Returns the empty string if the texts are equal.
+func unifiedDiff(oldName, newName, old, new string) string {
+	if old == new {
+		return ""
+	}
+	edits := diffLines(splitLines(old), splitLines(new))
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	oldLine, newLine := 1, 1
+	for start := 0; start < len(edits); {
+		// find the next change, and extend the hunk for as long as the
+		// changes are close enough to share their context
+		first := start
+		for first < len(edits) && edits[first].op == ' ' {
+			first++
+		}
+		if first == len(edits) {
+			break
+		}
+		last := first
+		for i := first; i < len(edits); i++ {
+			if edits[i].op != ' ' {
+				last = i
+			} else if i-last > 2*diffContext {
+				break
+			}
+		}
+		from := max(first-diffContext, start)
+		to := min(last+diffContext+1, len(edits))
+		for _, e := range edits[start:from] {
+			oldLine, newLine = advance(e, oldLine, newLine)
+		}
+		var oldCount, newCount int
+		for _, e := range edits[from:to] {
+			if e.op != '+' {
+				oldCount++
+			}
+			if e.op != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(oldLine, oldCount), hunkRange(newLine, newCount))
+		for _, e := range edits[from:to] {
+			b.WriteByte(e.op)
+			b.WriteString(e.line)
+			b.WriteString("\n")
+			oldLine, newLine = advance(e, oldLine, newLine)
+		}
+		start = to
+	}
+	return b.String()
+}
+
+func advance(e edit, oldLine, newLine int) (int, int) {
+	if e.op != '+' {
+		oldLine++
+	}
+	if e.op != '-' {
+		newLine++
+	}
+	return oldLine, newLine
+}
+
+func hunkRange(line, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", line-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", line)
+	}
+	return fmt.Sprintf("%d,%d", line, count)
+}
+
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for i, line := range lines {
+		if strings.HasSuffix(line, "\n") {
+			lines[i] = line[:len(line)-1]
+		} else {
+			lines[i] = line + "\n\\ No newline at end of file"
+		}
+	}
+	return lines
+}
+
+// diffLines finds the edits turning a into b, along their longest common
+// subsequence of lines.
+func diffLines(a, b []string) []edit {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var edits []edit
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i]})
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, edit{'-', a[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		edits = append(edits, edit{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		edits = append(edits, edit{'+', b[j]})
+	}
+	return edits
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/cvanloo/blog-go/markup/diagnostic"
+	"github.com/cvanloo/blog-go/markup/format"
+)
+
+// formatSources prints the sources in their canonical form.
+// Without any sources, it formats stdin to stdout.
+func formatSources() int {
+	argSet := flag.NewFlagSet("fmt", flag.ExitOnError)
+	argSet.Var(&source, "source", "Input files. If given a directory, it will be processed recursively.")
+	extensions := argSet.String("ext", ".md,.ᗢ", "Extensions of the files to format in directories.")
+	write := argSet.Bool("w", false, "Write the result back to the source files, instead of printing it.")
+	diff := argSet.Bool("d", false, "Print a diff of the changes, instead of the result.")
+	argSet.Parse(os.Args[2:])
+	source = append(source, argSet.Args()...)
+
+	if len(source) == 0 {
+		if *write {
+			log.Println("cannot write the result back to stdin")
+			return -1
+		}
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			log.Println(err)
+			return 1
+		}
+		if err := formatFile("<stdin>", src, false, *diff); err != nil {
+			if printErr := diagnostic.Fprint(os.Stderr, diagnostic.Collect(err), nil); printErr != nil {
+				log.Println(printErr)
+			}
+			return 1
+		}
+		return 0
+	}
+
+	files, err := collectFiles(source, strings.Split(*extensions, ","))
+	for _, filename := range files {
+		src, readErr := os.ReadFile(filename)
+		if readErr != nil {
+			err = errors.Join(err, readErr)
+			continue
+		}
+		err = errors.Join(err, formatFile(filename, src, *write, *diff))
+	}
+	if err != nil {
+		if printErr := diagnostic.Fprint(os.Stderr, diagnostic.Collect(err), diagnostic.Files()); printErr != nil {
+			log.Println(printErr)
+		}
+		return 1
+	}
+	return 0
+}
+
+// formatFile prints the canonical form of a single source, or its diff, or
+// writes it back, if it changed.
+func formatFile(filename string, src []byte, write, diff bool) error {
+	formatted, err := format.Source(filename, src)
+	if err != nil {
+		return err
+	}
+	if diff {
+		fmt.Print(unifiedDiff(filename+".orig", filename, string(src), string(formatted)))
+	}
+	if write {
+		if bytes.Equal(src, formatted) {
+			return nil
+		}
+		fi, err := os.Stat(filename)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filename, formatted, fi.Mode().Perm())
+	}
+	if !diff {
+		_, err = os.Stdout.Write(formatted)
+	}
+	return err
+}
+
+// collectFiles lists the files, and those in the directories (recursively)
+// with one of the extensions.
+func collectFiles(paths []string, extensions []string) (files []string, err error) {
+	for _, path := range paths {
+		fi, statErr := os.Stat(path)
+		if statErr != nil {
+			err = errors.Join(err, statErr)
+			continue
+		}
+		if !fi.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		walkErr := filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && slices.Contains(extensions, filepath.Ext(path)) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		err = errors.Join(err, walkErr)
+	}
+	return files, err
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/cvanloo/blog-go/markup/diagnostic"
+	"github.com/cvanloo/blog-go/markup/markdown"
+	"github.com/cvanloo/blog-go/markup/parser"
+)
+
+// importSources converts Markdown posts, like those of a Hugo or Jekyll site,
+// into sources of the markup, and copies the images they reference along.
+// Everything that could not be converted is written to a report.
+func importSources() int {
+	argSet := flag.NewFlagSet("import", flag.ExitOnError)
+	argSet.Var(&source, "source", "Markdown files. If given a directory, it will be processed recursively.")
+	out := argSet.String("out", ".", "Directory to write the converted sources and their images to.")
+	static := argSet.String("static", "", "Directory that absolute image paths like /images/cat.png are relative to, the static directory of Hugo, or the root of a Jekyll site.")
+	author := argSet.String("author", "", "Author of the posts whose front matter names none.")
+	lang := argSet.String("lang", "", "Language of the posts whose front matter names none.")
+	extensions := argSet.String("ext", ".md,.markdown", "Extensions of the files to import in directories.")
+	reportPath := argSet.String("report", "", "File to write the report to. (default import-report.txt in the output directory)")
+	argSet.Parse(os.Args[2:])
+	source = append(source, argSet.Args()...)
+	if len(source) == 0 {
+		log.Println("no sources to import")
+		return -1
+	}
+	if *reportPath == "" {
+		*reportPath = filepath.Join(*out, "import-report.txt")
+	}
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		log.Println(err)
+		return -1
+	}
+
+	files, err := collectFiles(source, strings.Split(*extensions, ","))
+	im := importer{
+		cfg:    markdown.Config{Author: *author, Lang: *lang},
+		out:    *out,
+		static: *static,
+		posts:  map[string]string{},
+		images: map[string]string{},
+	}
+	for _, filename := range files {
+		if filepath.Base(filename) == "_index.md" {
+			continue // a list page of Hugo, not a post
+		}
+		err = errors.Join(err, im.importFile(filename))
+	}
+
+	report, createErr := os.Create(*reportPath)
+	if createErr != nil {
+		log.Println(createErr)
+		return 1
+	}
+	defer report.Close()
+	if printErr := diagnostic.Fprint(report, im.problems, diagnostic.Files()); printErr != nil {
+		log.Println(printErr)
+		return 1
+	}
+	fmt.Printf("imported %d posts and %d images, %d problems are listed in %s\n", len(im.posts), len(im.images), len(im.problems), *reportPath)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	return 0
+}
+
+type importer struct {
+	cfg         markdown.Config
+	out, static string
+	posts       map[string]string // source of each written post, by its name
+	images      map[string]string // source of each copied image, by its name
+	problems    []diagnostic.Diagnostic
+}
+
+// importFile converts a single post, and copies its images.
+// The problems of the post are added to the report, only errors reading or
+// writing files are returned.
+func (im *importer) importFile(filename string) error {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	doc, err := im.cfg.Convert(filename, src)
+	if err != nil {
+		im.problems = append(im.problems, diagnostic.Collect(err)...)
+		return nil
+	}
+	im.problems = append(im.problems, doc.Warnings...)
+
+	// the post is named after the last segment of its url-path
+	base := path.Base(metaText(doc.Blog.Meta["url-path"]))
+	name := base
+	for i := 2; im.posts[name] != ""; i++ {
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	if name != base {
+		im.warn(filename, "post-name", fmt.Sprintf("post has the same name as %s, it was written to %s.md instead", im.posts[base], name))
+	}
+	im.posts[name] = filename
+	outPath := filepath.Join(im.out, name+".md")
+	converted, err := doc.Source(outPath)
+	if converted == nil {
+		return err
+	}
+	// a converted source that doesn't parse is still written, so that it
+	// can be fixed by hand
+	im.problems = append(im.problems, diagnostic.Collect(err)...)
+	if err := os.WriteFile(outPath, converted, 0644); err != nil {
+		return err
+	}
+
+	var copyErr error
+	for _, image := range doc.Images {
+		copyErr = errors.Join(copyErr, im.copyImage(filename, image))
+	}
+	return copyErr
+}
+
+// copyImage copies an image referenced by the post at filename into the output
+// directory.
+// Relative paths are relative to the post, absolute ones to the static
+// directory.
+func (im *importer) copyImage(filename, image string) error {
+	var from string
+	if path.IsAbs(image) {
+		if im.static == "" {
+			im.warn(filename, "missing-image", fmt.Sprintf("image %s has an absolute path, use -static to import it", image))
+			return nil
+		}
+		from = filepath.Join(im.static, filepath.FromSlash(image))
+	} else {
+		from = filepath.Join(filepath.Dir(filename), filepath.FromSlash(image))
+	}
+	name := path.Base(image)
+	if copied, ok := im.images[name]; ok {
+		if copied != from {
+			im.warn(filename, "image-name", fmt.Sprintf("image %s has the same name as %s, which was copied instead", from, copied))
+		}
+		return nil
+	}
+	in, err := os.Open(from)
+	if err != nil {
+		im.warn(filename, "missing-image", fmt.Sprintf("image %s could not be copied: %v", image, err))
+		return nil
+	}
+	defer in.Close()
+	dst, err := os.Create(filepath.Join(im.out, name))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, in); err != nil {
+		dst.Close()
+		return err
+	}
+	im.images[name] = from
+	return dst.Close()
+}
+
+// warn about a problem with the post as a whole.
+func (im *importer) warn(filename, code, message string) {
+	im.problems = append(im.problems, diagnostic.Diagnostic{
+		Severity: diagnostic.SeverityWarning,
+		Code:     code,
+		Span:     diagnostic.Span{Filename: filename, Start: diagnostic.Position{Line: 1, Column: 1}, End: diagnostic.Position{Line: 1, Column: 1}},
+		Message:  message,
+	})
+}
+
+// metaText is the text of the first value of a meta key.
+func metaText(values []parser.TextSimple) string {
+	if len(values) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for _, node := range values[0] {
+		if text, ok := node.(*parser.Text); ok {
+			b.WriteString(text.Text)
+		}
+	}
+	return b.String()
+}
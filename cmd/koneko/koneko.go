@@ -4,6 +4,38 @@
 // koneko -source hello_world.md,goodbye_moon.md -out /tmp/koneko
 //
 // koneko -source hello_world.md -source goodbye_moon.md -out /tmp/koneko
+//
+// Print the stylesheet for syntax highlighted code blocks:
+// koneko highlight-css
+//
+// Report problems in the sources as json, for editor integrations:
+// koneko -source hello_world.md -out /tmp/koneko --diagnostics=json
+//
+// List the `TODO:` notes left in comments of all sources:
+// koneko todo -source posts/
+//
+// List the files included by code blocks of the sources, as make rules:
+// koneko deps -source posts/ > posts.d
+//
+// Run the language server, for editors, speaking over stdin and stdout:
+// koneko lsp
+//
+// Format the sources in place, or print a diff of what would change:
+// koneko fmt -w posts/
+// koneko fmt -d hello_world.md
+//
+// Import the posts of a Hugo site, with a report of what could not be converted:
+// koneko import -out posts/ -static hugo/static/ hugo/content/posts/
+//
+// Print the syntax tree of a source as JSON for scripts, and turn it back into
+// source:
+// koneko ast hello_world.md > hello_world.json
+// koneko ast -decode hello_world.json
+//
+// Print what the lexer, the parser, and the template data make of a source:
+// koneko debug lex hello_world.md
+// koneko debug parse hello_world.md
+// koneko debug data hello_world.md
 package main
 
 import (
@@ -20,7 +52,10 @@ import (
 	//. "github.com/cvanloo/blog-go/assert"
 	"github.com/cvanloo/blog-go/config"
 	"github.com/cvanloo/blog-go/markup"
+	"github.com/cvanloo/blog-go/markup/diagnostic"
+	"github.com/cvanloo/blog-go/markup/lsp"
 	"github.com/cvanloo/blog-go/page"
+	"github.com/cvanloo/blog-go/page/highlight"
 )
 
 type ArrayFlag []string
@@ -59,15 +94,47 @@ func main() {
 }
 
 func app() int {
-	fmt.Println("こんにちは、子猫ちゃん")
 	switch {
+	case len(os.Args) >= 2 && os.Args[1] == "highlight-css":
+		// no greeting, the output is meant to be redirected into a file
+		fmt.Print(highlight.CSS())
+	case len(os.Args) >= 2 && os.Args[1] == "todo":
+		// no greeting either, the output is meant to be read by editors and grep
+		return todo()
+	case len(os.Args) >= 2 && os.Args[1] == "deps":
+		// no greeting either, the output is meant to be included by make
+		return deps()
+	case len(os.Args) >= 2 && os.Args[1] == "fmt":
+		// no greeting, the formatted source may be printed to stdout
+		return formatSources()
+	case len(os.Args) >= 2 && os.Args[1] == "import":
+		// no greeting, import prints a summary instead
+		return importSources()
+	case len(os.Args) >= 2 && os.Args[1] == "ast":
+		// no greeting, the output is meant for scripts
+		return printAST()
+	case len(os.Args) >= 2 && os.Args[1] == "debug":
+		// no greeting, the output is long enough as it is
+		return debug()
+	case len(os.Args) >= 2 && os.Args[1] == "lsp":
+		// stdout belongs to the protocol, log goes to stderr
+		if err := lsp.Serve(os.Stdin, os.Stdout); err != nil {
+			log.Println(err)
+			return 1
+		}
 	case len(os.Args) >= 2 && os.Args[1] == "make-assets":
 		os.Setenv("MAKE_ASSETS", "1")
 		argSet := flag.NewFlagSet("make-assets", flag.ExitOnError)
 		argSet.Var(&source, "source", "Input files. If given a directory, it will be processed recursively. A hyphen (the default) will read from stdin.")
 		out := argSet.String("out", ".", "Directory to write static sites to.")
 		envPath := argSet.String("env", ".env", "Path to the environment file.")
+		diagnostics := argSet.String("diagnostics", "text", "Format of the reported problems in the sources, text or json.")
 		argSet.Parse(os.Args[2:])
+		if *diagnostics != "text" && *diagnostics != "json" {
+			log.Printf("invalid diagnostics format: %s", *diagnostics)
+			return -1
+		}
+		greet(*diagnostics)
 		if err := godotenv.Load(*envPath); err != nil {
 			log.Println(err)
 			return -1
@@ -82,14 +149,19 @@ func app() int {
 			log.Println(err)
 			return -1
 		}
+		var warnings []diagnostic.Diagnostic
 		m := markup.New(
 			markup.SiteInfo(siteInfo),
 			markup.IncludeExtensions(strings.Split(cfg.Extensions, ",")...),
 			markup.SourcePaths(source),
 			markup.OutDir(*out),
+			markup.ReportWarnings(func(ds []diagnostic.Diagnostic) {
+				warnings = append(warnings, ds...)
+			}),
 		)
-		if err := m.MakeAssets(); err != nil {
-			fmt.Println(err)
+		err = m.MakeAssets()
+		report(warnings, err, *diagnostics)
+		if err != nil {
 			return 1
 		}
 	default:
@@ -97,7 +169,13 @@ func app() int {
 		argSet.Var(&source, "source", "Input files. If given a directory, it will be processed recursively. A hyphen (the default) will read from stdin.")
 		out := argSet.String("out", ".", "Directory to write static sites to.")
 		envPath := argSet.String("env", ".env", "Path to the environment file.")
+		diagnostics := argSet.String("diagnostics", "text", "Format of the reported problems in the sources, text or json.")
 		argSet.Parse(os.Args[1:])
+		if *diagnostics != "text" && *diagnostics != "json" {
+			log.Printf("invalid diagnostics format: %s", *diagnostics)
+			return -1
+		}
+		greet(*diagnostics)
 		if err := godotenv.Load(*envPath); err != nil {
 			log.Println(err)
 			return -1
@@ -121,20 +199,92 @@ func app() int {
 			log.Printf("%s is not a directory", *out)
 			return -1
 		}
+		var warnings []diagnostic.Diagnostic
 		m := markup.New(
 			markup.SiteInfo(siteInfo),
 			markup.IncludeExtensions(strings.Split(cfg.Extensions, ",")...),
 			markup.SourcePaths(source),
 			markup.OutDir(*out),
+			markup.ReportWarnings(func(ds []diagnostic.Diagnostic) {
+				warnings = append(warnings, ds...)
+			}),
 		)
-		if err := m.Run(); err != nil {
-			fmt.Println(err)
+		err = m.Run()
+		report(warnings, err, *diagnostics)
+		if err != nil {
 			return 1
 		}
 	}
 	return 0
 }
 
+// greet the user, unless the output is meant for a machine.
+func greet(diagnostics string) {
+	if diagnostics != "json" {
+		fmt.Println("こんにちは、子猫ちゃん")
+	}
+}
+
+// report prints the problems found in the sources, the warnings followed by
+// the errors, either with the offending source lines for humans, or as json
+// for editor integrations.
+// Nothing is printed if there are no problems.
+func report(warnings []diagnostic.Diagnostic, err error, diagnostics string) {
+	ds := append(warnings, diagnostic.Collect(err)...)
+	if len(ds) == 0 {
+		return
+	}
+	var printErr error
+	if diagnostics == "json" {
+		printErr = diagnostic.FprintJSON(os.Stdout, ds)
+	} else {
+		printErr = diagnostic.Fprint(os.Stdout, ds, diagnostic.Files())
+	}
+	if printErr != nil {
+		log.Println(printErr)
+	}
+}
+
+func todo() int {
+	argSet := flag.NewFlagSet("todo", flag.ExitOnError)
+	argSet.Var(&source, "source", "Input files. If given a directory, it will be processed recursively.")
+	extensions := argSet.String("ext", ".md,.ᗢ", "Extensions of the files to search in directories.")
+	argSet.Parse(os.Args[2:])
+	m := markup.New(
+		markup.IncludeExtensions(strings.Split(*extensions, ",")...),
+		markup.SourcePaths(source),
+	)
+	todos, err := m.Todos()
+	for _, t := range todos {
+		fmt.Println(t)
+	}
+	if err != nil {
+		// sources that are broken still get searched, so only warn about them
+		log.Println(err)
+	}
+	return 0
+}
+
+func deps() int {
+	argSet := flag.NewFlagSet("deps", flag.ExitOnError)
+	argSet.Var(&source, "source", "Input files. If given a directory, it will be processed recursively.")
+	extensions := argSet.String("ext", ".md,.ᗢ", "Extensions of the files to search in directories.")
+	argSet.Parse(os.Args[2:])
+	m := markup.New(
+		markup.IncludeExtensions(strings.Split(*extensions, ",")...),
+		markup.SourcePaths(source),
+	)
+	deps, err := m.Dependencies()
+	for _, d := range deps {
+		fmt.Println(d)
+	}
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	return 0
+}
+
 func initializeSite(cfg SiteConfig) (siteInfo page.Site, err error) {
 	addr, err := url.Parse(cfg.Address)
 	if err != nil {
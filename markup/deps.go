@@ -0,0 +1,51 @@
+package markup
+
+import (
+	"slices"
+	"strings"
+)
+
+// Dependency lists the files that a source includes, see Markup.Dependencies.
+type Dependency struct {
+	Filename string
+	Includes []string
+}
+
+// String formats the dependency as a make rule, so that the output of
+// `koneko deps` can be included by a Makefile:
+//
+//	posts/hello.md: snippets/server.go snippets/client.go
+func (d Dependency) String() string {
+	names := []string{escapeMakeName(d.Filename) + ":"}
+	for _, include := range d.Includes {
+		names = append(names, escapeMakeName(include))
+	}
+	return strings.Join(names, " ")
+}
+
+func escapeMakeName(name string) string {
+	return strings.NewReplacer(" ", `\ `, "#", `\#`, "$", "$$").Replace(name)
+}
+
+// Dependencies parses all sources and lists the files that their code blocks
+// include, ordered by source. Sources without includes are left out.
+// Sources that fail to lex or parse are skipped, their errors are returned
+// together with the dependencies of the other sources.
+func (m Markup) Dependencies() (deps []Dependency, runErr error) {
+	mp := newMarkupProcessor(m.IncludeExt, m.ExcludeExt, m.SourcePaths, m.Sources)
+	runErr = mp.Run()
+	m.reportWarnings(mp.warnings)
+	for _, res := range mp.results {
+		if len(res.deps) == 0 {
+			continue
+		}
+		deps = append(deps, Dependency{
+			Filename: res.src.Name,
+			Includes: slices.Compact(slices.Sorted(slices.Values(res.deps))),
+		})
+	}
+	slices.SortFunc(deps, func(a, b Dependency) int {
+		return strings.Compare(a.Filename, b.Filename)
+	})
+	return deps, runErr
+}
@@ -0,0 +1,46 @@
+package markup_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/cvanloo/blog-go/markup"
+)
+
+func TestDependencies(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"my server.go": "package main\n",
+		"client.go":    "package main\n",
+		"a.md":         "# A\n\n```go {include=client.go}\n```\n\n```go {include=\"my server.go\"}\n```\n\n```go {include=client.go}\n```\n",
+		"b.md":         "# B\n\nNo includes.\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := markup.New(
+		markup.IncludeExtensions(".md"),
+		markup.SourcePaths([]string{dir}),
+	)
+	deps, err := m.Dependencies()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []markup.Dependency{
+		{
+			Filename: filepath.Join(dir, "a.md"),
+			Includes: []string{filepath.Join(dir, "client.go"), filepath.Join(dir, "my server.go")},
+		},
+	}
+	if diff := deep.Equal(deps, expected); diff != nil {
+		t.Error(diff)
+	}
+	if rule, expected := deps[0].String(), filepath.Join(dir, "a.md")+": "+filepath.Join(dir, "client.go")+" "+filepath.Join(dir, `my\ server.go`); rule != expected {
+		t.Errorf("expected rule %q, got: %q", expected, rule)
+	}
+}
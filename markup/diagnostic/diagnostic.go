@@ -0,0 +1,198 @@
+// Package diagnostic describes problems found in the sources, together with
+// where in the source they are.
+//
+// Errors of the lexer, the parser and the visitors either are or can be
+// turned into a Diagnostic.
+// Collect flattens an error (usually an errors.Join chain) into a list of
+// diagnostics, which can be rendered for humans with Fprint, showing the
+// offending source line, or for editors with FprintJSON.
+package diagnostic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+type (
+	// Position is a location in the source.
+	// Line and Column start at 1, the column is counted in runes.
+	Position struct {
+		Offset int `json:"offset"` // in runes
+		Line   int `json:"line"`
+		Column int `json:"column"`
+	}
+	// Span is the range of the source a token or node was made from, up to
+	// but excluding End.
+	Span struct {
+		Filename string   `json:"filename"`
+		Start    Position `json:"start"`
+		End      Position `json:"end"`
+	}
+
+	Severity int
+
+	Diagnostic struct {
+		Severity Severity `json:"severity"`
+		Code     string   `json:"code,omitempty"` // short, stable identifier of the kind of problem, like missing-link-definition
+		Span     Span     `json:"span"`
+		Message  string   `json:"message"`
+		Hints    []string `json:"hints,omitempty"` // suggestions on how to fix the problem
+		Err      error    `json:"-"`               // the error the diagnostic was made from, if any
+	}
+
+	// Diagnoser is implemented by errors that can describe themselves as a Diagnostic.
+	Diagnoser interface {
+		Diagnostic() Diagnostic
+	}
+)
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+	SeverityInfo
+	SeverityHint
+)
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// String formats the start of the span as file:line:col.
+func (s Span) String() string {
+	return fmt.Sprintf("%s:%s", s.Filename, s.Start)
+}
+
+// IsZero reports whether the span was never set, for example for nodes that
+// were not made by the parser.
+func (s Span) IsZero() bool {
+	return s.Start.Line == 0
+}
+
+// Contains reports whether the offset lies within the span.
+func (s Span) Contains(offset int) bool {
+	return s.Start.Offset <= offset && offset < s.End.Offset
+}
+
+func (s Severity) String() string {
+	switch s {
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	case SeverityInfo:
+		return "info"
+	case SeverityHint:
+		return "hint"
+	}
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	if s < SeverityError || s > SeverityHint {
+		return nil, fmt.Errorf("invalid severity: %d", s)
+	}
+	return []byte(s.String()), nil
+}
+
+func (s *Severity) UnmarshalText(text []byte) error {
+	switch string(text) {
+	default:
+		return fmt.Errorf("invalid severity: %s", text)
+	case "error":
+		*s = SeverityError
+	case "warning":
+		*s = SeverityWarning
+	case "info":
+		*s = SeverityInfo
+	case "hint":
+		*s = SeverityHint
+	}
+	return nil
+}
+
+// At makes an error diagnostic about the source at span, unless err is nil.
+func At(span Span, code string, err error, hints ...string) error {
+	if err == nil {
+		return nil
+	}
+	return Diagnostic{
+		Severity: SeverityError,
+		Code:     code,
+		Span:     span,
+		Message:  err.Error(),
+		Hints:    hints,
+		Err:      err,
+	}
+}
+
+// Warn makes a warning diagnostic about the source at span, for problems that
+// don't stop the build.
+func Warn(span Span, code string, err error, hints ...string) Diagnostic {
+	return Diagnostic{
+		Severity: SeverityWarning,
+		Code:     code,
+		Span:     span,
+		Message:  err.Error(),
+		Hints:    hints,
+		Err:      err,
+	}
+}
+
+func (d Diagnostic) Error() string {
+	if d.Span.IsZero() {
+		return d.Message
+	}
+	return fmt.Sprintf("%s: %s", d.Span, d.Message)
+}
+
+func (d Diagnostic) Unwrap() error {
+	return d.Err
+}
+
+func (d Diagnostic) Diagnostic() Diagnostic {
+	return d
+}
+
+// MarshalJSON leaves out the span of a diagnostic without location, instead
+// of pointing at line 0 of no file.
+func (d Diagnostic) MarshalJSON() ([]byte, error) {
+	type plain Diagnostic // without the MarshalJSON method
+	var span *Span
+	if !d.Span.IsZero() {
+		span = &d.Span
+	}
+	return json.Marshal(struct {
+		plain
+		Span *Span `json:"span,omitempty"`
+	}{plain(d), span})
+}
+
+// Collect flattens err into its diagnostics.
+// Joined errors are collected one by one, errors wrapping a Diagnoser are
+// replaced by the diagnostics they wrap.
+// Any other error becomes a diagnostic without location.
+func Collect(err error) (ds []Diagnostic) {
+	if err == nil {
+		return nil
+	}
+	switch e := err.(type) {
+	case Diagnoser:
+		return []Diagnostic{e.Diagnostic()}
+	case interface{ Unwrap() []error }:
+		for _, inner := range e.Unwrap() {
+			ds = append(ds, Collect(inner)...)
+		}
+		return ds
+	}
+	var d Diagnoser
+	if inner := errors.Unwrap(err); inner != nil && errors.As(inner, &d) {
+		return Collect(inner)
+	}
+	return []Diagnostic{{
+		Severity: SeverityError,
+		Message:  err.Error(),
+		Err:      err,
+	}}
+}
@@ -0,0 +1,186 @@
+package diagnostic_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/cvanloo/blog-go/markup/diagnostic"
+	"github.com/cvanloo/blog-go/markup/lexer"
+	"github.com/cvanloo/blog-go/markup/parser"
+)
+
+func span(line, startCol, endCol int) diagnostic.Span {
+	return diagnostic.Span{
+		Filename: "post.md",
+		Start:    diagnostic.Position{Line: line, Column: startCol},
+		End:      diagnostic.Position{Line: line, Column: endCol},
+	}
+}
+
+func TestRender(t *testing.T) {
+	source := "# Title\n\nA [link][missing] here.\n\t{漢字|かんじ} [x][y]\n"
+	testCases := []struct {
+		name       string
+		diagnostic diagnostic.Diagnostic
+		source     string
+		expected   string
+	}{
+		{
+			name: "Underline with hint",
+			diagnostic: diagnostic.Diagnostic{
+				Code:    "missing-link-definition",
+				Span:    span(3, 3, 18),
+				Message: "missing url definition for link with id: missing",
+				Hints:   []string{"define the url with [missing]: https://..."},
+			},
+			source: source,
+			expected: `error[missing-link-definition]: missing url definition for link with id: missing
+ --> post.md:3:3
+  |
+3 | A [link][missing] here.
+  |   ^^^^^^^^^^^^^^^
+  = hint: define the url with [missing]: https://...
+`,
+		},
+		{
+			name: "Tabs and wide characters",
+			diagnostic: diagnostic.Diagnostic{
+				Severity: diagnostic.SeverityWarning,
+				Span:     span(4, 11, 17),
+				Message:  "suspicious link",
+			},
+			source: source,
+			expected: "warning: suspicious link\n" +
+				" --> post.md:4:11\n" +
+				"  |\n" +
+				"4 | \t{漢字|かんじ} [x][y]\n" +
+				"  | \t              ^^^^^^\n",
+		},
+		{
+			name: "Wide common characters and combining marks",
+			diagnostic: diagnostic.Diagnostic{
+				Code:    "ruby-readings",
+				Span:    span(1, 13, 14),
+				Message: "ruby must have either one reading per character or a single reading",
+			},
+			source: "ラーメン・ガ，{漢字|か|ん|じ}\n",
+			expected: "error[ruby-readings]: ruby must have either one reading per character or a single reading\n" +
+				" --> post.md:1:13\n" +
+				"  |\n" +
+				"1 | ラーメン・ガ，{漢字|か|ん|じ}\n" +
+				"  |                     ^^\n",
+		},
+		{
+			name: "Empty span",
+			diagnostic: diagnostic.Diagnostic{
+				Code:    "syntax",
+				Span:    span(1, 8, 8),
+				Message: "expected: `\\n`",
+			},
+			source: source,
+			expected: "error[syntax]: expected: `\\n`\n" +
+				" --> post.md:1:8\n" +
+				"  |\n" +
+				"1 | # Title\n" +
+				"  |        ^\n",
+		},
+		{
+			name: "Source not available",
+			diagnostic: diagnostic.Diagnostic{
+				Span:    span(3, 3, 18),
+				Message: "missing url definition for link with id: missing",
+			},
+			expected: "error: missing url definition for link with id: missing\n" +
+				" --> post.md:3:3\n",
+		},
+		{
+			name: "No location",
+			diagnostic: diagnostic.Diagnostic{
+				Message: "unknown template: blog",
+				Hints:   []string{"the templates are post and post-quotes"},
+			},
+			source: source,
+			expected: "error: unknown template: blog\n" +
+				" = hint: the templates are post and post-quotes\n",
+		},
+	}
+	for _, testCase := range testCases {
+		if diff := deep.Equal(testCase.diagnostic.Render(testCase.source), testCase.expected); diff != nil {
+			t.Errorf("%s: %v", testCase.name, diff)
+		}
+	}
+}
+
+func TestCollect(t *testing.T) {
+	lx := lexer.New()
+	lx.LexSource("post.md", "# Title\n\nA [link][missing] here.\n")
+	blog, err := parser.Parse(lx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refFixer := &parser.FixReferencesVisitor{}
+	blog.Accept(refFixer)
+	plain := errors.New("not publishing post")
+	err = errors.Join(
+		fmt.Errorf("processing post.md failed while resolving references: %w", refFixer.Errors),
+		plain,
+		parser.ParserError{
+			State: parser.ParsingSection,
+			Token: lexer.Token{Type: lexer.TokenSectionContent, Span: span(1, 2, 2)},
+			Inner: parser.ErrSectionMissingHeading,
+		},
+	)
+	ds := diagnostic.Collect(err)
+	if len(ds) != 3 {
+		t.Fatalf("expected 3 diagnostics, got: %v", ds)
+	}
+	if ds[0].Code != "missing-link-definition" || ds[0].Span.String() != "post.md:3:3" {
+		t.Errorf("expected the missing link definition at post.md:3:3, got: %v", ds[0])
+	}
+	if ds[1].Message != plain.Error() || !ds[1].Span.IsZero() {
+		t.Errorf("expected the plain error without location, got: %v", ds[1])
+	}
+	if ds[2].Code != "missing-heading" || len(ds[2].Hints) != 1 || !errors.Is(ds[2], parser.ErrSectionMissingHeading) {
+		t.Errorf("expected the parser error with a hint, got: %v", ds[2])
+	}
+}
+
+func TestFprintJSON(t *testing.T) {
+	ds := []diagnostic.Diagnostic{{
+		Severity: diagnostic.SeverityWarning,
+		Code:     "unused-definition",
+		Span:     span(6, 3, 9),
+		Message:  "unused definition for sidenote or footnote with id: unused",
+	}}
+	var buf bytes.Buffer
+	if err := diagnostic.FprintJSON(&buf, ds); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []diagnostic.Diagnostic
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(decoded, ds); diff != nil {
+		t.Error(diff)
+	}
+	buf.Reset()
+	if err := diagnostic.FprintJSON(&buf, []diagnostic.Diagnostic{{Message: "not publishing post"}}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), `"span"`) {
+		t.Errorf("expected no span for a diagnostic without location, got: %s", buf.String())
+	}
+	buf.Reset()
+	if err := diagnostic.FprintJSON(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "[]\n" {
+		t.Errorf("expected an empty array, got: %s", buf.String())
+	}
+}
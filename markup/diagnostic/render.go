@@ -0,0 +1,223 @@
+package diagnostic
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Sources looks up the source of a file, to show the offending line of a
+// diagnostic.
+// It returns false if the source is not available, for example because it was
+// read from stdin.
+type Sources func(filename string) (source string, ok bool)
+
+// Files is a Sources reading the sources from disk.
+// Each file is read only once.
+func Files() Sources {
+	cache := map[string]string{}
+	return func(filename string) (string, bool) {
+		if source, ok := cache[filename]; ok {
+			return source, true
+		}
+		bs, err := os.ReadFile(filename)
+		if err != nil {
+			return "", false
+		}
+		cache[filename] = string(bs)
+		return cache[filename], true
+	}
+}
+
+// Fprint renders the diagnostics for humans, each with the line of the source it
+// refers to and the span underlined:
+//
+//	error[missing-link-definition]: missing url definition for link with id: missing
+//	 --> post.md:4:3
+//	  |
+//	4 | A [link][missing] in a paragraph.
+//	  |   ^^^^^^^^^^^^^^^
+//	  = hint: define the url with [missing]: https://...
+//
+// sources may be nil, in which case no source lines are shown.
+func Fprint(w io.Writer, ds []Diagnostic, sources Sources) error {
+	for _, d := range ds {
+		var source string
+		if sources != nil && !d.Span.IsZero() {
+			source, _ = sources(d.Span.Filename)
+		}
+		if _, err := io.WriteString(w, d.Render(source)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FprintJSON writes the diagnostics as a JSON array, to be consumed by editors
+// and other tools.
+func FprintJSON(w io.Writer, ds []Diagnostic) error {
+	if ds == nil {
+		ds = []Diagnostic{} // print [] instead of null
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(ds)
+}
+
+// Render formats the diagnostic like Fprint does.
+// The source line is omitted if source is empty or doesn't contain the line.
+func (d Diagnostic) Render(source string) string {
+	var b strings.Builder
+	b.WriteString(d.Severity.String())
+	if d.Code != "" {
+		fmt.Fprintf(&b, "[%s]", d.Code)
+	}
+	fmt.Fprintf(&b, ": %s\n", d.Message)
+	if d.Span.IsZero() {
+		for _, hint := range d.Hints {
+			fmt.Fprintf(&b, " = hint: %s\n", hint)
+		}
+		return b.String()
+	}
+	lineNumber := fmt.Sprint(d.Span.Start.Line)
+	gutter := strings.Repeat(" ", len(lineNumber))
+	fmt.Fprintf(&b, "%s--> %s\n", gutter, d.Span)
+	if line, ok := sourceLine(source, d.Span.Start.Line); ok {
+		fmt.Fprintf(&b, "%s |\n", gutter)
+		fmt.Fprintf(&b, "%s | %s\n", lineNumber, line)
+		fmt.Fprintf(&b, "%s | %s\n", gutter, underline(line, d.Span))
+	}
+	for _, hint := range d.Hints {
+		fmt.Fprintf(&b, "%s = hint: %s\n", gutter, hint)
+	}
+	return b.String()
+}
+
+func sourceLine(source string, line int) (string, bool) {
+	if source == "" {
+		return "", false
+	}
+	lines := strings.Split(source, "\n")
+	if line < 1 || line > len(lines) {
+		return "", false
+	}
+	return strings.TrimRight(lines[line-1], "\r"), true
+}
+
+// underline marks the part of line covered by span with carets.
+// Spans reaching past the line are underlined up to its end, empty spans get
+// a single caret.
+func underline(line string, span Span) string {
+	rs := []rune(line)
+	start := min(span.Start.Column-1, len(rs))
+	end := len(rs)
+	if span.End.Line == span.Start.Line {
+		end = min(span.End.Column-1, len(rs))
+	}
+	var b strings.Builder
+	for _, r := range rs[:start] {
+		if r == '\t' {
+			b.WriteRune('\t')
+		} else {
+			b.WriteString(strings.Repeat(" ", runeWidth(r)))
+		}
+	}
+	width := 0
+	for _, r := range rs[start:max(start, end)] {
+		width += runeWidth(r)
+	}
+	b.WriteString(strings.Repeat("^", max(width, 1)))
+	return b.String()
+}
+
+// runeWidth is the number of columns r takes up in a terminal: none for
+// combining marks and invisible formatting characters, and two for the wide and
+// fullwidth characters of east asian scripts.
+// Counting runes instead would misplace the carets under CJK text, which also
+// uses common characters like ー and ・ that don't belong to any one script.
+func runeWidth(r rune) int {
+	switch {
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	case unicode.Is(eastAsianWide, r):
+		return 2
+	}
+	return 1
+}
+
+// eastAsianWide are the characters of east asian width W (wide) or F
+// (fullwidth), as defined by Unicode Standard Annex #11.
+// The ranges are taken from EastAsianWidth.txt of the Unicode 15.1 character
+// database (https://www.unicode.org/Public/15.1.0/ucd/EastAsianWidth.txt),
+// with neighbouring ranges of a script merged into its whole blocks.
+// Keep them in sync with that file when updating to a newer Unicode version.
+var eastAsianWide = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x1100, 0x115f, 1}, // hangul jamo initial consonants
+		{0x231a, 0x231b, 1}, // watch, hourglass
+		{0x2329, 0x232a, 1}, // angle brackets
+		{0x23e9, 0x23ec, 1},
+		{0x23f0, 0x23f0, 1},
+		{0x23f3, 0x23f3, 1},
+		{0x25fd, 0x25fe, 1},
+		{0x2614, 0x2615, 1},
+		{0x2648, 0x2653, 1},
+		{0x267f, 0x267f, 1},
+		{0x2693, 0x2693, 1},
+		{0x26a1, 0x26a1, 1},
+		{0x26aa, 0x26ab, 1},
+		{0x26bd, 0x26be, 1},
+		{0x26c4, 0x26c5, 1},
+		{0x26ce, 0x26ce, 1},
+		{0x26d4, 0x26d4, 1},
+		{0x26ea, 0x26ea, 1},
+		{0x26f2, 0x26f3, 1},
+		{0x26f5, 0x26f5, 1},
+		{0x26fa, 0x26fa, 1},
+		{0x26fd, 0x26fd, 1},
+		{0x2705, 0x2705, 1},
+		{0x270a, 0x270b, 1},
+		{0x2728, 0x2728, 1},
+		{0x274c, 0x274c, 1},
+		{0x274e, 0x274e, 1},
+		{0x2753, 0x2755, 1},
+		{0x2757, 0x2757, 1},
+		{0x2795, 0x2797, 1},
+		{0x27b0, 0x27b0, 1},
+		{0x27bf, 0x27bf, 1},
+		{0x2b1b, 0x2b1c, 1},
+		{0x2b50, 0x2b50, 1},
+		{0x2b55, 0x2b55, 1},
+		{0x2e80, 0x303e, 1}, // cjk radicals, kangxi radicals, cjk symbols and punctuation
+		{0x3041, 0x33ff, 1}, // hiragana, katakana, bopomofo, hangul compatibility jamo, kanbun, enclosed cjk
+		{0x3400, 0x4dbf, 1}, // cjk unified ideographs extension a
+		{0x4e00, 0x9fff, 1}, // cjk unified ideographs
+		{0xa000, 0xa4cf, 1}, // yi
+		{0xa960, 0xa97f, 1}, // hangul jamo extended-a
+		{0xac00, 0xd7a3, 1}, // hangul syllables
+		{0xf900, 0xfaff, 1}, // cjk compatibility ideographs
+		{0xfe10, 0xfe19, 1}, // vertical forms
+		{0xfe30, 0xfe6f, 1}, // cjk compatibility forms, small form variants
+		{0xff00, 0xff60, 1}, // fullwidth forms
+		{0xffe0, 0xffe6, 1}, // fullwidth signs
+	},
+	R32: []unicode.Range32{
+		{0x16fe0, 0x18cff, 1}, // tangut, khitan
+		{0x1b000, 0x1b2ff, 1}, // kana supplement and extensions, nushu
+		{0x1f004, 0x1f004, 1},
+		{0x1f0cf, 0x1f0cf, 1},
+		{0x1f18e, 0x1f18e, 1},
+		{0x1f191, 0x1f19a, 1},
+		{0x1f200, 0x1f2ff, 1}, // enclosed ideographic supplement
+		{0x1f300, 0x1f64f, 1}, // pictographs, emoticons
+		{0x1f680, 0x1f6ff, 1}, // transport and map symbols
+		{0x1f7e0, 0x1f7eb, 1},
+		{0x1f900, 0x1f9ff, 1}, // supplemental symbols and pictographs
+		{0x1fa70, 0x1faff, 1},
+		{0x20000, 0x2fffd, 1}, // cjk unified ideographs extensions b to f, compatibility supplement
+		{0x30000, 0x3fffd, 1}, // cjk unified ideographs extensions g and h
+	},
+}
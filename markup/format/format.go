@@ -0,0 +1,658 @@
+// Package format prints a parsed blog back as markup source, in a canonical
+// form: a normalized meta block, headings and attribute lists, wrapped
+// paragraphs, and all link, sidenote, and abbreviation definitions sorted at
+// the end of the document.
+//
+// The printed source parses to the same blog, except that paragraphs may be
+// split differently into lines.
+package format
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/cvanloo/blog-go/markup/diagnostic"
+	"github.com/cvanloo/blog-go/markup/lexer"
+	"github.com/cvanloo/blog-go/markup/parser"
+)
+
+// DefaultWidth is the number of runes after which paragraphs are wrapped.
+const DefaultWidth = 80
+
+// Config controls how a blog is printed.
+type Config struct {
+	// Width after which paragraphs are wrapped, zero disables wrapping.
+	Width int
+	// Comments to print, as collected by the lexer in lexer.Lexer.Comments.
+	// Comments aren't part of the blog, each is printed on its own line
+	// before the section or block that followed it in the source.
+	Comments []lexer.Token
+}
+
+// Fprint prints the blog with the DefaultWidth and without any comments.
+func Fprint(w io.Writer, blog *parser.Blog) error {
+	return Config{Width: DefaultWidth}.Fprint(w, blog)
+}
+
+// Source formats the markup source of a single file, keeping its comments.
+// Nothing is formatted if the source has any lexer or parser errors, or
+// parser warnings, which are about source that doesn't make it into the blog,
+// and so would be lost.
+func Source(filename string, src []byte) ([]byte, error) {
+	lx := lexer.New()
+	lx.LexSource(filename, string(src))
+	if len(lx.Errors) > 0 {
+		return nil, errors.Join(lx.Errors...)
+	}
+	blog, err := parser.Parse(lx)
+	if err != nil {
+		return nil, err
+	}
+	if len(blog.Warnings) > 0 {
+		var errs []error
+		for _, warning := range blog.Warnings {
+			errs = append(errs, warning)
+		}
+		return nil, errors.Join(errs...)
+	}
+	var buf bytes.Buffer
+	cfg := Config{Width: DefaultWidth, Comments: lx.Comments}
+	if err := cfg.Fprint(&buf, blog); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Fprint prints the blog as markup source to w.
+func (cfg Config) Fprint(w io.Writer, blog *parser.Blog) error {
+	p := &printer{
+		width:    cfg.Width,
+		comments: slices.SortedFunc(slices.Values(cfg.Comments), func(a, b lexer.Token) int { return cmp.Compare(a.Pos, b.Pos) }),
+	}
+	var parts []string
+	if meta := p.meta(blog); meta != "" {
+		parts = append(parts, meta)
+	}
+	var nodes []parser.Node
+	for _, html := range blog.Htmls {
+		nodes = append(nodes, html)
+	}
+	for _, section := range blog.Sections {
+		nodes = append(nodes, section)
+	}
+	if content := p.topLevel(nodes); content != "" {
+		parts = append(parts, content)
+	}
+	if definitions := p.definitions(blog); definitions != "" {
+		parts = append(parts, definitions)
+	}
+	if comments := p.commentsBefore(-1); comments != "" {
+		parts = append(parts, strings.TrimSuffix(comments, "\n"))
+	}
+	if p.err != nil {
+		return p.err
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(w, strings.Join(parts, "\n\n")+"\n")
+	return err
+}
+
+type printer struct {
+	width    int
+	comments []lexer.Token // not yet printed, in source order
+	// raw is the indentation that the lexer keeps in the raw text of
+	// monospace and math spanning lines, it is added back by the enclosing
+	// admonitions and list items
+	raw int
+	// err collects the attributes that can't be printed as source
+	err error
+}
+
+// indented prints while the enclosing block indents its content by n.
+func (p *printer) indented(n int, print func() string) string {
+	p.raw += n
+	defer func() { p.raw -= n }()
+	return print()
+}
+
+// commentsBefore prints all comments preceding the offset, each on its own
+// line, or all remaining comments if the offset is negative.
+func (p *printer) commentsBefore(offset int) string {
+	var b strings.Builder
+	for len(p.comments) > 0 && (offset < 0 || p.comments[0].Pos < offset) {
+		text := p.comments[0].Text
+		p.comments = p.comments[1:]
+		switch {
+		case strings.Contains(text, "\n"):
+			fmt.Fprintf(&b, "%%%%{\n%s\n}%%%%\n", text)
+		case text == "":
+			b.WriteString("%%\n")
+		default:
+			fmt.Fprintf(&b, "%%%% %s\n", text)
+		}
+	}
+	return b.String()
+}
+
+// commentsBeforeNode prints the comments preceding the node in the source.
+func (p *printer) commentsBeforeNode(node parser.Node) string {
+	located, ok := node.(interface{ Location() diagnostic.Span })
+	if !ok || located.Location().IsZero() {
+		return ""
+	}
+	return p.commentsBefore(located.Location().Start.Offset)
+}
+
+func (p *printer) meta(blog *parser.Blog) string {
+	if len(blog.Meta) == 0 {
+		return ""
+	}
+	// keys are printed in the order they were first defined in
+	position := func(key string) int {
+		if spans := blog.Locations.Meta[key]; len(spans) > 0 {
+			return spans[0].Start.Offset
+		}
+		return -1
+	}
+	keys := slices.SortedFunc(maps.Keys(blog.Meta), func(a, b string) int {
+		pa, pb := position(a), position(b)
+		if pa < 0 || pb < 0 {
+			pa, pb = -pa, -pb // keys without a location go last
+		}
+		return cmp.Or(cmp.Compare(pa, pb), strings.Compare(a, b))
+	})
+	var b strings.Builder
+	b.WriteString("---\n")
+	for _, key := range keys {
+		for _, value := range blog.Meta[key] {
+			if v := strings.TrimRight(simple(value), " \t"); v != "" {
+				fmt.Fprintf(&b, "%s: %s\n", key, v)
+			} else {
+				fmt.Fprintf(&b, "%s:\n", key)
+			}
+		}
+	}
+	b.WriteString("---")
+	return b.String()
+}
+
+// simple prints text verbatim, as it is used where nothing can be escaped.
+func simple(t parser.TextSimple) string {
+	var b strings.Builder
+	for _, n := range t {
+		switch n := n.(type) {
+		case *parser.Text:
+			b.WriteString(n.Text)
+		case *parser.AmpSpecial:
+			b.WriteString(n.Text)
+		}
+	}
+	return b.String()
+}
+
+// topLevel prints the sections and the html elements preceding them, with
+// the comments found between them.
+func (p *printer) topLevel(nodes []parser.Node) string {
+	var parts []string
+	for _, node := range nodes {
+		block := p.commentsBeforeNode(node) + p.block(node, 0)
+		parts = append(parts, block)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// blocks prints the nodes separated by empty lines.
+// Indent is the width of the prefix the nodes will be printed behind.
+func (p *printer) blocks(nodes []parser.Node, indent int) string {
+	var b strings.Builder
+	for i, node := range nodes {
+		if i > 0 {
+			b.WriteString("\n\n")
+			if prev, ok := nodes[i-1].(*parser.List); ok {
+				if next, ok := node.(*parser.List); ok && prev.Ordered == next.Ordered {
+					// keep adjacent lists from merging into one
+					b.WriteString("%%\n")
+				}
+			}
+		}
+		b.WriteString(p.block(node, indent))
+	}
+	return b.String()
+}
+
+func (p *printer) block(node parser.Node, indent int) string {
+	switch node := node.(type) {
+	default:
+		panic(fmt.Sprintf("format: unexpected block node: %T", node))
+	case *parser.Section:
+		return p.section(node)
+	case *parser.Paragraph:
+		text := p.paragraph(node.Content, indent)
+		if len(node.Attributes) > 0 {
+			if strings.HasSuffix(text, "\\") {
+				text += "\n" // the line break needs the end of its line
+			} else {
+				text += " "
+			}
+			text += p.attributes(node.Attributes)
+		}
+		return text
+	case *parser.Html:
+		return p.html(node, indent)
+	case *parser.Image:
+		return p.image(node)
+	case *parser.CodeBlock:
+		return p.codeBlock(node)
+	case *parser.BlockQuote:
+		return p.blockQuote(node, indent)
+	case *parser.Admonition:
+		return p.admonition(node, indent)
+	case *parser.List:
+		return p.list(node, indent)
+	case *parser.Table:
+		return p.table(node)
+	case *parser.DefinitionList:
+		return p.definitionList(node)
+	case *parser.HorizontalRule:
+		return "---"
+	}
+}
+
+func (p *printer) section(s *parser.Section) string {
+	var b strings.Builder
+	b.WriteString(strings.Repeat("#", s.Level))
+	b.WriteString(" ")
+	b.WriteString(strings.TrimRight(p.inline(s.Heading, context{lineEnd: true}), " "))
+	if len(s.Attributes) > 0 {
+		b.WriteString(" ")
+		b.WriteString(p.attributes(s.Attributes))
+	}
+	var parts []string
+	for _, node := range s.Content {
+		block := p.commentsBeforeNode(node) + p.block(node, 0)
+		if len(parts) > 0 {
+			if prev, ok := s.Content[len(parts)-1].(*parser.List); ok {
+				if next, ok := node.(*parser.List); ok && prev.Ordered == next.Ordered && !strings.HasPrefix(block, "%%") {
+					block = "%%\n" + block
+				}
+			}
+		}
+		parts = append(parts, block)
+	}
+	if len(parts) > 0 {
+		b.WriteString("\n\n")
+		b.WriteString(strings.Join(parts, "\n\n"))
+	}
+	return b.String()
+}
+
+func (p *printer) html(h *parser.Html, indent int) string {
+	var b strings.Builder
+	b.WriteString(openTag(h))
+	if len(h.Content) > 0 {
+		b.WriteString("\n")
+		b.WriteString(p.blocks(h.Content, indent))
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "</%s>", h.Name)
+	return b.String()
+}
+
+func openTag(h *parser.Html) string {
+	var b strings.Builder
+	b.WriteString("<")
+	b.WriteString(h.Name)
+	for _, key := range slices.Sorted(maps.Keys(h.Attributes)) {
+		b.WriteString(" ")
+		b.WriteString(key)
+		if val := h.Attributes[key]; val != "" {
+			fmt.Fprintf(&b, "=%q", val)
+		}
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+func (p *printer) image(img *parser.Image) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "![%s](%s", simple(img.Alt), img.Name)
+	if title := simple(img.Title); title != "" {
+		fmt.Fprintf(&b, " \"%s\"", title)
+	}
+	b.WriteString(")")
+	if len(img.Attributes) > 0 {
+		b.WriteString(p.attributes(img.Attributes))
+	}
+	return b.String()
+}
+
+func (p *printer) codeBlock(c *parser.CodeBlock) string {
+	var b strings.Builder
+	b.WriteString("```")
+	attrs := maps.Clone(c.Attributes)
+	if lang := attrs["Lang"]; lang != "" && isASCIIWord(lang) {
+		b.WriteString(lang)
+		delete(attrs, "Lang")
+	}
+	if len(attrs) > 0 {
+		b.WriteString(" ")
+		b.WriteString(p.attributes(attrs))
+	}
+	b.WriteString("\n")
+	for _, line := range c.Lines {
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	b.WriteString("```")
+	return b.String()
+}
+
+func isASCIIWord(s string) bool {
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *printer) blockQuote(q *parser.BlockQuote, indent int) string {
+	// the lexer reads the content without the prefixes
+	raw := p.raw
+	p.raw = 0
+	text := p.blocks(q.Content, indent+2)
+	p.raw = raw
+	if len(q.Author) > 0 || len(q.Source) > 0 {
+		attribution := "-- " + p.inline(parser.TextRich(q.Author), context{lineEnd: true})
+		if len(q.Source) > 0 {
+			attribution += ", " + p.inline(q.Source, context{lineEnd: true})
+		}
+		if text != "" {
+			text += "\n"
+		}
+		text += attribution
+	}
+	return prefixLines(text, "> ", "> ")
+}
+
+func (p *printer) admonition(a *parser.Admonition, indent int) string {
+	var b strings.Builder
+	switch {
+	case a.Open:
+		b.WriteString("???+")
+	case a.Collapsible:
+		b.WriteString("???")
+	default:
+		b.WriteString("!!!")
+	}
+	b.WriteString(" ")
+	b.WriteString(a.Type)
+	if len(a.Title) > 0 {
+		fmt.Fprintf(&b, " \"%s\"", simple(a.Title))
+	}
+	if len(a.Content) > 0 {
+		b.WriteString("\n")
+		content := p.indented(4, func() string { return p.blocks(a.Content, indent+4) })
+		b.WriteString(prefixLines(content, "    ", "    "))
+	}
+	return b.String()
+}
+
+func (p *printer) list(l *parser.List, indent int) string {
+	// items are separated by an empty line only if one of them needs one
+	// to separate its own paragraphs
+	loose := slices.ContainsFunc(l.Items, func(item *parser.ListItem) bool {
+		paragraphs := 0
+		for _, node := range item.Content {
+			if _, ok := node.(*parser.Paragraph); ok {
+				paragraphs++
+			}
+		}
+		return paragraphs > 1
+	})
+	var items []string
+	for i, item := range l.Items {
+		marker := "-"
+		if l.Ordered {
+			marker = strconv.Itoa(l.Start+i) + "."
+		}
+		marker += " "
+		hanging := strings.Repeat(" ", len(marker))
+		if item.Task {
+			if item.Checked {
+				marker += "[x] "
+			} else {
+				marker += "[ ] "
+			}
+		}
+		var b strings.Builder
+		for j, node := range item.Content {
+			if j > 0 {
+				// only a list starting at one may directly follow a paragraph
+				if list, ok := node.(*parser.List); ok && (!list.Ordered || list.Start == 1) {
+					b.WriteString("\n")
+				} else {
+					b.WriteString("\n\n")
+				}
+			}
+			// a list without a paragraph before it starts on the next line
+			if _, ok := node.(*parser.List); ok && j == 0 {
+				b.WriteString("\n")
+			}
+			b.WriteString(p.indented(len(hanging), func() string { return p.block(node, indent+len(hanging)) }))
+		}
+		items = append(items, prefixLines(b.String(), marker, hanging))
+	}
+	if loose {
+		return strings.Join(items, "\n\n")
+	}
+	return strings.Join(items, "\n")
+}
+
+func (p *printer) table(t *parser.Table) string {
+	rows := [][]string{make([]string, len(t.Alignments))}
+	for i, cell := range t.Header {
+		rows[0][i] = p.inline(cell, context{lineEnd: true})
+	}
+	for _, row := range t.Rows {
+		cells := make([]string, len(t.Alignments))
+		for i, cell := range row {
+			cells[i] = p.inline(cell, context{lineEnd: true})
+		}
+		rows = append(rows, cells)
+	}
+	widths := make([]int, len(t.Alignments))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], 3, len([]rune(cell)))
+		}
+	}
+	line := func(cells []string) string {
+		var b strings.Builder
+		for i, cell := range cells {
+			fmt.Fprintf(&b, "| %s%s ", cell, strings.Repeat(" ", widths[i]-len([]rune(cell))))
+		}
+		b.WriteString("|")
+		return b.String()
+	}
+	delimiters := make([]string, len(t.Alignments))
+	for i, alignment := range t.Alignments {
+		dashes := strings.Repeat("-", widths[i])
+		switch alignment {
+		default:
+			delimiters[i] = dashes
+		case parser.AlignLeft:
+			delimiters[i] = ":" + dashes[1:]
+		case parser.AlignCenter:
+			delimiters[i] = ":" + dashes[2:] + ":"
+		case parser.AlignRight:
+			delimiters[i] = dashes[1:] + ":"
+		}
+	}
+	lines := []string{line(rows[0]), line(delimiters)}
+	for _, row := range rows[1:] {
+		lines = append(lines, line(row))
+	}
+	if len(t.Attributes) > 0 {
+		lines = append(lines, p.attributes(t.Attributes))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (p *printer) definitionList(l *parser.DefinitionList) string {
+	var lines []string
+	for _, definition := range l.Definitions {
+		lines = append(lines, simple(parser.TextSimple(definition.Term)))
+		for _, explanation := range definition.Explanations {
+			lines = append(lines, ": "+p.inline(explanation, context{lineEnd: true}))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// definitions prints the link, sidenote, and abbreviation definitions, each
+// kind sorted by id.
+func (p *printer) definitions(blog *parser.Blog) string {
+	var groups []string
+	var links []string
+	for _, id := range slices.SortedFunc(maps.Keys(blog.LinkDefinitions), compareIDs) {
+		links = append(links, fmt.Sprintf("[%s]: %s", id, blog.LinkDefinitions[id]))
+	}
+	if len(links) > 0 {
+		groups = append(groups, strings.Join(links, "\n"))
+	}
+	ids := slices.Collect(maps.Keys(blog.SidenoteDefinitions))
+	for id := range blog.FootnoteDefinitions {
+		if _, ok := blog.SidenoteDefinitions[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	slices.SortFunc(ids, compareIDs)
+	var sidenotes strings.Builder
+	separate := false // from a definition with more than one paragraph
+	for i, id := range ids {
+		paragraphs := blog.FootnoteDefinitions[id]
+		if len(paragraphs) == 0 {
+			paragraphs = []parser.TextRich{blog.SidenoteDefinitions[id]}
+		}
+		if i > 0 {
+			sidenotes.WriteString("\n")
+			if separate || len(paragraphs) > 1 {
+				sidenotes.WriteString("\n")
+			}
+		}
+		fmt.Fprintf(&sidenotes, "[^%s]: %s", id, p.inline(paragraphs[0], context{lineEnd: true}))
+		for _, paragraph := range paragraphs[1:] {
+			sidenotes.WriteString("\n\n")
+			text := p.indented(4, func() string { return p.paragraph(paragraph, 4) })
+			sidenotes.WriteString(prefixLines(text, "    ", "    "))
+		}
+		separate = len(paragraphs) > 1
+	}
+	if sidenotes.Len() > 0 {
+		groups = append(groups, sidenotes.String())
+	}
+	var abbreviations []string
+	for _, abbr := range slices.Sorted(maps.Keys(blog.AbbreviationDefinitions)) {
+		abbreviations = append(abbreviations, fmt.Sprintf("*[%s]: %s", abbr, blog.AbbreviationDefinitions[abbr]))
+	}
+	if len(abbreviations) > 0 {
+		groups = append(groups, strings.Join(abbreviations, "\n"))
+	}
+	return strings.Join(groups, "\n\n")
+}
+
+// compareIDs orders numeric ids by their value, before all other ids.
+func compareIDs(a, b string) int {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return cmp.Or(cmp.Compare(na, nb), strings.Compare(a, b))
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// attributes prints an attribute list, with the id and classes first, in
+// their short forms, followed by the other keys in order.
+// Keys and values that the lexer would read differently are reported in p.err.
+func (p *printer) attributes(attrs parser.Attributes) string {
+	var fields []string
+	rest := maps.Clone(attrs)
+	if id, ok := rest["id"]; ok && id != "" && isAttrWord(id) && !strings.Contains(id, "=") {
+		fields = append(fields, "#"+id)
+		delete(rest, "id")
+	}
+	if class, ok := rest["class"]; ok && class != "" {
+		classes := strings.Fields(class)
+		if strings.Join(classes, " ") == class && !slices.ContainsFunc(classes, func(c string) bool { return !isAttrWord(c) || strings.Contains(c, "=") }) {
+			for _, c := range classes {
+				fields = append(fields, "."+c)
+			}
+			delete(rest, "class")
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(rest)) {
+		if !isAttrKey(key) {
+			p.err = errors.Join(p.err, fmt.Errorf("attribute key %q can't be printed", key))
+			continue
+		}
+		val := rest[key]
+		if strings.Contains(val, "'") && strings.Contains(val, "\"") {
+			p.err = errors.Join(p.err, fmt.Errorf("attribute %s: value %q can't be printed, it contains both kinds of quotes", key, val))
+			continue
+		}
+		fields = append(fields, key+"="+attrValue(val))
+	}
+	return "{" + strings.Join(fields, " ") + "}"
+}
+
+func isAttrWord(s string) bool {
+	return !strings.ContainsAny(s, " \u00A0\n\r\v\t}'\"")
+}
+
+// isAttrKey reports whether s is lexed back as a single key, and not as an id.
+func isAttrKey(s string) bool {
+	return s != "" && !strings.HasPrefix(s, "#") && !strings.ContainsAny(s, " \u00A0\n\r\v\t=}")
+}
+
+func attrValue(val string) string {
+	switch {
+	case val != "" && isAttrWord(val):
+		return val
+	case strings.Contains(val, "\""):
+		return "'" + val + "'"
+	}
+	return "\"" + val + "\""
+}
+
+// prefixLines puts first before the first line of the text, and rest before
+// all other lines.
+// Empty lines get only the prefix without its trailing spaces.
+func prefixLines(text, first, rest string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		prefix := rest
+		if i == 0 {
+			prefix = first
+		}
+		if line == "" {
+			prefix = strings.TrimRight(prefix, " ")
+		}
+		lines[i] = prefix + line
+	}
+	return strings.Join(lines, "\n")
+}
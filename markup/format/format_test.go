@@ -0,0 +1,330 @@
+package format_test
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/cvanloo/blog-go/markup"
+	"github.com/cvanloo/blog-go/markup/format"
+	"github.com/cvanloo/blog-go/markup/lexer"
+	markupparser "github.com/cvanloo/blog-go/markup/parser"
+)
+
+type lexerTestCase struct {
+	name, source string
+}
+
+// lexerTestSources collects the name and source of every test case in the
+// lexer tests.
+func lexerTestSources(t *testing.T) (cases []lexerTestCase) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "../lexer/lexer_test.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		lit, ok := n.(*ast.CompositeLit)
+		if !ok {
+			return true
+		}
+		var tc lexerTestCase
+		hasSource := false
+		for _, elt := range lit.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				continue
+			}
+			key, ok := kv.Key.(*ast.Ident)
+			if !ok {
+				continue
+			}
+			switch key.Name {
+			case "name":
+				tc.name = stringConstant(t, fset, kv.Value)
+			case "source":
+				tc.source = stringConstant(t, fset, kv.Value)
+				hasSource = true
+			}
+		}
+		if hasSource {
+			cases = append(cases, tc)
+		}
+		return true
+	})
+	if len(cases) == 0 {
+		t.Fatal("no test cases found in the lexer tests")
+	}
+	return append(cases, lexerTestCase{"markup.BlogTestSource", markup.BlogTestSource})
+}
+
+// stringConstant evaluates a string literal, or a concatenation of them.
+func stringConstant(t *testing.T, fset *token.FileSet, expr ast.Expr) string {
+	t.Helper()
+	switch expr := expr.(type) {
+	case *ast.BasicLit:
+		if expr.Kind == token.STRING {
+			s, err := strconv.Unquote(expr.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		}
+	case *ast.BinaryExpr:
+		if expr.Op == token.ADD {
+			return stringConstant(t, fset, expr.X) + stringConstant(t, fset, expr.Y)
+		}
+	case *ast.ParenExpr:
+		return stringConstant(t, fset, expr.X)
+	}
+	t.Fatalf("%s: source is not a string constant", fset.Position(expr.Pos()))
+	return ""
+}
+
+func parse(t *testing.T, src string) (*markupparser.Blog, []lexer.Token, bool) {
+	t.Helper()
+	lx := lexer.New()
+	lx.LexSource("test.md", src)
+	if len(lx.Errors) > 0 {
+		return nil, nil, false
+	}
+	blog, err := markupparser.Parse(lx)
+	if err != nil {
+		return nil, nil, false
+	}
+	return blog, lx.Comments, true
+}
+
+// unparsableLexerTests are the lexer test cases that are about an error, and
+// whose source therefore can't be round-tripped.
+var unparsableLexerTests = map[string]bool{
+	"Empty Meta Block Without End Marker":                true,
+	"Non-Empty Meta Block with Keys, Missing End Marker": true,
+	"Non-Empty Meta Block with mixed +++ and ---":        true,
+	"Nested sections up to level 6":                      true,
+	"Section level too deep":                             true,
+	"Unclosed title":                                     true,
+	"Unterminated block comment":                         true,
+	"Unclosed Element Ends at Empty Line":                true,
+	"Unclosed Mono":                                      true,
+	"Missing Html Tag Name":                              true,
+	"Unclosed Code Block Attribute List":                 true,
+	"Unclosed Code Block Attribute List at the End":      true,
+	"Unclosed Image Alt Text":                            true,
+	"Invalid Content Skipped up to Next Section":         true,
+}
+
+// TestRoundTrip formats every lexer test case, and parses the result back
+// into the same blog.
+// The blogs are compared up to how their text is split into text nodes and
+// lines, that is after adjacent text nodes are merged, and whitespace is
+// collapsed into a single space.
+// The formatted source must also format to itself.
+func TestRoundTrip(t *testing.T) {
+	deep.NilMapsAreEmpty = true
+	deep.NilSlicesAreEmpty = true
+	defer func() {
+		deep.NilMapsAreEmpty = false
+		deep.NilSlicesAreEmpty = false
+	}()
+	tested := 0
+	skipped := make(map[string]bool)
+	for _, tc := range lexerTestSources(t) {
+		src := tc.source
+		blog, comments, ok := parse(t, src)
+		if !ok {
+			if !unparsableLexerTests[tc.name] {
+				t.Errorf("%s: source doesn't parse, but is not listed as a case about an error", tc.name)
+			}
+			skipped[tc.name] = true
+			continue
+		}
+		tested++
+		var formatted bytes.Buffer
+		if err := (format.Config{Width: format.DefaultWidth, Comments: comments}).Fprint(&formatted, blog); err != nil {
+			t.Fatal(err)
+		}
+		roundTripped, _, ok := parse(t, formatted.String())
+		if !ok {
+			t.Errorf("%s: formatted source doesn't parse:\n%s\n--- from:\n%s", tc.name, formatted.String(), src)
+			continue
+		}
+		if diff := deep.Equal(normalize(roundTripped), normalize(blog)); diff != nil {
+			t.Errorf("%s: %v\n%s\n--- from:\n%s", tc.name, diff, formatted.String(), src)
+			continue
+		}
+		again, err := format.Source("test.md", formatted.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(again) != formatted.String() {
+			t.Errorf("%s: formatting is not idempotent:\n%s\n--- then:\n%s", tc.name, formatted.String(), again)
+		}
+	}
+	for name := range unparsableLexerTests {
+		if !skipped[name] {
+			t.Errorf("%s: listed as a case about an error, but there is no such case, or its source parses", name)
+		}
+	}
+	if tested == 0 {
+		t.Error("no test case was round-tripped")
+	}
+}
+
+func TestSource(t *testing.T) {
+	src := `---
+title: Formatting
+url-path: formatting
+---
+%% a comment
+#   Intro   {#intro   .wide}
+Some *text*  that goes on and on, for so long that it no longer fits on one line [^1].
+
+[^1]: A footnote.
+[link]: https://example.org
+`
+	expected := `---
+title: Formatting
+url-path: formatting
+---
+
+%% a comment
+# Intro {#intro .wide}
+
+Some *text* that goes on and on, for so long that it no longer fits on one
+line [^1].
+
+[link]: https://example.org
+
+[^1]: A footnote.
+`
+	formatted, err := format.Source("test.md", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(formatted) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, formatted)
+	}
+	if _, err := format.Source("test.md", []byte("# Heading {#}\n")); err == nil {
+		t.Error("expected the lexer errors to be returned")
+	}
+	if _, err := format.Source("test.md", []byte("# Heading\n\n| a | b |\n|---|---|\n| 1 | 2 | 3 |\n")); err == nil {
+		t.Error("expected the excess table cells to be reported")
+	}
+}
+
+// normalize merges adjacent text nodes and collapses their whitespace.
+func normalize(blog *markupparser.Blog) *markupparser.Blog {
+	normalizeValue(reflect.ValueOf(blog))
+	return blog
+}
+
+var nodeType = reflect.TypeFor[markupparser.Node]()
+
+func normalizeValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			normalizeValue(v.Elem())
+		}
+	case reflect.Struct:
+		for i := range v.NumField() {
+			normalizeValue(v.Field(i))
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(key))
+			normalizeValue(elem)
+			v.SetMapIndex(key, elem)
+		}
+	case reflect.Slice:
+		if v.Type().Elem() == nodeType {
+			v.Set(reflect.ValueOf(mergeText(v.Interface())).Convert(v.Type()))
+		}
+		for i := range v.Len() {
+			normalizeValue(v.Index(i))
+		}
+	}
+}
+
+func mergeText(nodes any) []markupparser.Node {
+	var merged []markupparser.Node
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			merged = append(merged, &markupparser.Text{Text: text.String()})
+			text.Reset()
+		}
+	}
+	in := reflect.ValueOf(nodes)
+	for i := range in.Len() {
+		node := in.Index(i).Interface().(markupparser.Node)
+		if t, ok := node.(*markupparser.Text); ok {
+			text.WriteString(t.Text)
+			continue
+		}
+		flush()
+		merged = append(merged, node)
+	}
+	flush()
+	var normalized []markupparser.Node
+	for i, node := range merged {
+		if t, ok := node.(*markupparser.Text); ok {
+			s := strings.Join(strings.Fields(t.Text), " ")
+			if s == "" && (i == 0 || i == len(merged)-1) {
+				continue
+			}
+			if i > 0 && strings.IndexFunc(t.Text, isSpace) == 0 {
+				s = " " + strings.TrimLeft(s, " ")
+			}
+			if i < len(merged)-1 && strings.LastIndexFunc(t.Text, isSpace) == len(t.Text)-1 {
+				s = strings.TrimRight(s, " ") + " "
+			}
+			if s == "" {
+				continue
+			}
+			t.Text = s
+		}
+		if _, ok := node.(*markupparser.Footnote); ok && len(normalized) > 0 {
+			// like TextRich.Append, which can't if a comment split the text
+			if t, ok := normalized[len(normalized)-1].(*markupparser.Text); ok {
+				if t.Text = strings.TrimRight(t.Text, " "); t.Text == "" {
+					normalized = normalized[:len(normalized)-1]
+				}
+			}
+		}
+		normalized = append(normalized, node)
+	}
+	return normalized
+}
+
+func isSpace(r rune) bool {
+	return strings.ContainsRune(" \t\n\r\v\f", r)
+}
+
+func TestUnprintableAttributes(t *testing.T) {
+	for _, attrs := range []markupparser.Attributes{
+		{"#bench": ""},
+		{"caption": `it's "quoted"`},
+	} {
+		blog := &markupparser.Blog{
+			Sections: []*markupparser.Section{{
+				Attributes: attrs,
+				Level:      1,
+				Heading:    markupparser.TextRich{&markupparser.Text{Text: "Heading"}},
+			}},
+		}
+		var formatted bytes.Buffer
+		if err := format.Fprint(&formatted, blog); err == nil {
+			t.Errorf("%v: expected an error, got:\n%s", attrs, formatted.String())
+		}
+	}
+}
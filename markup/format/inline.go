@@ -0,0 +1,400 @@
+package format
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/cvanloo/blog-go/markup/lexer"
+	"github.com/cvanloo/blog-go/markup/parser"
+)
+
+const (
+	// breakable marks a space at which a paragraph may be wrapped.
+	breakable = '\x00'
+	// lineBreak marks the end of a line forced by a LineBreak.
+	lineBreak = '\x01'
+)
+
+// context of the lexer in which the text will be read back.
+type context struct {
+	wrap      bool // spaces are breakable
+	sidenote  bool // inside of an inline sidenote, which ends at a `)`
+	lineStart bool // the text starts a line, where it could be read as the start of a block
+	lineEnd   bool // the text ends with its line, like a heading
+}
+
+// paragraph prints text that wraps after the width of the printer, less the
+// indent.
+func (p *printer) paragraph(content []parser.Node, indent int) string {
+	text := strings.Trim(p.inline(content, context{wrap: true, lineStart: true}), string(breakable))
+	// a break at the end is followed by the end of the paragraph anyway
+	text = strings.TrimRight(text, string([]rune{breakable, lineBreak}))
+	if p.width <= 0 {
+		return strings.NewReplacer(string(breakable), " ", string(lineBreak), "\n").Replace(text)
+	}
+	width := max(p.width-indent, 20)
+	var b strings.Builder
+	for i, line := range strings.Split(text, string(lineBreak)) {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		column := 0
+		words := strings.FieldsFunc(line, func(r rune) bool { return r == breakable })
+		for j, word := range words {
+			length := utf8.RuneCountInString(word)
+			if j > 0 {
+				// only a line starting with a letter can't be mistaken for
+				// the start of a list item, a table, a definition, and so on
+				first, _ := utf8.DecodeRuneInString(word)
+				if column+1+length > width && unicode.IsLetter(first) {
+					b.WriteString("\n")
+					column = 0
+				} else {
+					b.WriteString(" ")
+					column++
+				}
+			}
+			b.WriteString(word)
+			column += length
+		}
+	}
+	return b.String()
+}
+
+// inline prints rich text, escaping whatever would be read back as markup.
+func (p *printer) inline(content []parser.Node, ctx context) string {
+	nodes := mergeText(content)
+	pieces := make([]string, len(nodes))
+	for i, node := range nodes {
+		if _, ok := node.(*parser.Text); !ok {
+			pieces[i] = p.node(node, ctx)
+		}
+	}
+	var b strings.Builder
+	for i, node := range nodes {
+		var next string
+		if i+1 < len(nodes) {
+			next = pieces[i+1]
+			if text, ok := nodes[i+1].(*parser.Text); ok {
+				next = text.Text
+			}
+		}
+		prev, _ := utf8.DecodeLastRuneInString(b.String())
+		switch node := node.(type) {
+		default:
+			piece := pieces[i]
+			if isEmphasisLike(node) && prev == '*' {
+				piece = p.emphasis(node, '_', ctx)
+			}
+			if isEmphasisLike(node) && strings.HasPrefix(next, "*") {
+				piece = p.emphasis(node, '_', ctx)
+			}
+			b.WriteString(piece)
+		case *parser.Text:
+			textCtx := ctx
+			textCtx.lineStart = ctx.lineStart && i == 0 || prev == lineBreak || prev == '\n'
+			b.WriteString(escape(node.Text, prev, next, textCtx))
+		case *parser.Subscript:
+			// a subscript next to a word is read back as non-breaking spaces
+			after, _ := utf8.DecodeRuneInString(next)
+			if isWordRune(prev) || isWordRune(after) {
+				p.err = errors.Join(p.err, fmt.Errorf("subscript %q can't be printed next to a word", node.Text))
+			}
+			b.WriteString(pieces[i])
+		case *parser.Footnote:
+			// separate the marker from the preceding word, or it is read
+			// back as a single word sidenote
+			if prev != utf8.RuneError && !isSpace(prev) && prev != breakable && prev != lineBreak {
+				b.WriteString(" ")
+			}
+			b.WriteString(pieces[i])
+		case *parser.Link:
+			b.WriteString(pieces[i])
+			if strings.HasSuffix(pieces[i], "]") && node.Ref == "" && strings.ContainsAny(firstRune(next), "([{") {
+				b.WriteString("()")
+			}
+		}
+	}
+	return b.String()
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+func firstRune(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError {
+		return ""
+	}
+	return s[:size]
+}
+
+// mergeText joins adjacent text nodes, since where the lexer splits text
+// depends on the escapes in it.
+func mergeText(content []parser.Node) []parser.Node {
+	var nodes []parser.Node
+	for _, node := range content {
+		text, ok := node.(*parser.Text)
+		if !ok {
+			nodes = append(nodes, node)
+			continue
+		}
+		if len(nodes) > 0 {
+			if last, ok := nodes[len(nodes)-1].(*parser.Text); ok {
+				merged := *last
+				merged.Text += text.Text
+				merged.Span.End = text.Span.End
+				nodes[len(nodes)-1] = &merged
+				continue
+			}
+		}
+		nodes = append(nodes, text)
+	}
+	return nodes
+}
+
+func isEmphasisLike(node parser.Node) bool {
+	switch node.(type) {
+	case *parser.Emphasis, *parser.Strong, *parser.EmphasisStrong:
+		return true
+	}
+	return false
+}
+
+func (p *printer) emphasis(node parser.Node, delim rune, ctx context) string {
+	var count int
+	var content []parser.Node
+	switch node := node.(type) {
+	case *parser.Emphasis:
+		count, content = 1, node.Content
+	case *parser.Strong:
+		count, content = 2, node.Content
+	case *parser.EmphasisStrong:
+		count, content = 3, node.Content
+	}
+	text := p.inline(content, ctx)
+	if strings.HasPrefix(text, "*") || strings.HasSuffix(text, "*") {
+		delim = '_' // or the delimiters run together
+	}
+	d := strings.Repeat(string(delim), count)
+	return d + text + d
+}
+
+func (p *printer) node(node parser.Node, ctx context) string {
+	// only text at the top level wraps, a link can't span lines
+	inner := context{}
+	switch node := node.(type) {
+	default:
+		panic(fmt.Sprintf("format: unexpected inline node: %T", node))
+	case *parser.AmpSpecial:
+		return node.Text
+	case *parser.Emphasis, *parser.Strong, *parser.EmphasisStrong:
+		return p.emphasis(node, '*', inner)
+	case *parser.Strikethrough:
+		return "~~" + p.inline(node.Content, inner) + "~~"
+	case *parser.Marker:
+		return "==" + p.inline(node.Content, inner) + "=="
+	case *parser.EnquoteSingle:
+		return "`" + p.inline(node.Content, inner) + "'"
+	case *parser.EnquoteDouble:
+		return "\"" + p.inline(node.Content, inner) + "\""
+	case *parser.EnquoteAngled:
+		return "<<" + p.inline(node.Content, inner) + ">>"
+	case *parser.Mono:
+		return "`" + p.rawText(node.Text) + "`"
+	case *parser.Math:
+		if node.Inline {
+			return "$" + p.rawText(node.TeX) + "$"
+		}
+		return "$$" + p.rawText(node.TeX) + "$$"
+	case *parser.Superscript:
+		return "^" + node.Text + "^"
+	case *parser.Subscript:
+		return "~" + node.Text + "~"
+	case *parser.Kbd:
+		return "[[" + node.Text + "]]"
+	case *parser.Linkify:
+		return "<" + node.Text + ">"
+	case *parser.LineBreak:
+		switch {
+		case ctx.wrap:
+			return "\\" + string(lineBreak)
+		case ctx.lineEnd:
+			return "\\" // the line of the text ends right after the break
+		}
+		return "\\\n"
+	case *parser.Footnote:
+		return "[^" + node.Ref + "]"
+	case *parser.Abbreviation:
+		return escape(node.Abbr, utf8.RuneError, "", ctx)
+	case *parser.Ruby:
+		return "{" + strings.Join(node.Kanji, "") + "|" + strings.Join(node.Furigana, "|") + "}"
+	case *parser.Span:
+		return "[" + p.inline(node.Content, inner) + "]" + p.attributes(node.Attributes)
+	case *parser.Sidenote:
+		word := "[" + p.inline(node.Word, inner) + "]"
+		if node.Ref != "" {
+			return word + "[^" + node.Ref + "]"
+		}
+		return word + "(^" + p.inline(node.Content, context{sidenote: true}) + ")"
+	case *parser.Link:
+		name := "[" + p.inline(node.Name, inner) + "]"
+		switch {
+		case node.Ref != "":
+			return name + "[" + node.Ref + "]"
+		case node.Href == "" && node.Title == "":
+			return name
+		}
+		return name + "(" + destination(node.Href, node.Title) + ")"
+	case *parser.Html:
+		var b strings.Builder
+		b.WriteString(openTag(node))
+		content := strings.TrimRightFunc(p.inline(node.Content, inner), isSpace)
+		b.WriteString(content)
+		if strings.HasSuffix(content, "\\") {
+			b.WriteString("\n") // or the break escapes the closing tag
+		}
+		fmt.Fprintf(&b, "</%s>", node.Name)
+		return b.String()
+	}
+}
+
+// rawText removes the indentation of the enclosing blocks from the lines
+// after the first, since the blocks add it back.
+func (p *printer) rawText(s string) string {
+	if p.raw == 0 || !strings.Contains(s, "\n") {
+		return s
+	}
+	lines := strings.Split(s, "\n")
+	for i := 1; i < len(lines); i++ {
+		line := lines[i]
+		for range p.raw {
+			line = strings.TrimPrefix(line, " ")
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// destination prints the href and title of a link, the href is enclosed in
+// angle brackets if it is empty or would otherwise not be read back whole.
+func destination(href, title string) string {
+	var b strings.Builder
+	if href == "" || strings.ContainsFunc(href, isSpace) || strings.HasPrefix(href, "<") || !balanced(href) {
+		b.WriteString("<")
+		b.WriteString(strings.NewReplacer("\\", "\\\\", ">", "\\>").Replace(href))
+		b.WriteString(">")
+	} else {
+		b.WriteString(strings.ReplaceAll(href, "\\", "\\\\"))
+	}
+	if title != "" {
+		quote := "\""
+		if strings.Contains(title, "\"") && !strings.Contains(title, "'") {
+			quote = "'"
+		}
+		title = strings.NewReplacer("\\", "\\\\", quote, "\\"+quote).Replace(title)
+		b.WriteString(" " + quote + title + quote)
+	}
+	return b.String()
+}
+
+// balanced reports whether all parentheses are closed, in the right order.
+func balanced(s string) bool {
+	depth := 0
+	for _, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return false
+			}
+		}
+	}
+	return depth == 0
+}
+
+func isSpace(r rune) bool {
+	switch r {
+	case ' ', '\t', '\n', '\r', '\v', '\f':
+		return true
+	}
+	return false
+}
+
+// escape text preceded by the rune prev and followed by the printed next
+// node.
+// Runs of whitespace collapse into a single space, which is breakable if
+// the context wraps.
+func escape(text string, prev rune, next string, ctx context) string {
+	var b strings.Builder
+	rs := []rune(text)
+	if ctx.lineStart {
+		rs = []rune(strings.TrimLeftFunc(text, isSpace))
+		if len(rs) > 0 && strings.ContainsRune("-+#!", rs[0]) {
+			b.WriteRune('\\')
+			b.WriteRune(rs[0])
+			prev, rs = rs[0], rs[1:]
+		} else if i := strings.IndexFunc(string(rs), func(r rune) bool { return r < '0' || r > '9' }); i > 0 && rs[i] == '.' {
+			// an ordered list item
+			b.WriteString(string(rs[:i]))
+			b.WriteString("\\.")
+			prev, rs = '.', rs[i+1:]
+		}
+	}
+	space := ' '
+	if ctx.wrap {
+		space = breakable
+	}
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		if isSpace(r) {
+			for i+1 < len(rs) && isSpace(rs[i+1]) {
+				i++
+			}
+			b.WriteRune(space)
+			prev = r
+			continue
+		}
+		rest := string(rs[i+1:]) + next
+		after, _ := utf8.DecodeRuneInString(rest)
+		escaped := false
+		switch r {
+		case '\\', '*', '_', '`', '<', '>', '[', ']', '{', '}', '~', '|', '$':
+			// math may close in any of the following nodes, so a `$` is
+			// always escaped
+			escaped = true
+		case '-', '.':
+			escaped = prev == r || after == r
+		case '%':
+			// %% starts a comment only at the start of the line or after a space
+			escaped = after == r && (isSpace(prev) || prev == breakable || prev == lineBreak || prev == utf8.RuneError)
+		case '(':
+			escaped = after == '^'
+		case ')':
+			escaped = ctx.sidenote
+		case '&':
+			escaped = isAmpSpecial(string(rs[i:]) + next)
+		}
+		if escaped {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+		prev = r
+	}
+	return b.String()
+}
+
+func isAmpSpecial(s string) bool {
+	for _, special := range lexer.AmpSpecials {
+		if strings.HasPrefix(s, special) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package markup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/cvanloo/blog-go/markup/diagnostic"
+	"github.com/cvanloo/blog-go/markup/parser"
+)
+
+// IncludeVisitor replaces the content of code blocks having an include
+// attribute with the content of the referenced file.
+//
+//	```go {include=../snippets/server.go lines=10-42}
+//	```
+//
+// The path is relative to Dir, the directory of the source file.
+// Instead of a line range, a region can be selected:
+//
+//	```go {include=../snippets/server.go region=handler}
+//	```
+//
+// which includes all lines between a line containing `region:handler` and a
+// line containing `endregion:handler` (the marker lines themselves are
+// excluded).
+// The name must be followed by the end of the line or a character that can't
+// be part of a name, so that `region:handler2` doesn't start the region.
+// Without lines or region the whole file is included.
+type IncludeVisitor struct {
+	parser.NopVisitor
+	Dir string
+	// Dependencies lists all files included so far.
+	Dependencies []string
+	Err          error
+}
+
+var (
+	ErrIncludeNotEmpty    = errors.New("code block with an include attribute must be empty")
+	ErrIncludeRange       = errors.New("invalid line range")
+	ErrIncludeRegion      = errors.New("region not found")
+	ErrIncludeLinesRegion = errors.New("lines and region are mutually exclusive")
+)
+
+func (v *IncludeVisitor) VisitCodeBlock(c *parser.CodeBlock) {
+	include, ok := c.Attributes["include"]
+	if !ok {
+		return
+	}
+	if len(c.Lines) > 0 {
+		v.Err = errors.Join(v.Err, diagnostic.At(c.Location(), "invalid-include", fmt.Errorf("include %s: %w", include, ErrIncludeNotEmpty)))
+		return
+	}
+	path := include
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(v.Dir, path)
+	}
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		v.Err = errors.Join(v.Err, diagnostic.At(c.Location(), "invalid-include", fmt.Errorf("include %s: %w", include, err)))
+		return
+	}
+	v.Dependencies = append(v.Dependencies, path)
+	lines := strings.Split(strings.TrimSuffix(string(bs), "\n"), "\n")
+	lineRange, hasLines := c.Attributes["lines"]
+	region, hasRegion := c.Attributes["region"]
+	switch {
+	case hasLines && hasRegion:
+		err = ErrIncludeLinesRegion
+	case hasLines:
+		lines, err = selectLines(lines, lineRange)
+	case hasRegion:
+		lines, err = selectRegion(lines, region)
+	}
+	if err != nil {
+		v.Err = errors.Join(v.Err, diagnostic.At(c.Location(), "invalid-include", fmt.Errorf("include %s: %w", include, err)))
+		return
+	}
+	c.Lines = lines
+}
+
+// selectLines returns the lines in the inclusive, 1-based range "from-to" or
+// the single line "n".
+func selectLines(lines []string, lineRange string) ([]string, error) {
+	from, to, isRange := strings.Cut(lineRange, "-")
+	first, err := strconv.Atoi(from)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrIncludeRange, lineRange)
+	}
+	last := first
+	if isRange {
+		last, err = strconv.Atoi(to)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrIncludeRange, lineRange)
+		}
+	}
+	if first < 1 || last < first {
+		return nil, fmt.Errorf("%w: %q", ErrIncludeRange, lineRange)
+	}
+	if last > len(lines) {
+		return nil, fmt.Errorf("%w: %q, file has %d lines", ErrIncludeRange, lineRange, len(lines))
+	}
+	return lines[first-1 : last], nil
+}
+
+// selectRegion returns the lines between the region:name and endregion:name markers.
+func selectRegion(lines []string, name string) ([]string, error) {
+	start, end := -1, -1
+	for i, line := range lines {
+		switch {
+		case containsMarker(line, "endregion:"+name):
+			if start >= 0 && end < 0 {
+				end = i
+			}
+		case containsMarker(line, "region:"+name):
+			if start < 0 {
+				start = i + 1
+			}
+		}
+	}
+	if start < 0 || end < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrIncludeRegion, name)
+	}
+	return lines[start:end], nil
+}
+
+// containsMarker reports whether the line contains the marker as a whole word,
+// not as part of a longer name.
+func containsMarker(line, marker string) bool {
+	for i := 0; ; {
+		j := strings.Index(line[i:], marker)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(marker)
+		before, _ := utf8.DecodeLastRuneInString(line[:start])
+		after, _ := utf8.DecodeRuneInString(line[end:])
+		if !isNameRune(before) && !isNameRune(after) {
+			return true
+		}
+		i = start + 1
+	}
+}
+
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-'
+}
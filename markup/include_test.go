@@ -0,0 +1,119 @@
+package markup_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/cvanloo/blog-go/markup"
+	"github.com/cvanloo/blog-go/markup/parser"
+)
+
+func TestInclude(t *testing.T) {
+	dir := t.TempDir()
+	server := `package main
+
+// region:handler2
+func handler2() {
+}
+// endregion:handler2
+
+// region:handler
+func handler() {
+}
+// endregion:handler
+
+func main() {
+}
+`
+	if err := os.WriteFile(filepath.Join(dir, "server.go"), []byte(server), 0666); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name          string
+		attributes    parser.Attributes
+		lines         []string
+		expected      []string
+		expectedError error
+	}{
+		{
+			name:       "Whole file",
+			attributes: parser.Attributes{"include": "server.go"},
+			expected: []string{
+				"package main", "", "// region:handler2", "func handler2() {", "}",
+				"// endregion:handler2", "", "// region:handler", "func handler() {", "}",
+				"// endregion:handler", "", "func main() {", "}",
+			},
+		},
+		{
+			name:       "Line range",
+			attributes: parser.Attributes{"include": "server.go", "lines": "13-14"},
+			expected:   []string{"func main() {", "}"},
+		},
+		{
+			name:       "Single line",
+			attributes: parser.Attributes{"include": "server.go", "lines": "1"},
+			expected:   []string{"package main"},
+		},
+		{
+			name:       "Region",
+			attributes: parser.Attributes{"include": "server.go", "region": "handler"},
+			expected:   []string{"func handler() {", "}"},
+		},
+		{
+			name:       "Region with a longer name",
+			attributes: parser.Attributes{"include": "server.go", "region": "handler2"},
+			expected:   []string{"func handler2() {", "}"},
+		},
+		{
+			name:          "Region name only as a prefix",
+			attributes:    parser.Attributes{"include": "server.go", "region": "hand"},
+			expectedError: markup.ErrIncludeRegion,
+		},
+		{
+			name:          "Line range out of bounds",
+			attributes:    parser.Attributes{"include": "server.go", "lines": "13-15"},
+			expectedError: markup.ErrIncludeRange,
+		},
+		{
+			name:          "Missing region",
+			attributes:    parser.Attributes{"include": "server.go", "region": "main"},
+			expectedError: markup.ErrIncludeRegion,
+		},
+		{
+			name:          "Missing file",
+			attributes:    parser.Attributes{"include": "client.go"},
+			expectedError: os.ErrNotExist,
+		},
+		{
+			name:          "Code block not empty",
+			attributes:    parser.Attributes{"include": "server.go"},
+			lines:         []string{"package main"},
+			expected:      []string{"package main"},
+			expectedError: markup.ErrIncludeNotEmpty,
+		},
+	}
+	for _, testCase := range testCases {
+		codeBlock := &parser.CodeBlock{
+			Attributes: testCase.attributes,
+			Lines:      testCase.lines,
+		}
+		blog := &parser.Blog{
+			Sections: []*parser.Section{{Level: 1, Content: []parser.Node{codeBlock}}},
+		}
+		includer := &markup.IncludeVisitor{Dir: dir}
+		blog.Accept(includer)
+		if !errors.Is(includer.Err, testCase.expectedError) {
+			t.Errorf("%s: expected error %v, got: %v", testCase.name, testCase.expectedError, includer.Err)
+		}
+		if diff := deep.Equal(codeBlock.Lines, testCase.expected); diff != nil {
+			t.Errorf("%s: %v", testCase.name, diff)
+		}
+		if testCase.expectedError == nil && len(includer.Dependencies) != 1 {
+			t.Errorf("%s: expected the included file to be recorded as dependency, got: %v", testCase.name, includer.Dependencies)
+		}
+	}
+}
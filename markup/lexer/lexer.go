@@ -3,29 +3,39 @@ package lexer
 import (
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"unicode"
 
 	. "github.com/cvanloo/blog-go/assert"
+	"github.com/cvanloo/blog-go/markup/diagnostic"
 )
 
+var ErrInternal = errors.New("internal lexer error")
+
 type (
 	Lexer struct {
 		Filename      string
 		Source        []rune
 		Pos, Consumed int
 		Lexemes       []Token
+		Comments      []Token
 		Errors        []error
+		lists         []int // indentation of the lists being lexed, innermost last
+		admonitions   []int // indentation of the markers of the admonitions being lexed, innermost last
+		lines         []int // offsets of the line starts in Source, see Position
 	}
 	LexerError struct {
 		Filename string
 		Pos      int
+		Span     diagnostic.Span
 		Inner    error
 	}
 	Token struct {
 		Type     TokenType
-		Filename string `deep:"-"`
-		Pos      int    `deep:"-"`
+		Filename string          `deep:"-"`
+		Pos      int             `deep:"-"` // rune offset into the source
+		Span     diagnostic.Span `deep:"-"`
 		Text     string
 	}
 )
@@ -43,24 +53,30 @@ const (
 	TokenHtmlTagAttrVal
 	TokenHtmlTagContent
 	TokenHtmlTagClose
-	TokenSection1Begin
-	TokenSection1Content
-	TokenSection1End
-	TokenSection2Begin
-	TokenSection2Content
-	TokenSection2End
+	TokenSectionBegin
+	TokenSectionContent
+	TokenSectionEnd
 	TokenParagraphBegin
 	TokenParagraphEnd
 	TokenText
 	TokenLineBreak
 	TokenAmpSpecial
 	TokenMono
+	TokenMathInline
+	TokenMathDisplay
 	TokenEmphasisBegin
 	TokenEmphasisEnd
 	TokenStrikethroughBegin
 	TokenStrikethroughEnd
 	TokenMarkerBegin
 	TokenMarkerEnd
+	TokenRubyBegin
+	TokenRubyBase
+	TokenRubyText
+	TokenRubyEnd
+	TokenSuperscript
+	TokenSubscript
+	TokenKbd
 	TokenStrongBegin
 	TokenStrongEnd
 	TokenEmphasisStrongBegin
@@ -71,15 +87,21 @@ const (
 	TokenEnquoteDoubleEnd
 	TokenEnquoteAngledBegin
 	TokenEnquoteAngledEnd
+	TokenDefinitionListBegin
 	TokenDefinitionTerm
 	TokenDefinitionExplanationBegin
 	TokenDefinitionExplanationEnd
+	TokenDefinitionListEnd
 	TokenHorizontalRule
 	TokenBlockquoteBegin
 	TokenBlockquoteAttrAuthor
 	TokenBlockquoteAttrSource
 	TokenBlockquoteAttrEnd
 	TokenBlockquoteEnd
+	TokenAdmonitionBegin
+	TokenAdmonitionType
+	TokenAdmonitionTitle
+	TokenAdmonitionEnd
 	TokenImageBegin
 	TokenImageAltText
 	TokenImagePath
@@ -89,10 +111,13 @@ const (
 	TokenSidenoteDef
 	TokenSidenoteDefEnd
 	TokenSidenoteContent
+	TokenFootnoteRef
 	TokenLinkify
 	TokenLinkHref
 	TokenLinkRef
 	TokenLinkDef
+	TokenLinkTitle
+	TokenAbbreviationDef
 	TokenLinkableBegin
 	TokenLinkableEnd
 	TokenCodeBlockBegin
@@ -102,18 +127,81 @@ const (
 	TokenAttributeListID
 	TokenAttributeListKey
 	TokenAttributeListEnd
+	TokenListUnorderedBegin
+	TokenListOrderedBegin
+	TokenListItemBegin
+	TokenListItemTask
+	TokenListItemEnd
+	TokenListEnd
+	TokenTableBegin
+	TokenTableRowBegin
+	TokenTableCellBegin
+	TokenTableCellEnd
+	TokenTableRowEnd
+	TokenTableAlignment
+	TokenTableEnd
+	TokenComment
 )
 
 func (t Token) String() string {
-	return fmt.Sprintf("%s:+%d: %s: `%s`", t.Filename, t.Pos, t.Type, t.Text)
+	return fmt.Sprintf("%s: %s: `%s`", t.Span, t.Type, t.Text)
 }
 
 func (t Token) Location() string {
-	return fmt.Sprintf("%s:+%d", t.Filename, t.Pos)
+	return t.Span.String()
 }
 
 func (err LexerError) Error() string {
-	return fmt.Sprintf("%s:+%d: %s", err.Filename, err.Pos, err.Inner)
+	return fmt.Sprintf("%s: %s", err.Span, err.Inner)
+}
+
+func (err LexerError) Unwrap() error {
+	return err.Inner
+}
+
+func (err LexerError) Diagnostic() diagnostic.Diagnostic {
+	d := diagnostic.Diagnostic{
+		Severity: diagnostic.SeverityError,
+		Code:     "syntax",
+		Span:     err.Span,
+		Message:  err.Inner.Error(),
+		Err:      err,
+	}
+	if errors.Is(err.Inner, ErrInternal) {
+		d.Code = "internal"
+		d.Hints = []string{"this is a bug in the lexer, please report it together with the source"}
+	}
+	return d
+}
+
+// Position converts a rune offset into Source to its line and column.
+func (lx *Lexer) Position(offset int) diagnostic.Position {
+	if lx.lines == nil {
+		lx.lines = []int{0}
+		for i, r := range lx.Source {
+			if r == '\n' {
+				lx.lines = append(lx.lines, i+1)
+			}
+		}
+	}
+	line, found := slices.BinarySearch(lx.lines, offset)
+	if !found {
+		line--
+	}
+	return diagnostic.Position{
+		Offset: offset,
+		Line:   line + 1,
+		Column: offset - lx.lines[line] + 1,
+	}
+}
+
+// Span makes the span of the source from start up to end.
+func (lx *Lexer) Span(start, end int) diagnostic.Span {
+	return diagnostic.Span{
+		Filename: lx.Filename,
+		Start:    lx.Position(start),
+		End:      lx.Position(end),
+	}
 }
 
 func New() *Lexer {
@@ -132,6 +220,7 @@ func (lx *Lexer) Tokens() func(func(Token) bool) {
 
 func (lx *Lexer) Clear() {
 	lx.Lexemes = nil
+	lx.Comments = nil
 	lx.Errors = nil
 }
 
@@ -173,7 +262,7 @@ func (lx *Lexer) IsEscape() bool {
 	switch lx.Peek1() {
 	default:
 		return false
-	case '\\', '~', '!', '`', '*', '_', '{', '}', '<', '>', '[', ']', '(', ')', '|', '#', '+', '-', '.', '\n':
+	case '\\', '~', '!', '`', '*', '_', '{', '}', '<', '>', '[', ']', '(', ')', '|', '#', '+', '-', '.', '$', '%', '\n':
 		return true
 	case '&':
 		ok, _ := lx.IsAmpSpecial()
@@ -181,12 +270,33 @@ func (lx *Lexer) IsEscape() bool {
 	}
 }
 
+// IsComment reports whether a %% comment starts at Peek.
+// The %% must start the line or follow whitespace, so that 50%% in prose is
+// just text.
+func (lx *Lexer) IsComment() bool {
+	return lx.Peek(2) == "%%" && (lx.Pos == 0 || unicode.IsSpace(lx.Source[lx.Pos-1]))
+}
+
 type Predicate func() bool
 
+// MaxSectionLevel is the deepest level a section can have (`######`).
+const MaxSectionLevel = 6
+
 var (
 	AmpSpecials      = []string{"&hyphen;", "&dash;", "&ndash;", "&mdash;", "&ldquo;", "&rdquo;", "&prime;", "&Prime;", "&tprime;", "&qprime;", "&bprime;", "&laquo;", "&raquo;", "&nbsp;"}
 	AmpShortSpecials = []string{"---", "--", "...", "…", "~", "\u00A0", "'"} // list longer char sequences first (--- must come before -- and -)
 	AmpAllSpecials   = append(AmpSpecials, AmpShortSpecials...)
+
+	// ampSpecialStarts holds the first character of each of the AmpAllSpecials.
+	ampSpecialStarts = func() string {
+		var sb strings.Builder
+		for _, special := range AmpAllSpecials {
+			if r := []rune(special)[0]; !strings.ContainsRune(sb.String(), r) {
+				sb.WriteRune(r)
+			}
+		}
+		return sb.String()
+	}()
 )
 
 func (lx *Lexer) IsAmpSpecial() (bool, string) {
@@ -201,6 +311,11 @@ func (lx *Lexer) IsAmpSpecial() (bool, string) {
 	return false, ""
 }
 
+func (lx *Lexer) isAmpSpecial() bool {
+	ok, _ := lx.IsAmpSpecial()
+	return ok
+}
+
 func (lx *Lexer) IsParagraphEnder() bool {
 	switch {
 	default:
@@ -209,6 +324,16 @@ func (lx *Lexer) IsParagraphEnder() bool {
 		fallthrough
 	case lx.IsLinkOrSidenoteDefinition():
 		fallthrough
+	case lx.IsListItemOnNextLine():
+		fallthrough
+	case lx.IsAdmonitionOnNextLine():
+		fallthrough
+	case lx.IsDedentOnNextLine():
+		fallthrough
+	case lx.IsAbbreviationDefinitionOnNextLine():
+		fallthrough
+	case lx.IsTableOnNextLine():
+		fallthrough
 	case lx.Peek(3) == "```":
 		fallthrough
 	case lx.Peek(2) == "![":
@@ -225,12 +350,18 @@ func (lx *Lexer) IsParagraphEnder() bool {
 }
 
 func (lx *Lexer) IsTermDefinition() bool {
+	if !lx.IsOnlyWhitespaceBeforeOnLine() {
+		return false
+	}
 	lpos := lx.Pos
 	lcon := lx.Consumed
 	defer func() {
 		lx.Pos = lpos
 		lx.Consumed = lcon
 	}()
+	if lx.Peek(3) == "```" {
+		return false // a code block, whose first line may well start with a colon
+	}
 	lx.NextValids(SpecNonWhitespace)
 	lx.SkipWhitespaceNoNewLine()
 	if lx.Peek1() != '\n' {
@@ -262,6 +393,9 @@ func (lx *Lexer) IsSingleWordSidenote() bool {
 }
 
 func (lx *Lexer) IsLinkOrSidenoteDefinition() bool {
+	if !lx.IsOnlyWhitespaceBeforeOnLine() {
+		return false
+	}
 	lpos := lx.Pos
 	lcon := lx.Consumed
 	defer func() {
@@ -276,7 +410,7 @@ func (lx *Lexer) IsLinkOrSidenoteDefinition() bool {
 	if lx.Peek1() == '^' {
 		lx.SkipNext1()
 	}
-	lx.NextUntilMatch("]")
+	lx.NextUntilSpec(CharInAny("]\n"))
 	if lx.Peek1() != ']' {
 		return false
 	}
@@ -287,6 +421,382 @@ func (lx *Lexer) IsLinkOrSidenoteDefinition() bool {
 	return true
 }
 
+// IsTrailingAttributeList reports whether an attribute list that ends the
+// paragraph starts at Peek.
+// To not mistake text in braces for attributes, the list must start with an
+// #id or .class, or contain a key=value pair.
+func (lx *Lexer) IsTrailingAttributeList() bool {
+	lpos := lx.Pos
+	lcon := lx.Consumed
+	defer func() {
+		lx.Pos = lpos
+		lx.Consumed = lcon
+	}()
+	if lx.Peek1() != '{' {
+		return false
+	}
+	lx.SkipNext1()
+	attrs, ok := lx.NextUntilMatch("}")
+	if !ok || strings.ContainsRune(attrs, '\n') {
+		return false
+	}
+	attrs = strings.TrimSpace(attrs)
+	if !(strings.HasPrefix(attrs, "#") || strings.HasPrefix(attrs, ".") || strings.Contains(attrs, "=")) {
+		return false
+	}
+	lx.SkipNext1()
+	lx.SkipWhitespaceNoNewLine()
+	if lx.IsEOF() {
+		return true
+	}
+	if lx.Peek1() != '\n' {
+		return false
+	}
+	if lx.IsParagraphEnder() {
+		return true
+	}
+	lx.SkipNext1()
+	lx.SkipWhitespaceNoNewLine()
+	return lx.IsEOF() || lx.Peek1() == '\n'
+}
+
+// IsRuby reports whether a ruby annotation like {漢字|かんじ} starts at Peek.
+func (lx *Lexer) IsRuby() bool {
+	lpos := lx.Pos
+	lcon := lx.Consumed
+	defer func() {
+		lx.Pos = lpos
+		lx.Consumed = lcon
+	}()
+	if lx.Peek1() != '{' {
+		return false
+	}
+	lx.SkipNext1()
+	if len(lx.NextValids(SpecRubyBase)) == 0 || lx.Peek1() != '|' {
+		return false
+	}
+	for lx.Peek1() == '|' {
+		lx.SkipNext1()
+		lx.NextValids(SpecRubyText)
+	}
+	return lx.Peek1() == '}'
+}
+
+// IsScript reports whether a superscript or subscript delimited by delim
+// starts at Peek.
+// The script must not be empty and must not contain whitespace, so that a
+// single ~ still makes a non-breaking space.
+// A subscript must also not touch a word on either side, so that chains of
+// non-breaking spaces like 10~km~wide keep their meaning.
+func (lx *Lexer) IsScript(delim rune) bool {
+	lpos := lx.Pos
+	lcon := lx.Consumed
+	defer func() {
+		lx.Pos = lpos
+		lx.Consumed = lcon
+	}()
+	if lx.Peek1() != delim {
+		return false
+	}
+	if delim == '~' && lx.Pos > 0 && isWordRune(lx.Source[lx.Pos-1]) {
+		return false
+	}
+	lx.SkipNext1()
+	script := lx.NextValids(CharNotInSpec{CharInAny(" \u00A0\n\r\v\t" + string(delim))})
+	if len(script) == 0 || lx.Peek1() != delim {
+		return false
+	}
+	lx.SkipNext1()
+	return delim != '~' || lx.IsEOF() || !isWordRune(lx.Peek1())
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// IsKbd reports whether a keyboard key like [[Ctrl]] starts at Peek.
+func (lx *Lexer) IsKbd() bool {
+	lpos := lx.Pos
+	lcon := lx.Consumed
+	defer func() {
+		lx.Pos = lpos
+		lx.Consumed = lcon
+	}()
+	if lx.Peek(2) != "[[" {
+		return false
+	}
+	lx.SkipNext(2)
+	key := lx.NextValids(SpecKbd)
+	return len(strings.TrimSpace(key)) > 0 && lx.Peek(2) == "]]"
+}
+
+// IsAbbreviationDefinition reports whether an abbreviation definition like
+// *[HTML]: HyperText Markup Language starts at Peek.
+func (lx *Lexer) IsAbbreviationDefinition() bool {
+	lpos := lx.Pos
+	lcon := lx.Consumed
+	defer func() {
+		lx.Pos = lpos
+		lx.Consumed = lcon
+	}()
+	if lx.Peek(2) != "*[" {
+		return false
+	}
+	lx.SkipNext(2)
+	abbr := lx.NextValids(SpecKbd)
+	return len(strings.TrimSpace(abbr)) > 0 && lx.Peek(2) == "]:"
+}
+
+func (lx *Lexer) IsAbbreviationDefinitionOnNextLine() bool {
+	lpos := lx.Pos
+	lcon := lx.Consumed
+	defer func() {
+		lx.Pos = lpos
+		lx.Consumed = lcon
+	}()
+	if lx.Peek1() != '\n' {
+		return false
+	}
+	lx.SkipNext1()
+	lx.SkipWhitespaceNoNewLine()
+	return lx.IsAbbreviationDefinition()
+}
+
+// IsListItem reports whether a list item marker followed by a space starts
+// at Peek, see NextListItemMarker.
+func (lx *Lexer) IsListItem() bool {
+	lpos := lx.Pos
+	lcon := lx.Consumed
+	defer func() {
+		lx.Pos = lpos
+		lx.Consumed = lcon
+	}()
+	if !lx.NextListItemMarker() {
+		return false
+	}
+	return lx.Peek1() == ' ' || lx.Peek1() == '\t'
+}
+
+// IsTask reports whether a task checkbox `[ ]`, `[x]` or `[X]` starts at Peek,
+// followed by a space or the end of the line.
+func (lx *Lexer) IsTask() bool {
+	if box := lx.Peek(3); box != "[ ]" && box != "[x]" && box != "[X]" {
+		return false
+	}
+	after := []rune(lx.Peek(4))
+	return len(after) == 3 || after[3] == ' ' || after[3] == '\t' || after[3] == '\n'
+}
+
+// IsOrderedListItem reports whether a numbered list item starts at Peek.
+func (lx *Lexer) IsOrderedListItem() bool {
+	return lx.IsListItem() && SpecNumber.IsValid(lx.Peek1())
+}
+
+// IsListItemOnNextLine reports whether Peek is at the end of a line and the
+// next line starts a list item that ends the paragraph before it.
+// Like in CommonMark, only an ordered list starting at `1.` does, so that a
+// wrapped line starting with a number like `1945.` stays in the paragraph.
+// Inside a list, its next item or one of an enclosing list always does.
+func (lx *Lexer) IsListItemOnNextLine() bool {
+	lpos := lx.Pos
+	lcon := lx.Consumed
+	defer func() {
+		lx.Pos = lpos
+		lx.Consumed = lcon
+	}()
+	if lx.Peek1() != '\n' {
+		return false
+	}
+	lx.SkipNext1()
+	lx.SkipWhitespaceNoNewLine()
+	if !lx.IsListItem() {
+		return false
+	}
+	if len(lx.lists) > 0 && lx.Indentation() <= lx.lists[len(lx.lists)-1] {
+		return true
+	}
+	return !lx.IsOrderedListItem() || lx.Peek(3) == "1. " || lx.Peek(3) == "1.\t"
+}
+
+// IsAdmonition reports whether an admonition starts at Peek, that is `!!!`, `???` or `???+` followed by its type.
+func (lx *Lexer) IsAdmonition() bool {
+	lpos := lx.Pos
+	lcon := lx.Consumed
+	defer func() {
+		lx.Pos = lpos
+		lx.Consumed = lcon
+	}()
+	if lx.NextIfMatch("???") {
+		lx.NextIfMatch("+")
+	} else if !lx.NextIfMatch("!!!") {
+		return false
+	}
+	if lx.Peek1() != ' ' && lx.Peek1() != '\t' {
+		return false
+	}
+	lx.SkipWhitespaceNoNewLine()
+	return SpecAscii.IsValid(lx.Peek1())
+}
+
+// IsAdmonitionOnNextLine reports whether Peek is at the end of a line and the following line starts an admonition.
+func (lx *Lexer) IsAdmonitionOnNextLine() bool {
+	lpos := lx.Pos
+	lcon := lx.Consumed
+	defer func() {
+		lx.Pos = lpos
+		lx.Consumed = lcon
+	}()
+	if lx.Peek1() != '\n' {
+		return false
+	}
+	lx.SkipNext1()
+	lx.SkipWhitespaceNoNewLine()
+	return lx.IsAdmonition()
+}
+
+// IsDedentOnNextLine reports whether Peek is at the end of a line and the next
+// line is indented no deeper than the marker of the innermost admonition being
+// lexed, so that it is no longer part of the admonition's content.
+func (lx *Lexer) IsDedentOnNextLine() bool {
+	if len(lx.admonitions) == 0 || lx.Peek1() != '\n' {
+		return false
+	}
+	lpos := lx.Pos
+	lcon := lx.Consumed
+	defer func() {
+		lx.Pos = lpos
+		lx.Consumed = lcon
+	}()
+	lx.SkipNext1()
+	lx.SkipWhitespaceNoNewLine()
+	if lx.IsEOF() || lx.Peek1() == '\n' {
+		return false // a blank line ends the paragraph anyway
+	}
+	return lx.Indentation() <= lx.admonitions[len(lx.admonitions)-1]
+}
+
+// NextLineIndentation returns the indentation of the next non-blank line,
+// or -1 if there is none.
+func (lx *Lexer) NextLineIndentation() int {
+	lpos := lx.Pos
+	lcon := lx.Consumed
+	defer func() {
+		lx.Pos = lpos
+		lx.Consumed = lcon
+	}()
+	lx.SkipWhitespace()
+	if lx.IsEOF() {
+		return -1
+	}
+	return lx.Indentation()
+}
+
+// NextLineIsListItem reports whether the next non-blank line starts with an
+// item that continues the list of an item starting with marker, that is an
+// item of an ordered list if marker is a digit, or else an item with the same
+// bullet.
+func (lx *Lexer) NextLineIsListItem(marker rune) bool {
+	lpos := lx.Pos
+	lcon := lx.Consumed
+	defer func() {
+		lx.Pos = lpos
+		lx.Consumed = lcon
+	}()
+	lx.SkipWhitespace()
+	if SpecNumber.IsValid(marker) {
+		return lx.IsOrderedListItem()
+	}
+	return lx.IsListItem() && lx.Peek1() == marker
+}
+
+// SkipIndentation skips over at most indent columns of leading whitespace.
+func (lx *Lexer) SkipIndentation(indent int) {
+	for col := 0; col < indent && (lx.Peek1() == ' ' || lx.Peek1() == '\t'); lx.Next1() {
+		if lx.Peek1() == '\t' {
+			col += 4
+		} else {
+			col++
+		}
+	}
+	lx.Skip()
+}
+
+// Indentation returns the width of the whitespace before Peek on its line.
+// A tab counts as four spaces.
+func (lx *Lexer) Indentation() (indent int) {
+	for i := lx.Pos - 1; i >= 0 && lx.Source[i] != '\n'; i-- {
+		if lx.Source[i] == '\t' {
+			indent += 4
+		} else {
+			indent++
+		}
+	}
+	return indent
+}
+
+// IsTable reports whether a table starts at Peek.
+// A table starts with a row (a line starting with `|`), followed by a delimiter row.
+func (lx *Lexer) IsTable() bool {
+	lpos := lx.Pos
+	lcon := lx.Consumed
+	defer func() {
+		lx.Pos = lpos
+		lx.Consumed = lcon
+	}()
+	if lx.Peek1() != '|' {
+		return false
+	}
+	lx.NextUntilMatch("\n")
+	lx.SkipNext1()
+	lx.SkipWhitespaceNoNewLine()
+	return lx.IsTableDelimiterRow()
+}
+
+// IsTableOnNextLine reports whether Peek is at the end of a line and a table starts on the following line.
+func (lx *Lexer) IsTableOnNextLine() bool {
+	lpos := lx.Pos
+	lcon := lx.Consumed
+	defer func() {
+		lx.Pos = lpos
+		lx.Consumed = lcon
+	}()
+	if lx.Peek1() != '\n' {
+		return false
+	}
+	lx.SkipNext1()
+	lx.SkipWhitespaceNoNewLine()
+	return lx.IsTable()
+}
+
+// IsTableDelimiterRow reports whether the line at Peek is a table delimiter row, like
+//
+//	|:-----|:-----:|------:|
+func (lx *Lexer) IsTableDelimiterRow() bool {
+	lpos := lx.Pos
+	lcon := lx.Consumed
+	defer func() {
+		lx.Pos = lpos
+		lx.Consumed = lcon
+	}()
+	if lx.Peek1() != '|' {
+		return false
+	}
+	row, _ := lx.NextUntilMatch("\n")
+	return strings.Contains(row, "-") && strings.Trim(row, "|:- \t") == ""
+}
+
+// SectionLevel returns the number of hashes at Peek.
+func (lx *Lexer) SectionLevel() int {
+	level := 0
+	for _, r := range lx.Peek(MaxSectionLevel + 1) {
+		if r != '#' {
+			break
+		}
+		level++
+	}
+	return level
+}
+
 func (lx *Lexer) IsHorizontalRule() bool {
 	lpos := lx.Pos
 	lcon := lx.Consumed
@@ -326,6 +836,14 @@ func (lx *Lexer) SkipWhitespace() {
 	lx.Skip()
 }
 
+// SkipWhitespaceInBlock is like SkipWhitespace, but stops at a block boundary (see IsBlockBoundary).
+func (lx *Lexer) SkipWhitespaceInBlock() {
+	for !lx.IsEOF() && !lx.IsBlockBoundary() && unicode.IsSpace(lx.Peek1()) {
+		lx.Next1()
+	}
+	lx.Skip()
+}
+
 func (lx *Lexer) SkipWhitespaceNoNewLine() {
 	for !lx.IsEOF() && unicode.IsSpace(lx.Peek1()) && lx.Peek1() != '\n' {
 		lx.Next1()
@@ -411,6 +929,55 @@ func (lx *Lexer) NextUntilMatch(search string) (string, bool) {
 	}
 }
 
+// NextUntilMatchInBlock is like NextUntilMatch, but gives up at a block
+// boundary (see IsBlockBoundary).
+func (lx *Lexer) NextUntilMatchInBlock(search string) (string, bool) {
+	lpos := lx.Pos
+	for !lx.IsEOF() && !lx.IsBlockBoundary() {
+		if lx.MatchAtPos(search) {
+			return string(lx.Source[lpos:lx.Pos]), true
+		}
+		lx.Next1()
+	}
+	return string(lx.Source[lpos:lx.Pos]), false
+}
+
+// IsBlockBoundary reports whether Peek is at the end of a line followed by an
+// empty line (or the end of the source), which always ends the current block.
+// Inline elements never reach past a block boundary, so that an unclosed one
+// is reported only once, and lexing resumes with the next block.
+func (lx *Lexer) IsBlockBoundary() bool {
+	if lx.Peek1() != '\n' {
+		return false
+	}
+	for _, r := range lx.Source[lx.Pos+1:] {
+		switch r {
+		default:
+			return false
+		case ' ', '\t', '\r':
+		case '\n':
+			return true
+		}
+	}
+	return true
+}
+
+// NextListItemMarker advances past a list item marker, one of `-`, `*`, `+`,
+// or a number followed by a dot.
+// Returns false if Peek is not at a list item marker.
+func (lx *Lexer) NextListItemMarker() bool {
+	if lx.Peek1() == '-' || lx.Peek1() == '*' || lx.Peek1() == '+' {
+		lx.Next1()
+		return true
+	}
+	digits := lx.NextValids(SpecNumber)
+	if len(digits) > 0 && lx.Peek1() == '.' {
+		lx.Next1()
+		return true
+	}
+	return false
+}
+
 func (lx *Lexer) NextIfMatch(test string) bool {
 	if !lx.MatchAtPos(test) {
 		return false
@@ -429,11 +996,37 @@ func (lx *Lexer) Emit(tokenType TokenType) {
 		Filename: lx.Filename,
 		Type:     tokenType,
 		Pos:      lx.Consumed,
+		Span:     lx.Span(lx.Consumed, lx.Pos),
 		Text:     string(lx.Source[lx.Consumed:lx.Pos]),
 	})
 	lx.Consumed = lx.Pos
 }
 
+// EmitUnescaped is like Emit, but removes the backslash in front of escaped
+// (ASCII punctuation) characters from the token text.
+func (lx *Lexer) EmitUnescaped(tokenType TokenType) {
+	lx.Emit(tokenType)
+	token := &lx.Lexemes[len(lx.Lexemes)-1]
+	token.Text = unescape(token.Text)
+}
+
+func unescape(s string) string {
+	if !strings.ContainsRune(s, '\\') {
+		return s
+	}
+	var b strings.Builder
+	rs := []rune(s)
+	for i := 0; i < len(rs); i++ {
+		if rs[i] == '\\' && i+1 < len(rs) && strings.ContainsRune(asciiPunctuation, rs[i+1]) {
+			i++
+		}
+		b.WriteRune(rs[i])
+	}
+	return b.String()
+}
+
+const asciiPunctuation = "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
+
 func (lx *Lexer) EmitIfNonEmpty(tokenType TokenType) bool {
 	if lx.Pos > lx.Consumed {
 		lx.Emit(tokenType)
@@ -464,21 +1057,40 @@ func (lx *Lexer) ExpectAndSkip(expected string) bool {
 }
 
 func (lx *Lexer) Error(err error) {
+	// An element left unclosed at a block boundary also leaves all the elements
+	// it is nested in unclosed, only the innermost one is reported.
+	if n := len(lx.Errors); n > 0 && lx.IsBlockBoundary() {
+		if last, ok := lx.Errors[n-1].(LexerError); ok && last.Filename == lx.Filename && last.Pos == lx.Pos {
+			return
+		}
+	}
 	lx.Errors = append(lx.Errors, LexerError{
 		Filename: lx.Filename,
 		Pos:      lx.Pos,
+		Span:     lx.Span(lx.Pos, lx.Pos),
 		Inner:    err,
 	})
 }
 
 // LexSource lexes the passed source and returns the first error that occurred during said lexing, if any.
-func (lx *Lexer) LexSource(filename, source string) error {
+func (lx *Lexer) LexSource(filename, source string) (err error) {
 	// reset lexer state when parsing new file, leave errors though
 	lx.Filename = filename
 	lx.Source = []rune(source)
+	lx.lines = nil
 	lx.Pos = 0
 	lx.Consumed = 0
 	firstSourceErrorIdx := len(lx.Errors)
+	defer func() {
+		// the lexer is confused, which is a bug, but shouldn't crash the build
+		if r := recover(); r != nil {
+			lx.Error(fmt.Errorf("%w: %v", ErrInternal, r))
+			lx.Pos = len(lx.Source)
+			lx.Skip()
+			lx.Emit(TokenEOF)
+			err = lx.Errors[firstSourceErrorIdx]
+		}
+	}()
 	lx.LexMetaOrContent()
 	if len(lx.Errors) > firstSourceErrorIdx {
 		return lx.Errors[firstSourceErrorIdx]
@@ -508,6 +1120,10 @@ var (
 	SpecAttrKey            = CharNotInSpec{CharInAny(" \u00A0\n\r\v\t=}")}
 	SpecImagePath          = CharNotInSpec{CharInAny(" \u00A0\n\r\v\t)")}
 	SpecSingleWordSidenote = CharNotInSpec{CharInAny(" \u00A0\n\r\v\t[(")}
+	SpecKbd                = CharNotInSpec{CharInAny("\n[]")}
+	SpecRubyBase           = CharNotInSpec{CharInAny(" \u00A0\n\r\v\t{|}=")}
+	SpecRubyText           = CharNotInSpec{CharInAny("\n{|}")}
+	SpecAdmonitionTitle    = CharNotInSpec{CharInAny("\"\n")}
 )
 
 func (c CharInRange) IsValid(r rune) bool {
@@ -648,6 +1264,10 @@ func (lx *Lexer) LexMetaValue() {
 			lx.LexAsMultiLineStringOrAmpSpecial()
 			lx.ExpectAndSkip("\n")
 			break
+		} else {
+			// empty value
+			lx.SkipNext1()
+			break
 		}
 	}
 }
@@ -684,141 +1304,92 @@ func (lx *Lexer) LexAsMultiLineStringOrAmpSpecial() {
 	}
 	lx.EmitIfNonEmpty(TokenText)
 }
-
-// LexContent lexes the top level of a markdown document (after the meta block).
-// At this level only section 1, html tags and term, link, and sidenote definitions are allowed.
-func (lx *Lexer) LexContent() {
-	lx.SkipWhitespace()
-	for !lx.IsEOF() {
-		if lx.Peek1() == '#' {
-			lx.LexSection1()
-		} else if lx.Peek1() == '<' {
-			lx.LexHtmlElement(false)
-		} else if lx.Peek1() == '[' {
-			lx.LexLinkOrSidenoteDefinition()
-		} else {
-			// @todo: term definitions
-			lx.Error(errors.New("content must start with section 1, html element, or link or sidenote definition"))
-			lx.NextUntilSpec(CharInAny("#<["))
-			lx.Skip()
-		}
-		lx.SkipWhitespace()
-	}
-	lx.Emit(TokenEOF)
-}
-
-// LexSection1 lexes a top-level section.
-//
-//	# Section 1
-//
-// - TokenSection1Begin "#"
-// - TokenText "Section 1"
-// - TokenSection1Content
-// - <...>
-// - TokenSection1End
-//
-// A section can be given a custom id, as in the following example:
-//
-//	# Some Heading {#custom-id}
-//
-// - TokenSection1Begin "##"
-// - TokenText "Some Heading"
-// - TokenAttributeListBegin
-// - TokenAttributeListID "custom-id"
-// - TokenAttributeListEnd
-// - TokenSection1Content
-// - <...>
-// - TokenSection1End
-func (lx *Lexer) LexSection1() {
-	Assert(lx.Peek1() == '#', "lexer state confused")
-	hashes := lx.NextValids(CharInAny("#"))
-	if len(hashes) != 1 {
-		lx.Error(errors.New("expected section level 1"))
-	}
-	lx.Emit(TokenSection1Begin)
-	lx.ExpectAndSkip(" ")
-	lx.SkipWhitespaceNoNewLine()
-	lx.LexTextUntilSpec(CharInAny("{\n")) // @todo: do we really want to allow all of these text elements inside a title? (wasn't there the same problem for sidenotes?)
-	lx.SkipWhitespaceNoNewLine()
-	if lx.Peek1() == '{' {
-		lx.LexAttributeList()
-	}
-	lx.Emit(TokenSection1Content)
-	lx.LexSection1Content()
-	lx.Emit(TokenSection1End)
-}
-
-// LexSection1Content lexes the contents of a top level section.
-// A section 1 can contain section twos, paragraphs, html elements, horizontal rule, {term,sidenote,link} definitions,
-// code blocks, images, block quotes.
-// A section 1 ends before another section 1 starts.
-func (lx *Lexer) LexSection1Content() {
-	lx.SkipWhitespace()
-	for !lx.IsEOF() {
-		if lx.IsTermDefinition() {
-			lx.LexDefinitionList()
-		} else if lx.IsHorizontalRule() {
-			lx.LexHorizontalRule()
-		} else {
-			lx.SkipWhitespace()
-			if lx.IsEOF() {
-				break
-			}
-			if lx.IsHorizontalRule() {
-				lx.LexHorizontalRule()
-			} else if lx.Peek(3) == "```" {
-				lx.LexCodeBlock()
-			} else if lx.Peek(2) == "##" {
-				lx.LexSection2()
-			} else if lx.Peek(2) == "![" {
-				lx.LexImage()
-			} else if lx.Peek1() == '>' {
-				lx.LexBlockQuotes()
-			} else if lx.Peek1() == '#' {
-				return // this section ends, next section starts
-			} else if lx.Peek1() == '<' && lx.Peek(5) != "<http" { // @todo: do this properly
-				lx.LexHtmlElement(false)
-			} else if lx.Peek1() == '[' {
-				// @fixme: this could also be a paragraph that starts out with a link!
-				lx.LexLinkOrSidenoteDefinition()
-			} else if lx.IsTermDefinition() { // @todo: i don't like this
-				lx.LexDefinitionList()
-			} else {
-				lx.LexParagraph()
+
+// LexContent lexes the top level of a markdown document (after the meta block).
+// At this level only sections, html tags and term, link, and sidenote definitions are allowed.
+func (lx *Lexer) LexContent() {
+	lx.SkipWhitespace()
+	for !lx.IsEOF() {
+		if lx.Peek1() == '#' {
+			lx.LexSection()
+		} else if lx.Peek1() == '<' {
+			lx.LexHtmlElement(false)
+		} else if lx.Peek1() == '[' {
+			lx.LexLinkOrSidenoteDefinition()
+		} else if lx.IsAbbreviationDefinition() {
+			lx.LexAbbreviationDefinition()
+		} else if lx.IsComment() {
+			lx.LexComment()
+		} else {
+			// @todo: term definitions
+			lx.Error(errors.New("content must start with section, html element, or link or sidenote definition"))
+			// resume at the next line that starts with something allowed here
+			for lx.Next1() != 0 && !(lx.IsStartOfLine() && (CharInAny("#<[").IsValid(lx.Peek1()) || lx.IsAbbreviationDefinition() || lx.IsComment())) {
 			}
+			lx.Skip()
 		}
+		lx.SkipWhitespace()
 	}
+	lx.Emit(TokenEOF)
 }
 
-// LexSection2 lexes a second level section.
+// LexSection lexes a section of any level, from `#` (level 1) up to `######` (level 6).
 //
-//	## Section 2
+//	# Section 1
 //
-// - TokenSection2Begin "##"
-// - TokenText "Section 2"
-// - TokenSection2Content
+// - TokenSectionBegin "#"
+// - TokenText "Section 1"
+// - TokenSectionContent
 // - <...>
-// - TokenSection2End
+// - TokenSectionEnd
 //
 // A section can be given a custom id, as in the following example:
 //
 //	## Some Heading {#custom-id}
 //
-// - TokenSection2Begin "##"
+// - TokenSectionBegin "##"
 // - TokenText "Some Heading"
 // - TokenAttributeListBegin
 // - TokenAttributeListID "custom-id"
 // - TokenAttributeListEnd
-// - TokenSection2Content
+// - TokenSectionContent
 // - <...>
-// - TokenSection2End
-func (lx *Lexer) LexSection2() {
-	Assert(lx.Peek(2) == "##", "lexer state confused")
+// - TokenSectionEnd
+//
+// The level of the section is given by the number of hashes in the text of TokenSectionBegin.
+// Sections of a deeper level are nested inside of the current section:
+//
+//	# Section 1
+//	## Section 1.1
+//	### Section 1.1.1
+//	# Section 2
+//
+// - TokenSectionBegin "#"
+// - TokenText "Section 1"
+// - TokenSectionContent
+// - TokenSectionBegin "##"
+// - TokenText "Section 1.1"
+// - TokenSectionContent
+// - TokenSectionBegin "###"
+// - TokenText "Section 1.1.1"
+// - TokenSectionContent
+// - TokenSectionEnd
+// - TokenSectionEnd
+// - TokenSectionEnd
+// - TokenSectionBegin "#"
+// - TokenText "Section 2"
+// - TokenSectionContent
+// - TokenSectionEnd
+//
+// The lexer doesn't care about skipped levels (e.g., a level 3 directly
+// inside of a level 1 section), it is up to the parser to report them.
+func (lx *Lexer) LexSection() {
+	Assert(lx.Peek1() == '#', "lexer state confused")
 	hashes := lx.NextValids(CharInAny("#"))
-	if len(hashes) != 2 {
-		lx.Error(errors.New("expected section level 2"))
+	if len(hashes) > MaxSectionLevel {
+		lx.Error(fmt.Errorf("section level must be at most %d", MaxSectionLevel))
 	}
-	lx.Emit(TokenSection2Begin)
+	lx.Emit(TokenSectionBegin)
 	lx.ExpectAndSkip(" ")
 	lx.SkipWhitespaceNoNewLine()
 	lx.LexTextUntilSpec(CharInAny("{\n")) // @todo: do we really want to allow all of these text elements inside a title? (wasn't there the same problem for sidenotes?)
@@ -826,16 +1397,16 @@ func (lx *Lexer) LexSection2() {
 	if lx.Peek1() == '{' {
 		lx.LexAttributeList()
 	}
-	lx.Emit(TokenSection2Content)
-	lx.LexSection2Content()
-	lx.Emit(TokenSection2End)
+	lx.Emit(TokenSectionContent)
+	lx.LexSectionContent(len(hashes))
+	lx.Emit(TokenSectionEnd)
 }
 
-// LexSection2Content lees the contents of a second level section.
-// A section 2 can contain paragraphs, html elements, horizontal rule, {term,sidenote,link} definitions, code blocks,
-// images, block quotes.
-// A section 2 ends before another section 1 or 2 starts.
-func (lx *Lexer) LexSection2Content() {
+// LexSectionContent lexes the contents of a section of the given level.
+// A section can contain sections of a deeper level, paragraphs, html elements, horizontal rule,
+// {term,sidenote,link} definitions, code blocks, images, block quotes, lists, tables.
+// A section ends before another section of the same or a higher level (fewer hashes) starts.
+func (lx *Lexer) LexSectionContent(level int) {
 	lx.SkipWhitespace()
 	for !lx.IsEOF() {
 		if lx.IsTermDefinition() {
@@ -847,21 +1418,32 @@ func (lx *Lexer) LexSection2Content() {
 			if lx.IsEOF() {
 				break
 			}
-			if lx.IsHorizontalRule() {
+			if lx.IsComment() {
+				lx.LexComment()
+			} else if lx.IsHorizontalRule() {
 				lx.LexHorizontalRule()
 			} else if lx.Peek(3) == "```" {
 				lx.LexCodeBlock()
-			} else if lx.Peek(2) == "##" {
-				return // this section ends, next section starts
 			} else if lx.Peek(2) == "![" {
 				lx.LexImage()
+			} else if lx.IsAbbreviationDefinition() {
+				lx.LexAbbreviationDefinition()
+			} else if lx.IsAdmonition() {
+				lx.LexAdmonition()
+			} else if lx.IsListItem() {
+				lx.LexList()
+			} else if lx.IsTable() {
+				lx.LexTable()
 			} else if lx.Peek1() == '>' {
 				lx.LexBlockQuotes()
 			} else if lx.Peek1() == '#' {
-				return // this section ends, next section starts
+				if lx.SectionLevel() <= level {
+					return // this section ends, next section starts
+				}
+				lx.LexSection()
 			} else if lx.Peek1() == '<' && lx.Peek(5) != "<http" { // @todo: do this properly
 				lx.LexHtmlElement(false)
-			} else if lx.Peek1() == '[' {
+			} else if lx.IsLinkOrSidenoteDefinition() {
 				lx.LexLinkOrSidenoteDefinition()
 			} else if lx.IsTermDefinition() { // @todo: i don't like this
 				lx.LexDefinitionList()
@@ -879,6 +1461,111 @@ func (lx *Lexer) LexParagraph() {
 	lx.Emit(TokenParagraphEnd)
 }
 
+// LexList lexes an ordered or unordered list.
+//
+//	Shopping list:
+//	- First item
+//	- Second item
+//	  continues here.
+//
+//	  Second paragraph of the second item.
+//	  - Nested item
+//	- [ ] Open task
+//	- [x] Finished task
+//
+// - TokenParagraphBegin
+// - TokenText "Shopping list:"
+// - TokenParagraphEnd
+// - TokenListUnorderedBegin
+// - TokenListItemBegin "-"
+// - TokenParagraphBegin
+// - TokenText "First item"
+// - TokenParagraphEnd
+// - TokenListItemEnd
+// - TokenListItemBegin "-"
+// - TokenParagraphBegin
+// - TokenText "Second item\n"
+// - TokenText "continues here."
+// - TokenParagraphEnd
+// - TokenParagraphBegin
+// - TokenText "Second paragraph of the second item."
+// - TokenParagraphEnd
+// - TokenListUnorderedBegin
+// - TokenListItemBegin "-"
+// - TokenParagraphBegin
+// - TokenText "Nested item"
+// - TokenParagraphEnd
+// - TokenListItemEnd
+// - TokenListEnd
+// - TokenListItemEnd
+// - TokenListItemBegin "-"
+// - TokenListItemTask "[ ]"
+// - TokenParagraphBegin
+// - TokenText "Open task"
+// - TokenParagraphEnd
+// - TokenListItemEnd
+// - TokenListItemBegin "-"
+// - TokenListItemTask "[x]"
+// - TokenParagraphBegin
+// - TokenText "Finished task"
+// - TokenParagraphEnd
+// - TokenListItemEnd
+// - TokenListEnd
+//
+// Ordered lists use `1.`, `2.`, ... as markers and begin with
+// TokenListOrderedBegin instead.
+// Everything indented deeper than the marker of an item belongs to the item.
+// The list ends at the first line that is neither indented deeper nor another
+// item of the same kind of list.
+// Like in CommonMark, an item with a different bullet, like `*` after `-`,
+// starts a new list.
+func (lx *Lexer) LexList() {
+	Assert(lx.IsListItem(), "lexer state confused")
+	indent := lx.Indentation()
+	marker := lx.Peek1()
+	lx.lists = append(lx.lists, indent)
+	defer func() { lx.lists = lx.lists[:len(lx.lists)-1] }()
+	ordered := lx.IsOrderedListItem()
+	if ordered {
+		lx.Emit(TokenListOrderedBegin)
+	} else {
+		lx.Emit(TokenListUnorderedBegin)
+	}
+	for {
+		lx.LexListItem(indent)
+		if lx.NextLineIndentation() != indent || !lx.NextLineIsListItem(marker) {
+			break
+		}
+		lx.SkipWhitespace()
+	}
+	lx.Emit(TokenListEnd)
+}
+
+// LexListItem lexes a single item of a list whose markers are indented by
+// indent, see LexList.
+// Besides paragraphs and nested lists, an item can contain any block content,
+// like code blocks, which have the indentation of their fence removed.
+func (lx *Lexer) LexListItem(indent int) {
+	Assert(lx.IsListItem(), "lexer state confused")
+	lx.NextListItemMarker()
+	lx.Emit(TokenListItemBegin)
+	lx.SkipWhitespaceNoNewLine()
+	if lx.IsTask() {
+		lx.Next(3)
+		lx.Emit(TokenListItemTask)
+		lx.SkipWhitespaceNoNewLine()
+	}
+	if lx.Peek1() != '\n' && !lx.IsEOF() {
+		lx.LexParagraph()
+	}
+	for lx.NextLineIndentation() > indent {
+		if !lx.LexBlock() {
+			break // not allowed inside a list item, let the enclosing section deal with it
+		}
+	}
+	lx.Emit(TokenListItemEnd)
+}
+
 // LexCodeBlock lexes a code block.
 //
 //	```
@@ -898,6 +1585,9 @@ func (lx *Lexer) LexParagraph() {
 //	console.log('Hello, 金星')
 //	```
 //
+// An indented code block (inside of an admonition for example) has the indentation of its opening tag removed from
+// each line.
+//
 // The lexer produces the tokens:
 // - TokenCodeBlockBegin "```"
 // - TokenCodeBlockLang "go"
@@ -906,6 +1596,7 @@ func (lx *Lexer) LexParagraph() {
 // - TokenCodeBlockEnd "```"
 func (lx *Lexer) LexCodeBlock() {
 	Assert(lx.Peek(3) == "```", "lexer state confused")
+	indent := lx.Indentation()
 	lx.Next(3)
 	lx.Emit(TokenCodeBlockBegin)
 	lang := lx.NextValids(SpecAscii)
@@ -913,21 +1604,138 @@ func (lx *Lexer) LexCodeBlock() {
 		lx.Emit(TokenCodeBlockLang)
 	}
 	lx.SkipWhitespaceNoNewLine()
-	if lx.Peek1() == '{' {
-		lx.LexAttributeList()
+	if lx.Peek1() == '{' && !lx.LexLineAttributeList() && lx.IsEOF() {
+		// the source ends in the unclosed attribute list, no body to lex
+		lx.Emit(TokenCodeBlockEnd)
+		return
 	}
 	lx.ExpectAndSkip("\n")
-	for lx.Peek(3) != "```" {
+	lx.SkipIndentation(indent)
+	for !lx.IsEOF() && lx.Peek(3) != "```" {
 		lx.NextUntilMatch("\n")
 		//lx.Next1() // @todo: include newline or nah?
 		lx.Emit(TokenText)
 		lx.ExpectAndSkip("\n")
+		lx.SkipIndentation(indent)
 	}
 	lx.Expect("```")
 	lx.Emit(TokenCodeBlockEnd)
 	lx.ExpectAndSkip("\n")
 }
 
+// LexTable lexes a table of the form
+//
+//	| Benchmark | ns/op |
+//	|:----------|------:|
+//	| *Lexer*   | 1200  |
+//	{#lexer-bench caption="Benchmark results"}
+//
+// Every row must start with a `|`, the trailing `|` is optional.
+// The delimiter row following the header row determines the alignment of each column:
+// `:--` is left, `:-:` is center, and `--:` is right aligned.
+// An optional attribute list directly following the last row can be used to
+// give the table an id and a caption.
+//
+// - TokenTableBegin
+// - TokenTableRowBegin
+// - TokenTableCellBegin
+// - TokenText "Benchmark "
+// - TokenTableCellEnd
+// - TokenTableCellBegin
+// - TokenText "ns/op "
+// - TokenTableCellEnd
+// - TokenTableRowEnd
+// - TokenTableAlignment ":----------"
+// - TokenTableAlignment "------:"
+// - TokenTableRowBegin
+// - TokenTableCellBegin
+// - TokenEmphasisBegin "*"
+// - TokenText "Lexer"
+// - TokenEmphasisEnd "*"
+// - TokenText "   "
+// - TokenTableCellEnd
+// - TokenTableCellBegin
+// - TokenText "1200  "
+// - TokenTableCellEnd
+// - TokenTableRowEnd
+// - TokenAttributeListBegin
+// - TokenAttributeListID "lexer-bench"
+// - TokenAttributeListKey "caption"
+// - TokenText "Benchmark results"
+// - TokenAttributeListEnd
+// - TokenTableEnd
+func (lx *Lexer) LexTable() {
+	Assert(lx.IsTable(), "lexer state confused")
+	lx.Emit(TokenTableBegin)
+	lx.LexTableRow()
+	lx.LexTableDelimiterRow()
+	for {
+		lx.SkipWhitespaceNoNewLine()
+		if lx.Peek1() != '|' {
+			break
+		}
+		lx.LexTableRow()
+	}
+	if lx.Peek1() == '{' {
+		lx.LexAttributeList()
+		lx.SkipWhitespaceNoNewLine()
+		if !lx.IsEOF() {
+			lx.ExpectAndSkip("\n")
+		}
+	}
+	lx.Emit(TokenTableEnd)
+}
+
+// LexTableRow lexes a single row of a table.
+// The newline at the end of the row is consumed.
+func (lx *Lexer) LexTableRow() {
+	Assert(lx.Peek1() == '|', "lexer state confused")
+	lx.SkipNext1()
+	lx.Emit(TokenTableRowBegin)
+	for {
+		lx.SkipWhitespaceNoNewLine()
+		if lx.IsEOF() || lx.Peek1() == '\n' {
+			break
+		}
+		lx.Emit(TokenTableCellBegin)
+		lx.LexRichTextUntilPred(func() bool { return lx.Peek1() == '|' || lx.Peek1() == '\n' })
+		lx.Emit(TokenTableCellEnd)
+		if lx.Peek1() == '|' {
+			lx.SkipNext1()
+		}
+	}
+	lx.Emit(TokenTableRowEnd)
+	if !lx.IsEOF() {
+		lx.SkipNext1()
+	}
+}
+
+// LexTableDelimiterRow lexes the delimiter row separating the table header from the body.
+// The newline at the end of the row is consumed.
+func (lx *Lexer) LexTableDelimiterRow() {
+	lx.SkipWhitespaceNoNewLine()
+	Assert(lx.IsTableDelimiterRow(), "lexer state confused")
+	lx.SkipNext1()
+	for {
+		lx.SkipWhitespaceNoNewLine()
+		if lx.IsEOF() || lx.Peek1() == '\n' {
+			break
+		}
+		delim := lx.NextValids(CharInAny(":-"))
+		if !strings.Contains(delim, "-") {
+			lx.Error(errors.New("table delimiter must contain at least one -"))
+		}
+		lx.Emit(TokenTableAlignment)
+		lx.SkipWhitespaceNoNewLine()
+		if lx.Peek1() == '|' {
+			lx.SkipNext1()
+		}
+	}
+	if !lx.IsEOF() {
+		lx.SkipNext1()
+	}
+}
+
 // LexAttributeList lexes an attribute list of the form
 //
 //	{key1=val1 key2 =val2 key3 = val3 key4 = 'with spaces between' key5= key6=val6}
@@ -947,7 +1755,7 @@ func (lx *Lexer) LexCodeBlock() {
 // - TokenText "val6"
 // - TokenAttributeListEnd
 //
-// An attribute list can contain a custom id as the very first element:
+// An attribute list can contain a custom id, usually as the first element:
 //
 //	{#some-id key1=val1 key2=val2}
 //
@@ -958,21 +1766,37 @@ func (lx *Lexer) LexCodeBlock() {
 // - TokenAttributeListKey "key2"
 // - TokenText "val2"
 // - TokenAttributeListEnd
-func (lx *Lexer) LexAttributeList() {
+//
+// An attribute list that is not closed before the next block boundary ends
+// there, LexAttributeList reports whether it was closed.
+func (lx *Lexer) LexAttributeList() bool {
+	return lx.lexAttributeList(lx.IsBlockBoundary, lx.SkipWhitespaceInBlock)
+}
+
+// LexLineAttributeList lexes an attribute list like LexAttributeList, but one
+// that must be closed on the same line, like the attribute list of a code
+// block fence. An unclosed one ends at the end of the line, so that the lines
+// following it are not mistaken for attributes.
+func (lx *Lexer) LexLineAttributeList() bool {
+	return lx.lexAttributeList(func() bool { return lx.Peek1() == '\n' }, lx.SkipWhitespaceNoNewLine)
+}
+
+func (lx *Lexer) lexAttributeList(end Predicate, skipWhitespace func()) bool {
 	Assert(lx.Peek1() == '{', "lexer state confused")
 	lx.Next1()
 	lx.Emit(TokenAttributeListBegin)
-	lx.SkipWhitespace()
-	if lx.Peek1() == '#' {
-		lx.SkipNext1()
-		id := lx.NextValids(SpecAttrVal)
-		if len(id) == 0 {
-			lx.Error(errors.New("must provide id"))
+	skipWhitespace()
+	for !lx.IsEOF() && !end() && lx.Peek1() != '}' {
+		if lx.Peek1() == '#' {
+			lx.SkipNext1()
+			id := lx.NextValids(SpecAttrVal)
+			if len(id) == 0 {
+				lx.Error(errors.New("must provide id"))
+			}
+			lx.Emit(TokenAttributeListID)
+			skipWhitespace()
+			continue
 		}
-		lx.Emit(TokenAttributeListID)
-		lx.SkipWhitespace()
-	}
-	for !lx.IsEOF() && lx.Peek1() != '}' {
 		key := lx.NextValids(SpecAttrKey)
 		if len(key) == 0 {
 			lx.Error(errors.New("must provide a key"))
@@ -983,13 +1807,14 @@ func (lx *Lexer) LexAttributeList() {
 			lx.SkipNext1()
 			lx.SkipWhitespaceNoNewLine()
 			if lx.Peek1() != '}' {
-				lx.LexStringValue()
+				lx.LexStringValue(end)
 			}
 		}
-		lx.SkipWhitespace()
+		skipWhitespace()
 	}
-	lx.Expect("}")
+	closed := lx.Expect("}")
 	lx.Emit(TokenAttributeListEnd)
+	return closed
 }
 
 // LexStringValue lexes a string value that is either a single word like
@@ -1001,24 +1826,21 @@ func (lx *Lexer) LexAttributeList() {
 //	'one or multiple words enclosed in single quotes'
 //
 // or simply empty (the absence of any characters or ”).
+// A quoted value that is not closed ends once end returns true.
 //
 // The lexer produces the token:
 // - TokenText "one or multiple words enclosed in single quotes"
 //
 // No token is produced if the string value is empty.
-func (lx *Lexer) LexStringValue() { // @todo: rename this function, since it is specific to LexAttributeList
-	if lx.Peek1() == '\'' {
-		lx.Next1()
-		lx.Skip()
-		lx.NextUntilMatch("'")
-		lx.EmitIfNonEmpty(TokenText)
-		lx.ExpectAndSkip("'")
-	} else if lx.Peek1() == '"' {
+func (lx *Lexer) LexStringValue(end Predicate) { // @todo: rename this function, since it is specific to LexAttributeList
+	if quote := lx.Peek1(); quote == '\'' || quote == '"' {
 		lx.Next1()
 		lx.Skip()
-		lx.NextUntilMatch("\"")
+		for !lx.IsEOF() && !end() && lx.Peek1() != quote {
+			lx.Next1()
+		}
 		lx.EmitIfNonEmpty(TokenText)
-		lx.ExpectAndSkip("\"")
+		lx.ExpectAndSkip(string(quote))
 	} else {
 		lx.NextValids(SpecAttrVal)
 		lx.EmitIfNonEmpty(TokenText)
@@ -1052,7 +1874,7 @@ func (lx *Lexer) LexSingleWordSidenote() {
 	lx.Emit(TokenText)
 	if lx.Peek(2) == "[^" {
 		lx.SkipNext(2)
-		lx.NextUntilMatch("]")
+		lx.NextUntilMatchInBlock("]")
 		lx.Emit(TokenSidenoteRef)
 		lx.ExpectAndSkip("]")
 	} else if lx.Peek(2) == "(^" {
@@ -1066,6 +1888,22 @@ func (lx *Lexer) LexSingleWordSidenote() {
 	lx.Emit(TokenLinkableEnd)
 }
 
+// LexFootnoteRef lexes a reference to a footnote.
+// Unlike a sidenote, the reference is not attached to a word.
+//
+//	Cited from the original paper [^1].
+//
+// - TokenText "Cited from the original paper "
+// - TokenFootnoteRef "1"
+// - TokenText "."
+func (lx *Lexer) LexFootnoteRef() {
+	Assert(lx.Peek(2) == "[^", "lexer state confused")
+	lx.SkipNext(2)
+	lx.NextUntilMatchInBlock("]")
+	lx.Emit(TokenFootnoteRef)
+	lx.ExpectAndSkip("]")
+}
+
 // LexLinkOrSidenote lexes the following elements:
 //
 //	[Link Text](https://example.com)
@@ -1075,6 +1913,16 @@ func (lx *Lexer) LexSingleWordSidenote() {
 // - TokenLinkHref "https://example.com"
 // - TokenLinkableEnd
 //
+// The href may be followed by a title, see LexLinkDestination.
+//
+//	[Link Text](https://example.com "Title")
+//
+// - TokenLinkableBegin "["
+// - TokenText "Link Text"
+// - TokenLinkHref "https://example.com"
+// - TokenLinkTitle "Title"
+// - TokenLinkableEnd
+//
 //	[Link Text][0]
 //
 // - TokenLinkableBegin "["
@@ -1098,6 +1946,19 @@ func (lx *Lexer) LexSingleWordSidenote() {
 // - TokenLinkHref ""
 // - TokenLinkableEnd
 //
+// Followed by an attribute list it makes a <span> instead
+//
+//	[Span Text]{.class lang=ja}
+//
+// - TokenLinkableBegin "["
+// - TokenText "Span Text"
+// - TokenAttributeListBegin
+// - TokenAttributeListKey ".class"
+// - TokenAttributeListKey "lang"
+// - TokenText "ja"
+// - TokenAttributeListEnd
+// - TokenLinkableEnd
+//
 // A bit exotic, but also allowed
 //
 //	[Sidenote Text](^Sidenote content)
@@ -1116,13 +1977,13 @@ func (lx *Lexer) LexLinkOrSidenote() {
 	if lx.Peek(2) == "[^" {
 		// reference style sidenote
 		lx.SkipNext(2)
-		lx.NextUntilMatch("]")
+		lx.NextUntilMatchInBlock("]")
 		lx.Emit(TokenSidenoteRef)
 		lx.ExpectAndSkip("]")
 	} else if lx.Peek1() == '[' {
 		// reference style link
 		lx.SkipNext1()
-		lx.NextUntilMatch("]")
+		lx.NextUntilMatchInBlock("]")
 		lx.Emit(TokenLinkRef)
 		lx.ExpectAndSkip("]")
 	} else if lx.Peek(2) == "(^" { // @todo: good idea to make my own MD extension?
@@ -1134,9 +1995,11 @@ func (lx *Lexer) LexLinkOrSidenote() {
 	} else if lx.Peek1() == '(' {
 		// (normal) link
 		lx.SkipNext1()
-		lx.NextUntilMatch(")")
-		lx.Emit(TokenLinkHref)
-		lx.ExpectAndSkip(")")
+		lx.LexLinkDestination()
+	} else if lx.Peek1() == '{' {
+		// span with an attribute list
+		lx.Skip()
+		lx.LexAttributeList()
 	} else {
 		// not an error, it's just an link with an empty href
 		lx.Skip()
@@ -1146,72 +2009,230 @@ func (lx *Lexer) LexLinkOrSidenote() {
 	lx.Emit(TokenLinkableEnd)
 }
 
+// LexLinkDestination lexes the href and optional title of a link, up to and
+// including the closing parenthesis.
+//
+// The href can contain balanced parentheses, and escaped ones:
+//
+//	(https://en.wikipedia.org/wiki/Go_(programming_language))
+//	(https://en.wikipedia.org/wiki/Emoticon_\(\))
+//
+// An href enclosed in angle brackets can also contain spaces:
+//
+//	(</files/my notes.pdf>)
+//
+// The title is enclosed in double or single quotes:
+//
+//	(https://example.com "Title") or (https://example.com 'Title')
+//
+// - TokenLinkHref "https://example.com"
+// - TokenLinkTitle "Title"
+//
+// A title must be closed within its paragraph. If it isn't, the link ends
+// in front of the title, and the rest of the paragraph is lexed as text.
+func (lx *Lexer) LexLinkDestination() {
+	lx.SkipWhitespaceNoNewLine()
+	if lx.Peek1() == '<' {
+		lx.SkipNext1()
+		for !lx.IsEOF() && lx.Peek1() != '>' && lx.Peek1() != '\n' {
+			if lx.Peek1() == '\\' {
+				lx.Next1()
+			}
+			lx.Next1()
+		}
+		lx.EmitUnescaped(TokenLinkHref)
+		lx.ExpectAndSkip(">")
+	} else {
+		depth := 0
+	href:
+		for !lx.IsEOF() && SpecNonWhitespace.IsValid(lx.Peek1()) {
+			switch lx.Peek1() {
+			case '\\':
+				lx.Next1()
+			case '(':
+				depth++
+			case ')':
+				if depth == 0 {
+					break href
+				}
+				depth--
+			}
+			lx.Next1()
+		}
+		lx.EmitUnescaped(TokenLinkHref)
+	}
+	lx.SkipWhitespaceNoNewLine()
+	if quote := lx.Peek1(); quote == '"' || quote == '\'' {
+		open := lx.Pos
+		lx.SkipNext1()
+		for !lx.IsEOF() && !lx.IsBlockBoundary() && lx.Peek1() != quote {
+			if lx.Peek1() == '\\' {
+				lx.Next1()
+			}
+			lx.Next1()
+		}
+		if lx.Peek1() != quote {
+			// report the title at its opening quote, instead of the end of the
+			// paragraph, and lex the rest of the paragraph as text
+			lx.ResetToPos(open)
+			lx.Error(fmt.Errorf("link title is not closed, expected: `%c`", quote))
+			lx.SkipNext1()
+			return
+		}
+		lx.EmitUnescaped(TokenLinkTitle)
+		lx.ExpectAndSkip(string(quote))
+		lx.SkipWhitespaceNoNewLine()
+	}
+	lx.ExpectAndSkip(")")
+}
+
 // LexText lexes text elements, namely:
 // - strings
 // - <https://example.com/> form links
 // - *emphasis*, **strong**, ***emphasis strong***
 // - _emphasis_, __strong__, ___emphasis strong___
 // - &...; specials and ~ (nbsp), -- (en dash), --- (em dash), - (hyphen)
-// - ~~strikethrough~~ and ~strikethrough~
+// - ~~strikethrough~~
+// - ^superscript^, ~subscript~ and [[Kbd]] keys
 // - `mono spaced text`
-// - "enquote" and 'enquote' and <<enquote>>
+// - $inline math$ and $$display math$$
+// - "enquote" (also TeX style), `enquote' and <<enquote>>
+// - {漢字|かん|じ} ruby annotations
+// - %% comments, which are skipped
+// - word[^sidenote] and [^footnote] references
+// - [spans]{.with attributes}
 // - take care of escaped syntax \<>
 //
 // LexText stops lexing once the string at Peek is a syntactic construct that
 // denotes a content (non-text) element.
+//
+// An attribute list at the very end of the paragraph applies to the paragraph
+// itself:
+//
+//	A paragraph with a custom id. {#intro .lead}
+//
+// - TokenText "A paragraph with a custom id. "
+// - TokenAttributeListBegin
+// - TokenAttributeListID "intro"
+// - TokenAttributeListKey ".lead"
+// - TokenAttributeListEnd
 func (lx *Lexer) LexText() {
 	for !lx.IsEOF() && !lx.IsParagraphEnder() {
-		if ok, _ := lx.IsAmpSpecial(); ok {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexAmpSpecial()
-		} else if lx.IsSingleWordSidenote() {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexSingleWordSidenote()
-		} else if lx.Peek(3) == "***" || lx.Peek(3) == "___" {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexEmphasisStrong()
-		} else if lx.Peek(2) == "**" || lx.Peek(2) == "__" {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexStrong()
-		} else if lx.Peek(2) == "<<" {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexEnquoteAngled()
-		} else if lx.Peek(2) == "~~" {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexStrikethrough()
-		} else if lx.Peek(2) == "==" {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexMarker()
-		} else if lx.Peek1() == '*' || lx.Peek1() == '_' {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexEmphasis()
-		} else if lx.Peek1() == '<' {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexLinkifyOrHtmlElementInline()
-		} else if lx.Peek1() == '`' {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexMonoOrEnquoteSingle()
-		} else if lx.Peek1() == '"' {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexEnquoteDouble()
-		} else if lx.Peek1() == '[' {
+		if lx.LexInline(InlineParagraph) {
+			continue
+		}
+		if lx.Peek1() == '{' && lx.IsTrailingAttributeList() {
 			lx.EmitIfNonEmpty(TokenText)
-			lx.LexLinkOrSidenote()
-		} else if lx.IsEscape() {
+			lx.LexAttributeList()
+			lx.SkipWhitespaceNoNewLine()
+			lx.Skip()
+			return
+		}
+		lx.NextText()
+	}
+	lx.EmitIfNonEmpty(TokenText)
+}
+
+// InlineMode selects which of the inline elements that depend on their
+// surrounding LexInline lexes.
+type InlineMode int
+
+const (
+	// InlinePlain lexes no links or sidenotes, only footnote references, used in titles, attributions
+	// and emphasis.
+	InlinePlain InlineMode = iota
+	// InlineRich also lexes [links](...), [spans]{...} and [sidenotes][^...].
+	InlineRich
+	// InlineParagraph also lexes word[^sidenote] references and inline html
+	// elements.
+	InlineParagraph
+)
+
+// LexInline lexes the inline element at Peek, if there is one, and reports
+// whether it did. The text in front of the element is emitted first.
+//
+// All the text loops dispatch through LexInline, so that a new inline element
+// only has to be added here.
+func (lx *Lexer) LexInline(mode InlineMode) bool {
+	var lex func()
+	switch {
+	case lx.IsComment():
+		if lx.Peek(3) != "%%{" {
+			// a comment to the end of the line takes the spaces in front of it
+			// along, so that they don't end up at the end of the line
+			pos := lx.Pos
+			for lx.Pos > lx.Consumed && (lx.Source[lx.Pos-1] == ' ' || lx.Source[lx.Pos-1] == '\t') {
+				lx.Pos--
+			}
 			lx.EmitIfNonEmpty(TokenText)
-			lx.LexEscape()
-		} else {
-			lx.Next1()
+			lx.ResetToPos(pos)
+			lx.Skip()
 		}
+		lex = lx.LexComment
+	case lx.Peek1() == '~' && lx.IsScript('~'):
+		lex = lx.LexSubscript
+	case lx.Peek1() == '^' && lx.IsScript('^'):
+		lex = lx.LexSuperscript
+	case lx.Peek(2) == "[[" && lx.IsKbd():
+		lex = lx.LexKbd
+	case strings.ContainsRune(ampSpecialStarts, lx.Peek1()) && lx.isAmpSpecial():
+		lex = func() { lx.LexAmpSpecial() }
+	case lx.Peek(2) == "[^":
+		lex = lx.LexFootnoteRef
+	case mode == InlineParagraph && lx.IsSingleWordSidenote():
+		lex = lx.LexSingleWordSidenote
+	case lx.Peek(3) == "***" || lx.Peek(3) == "___":
+		lex = lx.LexEmphasisStrong
+	case lx.Peek(2) == "**" || lx.Peek(2) == "__":
+		lex = lx.LexStrong
+	case lx.Peek(2) == "<<":
+		lex = lx.LexEnquoteAngled
+	case lx.Peek(2) == "~~":
+		lex = lx.LexStrikethrough
+	case lx.Peek(2) == "==":
+		lex = lx.LexMarker
+	case lx.Peek1() == '{' && lx.IsRuby():
+		lex = lx.LexRuby
+	case lx.Peek1() == '*' || lx.Peek1() == '_':
+		lex = lx.LexEmphasis
+	case lx.Peek1() == '<' && mode == InlineParagraph:
+		lex = lx.LexLinkifyOrHtmlElementInline
+	case lx.Peek1() == '<':
+		lex = lx.LexLinkify
+	case lx.Peek1() == '`':
+		lex = lx.LexMonoOrEnquoteSingle
+	case lx.Peek1() == '$' && lx.IsMath() > 0:
+		lex = lx.LexMath
+	case lx.Peek1() == '"':
+		lex = lx.LexEnquoteDouble
+	case lx.Peek1() == '[' && mode != InlinePlain:
+		lex = lx.LexLinkOrSidenote
+	case lx.IsEscape():
+		lex = lx.LexEscape
+	default:
+		return false
 	}
 	lx.EmitIfNonEmpty(TokenText)
+	lex()
+	return true
+}
+
+// NextText advances past a rune of plain text.
+// The indentation of a wrapped line is left out of the text, so that the lines
+// of a list item or admonition don't keep the indentation of their block.
+func (lx *Lexer) NextText() {
+	lx.Next1()
+	if lx.Source[lx.Pos-1] == '\n' && (lx.Peek1() == ' ' || lx.Peek1() == '\t') {
+		lx.Emit(TokenText)
+		lx.SkipWhitespaceNoNewLine()
+	}
 }
 
 func (lx *Lexer) LexEscape() {
 	Assert(lx.Peek1() == '\\' && lx.IsEscape(), "lexer state confused")
 	lx.SkipNext1()
 	switch lx.Peek1() {
-	case '\\', '~', '!', '`', '*', '_', '{', '}', '<', '>', '[', ']', '(', ')', '|', '#', '+', '-', '.', '&':
+	case '\\', '~', '!', '`', '*', '_', '{', '}', '<', '>', '[', ']', '(', ')', '|', '#', '+', '-', '.', '&', '$', '%':
 		lx.Next1()
 		lx.Emit(TokenText)
 	case '\n':
@@ -1221,167 +2242,129 @@ func (lx *Lexer) LexEscape() {
 	}
 }
 
-// LexTextUntil lexes text elements, namely:
-// - strings
-// - <https://example.com/> form links
-// - [link text](href)
-// - *emphasis*, **strong**, ***emphasis strong***
-// - _emphasis_, __strong__, ___emphasis strong___
-// - &...; specials and ~ (nbsp), -- (en dash), --- (em dash), - (hyphen)
-// - ~~strikethrough~~ and ~strikethrough~
-// - `mono spaced text`
-// - "enquote" and 'enquote' and <<enquote>>
-// - take care of escaped syntax \<>
+// LexComment skips over a line comment or a block comment.
+// Comments never show up in the lexemes, they are only recorded in Comments.
+// A comment taking up a whole line also removes that line, so that it doesn't
+// split the surrounding paragraph.
 //
-// LexTextUntil stops lexing once match matches at Peek.
-func (lx *Lexer) LexTextUntil(match string) {
-	for !lx.IsEOF() && !lx.MatchAtPos(match) {
-		if ok, _ := lx.IsAmpSpecial(); ok {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexAmpSpecial()
-		} else if lx.Peek(3) == "***" || lx.Peek(3) == "___" {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexEmphasisStrong()
-		} else if lx.Peek(2) == "**" || lx.Peek(2) == "__" {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexStrong()
-		} else if lx.Peek(2) == "<<" {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexEnquoteAngled()
-		} else if lx.Peek(2) == "~~" {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexStrikethrough()
-		} else if lx.Peek(2) == "==" {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexMarker()
-		} else if lx.Peek1() == '*' || lx.Peek1() == '_' {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexEmphasis()
-		} else if lx.Peek1() == '<' {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexLinkify()
-		} else if lx.Peek1() == '`' {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexMonoOrEnquoteSingle()
-		} else if lx.Peek1() == '"' {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexEnquoteDouble()
-		} else if lx.Peek1() == '[' {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexLinkOrSidenote()
-		} else if lx.IsEscape() {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexEscape()
+//	%% line comment, until the end of the line
+//	%%{
+//	block comment, until the closing
+//	}%%
+//
+// - TokenComment "line comment, until the end of the line"
+// - TokenComment "block comment, until the closing"
+func (lx *Lexer) LexComment() {
+	Assert(lx.IsComment(), "lexer state confused")
+	wholeLine := lx.IsOnlyWhitespaceBeforeOnLine()
+	startPos := lx.Pos
+	lx.SkipNext(2)
+	commentPos := lx.Pos
+	var text string
+	if lx.Peek1() == '{' {
+		lx.SkipNext1()
+		var terminated bool
+		text, terminated = lx.NextUntilMatch("}%%")
+		if terminated {
+			lx.SkipNext(3)
 		} else {
-			lx.Next1()
+			lx.Error(errors.New("unterminated block comment"))
+			text = string(lx.Source[commentPos+1:])
+			lx.Pos = len(lx.Source)
+			lx.Skip()
+		}
+	} else {
+		text, _ = lx.NextUntilMatch("\n")
+		if !lx.MatchAtPos("\n") {
+			text = string(lx.Source[commentPos:])
+			lx.Pos = len(lx.Source)
+		}
+		lx.Skip()
+	}
+	if wholeLine && lx.Peek1() == '\n' && lx.Peek(2) != "\n\n" {
+		lx.SkipNext1()
+	}
+	lx.Comments = append(lx.Comments, Token{
+		Type:     TokenComment,
+		Filename: lx.Filename,
+		Pos:      startPos,
+		Span:     lx.Span(startPos, lx.Pos),
+		Text:     strings.TrimSpace(text),
+	})
+}
+
+// IsOnlyWhitespaceBeforeOnLine reports whether there is nothing but spaces
+// and tabs between the start of the line and the current position.
+func (lx *Lexer) IsOnlyWhitespaceBeforeOnLine() bool {
+	for i := lx.Pos - 1; i >= 0 && lx.Source[i] != '\n'; i-- {
+		if lx.Source[i] != ' ' && lx.Source[i] != '\t' {
+			return false
 		}
 	}
-	lx.EmitIfNonEmpty(TokenText)
+	return true
 }
 
-// LexTextUntilSpec lexes text elements, namely:
+// LexTextUntil lexes text elements, namely:
 // - strings
 // - <https://example.com/> form links
+// - [link text](href)
 // - *emphasis*, **strong**, ***emphasis strong***
 // - _emphasis_, __strong__, ___emphasis strong___
 // - &...; specials and ~ (nbsp), -- (en dash), --- (em dash), - (hyphen)
-// - ~~strikethrough~~ and ~strikethrough~
+// - ~~strikethrough~~
+// - ^superscript^, ~subscript~ and [[Kbd]] keys
 // - `mono spaced text`
-// - "enquote" and 'enquote' and <<enquote>>
+// - $inline math$ and $$display math$$
+// - "enquote" (also TeX style), `enquote' and <<enquote>>
+// - {漢字|かん|じ} ruby annotations
+// - %% comments, which are skipped
+// - [^footnote] references
 // - take care of escaped syntax \<>
 //
-// LexTextUntilSpec stops lexing once the spec matches at Peek.
-func (lx *Lexer) LexTextUntilSpec(spec CharSpec) {
-	for !lx.IsEOF() && !spec.IsValid(lx.Peek1()) {
-		if ok, _ := lx.IsAmpSpecial(); ok {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexAmpSpecial()
-		} else if lx.Peek(3) == "***" || lx.Peek(3) == "___" {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexEmphasisStrong()
-		} else if lx.Peek(2) == "**" || lx.Peek(2) == "__" {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexStrong()
-		} else if lx.Peek(2) == "<<" {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexEnquoteAngled()
-		} else if lx.Peek(2) == "~~" {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexStrikethrough()
-		} else if lx.Peek(2) == "==" {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexMarker()
-		} else if lx.Peek1() == '*' || lx.Peek1() == '_' {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexEmphasis()
-		} else if lx.Peek1() == '<' {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexLinkify()
-		} else if lx.Peek1() == '`' {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexMonoOrEnquoteSingle()
-		} else if lx.Peek1() == '"' {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexEnquoteDouble()
-		} else if lx.IsEscape() {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexEscape()
-		} else {
-			lx.Next1()
-		}
-	}
-	lx.EmitIfNonEmpty(TokenText)
+// LexTextUntil stops lexing once match matches at Peek, or at a block boundary.
+func (lx *Lexer) LexTextUntil(match string) {
+	lx.LexRichTextUntilPred(func() bool { return lx.MatchAtPos(match) })
+}
+
+// LexRichTextUntilPred lexes the same text elements as LexTextUntil, links and
+// footnote references included, but stops lexing when the predicate returns
+// true, or at a block boundary.
+func (lx *Lexer) LexRichTextUntilPred(pred Predicate) {
+	lx.lexTextUntilPred(InlineRich, pred)
 }
 
-// LexTextUntilPred lexes text elements, namely:
+// LexTextUntilSpec lexes text elements, namely:
 // - strings
 // - <https://example.com/> form links
 // - *emphasis*, **strong**, ***emphasis strong***
 // - _emphasis_, __strong__, ___emphasis strong___
 // - &...; specials and ~ (nbsp), -- (en dash), --- (em dash), - (hyphen)
-// - ~~strikethrough~~ and ~strikethrough~
+// - ~~strikethrough~~
+// - ^superscript^, ~subscript~ and [[Kbd]] keys
 // - `mono spaced text`
-// - "enquote" and 'enquote' and <<enquote>>
+// - $inline math$ and $$display math$$
+// - "enquote" (also TeX style), `enquote' and <<enquote>>
+// - {漢字|かん|じ} ruby annotations
+// - %% comments, which are skipped
+// - [^footnote] references
 // - take care of escaped syntax \<>
 //
-// LexTextUntilPred stops lexing when the predicate returns true.
+// LexTextUntilSpec stops lexing once the spec matches at Peek, or at a block
+// boundary.
+func (lx *Lexer) LexTextUntilSpec(spec CharSpec) {
+	lx.lexTextUntilPred(InlinePlain, func() bool { return spec.IsValid(lx.Peek1()) })
+}
+
+// LexTextUntilPred lexes the same text elements as LexTextUntilSpec, but stops
+// lexing when the predicate returns true, or at a block boundary.
 func (lx *Lexer) LexTextUntilPred(pred Predicate) {
-	for !lx.IsEOF() && !pred() {
-		if ok, _ := lx.IsAmpSpecial(); ok {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexAmpSpecial()
-		} else if lx.Peek(3) == "***" || lx.Peek(3) == "___" {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexEmphasisStrong()
-		} else if lx.Peek(2) == "**" || lx.Peek(2) == "__" {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexStrong()
-		} else if lx.Peek(2) == "<<" {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexEnquoteAngled()
-		} else if lx.Peek(2) == "~~" {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexStrikethrough()
-		} else if lx.Peek(2) == "==" {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexMarker()
-		} else if lx.Peek1() == '*' || lx.Peek1() == '_' {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexEmphasis()
-		} else if lx.Peek1() == '<' {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexLinkify()
-		} else if lx.Peek1() == '`' {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexMonoOrEnquoteSingle()
-		} else if lx.Peek1() == '"' {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexEnquoteDouble()
-		} else if lx.IsEscape() {
-			lx.EmitIfNonEmpty(TokenText)
-			lx.LexEscape()
-		} else {
-			lx.Next1()
+	lx.lexTextUntilPred(InlinePlain, pred)
+}
+
+func (lx *Lexer) lexTextUntilPred(mode InlineMode, pred Predicate) {
+	for !lx.IsEOF() && !lx.IsBlockBoundary() && !pred() {
+		if !lx.LexInline(mode) {
+			lx.NextText()
 		}
 	}
 	lx.EmitIfNonEmpty(TokenText)
@@ -1419,6 +2402,23 @@ func (lx *Lexer) LexLinkify() {
 // - TokenSidenoteDef "0"
 // - TokenText "This is the sidenote content."
 // - TokenSidenoteDefEnd
+//
+// The same definition is used for footnotes. A footnote can have more
+// paragraphs, these are indented by at least four spaces (or a tab):
+//
+//	[^1]: First paragraph of the footnote.
+//
+//	    Second paragraph of the footnote.
+//
+// - TokenSidenoteDef "1"
+// - TokenText "First paragraph of the footnote."
+// - TokenParagraphBegin
+// - TokenText "Second paragraph of the footnote."
+// - TokenParagraphEnd
+// - TokenSidenoteDefEnd
+//
+// Only footnotes can make use of the additional paragraphs, sidenotes are
+// limited to the first one.
 func (lx *Lexer) LexLinkOrSidenoteDefinition() {
 	Assert(lx.Peek1() == '[', "lexer state confused")
 	lx.SkipNext1()
@@ -1431,6 +2431,13 @@ func (lx *Lexer) LexLinkOrSidenoteDefinition() {
 		lx.SkipWhitespaceNoNewLine()
 		lx.LexTextUntil("\n")
 		lx.ExpectAndSkip("\n")
+		for lx.NextLineIndentation() >= 4 {
+			lx.SkipWhitespace()
+			if lx.IsParagraphEnder() {
+				break // not allowed inside a footnote, let the enclosing section deal with it
+			}
+			lx.LexParagraph()
+		}
 		lx.Emit(TokenSidenoteDefEnd)
 	} else {
 		// link definition
@@ -1460,21 +2467,24 @@ func (lx *Lexer) LexLinkOrSidenoteDefinition() {
 // - TokenImagePath "/path/to/image"
 // - TokenImageTitle "Optional Image Title"
 // - TokenImageEnd
+//
+// The image can be followed by an attribute list, see LexAttributeList.
+//
+//	![Alt Text](/path/to/image){#some-id}
 func (lx *Lexer) LexImage() {
 	Assert(lx.Peek(2) == "![", "lexer state confused")
 	lx.Next(2)
 	lx.Emit(TokenImageBegin)
-	lx.NextUntilMatch("]")
+	lx.NextUntilMatchInBlock("]")
 	lx.Emit(TokenImageAltText)
-	lx.ExpectAndSkip("]")
-	if lx.Expect("(") {
+	if lx.ExpectAndSkip("]") && lx.Expect("(") {
 		lx.SkipWhitespaceNoNewLine()
 		if lx.Peek1() == '\'' {
-			lx.NextUntilMatch("'")
+			lx.NextUntilMatchInBlock("'")
 			lx.Emit(TokenImagePath)
 			lx.ExpectAndSkip("'")
 		} else if lx.Peek1() == '"' {
-			lx.NextUntilMatch("\"")
+			lx.NextUntilMatchInBlock("\"")
 			lx.Emit(TokenImagePath)
 			lx.ExpectAndSkip("\"")
 		} else {
@@ -1485,12 +2495,15 @@ func (lx *Lexer) LexImage() {
 		if lx.Peek1() == '"' {
 			lx.Next1()
 			lx.Skip()
-			lx.NextUntilMatch(`"`)
+			lx.NextUntilMatchInBlock(`"`)
 			lx.Emit(TokenImageTitle)
 			lx.ExpectAndSkip(`"`)
 		}
 		lx.SkipWhitespaceNoNewLine()
 		lx.ExpectAndSkip(`)`)
+		if lx.Peek1() == '{' {
+			lx.LexAttributeList()
+		}
 	}
 	lx.Emit(TokenImageEnd)
 }
@@ -1500,63 +2513,225 @@ func (lx *Lexer) LexImage() {
 //	> Elea acta est.
 //	> -- Author, Source
 //
+// With the `>` (and one space after it) removed from each line, the content of a block quote may be any block
+// content (see LexBlock), including nested block quotes.
+// Empty lines (only a `>`) separate paragraphs.
+// The optional attribution on the last line ends the block quote.
+//
 // - TokenBlockquoteBegin
-// - TokenText "Elea acta est."
+// - TokenParagraphBegin
+// - TokenText "Elea acta est.\n"
+// - TokenParagraphEnd
 // - TokenBlockquoteAttrAuthor
 // - TokenText "Author"
 // - TokenBlockquoteAttrSource
 // - TokenText "Source"
 // - TokenBlockquoteAttrEnd
 // - TokenBlockquoteEnd
-//
-// @todo: nested block quotes
 func (lx *Lexer) LexBlockQuotes() {
 	Assert(lx.Peek1() == '>', "lexer state confused")
 	lx.Emit(TokenBlockquoteBegin)
-	for !lx.IsEOF() && lx.Peek1() == '>' {
+	var (
+		content []rune
+		offsets []int // position in Source of each rune in content
+	)
+	for !lx.IsEOF() && lx.Peek1() == '>' && !lx.IsBlockquoteAttribution() {
+		lx.Next1()
+		if lx.Peek1() == ' ' {
+			lx.Next1()
+		}
+		for !lx.IsEOF() {
+			offsets = append(offsets, lx.Pos)
+			content = append(content, lx.Next1())
+			if content[len(content)-1] == '\n' {
+				break
+			}
+		}
+		lx.Skip()
+		lx.SkipWhitespaceNoNewLine()
+	}
+	offsets = append(offsets, lx.Pos)
+	lx.LexEmbedded(content, offsets, (*Lexer).LexBlocks)
+	if lx.IsBlockquoteAttribution() {
 		lx.SkipNext1()
 		lx.SkipWhitespaceNoNewLine()
-		if lx.Peek(2) == "--" {
-			lx.SkipNext(2)
-			lx.Emit(TokenBlockquoteAttrAuthor)
+		lx.SkipNext(2)
+		lx.Emit(TokenBlockquoteAttrAuthor)
+		lx.SkipWhitespaceNoNewLine()
+		lx.LexTextUntilSpec(CharInAny(",\n"))
+		if lx.Peek1() == ',' {
+			lx.SkipNext1()
 			lx.SkipWhitespaceNoNewLine()
-			lx.LexTextUntilSpec(CharInAny(",\n")) // @todo: actually, would be better to do LexParagraph until -- (attribution)
-			if lx.Peek1() == ',' {
-				lx.SkipNext1()
-				lx.SkipWhitespaceNoNewLine()
-				lx.Emit(TokenBlockquoteAttrSource)
-				if lx.Peek1() == '[' {
-					lx.LexLinkOrSidenote() // @todo: actually only LexLink
-				} else {
-					lx.LexTextUntil("\n")
-				}
+			lx.Emit(TokenBlockquoteAttrSource)
+			if lx.Peek1() == '[' {
+				lx.LexLinkOrSidenote() // @todo: actually only LexLink
+			} else {
+				lx.LexTextUntil("\n")
 			}
-			lx.Emit(TokenBlockquoteAttrEnd)
+		}
+		lx.Emit(TokenBlockquoteAttrEnd)
+		if !lx.IsEOF() {
 			lx.ExpectAndSkip("\n")
-			lx.Emit(TokenBlockquoteEnd)
-			lx.SkipWhitespaceNoNewLine()
-			if lx.Peek1() == '>' {
-				lx.Error(errors.New("blockquote already finished by attribution"))
-			}
-			return
 		}
-		if lx.Peek1() == '\n' {
-			lx.Emit(TokenLineBreak)
+		lx.Emit(TokenBlockquoteEnd)
+		lx.SkipWhitespaceNoNewLine()
+		if lx.Peek1() == '>' {
+			lx.Error(errors.New("blockquote already finished by attribution"))
+		}
+		return
+	}
+	lx.Emit(TokenBlockquoteEnd)
+}
+
+// IsBlockquoteAttribution reports whether Peek is at a block quote line starting with `--`.
+func (lx *Lexer) IsBlockquoteAttribution() bool {
+	lpos := lx.Pos
+	lcon := lx.Consumed
+	defer func() {
+		lx.Pos = lpos
+		lx.Consumed = lcon
+	}()
+	if lx.Peek1() != '>' {
+		return false
+	}
+	lx.Next1()
+	lx.SkipWhitespaceNoNewLine()
+	return lx.Peek(2) == "--"
+}
+
+// LexBlocks lexes block content (see LexBlock) until the end of the source.
+// Content that isn't allowed is reported and skipped line by line.
+func (lx *Lexer) LexBlocks() {
+	for !lx.IsEOF() {
+		if !lx.LexBlock() && !lx.IsEOF() {
+			lx.Error(errors.New("block quote can only contain block content"))
+			lx.NextUntilMatch("\n")
 			lx.SkipNext1()
-		} else {
-			// @todo: what we actually want is a LexTextUntilAndIncluding("\n")
-			var nlFound bool
-			lx.LexTextUntilPred(func() bool {
-				if !nlFound && lx.Peek1() == '\n' {
-					nlFound = true
-					return false
-				}
-				return nlFound
-			})
 		}
+		lx.SkipWhitespace()
+	}
+}
+
+// LexEmbedded lexes content that is embedded in, but not contiguous in the source, like the lines of a block quote
+// without their `>` prefix.
+// The tokens, comments and errors are appended to those of lx, with their positions mapped back into the source using
+// offsets, which holds the position of each rune of content, plus the position of the end of content.
+func (lx *Lexer) LexEmbedded(content []rune, offsets []int, lex func(*Lexer)) {
+	Assert(len(offsets) == len(content)+1, "every rune of the embedded content needs an offset")
+	embedded := &Lexer{
+		Filename: lx.Filename,
+		Source:   content,
+	}
+	lex(embedded)
+	span := func(s diagnostic.Span) diagnostic.Span {
+		return lx.Span(offsets[s.Start.Offset], offsets[s.End.Offset])
+	}
+	for _, token := range embedded.Lexemes {
+		token.Pos = offsets[token.Pos]
+		token.Span = span(token.Span)
+		lx.Lexemes = append(lx.Lexemes, token)
+	}
+	for _, comment := range embedded.Comments {
+		comment.Pos = offsets[comment.Pos]
+		comment.Span = span(comment.Span)
+		lx.Comments = append(lx.Comments, comment)
+	}
+	for _, err := range embedded.Errors {
+		if lxe, ok := err.(LexerError); ok {
+			lxe.Pos = offsets[min(lxe.Pos, len(content))]
+			lxe.Span = lx.Span(lxe.Pos, lxe.Pos)
+			err = lxe
+		}
+		lx.Errors = append(lx.Errors, err)
+	}
+}
+
+// LexAdmonition lexes an admonition box, of one of the types info, warning, danger or tip.
+// The content of the box is indented deeper than its marker and may contain any block content.
+// The first line that is indented no deeper than the marker ends the box, even in the middle of a paragraph.
+//
+//	!!! warning "Custom title"
+//	    Mind the gap.
+//
+//	    ```sh
+//	    rm -rf /
+//	    ```
+//
+// Starting the box with `???` instead makes it collapsible, `???+` makes it collapsible but initially expanded.
+// The title is optional and defaults to the type.
+//
+// - TokenAdmonitionBegin "!!!"
+// - TokenAdmonitionType "warning"
+// - TokenAdmonitionTitle "Custom title"
+// - TokenParagraphBegin
+// - TokenText "Mind the gap."
+// - TokenParagraphEnd
+// - TokenCodeBlockBegin "```"
+// - <...>
+// - TokenCodeBlockEnd "```"
+// - TokenAdmonitionEnd
+func (lx *Lexer) LexAdmonition() {
+	Assert(lx.IsAdmonition(), "lexer state confused")
+	indent := lx.Indentation()
+	lx.admonitions = append(lx.admonitions, indent)
+	defer func() { lx.admonitions = lx.admonitions[:len(lx.admonitions)-1] }()
+	if lx.NextIfMatch("???") {
+		lx.NextIfMatch("+")
+	} else {
+		lx.Next(3)
+	}
+	lx.Emit(TokenAdmonitionBegin)
+	lx.SkipWhitespaceNoNewLine()
+	lx.NextValids(SpecAscii)
+	lx.Emit(TokenAdmonitionType)
+	lx.SkipWhitespaceNoNewLine()
+	if lx.Peek1() == '"' {
+		lx.SkipNext1()
+		lx.NextValids(SpecAdmonitionTitle)
+		lx.Emit(TokenAdmonitionTitle)
+		lx.ExpectAndSkip(`"`)
 		lx.SkipWhitespaceNoNewLine()
 	}
-	lx.Emit(TokenBlockquoteEnd)
+	if !lx.IsEOF() {
+		lx.ExpectAndSkip("\n")
+	}
+	for lx.NextLineIndentation() > indent {
+		if !lx.LexBlock() {
+			break // not allowed inside an admonition, let the enclosing section deal with it
+		}
+	}
+	lx.Emit(TokenAdmonitionEnd)
+}
+
+// LexBlock lexes a single block, that is any content allowed inside of admonitions and block quotes:
+// paragraphs, code blocks, images, admonitions, lists, tables, block quotes and horizontal rules.
+// Returns false without lexing anything if the next content is something else, like a definition or section.
+func (lx *Lexer) LexBlock() bool {
+	if lx.IsHorizontalRule() {
+		lx.LexHorizontalRule()
+		return true
+	}
+	lx.SkipWhitespace()
+	if lx.IsComment() {
+		lx.LexComment()
+	} else if lx.Peek(3) == "```" {
+		lx.LexCodeBlock()
+	} else if lx.Peek(2) == "![" {
+		lx.LexImage()
+	} else if lx.IsAdmonition() {
+		lx.LexAdmonition()
+	} else if lx.IsListItem() {
+		lx.LexList()
+	} else if lx.IsTable() {
+		lx.LexTable()
+	} else if lx.Peek1() == '>' {
+		lx.LexBlockQuotes()
+	} else if lx.IsEOF() || lx.IsParagraphEnder() {
+		return false
+	} else {
+		lx.LexParagraph()
+	}
+	return true
 }
 
 // LexHorizontalRule lexes a horizontal rule of the form <WSL>---<WSL> or <WSL>***<WSL>
@@ -1576,16 +2751,23 @@ func (lx *Lexer) LexHorizontalRule() {
 
 // LexDefinitionList lexes a definition of the form
 //
-// Term
-// : Explanation of term
+//	Term
+//	: Explanation of term
+//	: Another explanation of the same term
 //
+// - TokenDefinitionListBegin
 // - TokenDefinitionTerm "Term"
 // - TokenDefinitionExplanationBegin
 // - TokenText "Explanation of term"
 // - TokenDefinitionExplanationEnd
+// - TokenDefinitionExplanationBegin
+// - TokenText "Another explanation of the same term"
+// - TokenDefinitionExplanationEnd
 // - <...> optional more term definitions
+// - TokenDefinitionListEnd
 func (lx *Lexer) LexDefinitionList() {
-	Assert(lx.IsStartOfLine(), "lexer state confused")
+	Assert(lx.IsOnlyWhitespaceBeforeOnLine(), "lexer state confused")
+	lx.Emit(TokenDefinitionListBegin)
 	for lx.IsTermDefinition() {
 		term := lx.NextValids(SpecNonWhitespace)
 		if len(term) == 0 {
@@ -1595,15 +2777,22 @@ func (lx *Lexer) LexDefinitionList() {
 		lx.SkipWhitespaceNoNewLine()
 		lx.Expect("\n")
 		lx.SkipWhitespace()
-		lx.Expect(":")
-		lx.SkipWhitespace()
-		lx.Emit(TokenDefinitionExplanationBegin)
-		lx.LexTextUntil("\n")
-		lx.ExpectAndSkip("\n")
-		lx.Emit(TokenDefinitionExplanationEnd)
+		for lx.Peek1() == ':' {
+			lx.SkipNext1()
+			lx.SkipWhitespaceNoNewLine()
+			lx.Emit(TokenDefinitionExplanationBegin)
+			lx.LexTextUntil("\n")
+			lx.ExpectAndSkip("\n")
+			lx.Emit(TokenDefinitionExplanationEnd)
+			lx.SkipWhitespaceNoNewLine()
+		}
 	}
+	lx.Emit(TokenDefinitionListEnd)
 }
 
+// IsMonoOrEnquoteSingle decides what the backtick at Peek starts:
+// 1 for `mono`, 2 for `enquote single', 3 for a TeX style double enquote, and 0
+// if the backtick is never closed.
 func (lx *Lexer) IsMonoOrEnquoteSingle() int {
 	Assert(lx.Peek1() == '`', "lexer state confused")
 	lpos := lx.Pos
@@ -1612,6 +2801,18 @@ func (lx *Lexer) IsMonoOrEnquoteSingle() int {
 		lx.Pos = lpos
 		lx.Consumed = lcon
 	}()
+	if lx.Peek(2) == "``" && lx.Peek(3) != "```" {
+		lx.Next(2)
+		for !lx.IsEOF() && lx.Peek(2) != "\n\n" {
+			if lx.Peek1() == '\\' && lx.IsEscape() {
+				lx.Next1()
+			} else if lx.Peek(2) == "''" {
+				return 3
+			}
+			lx.Next1()
+		}
+		return 1
+	}
 	// @todo: this could be a useful function: SearchForwardWithEscaped(r rune)
 	lx.Next1()
 	for !lx.IsEOF() {
@@ -1635,6 +2836,8 @@ func (lx *Lexer) LexMonoOrEnquoteSingle() {
 		lx.LexMono()
 	case 2:
 		lx.LexEnquoteSingle()
+	case 3:
+		lx.LexEnquoteDoubleTeX()
 	}
 }
 
@@ -1646,35 +2849,120 @@ func (lx *Lexer) LexMonoOrEnquoteSingle() {
 func (lx *Lexer) LexMono() {
 	Assert(lx.Peek1() == '`', "lexer state confused")
 	lx.SkipNext1()
-	lx.NextUntilMatch("`")
+	lx.NextUntilMatchInBlock("`")
 	lx.Emit(TokenMono)
 	lx.ExpectAndSkip("`")
 }
 
+// IsMath checks if Peek is at the start of inline math ($...$) or display
+// math ($$...$$) and returns the length of the delimiter, or 0 if it is not.
+//
+// Inline math must not start with a space, and its closing $ must neither
+// follow a space nor be followed by a digit, so that "it costs $5 or $10" is
+// not mistaken for math.
+// Neither inline nor display math can span an empty line.
+func (lx *Lexer) IsMath() int {
+	delim, _ := lx.mathEnd()
+	return delim
+}
+
+// mathEnd returns the length of the math delimiter at Peek and the position
+// of the closing delimiter.
+func (lx *Lexer) mathEnd() (delim int, end int) {
+	Assert(lx.Peek1() == '$', "lexer state confused")
+	lpos := lx.Pos
+	lcon := lx.Consumed
+	defer func() {
+		lx.Pos = lpos
+		lx.Consumed = lcon
+	}()
+	if lx.NextIfMatch("$$") {
+		for !lx.IsEOF() && !lx.MatchAtPos("\n\n") {
+			if lx.MatchAtPos("$$") {
+				return 2, lx.Pos
+			}
+			if lx.Next1() == '\\' {
+				lx.Next1()
+			}
+		}
+		return 0, 0
+	}
+	lx.Next1()
+	if lx.IsEOF() || unicode.IsSpace(lx.Peek1()) || lx.Peek1() == '$' {
+		return 0, 0
+	}
+	for !lx.IsEOF() && !lx.MatchAtPos("\n\n") {
+		if r := lx.Next1(); r == '\\' {
+			lx.Next1()
+		} else if r == '$' && !unicode.IsSpace(lx.Source[lx.Pos-2]) && !unicode.IsDigit(lx.Peek1()) {
+			return 1, lx.Pos - 1
+		}
+	}
+	return 0, 0
+}
+
+// LexMath lexes inline math like
+//
+//	$e^{i\pi} + 1 = 0$
+//
+// - TokenMathInline "e^{i\pi} + 1 = 0"
+//
+// or display math like
+//
+//	$$\sum_{i=1}^n i = \frac{n(n+1)}{2}$$
+//
+// - TokenMathDisplay "\sum_{i=1}^n i = \frac{n(n+1)}{2}"
+//
+// The math itself is not lexed, but passed on verbatim.
+func (lx *Lexer) LexMath() {
+	delim, end := lx.mathEnd()
+	Assert(delim > 0, "lexer state confused")
+	lx.SkipNext(delim)
+	lx.Next(end - lx.Pos)
+	if delim == 2 {
+		lx.Emit(TokenMathDisplay)
+	} else {
+		lx.Emit(TokenMathInline)
+	}
+	lx.SkipNext(delim)
+}
+
 func (lx *Lexer) LexEmphasis() {
 	Assert(lx.Peek1() == '*' || lx.Peek1() == '_', "lexer state confused")
-	lx.Next1()
+	delim := lx.Next(1)
 	lx.Emit(TokenEmphasisBegin)
 	lx.LexTextUntilPred(lx.IsEmphasis)
-	lx.Next(1) // should do two different functions for * and _
+	if lx.IsEmphasis() {
+		lx.Next(1) // should do two different functions for * and _
+	} else {
+		lx.Expect(delim) // unclosed
+	}
 	lx.Emit(TokenEmphasisEnd)
 }
 
 func (lx *Lexer) LexStrong() {
 	Assert(lx.Peek(2) == "**" || lx.Peek(2) == "__", "lexer state confused")
-	lx.Next(2)
+	delim := lx.Next(2)
 	lx.Emit(TokenStrongBegin)
 	lx.LexTextUntilPred(lx.IsStrong)
-	lx.Next(2) // should do two different functions for * and _
+	if lx.IsStrong() {
+		lx.Next(2) // should do two different functions for * and _
+	} else {
+		lx.Expect(delim) // unclosed
+	}
 	lx.Emit(TokenStrongEnd)
 }
 
 func (lx *Lexer) LexEmphasisStrong() {
 	Assert(lx.Peek(3) == "***" || lx.Peek(3) == "___", "lexer state confused")
-	lx.Next(3)
+	delim := lx.Next(3)
 	lx.Emit(TokenEmphasisStrongBegin)
 	lx.LexTextUntilPred(lx.IsEmphasisStrong)
-	lx.Next(3) // should do two different functions for * and _
+	if lx.IsEmphasisStrong() {
+		lx.Next(3) // should do two different functions for * and _
+	} else {
+		lx.Expect(delim) // unclosed
+	}
 	lx.Emit(TokenEmphasisStrongEnd)
 }
 
@@ -1696,6 +2984,24 @@ func (lx *Lexer) LexEnquoteDouble() {
 	lx.Emit(TokenEnquoteDoubleEnd)
 }
 
+// LexEnquoteDoubleTeX lexes the alternative (TeX) syntax of a double enquote
+//
+//	``Quoted text''
+//
+// The tokens are the same as for "Quoted text", except for the quotes:
+//
+//	TokenEnquoteDoubleBegin "``"
+//	TokenText "Quoted text"
+//	TokenEnquoteDoubleEnd "''"
+func (lx *Lexer) LexEnquoteDoubleTeX() {
+	Assert(lx.Peek(2) == "``", "lexer state confused")
+	lx.Next(2)
+	lx.Emit(TokenEnquoteDoubleBegin)
+	lx.LexTextUntil("''")
+	lx.Expect("''")
+	lx.Emit(TokenEnquoteDoubleEnd)
+}
+
 func (lx *Lexer) LexEnquoteAngled() {
 	Assert(lx.Peek(2) == "<<", "lexer state confused")
 	lx.Next(2)
@@ -1723,6 +3029,102 @@ func (lx *Lexer) LexMarker() {
 	lx.Emit(TokenMarkerEnd)
 }
 
+// LexRuby lexes a ruby annotation, with either a reading for each character
+// of the base text
+//
+//	{漢字|かん|じ}
+//
+// - TokenRubyBegin "{"
+// - TokenRubyBase "漢字"
+// - TokenRubyText "かん"
+// - TokenRubyText "じ"
+// - TokenRubyEnd "}"
+//
+// or a single reading for the whole base text
+//
+//	{今日|きょう}
+//
+// - TokenRubyBegin "{"
+// - TokenRubyBase "今日"
+// - TokenRubyText "きょう"
+// - TokenRubyEnd "}"
+func (lx *Lexer) LexRuby() {
+	Assert(lx.Peek1() == '{' && lx.IsRuby(), "lexer state confused")
+	lx.Next1()
+	lx.Emit(TokenRubyBegin)
+	lx.NextValids(SpecRubyBase)
+	lx.Emit(TokenRubyBase)
+	for lx.Peek1() == '|' {
+		lx.SkipNext1()
+		lx.NextValids(SpecRubyText)
+		lx.Emit(TokenRubyText)
+	}
+	lx.Expect("}")
+	lx.Emit(TokenRubyEnd)
+}
+
+// LexSuperscript lexes a superscript like
+//
+//	2^10^
+//
+// - TokenText "2"
+// - TokenSuperscript "10"
+func (lx *Lexer) LexSuperscript() {
+	Assert(lx.Peek1() == '^' && lx.IsScript('^'), "lexer state confused")
+	lx.SkipNext1()
+	lx.NextUntilMatch("^")
+	lx.Emit(TokenSuperscript)
+	lx.SkipNext1()
+}
+
+// LexSubscript lexes a subscript like
+//
+//	x (~i~)
+//
+// - TokenText "x ("
+// - TokenSubscript "i"
+// - TokenText ")"
+func (lx *Lexer) LexSubscript() {
+	Assert(lx.Peek1() == '~' && lx.IsScript('~'), "lexer state confused")
+	lx.SkipNext1()
+	lx.NextUntilMatch("~")
+	lx.Emit(TokenSubscript)
+	lx.SkipNext1()
+}
+
+// LexKbd lexes keyboard keys like
+//
+//	[[Ctrl]]+[[C]]
+//
+// - TokenKbd "Ctrl"
+// - TokenText "+"
+// - TokenKbd "C"
+func (lx *Lexer) LexKbd() {
+	Assert(lx.Peek(2) == "[[" && lx.IsKbd(), "lexer state confused")
+	lx.SkipNext(2)
+	lx.NextUntilMatch("]]")
+	lx.Emit(TokenKbd)
+	lx.SkipNext(2)
+}
+
+// LexAbbreviationDefinition lexes the definition of an abbreviation.
+//
+//	*[HTML]: HyperText Markup Language
+//
+// - TokenAbbreviationDef "HTML"
+// - TokenText "HyperText Markup Language"
+func (lx *Lexer) LexAbbreviationDefinition() {
+	Assert(lx.IsAbbreviationDefinition(), "lexer state confused")
+	lx.SkipNext(2)
+	lx.NextUntilMatch("]")
+	lx.Emit(TokenAbbreviationDef)
+	lx.ExpectAndSkip("]:")
+	lx.SkipWhitespaceNoNewLine()
+	lx.NextUntilMatch("\n")
+	lx.Emit(TokenText)
+	lx.Skip()
+}
+
 // LexHtmlElement lexes an HTML element like
 //
 //	<tag-name attr="val" ...>
@@ -1742,25 +3144,28 @@ func (lx *Lexer) LexHtmlElement(inline bool) {
 	tag := lx.NextValids(CharInSpec{SpecAscii, CharInAny("-_")})
 	if len(tag) == 0 {
 		lx.Error(errors.New("expected html tag name"))
+		return // drop the `<` and continue with what follows
 	}
 	lx.Emit(TokenHtmlTagOpen)
 	lx.SkipWhitespace()
 	if lx.MatchAtPos(">") {
 		lx.SkipNext1()
-	} else {
-		lx.LexHtmlElementAttributes()
-		lx.ExpectAndSkip(">")
+	} else if lx.LexHtmlElementAttributes() {
+		lx.SkipNext1() // the `>` ending the attributes
 	}
 	lx.LexHtmlElementContent(tag, inline)
 }
 
-func (lx *Lexer) LexHtmlElementAttributes() {
+// LexHtmlElementAttributes lexes the attributes of an html tag up to the
+// closing `>`.
+// It returns false if it had to give up on an invalid attribute.
+func (lx *Lexer) LexHtmlElementAttributes() bool {
 	lx.SkipWhitespace()
 	for lx.Peek1() != '>' {
 		attrKey := lx.NextValids(CharInSpec{SpecAscii, CharInAny("-_")})
 		if len(attrKey) == 0 {
-			lx.Error(fmt.Errorf("expected attribute or >, got: %s", lx.Peek(7)))
-			break
+			lx.Error(fmt.Errorf("expected attribute or >, got: %s", WhiteSpaceToVisible(lx.Peek(7))))
+			return false
 		}
 		lx.Emit(TokenHtmlTagAttrKey)
 		lx.SkipWhitespace()
@@ -1774,6 +3179,7 @@ func (lx *Lexer) LexHtmlElementAttributes() {
 		}
 		lx.SkipWhitespace()
 	}
+	return true
 }
 
 func (lx *Lexer) LexHtmlElementContent(tag string, inline bool) {
@@ -1781,6 +3187,7 @@ func (lx *Lexer) LexHtmlElementContent(tag string, inline bool) {
 	if lx.HasCloseTag(tag) {
 		lx.SkipWhitespace()
 		for !lx.IsEOF() {
+			pos := lx.Pos
 			if lx.Peek(2) == "</" {
 				lx.SkipNext(2)
 				lx.SkipWhitespace()
@@ -1809,6 +3216,11 @@ func (lx *Lexer) LexHtmlElementContent(tag string, inline bool) {
 					lx.LexParagraph()
 				}
 			}
+			if lx.Pos == pos {
+				lx.Error(fmt.Errorf("html element <%s> cannot contain: `%s`", tag, WhiteSpaceToVisible(lx.Peek(2))))
+				lx.NextUntilMatch("\n")
+				lx.Skip()
+			}
 			lx.SkipWhitespace()
 		}
 	}
@@ -250,6 +250,34 @@ author: Foo Bar
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
+		{
+			name: "Empty value in meta block",
+			source: `---
+title:
+author: Foo Bar
+---
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenMetaBegin, Text: "---"},
+				{Type: lexer.TokenMetaKey, Text: "title"},
+				{Type: lexer.TokenMetaKey, Text: "author"},
+				{Type: lexer.TokenText, Text: "Foo Bar"},
+				{Type: lexer.TokenMetaEnd, Text: "---"},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name:   "Empty value with trailing space in meta block",
+			source: "---\ntitle: \nauthor: Foo Bar\n---\n",
+			expected: []lexer.Token{
+				{Type: lexer.TokenMetaBegin, Text: "---"},
+				{Type: lexer.TokenMetaKey, Text: "title"},
+				{Type: lexer.TokenMetaKey, Text: "author"},
+				{Type: lexer.TokenText, Text: "Foo Bar"},
+				{Type: lexer.TokenMetaEnd, Text: "---"},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
 	}
 	RunTests(t, testCases)
 }
@@ -260,10 +288,10 @@ func TestLexSectionHeader(t *testing.T) {
 			name:   "Section 1 Header",
 			source: `# Hello, World!`,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Hello, World!"},
-				{Type: lexer.TokenSection1Content, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -275,14 +303,14 @@ func TestLexSectionHeader(t *testing.T) {
 ## Hello, World!
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "こんにちは、世界！"},
-				{Type: lexer.TokenSection1Content, Text: ""},
-				{Type: lexer.TokenSection2Begin, Text: "##"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionBegin, Text: "##"},
 				{Type: lexer.TokenText, Text: "Hello, World!"},
-				{Type: lexer.TokenSection2Content, Text: ""},
-				{Type: lexer.TokenSection2End, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -294,14 +322,14 @@ func TestLexSectionHeader(t *testing.T) {
 ##   	  Hello, World!   	
   `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Goodnight, Moon! "},
-				{Type: lexer.TokenSection1Content, Text: ""},
-				{Type: lexer.TokenSection2Begin, Text: "##"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionBegin, Text: "##"},
 				{Type: lexer.TokenText, Text: "Hello, World!   \t"},
-				{Type: lexer.TokenSection2Content, Text: ""},
-				{Type: lexer.TokenSection2End, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -313,21 +341,21 @@ func TestLexSectionHeader(t *testing.T) {
 ##   	  &ldquo;Hello, --- World...   	
   `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Goodnight,"},
 				{Type: lexer.TokenAmpSpecial, Text: "~"},
 				{Type: lexer.TokenText, Text: "Moon! "},
-				{Type: lexer.TokenSection1Content, Text: ""},
-				{Type: lexer.TokenSection2Begin, Text: "##"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionBegin, Text: "##"},
 				{Type: lexer.TokenAmpSpecial, Text: "&ldquo;"},
 				{Type: lexer.TokenText, Text: "Hello, "},
 				{Type: lexer.TokenAmpSpecial, Text: "---"},
 				{Type: lexer.TokenText, Text: " World"},
 				{Type: lexer.TokenAmpSpecial, Text: "..."},
 				{Type: lexer.TokenText, Text: "   \t"},
-				{Type: lexer.TokenSection2Content, Text: ""},
-				{Type: lexer.TokenSection2End, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -337,13 +365,13 @@ func TestLexSectionHeader(t *testing.T) {
 # Section 1 {#section-1}
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Section 1 "},
 				{Type: lexer.TokenAttributeListBegin, Text: "{"},
 				{Type: lexer.TokenAttributeListID, Text: "section-1"},
 				{Type: lexer.TokenAttributeListEnd, Text: "}"},
-				{Type: lexer.TokenSection1Content, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -353,7 +381,7 @@ func TestLexSectionHeader(t *testing.T) {
 # Section 1 {key1=val1 key2 key3='val 3' key4 = "val 4" key5 =}
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Section 1 "},
 				{Type: lexer.TokenAttributeListBegin, Text: "{"},
 				{Type: lexer.TokenAttributeListKey, Text: "key1"},
@@ -365,8 +393,8 @@ func TestLexSectionHeader(t *testing.T) {
 				{Type: lexer.TokenText, Text: "val 4"},
 				{Type: lexer.TokenAttributeListKey, Text: "key5"},
 				{Type: lexer.TokenAttributeListEnd, Text: "}"},
-				{Type: lexer.TokenSection1Content, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -376,7 +404,7 @@ func TestLexSectionHeader(t *testing.T) {
 # Section 1 {#section-1 key1=val1 key2 key3='val 3' key4 = "val 4" key5 =}
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Section 1 "},
 				{Type: lexer.TokenAttributeListBegin, Text: "{"},
 				{Type: lexer.TokenAttributeListID, Text: "section-1"},
@@ -389,8 +417,8 @@ func TestLexSectionHeader(t *testing.T) {
 				{Type: lexer.TokenText, Text: "val 4"},
 				{Type: lexer.TokenAttributeListKey, Text: "key5"},
 				{Type: lexer.TokenAttributeListEnd, Text: "}"},
-				{Type: lexer.TokenSection1Content, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -402,14 +430,14 @@ func TestLexSectionHeader(t *testing.T) {
 # Section 2
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Section 1"},
-				{Type: lexer.TokenSection1Content, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Section 2"},
-				{Type: lexer.TokenSection1Content, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -423,17 +451,17 @@ Some text
 # Section 2
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Section 1"},
-				{Type: lexer.TokenSection1Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Some text"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Section 2"},
-				{Type: lexer.TokenSection1Content, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -449,21 +477,21 @@ Some text
 ## Section 1.2
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Section 1"},
-				{Type: lexer.TokenSection1Content, Text: ""},
-				{Type: lexer.TokenSection2Begin, Text: "##"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionBegin, Text: "##"},
 				{Type: lexer.TokenText, Text: "Section 1.1"},
-				{Type: lexer.TokenSection2Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Some text"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
-				{Type: lexer.TokenSection2End, Text: ""},
-				{Type: lexer.TokenSection2Begin, Text: "##"},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenSectionBegin, Text: "##"},
 				{Type: lexer.TokenText, Text: "Section 1.2"},
-				{Type: lexer.TokenSection2Content, Text: ""},
-				{Type: lexer.TokenSection2End, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -477,20 +505,20 @@ Some text
 # And a section one again
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Here we go"},
 				{Type: lexer.TokenAmpSpecial, Text: "..."},
-				{Type: lexer.TokenSection1Content, Text: ""},
-				{Type: lexer.TokenSection2Begin, Text: "##"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionBegin, Text: "##"},
 				{Type: lexer.TokenAmpSpecial, Text: "..."},
 				{Type: lexer.TokenText, Text: "a section two"},
-				{Type: lexer.TokenSection2Content, Text: ""},
-				{Type: lexer.TokenSection2End, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "And a section one again"},
-				{Type: lexer.TokenSection1Content, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -501,13 +529,13 @@ Some text
 
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Some Section Title "},
 				{Type: lexer.TokenAttributeListBegin, Text: "{"},
 				{Type: lexer.TokenAttributeListID, Text: "custom-id"},
 				{Type: lexer.TokenAttributeListEnd, Text: "}"},
-				{Type: lexer.TokenSection1Content, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -518,15 +546,94 @@ Some text
 
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Some Section Title "},
 				{Type: lexer.TokenAttributeListBegin, Text: "{"},
 				{Type: lexer.TokenAttributeListID, Text: "custom.id"},
 				{Type: lexer.TokenAttributeListEnd, Text: "}"},
-				{Type: lexer.TokenSection1Content, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name: "Section 1 with custom id after other attributes",
+			source: `
+# Some Section Title {caption="Benchmarks" #custom-id .wide}
+
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Some Section Title "},
+				{Type: lexer.TokenAttributeListBegin, Text: "{"},
+				{Type: lexer.TokenAttributeListKey, Text: "caption"},
+				{Type: lexer.TokenText, Text: "Benchmarks"},
+				{Type: lexer.TokenAttributeListID, Text: "custom-id"},
+				{Type: lexer.TokenAttributeListKey, Text: ".wide"},
+				{Type: lexer.TokenAttributeListEnd, Text: "}"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name: "Nested sections up to level 6",
+			source: `
+# One
+### Three
+#### Four
+###### Six
+## Two
+# One again
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "One"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionBegin, Text: "###"},
+				{Type: lexer.TokenText, Text: "Three"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionBegin, Text: "####"},
+				{Type: lexer.TokenText, Text: "Four"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionBegin, Text: "######"},
+				{Type: lexer.TokenText, Text: "Six"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenSectionBegin, Text: "##"},
+				{Type: lexer.TokenText, Text: "Two"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "One again"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name: "Section level too deep",
+			source: `
+# One
+####### Seven
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "One"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionBegin, Text: "#######"},
+				{Type: lexer.TokenText, Text: "Seven"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
+			expectedErrors: []string{
+				"section level must be at most 6",
+			},
 		},
 	}
 	RunTests(t, testCases)
@@ -545,14 +652,34 @@ alert('haxxed!')
 ` + "```" + `
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Showcasing Code Blocks"},
-				{Type: lexer.TokenSection1Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenCodeBlockBegin, Text: "```"},
 				{Type: lexer.TokenText, Text: "console.log('1337')"},
 				{Type: lexer.TokenText, Text: "alert('haxxed!')"},
 				{Type: lexer.TokenCodeBlockEnd, Text: "```"},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name: "Code Block Starting with a Colon",
+			source: `
+# Showcasing Code Blocks
+
+` + "```" + `
+:term
+` + "```" + `
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Showcasing Code Blocks"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenCodeBlockBegin, Text: "```"},
+				{Type: lexer.TokenText, Text: ":term"},
+				{Type: lexer.TokenCodeBlockEnd, Text: "```"},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -567,15 +694,15 @@ alert('haxxed!')
 ` + "```" + `
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Showcasing Code Blocks"},
-				{Type: lexer.TokenSection1Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenCodeBlockBegin, Text: "```"},
 				{Type: lexer.TokenCodeBlockLang, Text: "js"},
 				{Type: lexer.TokenText, Text: "console.log('1337')"},
 				{Type: lexer.TokenText, Text: "alert('haxxed!')"},
 				{Type: lexer.TokenCodeBlockEnd, Text: "```"},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -590,9 +717,9 @@ alert('haxxed!')
 ` + "```" + `
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Showcasing Code Blocks"},
-				{Type: lexer.TokenSection1Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenCodeBlockBegin, Text: "```"},
 				{Type: lexer.TokenAttributeListBegin, Text: "{"},
 				{Type: lexer.TokenAttributeListKey, Text: "Source"},
@@ -603,7 +730,7 @@ alert('haxxed!')
 				{Type: lexer.TokenText, Text: "console.log('1337')"},
 				{Type: lexer.TokenText, Text: "alert('haxxed!')"},
 				{Type: lexer.TokenCodeBlockEnd, Text: "```"},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -620,12 +747,12 @@ alert('haxxed!')
 ` + "```" + `
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Showcasing Code Blocks"},
-				{Type: lexer.TokenSection1Content, Text: ""},
-				{Type: lexer.TokenSection2Begin, Text: "##"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionBegin, Text: "##"},
 				{Type: lexer.TokenText, Text: "The Full Thing"},
-				{Type: lexer.TokenSection2Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenCodeBlockBegin, Text: "```"},
 				{Type: lexer.TokenCodeBlockLang, Text: "js"},
 				{Type: lexer.TokenAttributeListBegin, Text: "{"},
@@ -637,8 +764,8 @@ alert('haxxed!')
 				{Type: lexer.TokenText, Text: "console.log('1337')"},
 				{Type: lexer.TokenText, Text: "alert('haxxed!')"},
 				{Type: lexer.TokenCodeBlockEnd, Text: "```"},
-				{Type: lexer.TokenSection2End, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -657,13 +784,13 @@ Hello, World!
 How are you doing?
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Section 1"},
-				{Type: lexer.TokenSection1Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Hello, World!\nHow are you doing?\n"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -679,16 +806,16 @@ Good evening, Moon.
 Where are you going?
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Section 1"},
-				{Type: lexer.TokenSection1Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Hello, World!\nHow are you doing?"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Good evening, Moon.\nWhere are you going?\n"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -704,9 +831,9 @@ Good--evening, Moon.
 Where are you going?
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Section 1"},
-				{Type: lexer.TokenSection1Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Hello"},
 				{Type: lexer.TokenAmpSpecial, Text: "..."},
@@ -717,7 +844,7 @@ Where are you going?
 				{Type: lexer.TokenAmpSpecial, Text: "--"},
 				{Type: lexer.TokenText, Text: "evening, Moon.\nWhere are you going?\n"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -732,9 +859,9 @@ How are you doing?
 [^1]: 世界 (Sekai) is the Japanese word for ` + "`" + `World'
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Section 1"},
-				{Type: lexer.TokenSection1Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Hello, "},
 				{Type: lexer.TokenLinkableBegin, Text: "["},
@@ -749,7 +876,7 @@ How are you doing?
 				{Type: lexer.TokenText, Text: "World"},
 				{Type: lexer.TokenEnquoteSingleEnd, Text: "'"},
 				{Type: lexer.TokenSidenoteDefEnd, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -764,9 +891,9 @@ How are you doing?
 [^1]: 世界 (Sekai) is the Japanese word for ` + "`" + `World'
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Section 1"},
-				{Type: lexer.TokenSection1Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Hello, "},
 				{Type: lexer.TokenLinkableBegin, Text: ""},
@@ -781,7 +908,7 @@ How are you doing?
 				{Type: lexer.TokenText, Text: "World"},
 				{Type: lexer.TokenEnquoteSingleEnd, Text: "'"},
 				{Type: lexer.TokenSidenoteDefEnd, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -794,9 +921,9 @@ Hello, [世界](^世界 \(Sekai\) is the Japanese word for ` + "`" + `World')
 How are you doing?
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Section 1"},
-				{Type: lexer.TokenSection1Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Hello, "},
 				{Type: lexer.TokenLinkableBegin, Text: "["},
@@ -813,7 +940,7 @@ How are you doing?
 				{Type: lexer.TokenLinkableEnd, Text: ""},
 				{Type: lexer.TokenText, Text: "\nHow are you doing?\n"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -826,9 +953,9 @@ Hello, 世界(^世界 \(Sekai\) is the Japanese word for ` + "`" + `World')
 How are you doing?
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Section 1"},
-				{Type: lexer.TokenSection1Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Hello, "},
 				{Type: lexer.TokenLinkableBegin, Text: ""},
@@ -845,7 +972,7 @@ How are you doing?
 				{Type: lexer.TokenLinkableEnd, Text: ""},
 				{Type: lexer.TokenText, Text: "\nHow are you doing?\n"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -862,9 +989,9 @@ How are you doing?
 [1]: https://jisho.org/word/世界
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Section 1"},
-				{Type: lexer.TokenSection1Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Hello, "},
 				{Type: lexer.TokenLinkableBegin, Text: "["},
@@ -873,13 +1000,13 @@ How are you doing?
 				{Type: lexer.TokenLinkableEnd, Text: ""},
 				{Type: lexer.TokenText, Text: "\nHow are you doing?"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
-				{Type: lexer.TokenSection2Begin, Text: "##"},
+				{Type: lexer.TokenSectionBegin, Text: "##"},
 				{Type: lexer.TokenText, Text: "Da da da"},
-				{Type: lexer.TokenSection2Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenLinkDef, Text: "1"},
 				{Type: lexer.TokenText, Text: "https://jisho.org/word/世界"},
-				{Type: lexer.TokenSection2End, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -897,9 +1024,9 @@ Check out this cool [website](https://blog.vanloo.ch) I found.
 
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Section 1"},
-				{Type: lexer.TokenSection1Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Hello, "},
 				{Type: lexer.TokenLinkableBegin, Text: "["},
@@ -908,9 +1035,9 @@ Check out this cool [website](https://blog.vanloo.ch) I found.
 				{Type: lexer.TokenLinkableEnd, Text: ""},
 				{Type: lexer.TokenText, Text: "\nHow are you doing?"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
-				{Type: lexer.TokenSection2Begin, Text: "##"},
+				{Type: lexer.TokenSectionBegin, Text: "##"},
 				{Type: lexer.TokenText, Text: "Section 2"},
-				{Type: lexer.TokenSection2Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Check out this cool "},
 				{Type: lexer.TokenLinkableBegin, Text: "["},
@@ -919,8 +1046,8 @@ Check out this cool [website](https://blog.vanloo.ch) I found.
 				{Type: lexer.TokenLinkableEnd, Text: ""},
 				{Type: lexer.TokenText, Text: " I found."},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
-				{Type: lexer.TokenSection2End, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -936,24 +1063,24 @@ Check out this cool blog: <https://blog.vanloo.ch>.
 Check out this cool blog: <https://blog.vanloo.ch>.
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Section 1"},
-				{Type: lexer.TokenSection1Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Check out this cool blog: "},
 				{Type: lexer.TokenLinkify, Text: "https://blog.vanloo.ch"},
 				{Type: lexer.TokenText, Text: "."},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
-				{Type: lexer.TokenSection2Begin, Text: "##"},
+				{Type: lexer.TokenSectionBegin, Text: "##"},
 				{Type: lexer.TokenText, Text: "Section 2"},
-				{Type: lexer.TokenSection2Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Check out this cool blog: "},
 				{Type: lexer.TokenLinkify, Text: "https://blog.vanloo.ch"},
 				{Type: lexer.TokenText, Text: ".\n"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
-				{Type: lexer.TokenSection2End, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -970,9 +1097,9 @@ This looks like a [link,] doesn't it?
 
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Section 1"},
-				{Type: lexer.TokenSection1Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "This looks like a "},
 				{Type: lexer.TokenLinkableBegin, Text: "["},
@@ -983,9 +1110,9 @@ This looks like a [link,] doesn't it?
 				{Type: lexer.TokenAmpSpecial, Text: "'"},
 				{Type: lexer.TokenText, Text: "t it?"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
-				{Type: lexer.TokenSection2Begin, Text: "##"},
+				{Type: lexer.TokenSectionBegin, Text: "##"},
 				{Type: lexer.TokenText, Text: "Section 2"},
-				{Type: lexer.TokenSection2Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "This looks like a "},
 				{Type: lexer.TokenLinkableBegin, Text: "["},
@@ -996,8 +1123,8 @@ This looks like a [link,] doesn't it?
 				{Type: lexer.TokenAmpSpecial, Text: "'"},
 				{Type: lexer.TokenText, Text: "t it?"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
-				{Type: lexer.TokenSection2End, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -1013,17 +1140,19 @@ RAM
 
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Section 1"},
-				{Type: lexer.TokenSection1Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Download more RAM"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenDefinitionListBegin, Text: ""},
 				{Type: lexer.TokenDefinitionTerm, Text: "RAM"},
 				{Type: lexer.TokenDefinitionExplanationBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Random Access Memory"},
 				{Type: lexer.TokenDefinitionExplanationEnd, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenDefinitionListEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -1043,15 +1172,16 @@ CPU
 
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Section 1"},
-				{Type: lexer.TokenSection1Content, Text: ""},
-				{Type: lexer.TokenSection2Begin, Text: "##"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionBegin, Text: "##"},
 				{Type: lexer.TokenText, Text: "Section 2"},
-				{Type: lexer.TokenSection2Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Download more RAM and improve CPU speed."},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenDefinitionListBegin, Text: ""},
 				{Type: lexer.TokenDefinitionTerm, Text: "RAM"},
 				{Type: lexer.TokenDefinitionExplanationBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Random Access Memory"},
@@ -1060,8 +1190,40 @@ CPU
 				{Type: lexer.TokenDefinitionExplanationBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Cheese Processing Unit"},
 				{Type: lexer.TokenDefinitionExplanationEnd, Text: ""},
-				{Type: lexer.TokenSection2End, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenDefinitionListEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name: "Term definition with multiple explanations",
+			source: `
+# Section 1
+
+RAM
+: Random Access Memory
+: A *male* sheep
+
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Section 1"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenDefinitionListBegin, Text: ""},
+				{Type: lexer.TokenDefinitionTerm, Text: "RAM"},
+				{Type: lexer.TokenDefinitionExplanationBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Random Access Memory"},
+				{Type: lexer.TokenDefinitionExplanationEnd, Text: ""},
+				{Type: lexer.TokenDefinitionExplanationBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "A "},
+				{Type: lexer.TokenEmphasisBegin, Text: "*"},
+				{Type: lexer.TokenText, Text: "male"},
+				{Type: lexer.TokenEmphasisEnd, Text: "*"},
+				{Type: lexer.TokenText, Text: " sheep"},
+				{Type: lexer.TokenDefinitionExplanationEnd, Text: ""},
+				{Type: lexer.TokenDefinitionListEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -1079,9 +1241,9 @@ What "the" ***frick?!!***
 
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Section 1"},
-				{Type: lexer.TokenSection1Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Blah blab "},
 				{Type: lexer.TokenEnquoteAngledBegin, Text: "<<"},
@@ -1097,9 +1259,9 @@ What "the" ***frick?!!***
 				{Type: lexer.TokenStrongEnd, Text: "**"},
 				{Type: lexer.TokenText, Text: "!!!"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
-				{Type: lexer.TokenSection2Begin, Text: "##"},
+				{Type: lexer.TokenSectionBegin, Text: "##"},
 				{Type: lexer.TokenText, Text: "Section 2"},
-				{Type: lexer.TokenSection2Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "What "},
 				{Type: lexer.TokenEnquoteDoubleBegin, Text: "\""},
@@ -1110,8 +1272,8 @@ What "the" ***frick?!!***
 				{Type: lexer.TokenText, Text: "frick?!!"},
 				{Type: lexer.TokenEmphasisStrongEnd, Text: "***"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
-				{Type: lexer.TokenSection2End, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -1127,9 +1289,9 @@ I ~~love~~ hate ==JavaScript==.
 ==JavaScript== is the ~~best~~ worst language.
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Section 1"},
-				{Type: lexer.TokenSection1Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "I "},
 				{Type: lexer.TokenStrikethroughBegin, Text: "~~"},
@@ -1141,9 +1303,9 @@ I ~~love~~ hate ==JavaScript==.
 				{Type: lexer.TokenMarkerEnd, Text: "=="},
 				{Type: lexer.TokenText, Text: "."},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
-				{Type: lexer.TokenSection2Begin, Text: "##"},
+				{Type: lexer.TokenSectionBegin, Text: "##"},
 				{Type: lexer.TokenText, Text: "Section 2"},
-				{Type: lexer.TokenSection2Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenMarkerBegin, Text: "=="},
 				{Type: lexer.TokenText, Text: "JavaScript"},
@@ -1154,8 +1316,8 @@ I ~~love~~ hate ==JavaScript==.
 				{Type: lexer.TokenStrikethroughEnd, Text: "~~"},
 				{Type: lexer.TokenText, Text: " worst language.\n"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
-				{Type: lexer.TokenSection2End, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -1176,21 +1338,22 @@ I forgot who this quote is from:
 ...maybe it had something to do with AI?
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Quotes and Citations"},
-				{Type: lexer.TokenSection1Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "I forgot who this quote is from:\n"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
 				{Type: lexer.TokenBlockquoteBegin, Text: ""},
-				{Type: lexer.TokenText, Text: "If we stop dreaming big dreams, if we stop looking for a greater purpose,\n"},
-				{Type: lexer.TokenText, Text: "then we may as well be machines ourselves.\n"},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "If we stop dreaming big dreams, if we stop looking for a greater purpose,\nthen we may as well be machines ourselves.\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
 				{Type: lexer.TokenBlockquoteEnd, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenAmpSpecial, Text: "..."},
 				{Type: lexer.TokenText, Text: "maybe it had something to do with AI?\n"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -1206,20 +1369,21 @@ Oh, I remember now:
 > -- Garry Kasparov
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Quotes and Citations"},
-				{Type: lexer.TokenSection1Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Oh, I remember now:"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
 				{Type: lexer.TokenBlockquoteBegin, Text: ""},
-				{Type: lexer.TokenText, Text: "If we stop dreaming big dreams, if we stop looking for a greater purpose,\n"},
-				{Type: lexer.TokenText, Text: "then we may as well be machines ourselves.\n"},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "If we stop dreaming big dreams, if we stop looking for a greater purpose,\nthen we may as well be machines ourselves.\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
 				{Type: lexer.TokenBlockquoteAttrAuthor, Text: ""},
 				{Type: lexer.TokenText, Text: "Garry Kasparov"},
 				{Type: lexer.TokenBlockquoteAttrEnd, Text: ""},
 				{Type: lexer.TokenBlockquoteEnd, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -1237,28 +1401,29 @@ Btw, it's from this book:
 > -- Garry Kasparov, Deep Thinking
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Quotes and Citations"},
-				{Type: lexer.TokenSection1Content, Text: ""},
-				{Type: lexer.TokenSection2Begin, Text: "##"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionBegin, Text: "##"},
 				{Type: lexer.TokenText, Text: "I remembered the book title too"},
-				{Type: lexer.TokenSection2Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Btw, it"},
 				{Type: lexer.TokenAmpSpecial, Text: "'"},
 				{Type: lexer.TokenText, Text: "s from this book:"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
 				{Type: lexer.TokenBlockquoteBegin, Text: ""},
-				{Type: lexer.TokenText, Text: "If we stop dreaming big dreams, if we stop looking for a greater purpose,\n"},
-				{Type: lexer.TokenText, Text: "then we may as well be machines ourselves.\n"},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "If we stop dreaming big dreams, if we stop looking for a greater purpose,\nthen we may as well be machines ourselves.\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
 				{Type: lexer.TokenBlockquoteAttrAuthor, Text: ""},
 				{Type: lexer.TokenText, Text: "Garry Kasparov"},
 				{Type: lexer.TokenBlockquoteAttrSource, Text: ""},
 				{Type: lexer.TokenText, Text: "Deep Thinking"},
 				{Type: lexer.TokenBlockquoteAttrEnd, Text: ""},
 				{Type: lexer.TokenBlockquoteEnd, Text: ""},
-				{Type: lexer.TokenSection2End, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -1270,10 +1435,11 @@ Btw, it's from this book:
 > Putting "fun" back in "fundamentally flawed."
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Quotes and Citations"},
-				{Type: lexer.TokenSection1Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenBlockquoteBegin, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Putting "},
 				{Type: lexer.TokenEnquoteDoubleBegin, Text: "\""},
 				{Type: lexer.TokenText, Text: "fun"},
@@ -1283,13 +1449,14 @@ Btw, it's from this book:
 				{Type: lexer.TokenText, Text: "fundamentally flawed."},
 				{Type: lexer.TokenEnquoteDoubleEnd, Text: "\""},
 				{Type: lexer.TokenText, Text: "\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
 				{Type: lexer.TokenBlockquoteEnd, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
 		{
-			name: "Blockquote containing empty lines",
+			name: "Blockquote containing empty lines between paragraphs",
 			source: `
 # Quotes and Citations
 
@@ -1300,17 +1467,21 @@ Btw, it's from this book:
 > Free the madness that lies within
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Quotes and Citations"},
-				{Type: lexer.TokenSection1Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenBlockquoteBegin, Text: ""},
-				{Type: lexer.TokenText, Text: "Free of virtue\n"},
-				{Type: lexer.TokenLineBreak, Text: ""},
-				{Type: lexer.TokenText, Text: "Free of sin\n"},
-				{Type: lexer.TokenLineBreak, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Free of virtue"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Free of sin"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Free the madness that lies within\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
 				{Type: lexer.TokenBlockquoteEnd, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -1324,19 +1495,19 @@ Btw, it's from this book:
 > Free the madness that lies within
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Quotes and Citations"},
-				{Type: lexer.TokenSection1Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenBlockquoteBegin, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Free of virtue"},
 				{Type: lexer.TokenLineBreak, Text: ""},
-				{Type: lexer.TokenText, Text: "\n"},
-				{Type: lexer.TokenText, Text: "Free of sin "}, // extra space not a problem
+				{Type: lexer.TokenText, Text: "\nFree of sin "}, // extra space not a problem
 				{Type: lexer.TokenLineBreak, Text: ""},
-				{Type: lexer.TokenText, Text: "\n"},
-				{Type: lexer.TokenText, Text: "Free the madness that lies within\n"},
+				{Type: lexer.TokenText, Text: "\nFree the madness that lies within\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
 				{Type: lexer.TokenBlockquoteEnd, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -1350,16 +1521,64 @@ Btw, it's from this book:
 > Second block quote
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Quotes and Citations"},
-				{Type: lexer.TokenSection1Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenBlockquoteBegin, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "First block quote\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
 				{Type: lexer.TokenBlockquoteEnd, Text: ""},
 				{Type: lexer.TokenBlockquoteBegin, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Second block quote\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenBlockquoteEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name: "Nested blockquote and code block with attribution",
+			source: `
+# Quotes and Citations
+
+> Outer quote.
+>
+> > Inner quote.
+> > -- Inner Author
+>
+> ` + "```" + `
+> code
+> ` + "```" + `
+> -- Outer Author, Outer Source
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Quotes and Citations"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenBlockquoteBegin, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Outer quote."},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenBlockquoteBegin, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Inner quote.\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenBlockquoteAttrAuthor, Text: ""},
+				{Type: lexer.TokenText, Text: "Inner Author"},
+				{Type: lexer.TokenBlockquoteAttrEnd, Text: ""},
+				{Type: lexer.TokenBlockquoteEnd, Text: ""},
+				{Type: lexer.TokenCodeBlockBegin, Text: "```"},
+				{Type: lexer.TokenText, Text: "code"},
+				{Type: lexer.TokenCodeBlockEnd, Text: "```"},
+				{Type: lexer.TokenBlockquoteAttrAuthor, Text: ""},
+				{Type: lexer.TokenText, Text: "Outer Author"},
+				{Type: lexer.TokenBlockquoteAttrSource, Text: ""},
+				{Type: lexer.TokenText, Text: "Outer Source"},
+				{Type: lexer.TokenBlockquoteAttrEnd, Text: ""},
 				{Type: lexer.TokenBlockquoteEnd, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -1380,9 +1599,9 @@ Hello, here is an image:
 I hope you like it.
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Image Test"},
-				{Type: lexer.TokenSection1Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Hello, here is an image:\n"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
@@ -1393,7 +1612,7 @@ I hope you like it.
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "I hope you like it.\n"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -1409,12 +1628,12 @@ Hello, here is an image:
 I hope you like it.
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Image Test"},
-				{Type: lexer.TokenSection1Content, Text: ""},
-				{Type: lexer.TokenSection2Begin, Text: "##"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionBegin, Text: "##"},
 				{Type: lexer.TokenText, Text: "With Alt Text"},
-				{Type: lexer.TokenSection2Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Hello, here is an image:\n"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
@@ -1426,8 +1645,8 @@ I hope you like it.
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "I hope you like it.\n"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
-				{Type: lexer.TokenSection2End, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -1449,15 +1668,15 @@ The following \&nbsp; turns into a non-break space.
 Here you have it in mono space: ` + "`" + `&nbsp;` + "`" + `
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Section 1"},
-				{Type: lexer.TokenSection1Content, Text: ""},
-				{Type: lexer.TokenSection2Begin, Text: "##"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionBegin, Text: "##"},
 				{Type: lexer.TokenText, Text: "Section 2 "},
 				{Type: lexer.TokenAttributeListBegin, Text: "{"},
 				{Type: lexer.TokenAttributeListID, Text: "escape-tut"},
 				{Type: lexer.TokenAttributeListEnd, Text: "}"},
-				{Type: lexer.TokenSection2Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "The following "},
 				{Type: lexer.TokenText, Text: "&"},
@@ -1468,8 +1687,8 @@ Here you have it in mono space: ` + "`" + `&nbsp;` + "`" + `
 				{Type: lexer.TokenMono, Text: "&nbsp;"},
 				{Type: lexer.TokenText, Text: "\n"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
-				{Type: lexer.TokenSection2End, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -1517,9 +1736,9 @@ Paragraph 2.
 Even more text.
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Section 1"},
-				{Type: lexer.TokenSection1Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Paragraph 1.\nMore text."},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
@@ -1527,7 +1746,7 @@ Even more text.
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Paragraph 2.\nEven more text.\n"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -1547,12 +1766,12 @@ Paragraph 2.
 Even more text.
 `,
 			expected: []lexer.Token{
-				{Type: lexer.TokenSection1Begin, Text: "#"},
+				{Type: lexer.TokenSectionBegin, Text: "#"},
 				{Type: lexer.TokenText, Text: "Section 1"},
-				{Type: lexer.TokenSection1Content, Text: ""},
-				{Type: lexer.TokenSection2Begin, Text: "##"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionBegin, Text: "##"},
 				{Type: lexer.TokenText, Text: "Section 2"},
-				{Type: lexer.TokenSection2Content, Text: ""},
+				{Type: lexer.TokenSectionContent, Text: ""},
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Paragraph 1.\nMore text."},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
@@ -1560,8 +1779,8 @@ Even more text.
 				{Type: lexer.TokenParagraphBegin, Text: ""},
 				{Type: lexer.TokenText, Text: "Paragraph 2.\nEven more text.\n"},
 				{Type: lexer.TokenParagraphEnd, Text: ""},
-				{Type: lexer.TokenSection2End, Text: ""},
-				{Type: lexer.TokenSection1End, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
 				{Type: lexer.TokenEOF, Text: ""},
 			},
 		},
@@ -1569,39 +1788,1348 @@ Even more text.
 	RunTests(t, testCases)
 }
 
-type TestCase struct {
-	name, source   string
-	expected       []lexer.Token
-	expectedErrors []string
-}
+func TestLexList(t *testing.T) {
+	testCases := []TestCase{
+		{
+			name: "Unordered list",
+			source: `
+# Section 1
 
-func RunTests(t *testing.T, testCases []TestCase) {
-	lx := lexer.New()
-	for _, testCase := range testCases {
-		t.Log("now testing", testCase.name)
-		lx.LexSource(testCase.name, testCase.source)
-		diffTokens := deep.Equal(lx.Lexemes, testCase.expected)
-		for _, diff := range diffTokens {
-			t.Error(diff)
-		}
-		diffErrors := deep.Equal(innerErrorStrings(lx.Errors), testCase.expectedErrors)
-		for _, diff := range diffErrors {
-			t.Error(diff)
-		}
-		lx.Clear()
-	}
-}
+- First item
+- Second item
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Section 1"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenListUnorderedBegin, Text: ""},
+				{Type: lexer.TokenListItemBegin, Text: "-"},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "First item"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenListItemEnd, Text: ""},
+				{Type: lexer.TokenListItemBegin, Text: "-"},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Second item\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenListItemEnd, Text: ""},
+				{Type: lexer.TokenListEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name: "Changing the bullet starts a new list",
+			source: `
+# Section 1
 
-func innerErrorStrings(es []error) (ss []string) {
-	for _, e := range es {
-		ss = append(ss, innerErrorString(e))
-	}
-	return ss
-}
+- One list
+* Another list
 
-func innerErrorString(e error) string {
-	if lxe, ok := e.(lexer.LexerError); ok {
-		return lxe.Inner.Error()
-	}
-	return e.Error()
+* Still the other list
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Section 1"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenListUnorderedBegin, Text: ""},
+				{Type: lexer.TokenListItemBegin, Text: "-"},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "One list"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenListItemEnd, Text: ""},
+				{Type: lexer.TokenListEnd, Text: ""},
+				{Type: lexer.TokenListUnorderedBegin, Text: ""},
+				{Type: lexer.TokenListItemBegin, Text: "*"},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Another list"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenListItemEnd, Text: ""},
+				{Type: lexer.TokenListItemBegin, Text: "*"},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Still the other list\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenListItemEnd, Text: ""},
+				{Type: lexer.TokenListEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name: "Ordered list directly following a paragraph",
+			source: `
+# Section 1
+
+Steps:
+1. First
+2. Second
+
+After the list.
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Section 1"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Steps:"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenListOrderedBegin, Text: ""},
+				{Type: lexer.TokenListItemBegin, Text: "1."},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "First"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenListItemEnd, Text: ""},
+				{Type: lexer.TokenListItemBegin, Text: "2."},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Second"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenListItemEnd, Text: ""},
+				{Type: lexer.TokenListEnd, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "After the list.\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name: "Number at the start of a wrapped line",
+			source: `
+# Section 1
+
+The war ended in
+1945. After that, it was rebuilt.
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Section 1"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "The war ended in\n1945. After that, it was rebuilt.\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name: "Ordered list not starting at one",
+			source: `
+# Section 1
+
+3. Third
+4. Fourth
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Section 1"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenListOrderedBegin, Text: ""},
+				{Type: lexer.TokenListItemBegin, Text: "3."},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Third"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenListItemEnd, Text: ""},
+				{Type: lexer.TokenListItemBegin, Text: "4."},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Fourth\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenListItemEnd, Text: ""},
+				{Type: lexer.TokenListEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name: "Nested list and multi-paragraph list item",
+			source: `
+# Section 1
+
+* Item
+  continued.
+
+  Second paragraph.
+  1. Nested
+* Last
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Section 1"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenListUnorderedBegin, Text: ""},
+				{Type: lexer.TokenListItemBegin, Text: "*"},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Item\n"},
+				{Type: lexer.TokenText, Text: "continued."},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Second paragraph."},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenListOrderedBegin, Text: ""},
+				{Type: lexer.TokenListItemBegin, Text: "1."},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Nested"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenListItemEnd, Text: ""},
+				{Type: lexer.TokenListEnd, Text: ""},
+				{Type: lexer.TokenListItemEnd, Text: ""},
+				{Type: lexer.TokenListItemBegin, Text: "*"},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Last\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenListItemEnd, Text: ""},
+				{Type: lexer.TokenListEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name: "Task list",
+			source: `
+# Section 1
+
+- [ ] Open
+- [x] Done
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Section 1"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenListUnorderedBegin, Text: ""},
+				{Type: lexer.TokenListItemBegin, Text: "-"},
+				{Type: lexer.TokenListItemTask, Text: "[ ]"},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Open"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenListItemEnd, Text: ""},
+				{Type: lexer.TokenListItemBegin, Text: "-"},
+				{Type: lexer.TokenListItemTask, Text: "[x]"},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Done\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenListItemEnd, Text: ""},
+				{Type: lexer.TokenListEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name: "Code block in a list item and a task without text",
+			source: `
+# Section 1
+
+- one
+- two
+
+  ` + "```" + `go
+  x := 1
+  ` + "```" + `
+- [ ]
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Section 1"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenListUnorderedBegin, Text: ""},
+				{Type: lexer.TokenListItemBegin, Text: "-"},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "one"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenListItemEnd, Text: ""},
+				{Type: lexer.TokenListItemBegin, Text: "-"},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "two"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenCodeBlockBegin, Text: "```"},
+				{Type: lexer.TokenCodeBlockLang, Text: "go"},
+				{Type: lexer.TokenText, Text: "x := 1"},
+				{Type: lexer.TokenCodeBlockEnd, Text: "```"},
+				{Type: lexer.TokenListItemEnd, Text: ""},
+				{Type: lexer.TokenListItemBegin, Text: "-"},
+				{Type: lexer.TokenListItemTask, Text: "[ ]"},
+				{Type: lexer.TokenListItemEnd, Text: ""},
+				{Type: lexer.TokenListEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+	}
+	RunTests(t, testCases)
+}
+
+func TestLexTable(t *testing.T) {
+	testCases := []TestCase{
+		{
+			name: "Table with alignment and caption",
+			source: `
+# Section 1
+
+| Name | ns/op |
+|:-----|------:|
+| Lexer | 12 |
+{#bench caption="Results"}
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Section 1"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenTableBegin, Text: ""},
+				{Type: lexer.TokenTableRowBegin, Text: ""},
+				{Type: lexer.TokenTableCellBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Name "},
+				{Type: lexer.TokenTableCellEnd, Text: ""},
+				{Type: lexer.TokenTableCellBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "ns/op "},
+				{Type: lexer.TokenTableCellEnd, Text: ""},
+				{Type: lexer.TokenTableRowEnd, Text: ""},
+				{Type: lexer.TokenTableAlignment, Text: ":-----"},
+				{Type: lexer.TokenTableAlignment, Text: "------:"},
+				{Type: lexer.TokenTableRowBegin, Text: ""},
+				{Type: lexer.TokenTableCellBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Lexer "},
+				{Type: lexer.TokenTableCellEnd, Text: ""},
+				{Type: lexer.TokenTableCellBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "12 "},
+				{Type: lexer.TokenTableCellEnd, Text: ""},
+				{Type: lexer.TokenTableRowEnd, Text: ""},
+				{Type: lexer.TokenAttributeListBegin, Text: "{"},
+				{Type: lexer.TokenAttributeListID, Text: "bench"},
+				{Type: lexer.TokenAttributeListKey, Text: "caption"},
+				{Type: lexer.TokenText, Text: "Results"},
+				{Type: lexer.TokenAttributeListEnd, Text: "}"},
+				{Type: lexer.TokenTableEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name: "Table with links, footnote references, and an escaped pipe",
+			source: `
+# Section 1
+
+| Tool | Notes |
+|------|-------|
+| [Go][go] | fast[^1] \| small |
+| [x](https://example.org) | ok |
+
+[go]: https://go.dev
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Section 1"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenTableBegin, Text: ""},
+				{Type: lexer.TokenTableRowBegin, Text: ""},
+				{Type: lexer.TokenTableCellBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Tool "},
+				{Type: lexer.TokenTableCellEnd, Text: ""},
+				{Type: lexer.TokenTableCellBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Notes "},
+				{Type: lexer.TokenTableCellEnd, Text: ""},
+				{Type: lexer.TokenTableRowEnd, Text: ""},
+				{Type: lexer.TokenTableAlignment, Text: "------"},
+				{Type: lexer.TokenTableAlignment, Text: "-------"},
+				{Type: lexer.TokenTableRowBegin, Text: ""},
+				{Type: lexer.TokenTableCellBegin, Text: ""},
+				{Type: lexer.TokenLinkableBegin, Text: "["},
+				{Type: lexer.TokenText, Text: "Go"},
+				{Type: lexer.TokenLinkRef, Text: "go"},
+				{Type: lexer.TokenLinkableEnd, Text: ""},
+				{Type: lexer.TokenText, Text: " "},
+				{Type: lexer.TokenTableCellEnd, Text: ""},
+				{Type: lexer.TokenTableCellBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "fast"},
+				{Type: lexer.TokenFootnoteRef, Text: "1"},
+				{Type: lexer.TokenText, Text: " "},
+				{Type: lexer.TokenText, Text: "|"},
+				{Type: lexer.TokenText, Text: " small "},
+				{Type: lexer.TokenTableCellEnd, Text: ""},
+				{Type: lexer.TokenTableRowEnd, Text: ""},
+				{Type: lexer.TokenTableRowBegin, Text: ""},
+				{Type: lexer.TokenTableCellBegin, Text: ""},
+				{Type: lexer.TokenLinkableBegin, Text: "["},
+				{Type: lexer.TokenText, Text: "x"},
+				{Type: lexer.TokenLinkHref, Text: "https://example.org"},
+				{Type: lexer.TokenLinkableEnd, Text: ""},
+				{Type: lexer.TokenText, Text: " "},
+				{Type: lexer.TokenTableCellEnd, Text: ""},
+				{Type: lexer.TokenTableCellBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "ok "},
+				{Type: lexer.TokenTableCellEnd, Text: ""},
+				{Type: lexer.TokenTableRowEnd, Text: ""},
+				{Type: lexer.TokenTableEnd, Text: ""},
+				{Type: lexer.TokenLinkDef, Text: "go"},
+				{Type: lexer.TokenText, Text: "https://go.dev"},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name: "Table without outer pipes directly following a paragraph",
+			source: `
+# Section 1
+
+Results:
+| *a* | b \| c
+|-----|:--:
+| 1
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Section 1"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Results:"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenTableBegin, Text: ""},
+				{Type: lexer.TokenTableRowBegin, Text: ""},
+				{Type: lexer.TokenTableCellBegin, Text: ""},
+				{Type: lexer.TokenEmphasisBegin, Text: "*"},
+				{Type: lexer.TokenText, Text: "a"},
+				{Type: lexer.TokenEmphasisEnd, Text: "*"},
+				{Type: lexer.TokenText, Text: " "},
+				{Type: lexer.TokenTableCellEnd, Text: ""},
+				{Type: lexer.TokenTableCellBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "b "},
+				{Type: lexer.TokenText, Text: "|"},
+				{Type: lexer.TokenText, Text: " c"},
+				{Type: lexer.TokenTableCellEnd, Text: ""},
+				{Type: lexer.TokenTableRowEnd, Text: ""},
+				{Type: lexer.TokenTableAlignment, Text: "-----"},
+				{Type: lexer.TokenTableAlignment, Text: ":--:"},
+				{Type: lexer.TokenTableRowBegin, Text: ""},
+				{Type: lexer.TokenTableCellBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "1"},
+				{Type: lexer.TokenTableCellEnd, Text: ""},
+				{Type: lexer.TokenTableRowEnd, Text: ""},
+				{Type: lexer.TokenTableEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+	}
+	RunTests(t, testCases)
+}
+
+func TestLexMath(t *testing.T) {
+	testCases := []TestCase{
+		{
+			name: "Inline math",
+			source: `
+# Math
+
+Euler: $e^{i\pi} + 1 = 0$, *but $x_1$*.
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Math"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Euler: "},
+				{Type: lexer.TokenMathInline, Text: "e^{i\\pi} + 1 = 0"},
+				{Type: lexer.TokenText, Text: ", "},
+				{Type: lexer.TokenEmphasisBegin, Text: "*"},
+				{Type: lexer.TokenText, Text: "but "},
+				{Type: lexer.TokenMathInline, Text: "x_1"},
+				{Type: lexer.TokenEmphasisEnd, Text: "*"},
+				{Type: lexer.TokenText, Text: ".\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name: "Dollar signs that are not math",
+			source: `
+# Math
+
+It costs $5 or $10.
+
+An escaped \$x$.
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Math"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "It costs $5 or $10."},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "An escaped "},
+				{Type: lexer.TokenText, Text: "$"},
+				{Type: lexer.TokenText, Text: "x$.\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name: "Display math",
+			source: `
+# Math
+
+$$
+\sum_{i=1}^n i = \frac{n(n+1)}{2}
+$$
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Math"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenMathDisplay, Text: "\n\\sum_{i=1}^n i = \\frac{n(n+1)}{2}\n"},
+				{Type: lexer.TokenText, Text: "\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+	}
+	RunTests(t, testCases)
+}
+
+func TestLexFootnotes(t *testing.T) {
+	testCases := []TestCase{
+		{
+			name: "Footnote references and a multi paragraph definition",
+			source: `
+# Notes
+
+A claim [^1] and a word[^2] with a sidenote.
+
+[^1]: First paragraph.
+
+    Second *paragraph*.
+
+[^2]: A sidenote.
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Notes"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "A claim "},
+				{Type: lexer.TokenFootnoteRef, Text: "1"},
+				{Type: lexer.TokenText, Text: " and a "},
+				{Type: lexer.TokenLinkableBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "word"},
+				{Type: lexer.TokenSidenoteRef, Text: "2"},
+				{Type: lexer.TokenLinkableEnd, Text: ""},
+				{Type: lexer.TokenText, Text: " with a sidenote."},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSidenoteDef, Text: "1"},
+				{Type: lexer.TokenText, Text: "First paragraph."},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Second "},
+				{Type: lexer.TokenEmphasisBegin, Text: "*"},
+				{Type: lexer.TokenText, Text: "paragraph"},
+				{Type: lexer.TokenEmphasisEnd, Text: "*"},
+				{Type: lexer.TokenText, Text: "."},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSidenoteDefEnd, Text: ""},
+				{Type: lexer.TokenSidenoteDef, Text: "2"},
+				{Type: lexer.TokenText, Text: "A sidenote."},
+				{Type: lexer.TokenSidenoteDefEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name: "Footnote references in emphasis and strong",
+			source: `
+# Notes
+
+*em [^a]* and **strong [^b]**
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Notes"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenEmphasisBegin, Text: "*"},
+				{Type: lexer.TokenText, Text: "em "},
+				{Type: lexer.TokenFootnoteRef, Text: "a"},
+				{Type: lexer.TokenEmphasisEnd, Text: "*"},
+				{Type: lexer.TokenText, Text: " and "},
+				{Type: lexer.TokenStrongBegin, Text: "**"},
+				{Type: lexer.TokenText, Text: "strong "},
+				{Type: lexer.TokenFootnoteRef, Text: "b"},
+				{Type: lexer.TokenStrongEnd, Text: "**"},
+				{Type: lexer.TokenText, Text: "\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+	}
+	RunTests(t, testCases)
+}
+
+func TestLexAdmonitions(t *testing.T) {
+	testCases := []TestCase{
+		{
+			name: "Unindented line directly after the content",
+			source: `
+# Boxes
+
+???+ danger
+    Open one.
+Directly after.
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Boxes"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenAdmonitionBegin, Text: "???+"},
+				{Type: lexer.TokenAdmonitionType, Text: "danger"},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Open one."},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenAdmonitionEnd, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Directly after.\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+	}
+	RunTests(t, testCases)
+}
+
+func TestLexEnquote(t *testing.T) {
+	testCases := []TestCase{
+		{
+			name: "TeX style double enquote with a nested single enquote",
+			source: `
+# Quotes
+
+He said ` + "``" + `it's ` + "`" + `fine' now'' and ` + "``" + `code` + "``" + `.
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Quotes"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "He said "},
+				{Type: lexer.TokenEnquoteDoubleBegin, Text: "``"},
+				{Type: lexer.TokenText, Text: "it"},
+				{Type: lexer.TokenAmpSpecial, Text: "'"},
+				{Type: lexer.TokenText, Text: "s "},
+				{Type: lexer.TokenEnquoteSingleBegin, Text: "`"},
+				{Type: lexer.TokenText, Text: "fine"},
+				{Type: lexer.TokenEnquoteSingleEnd, Text: "'"},
+				{Type: lexer.TokenText, Text: " now"},
+				{Type: lexer.TokenEnquoteDoubleEnd, Text: "''"},
+				{Type: lexer.TokenText, Text: " and "},
+				{Type: lexer.TokenMono, Text: ""},
+				{Type: lexer.TokenText, Text: "code"},
+				{Type: lexer.TokenMono, Text: ""},
+				{Type: lexer.TokenText, Text: ".\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+	}
+	RunTests(t, testCases)
+}
+
+func TestLexLinkDestination(t *testing.T) {
+	testCases := []TestCase{
+		{
+			name: "Balanced parentheses in the href",
+			source: `
+# Links
+
+See [Go](https://en.wikipedia.org/wiki/Go_(programming_language))
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Links"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "See "},
+				{Type: lexer.TokenLinkableBegin, Text: "["},
+				{Type: lexer.TokenText, Text: "Go"},
+				{Type: lexer.TokenLinkHref, Text: "https://en.wikipedia.org/wiki/Go_(programming_language)"},
+				{Type: lexer.TokenLinkableEnd, Text: ""},
+				{Type: lexer.TokenText, Text: "\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name: "Escaped parentheses in the href",
+			source: `
+# Links
+
+See [Emoticon](https://example.com/a_\))
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Links"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "See "},
+				{Type: lexer.TokenLinkableBegin, Text: "["},
+				{Type: lexer.TokenText, Text: "Emoticon"},
+				{Type: lexer.TokenLinkHref, Text: "https://example.com/a_)"},
+				{Type: lexer.TokenLinkableEnd, Text: ""},
+				{Type: lexer.TokenText, Text: "\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name: "Href in angle brackets with a title",
+			source: `
+# Links
+
+See [Notes](</files/my notes.pdf> "My \"notes\"")
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Links"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "See "},
+				{Type: lexer.TokenLinkableBegin, Text: "["},
+				{Type: lexer.TokenText, Text: "Notes"},
+				{Type: lexer.TokenLinkHref, Text: "/files/my notes.pdf"},
+				{Type: lexer.TokenLinkTitle, Text: "My \"notes\""},
+				{Type: lexer.TokenLinkableEnd, Text: ""},
+				{Type: lexer.TokenText, Text: "\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name: "Single quoted title",
+			source: `
+# Links
+
+See [Example](https://example.com 'Example')
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Links"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "See "},
+				{Type: lexer.TokenLinkableBegin, Text: "["},
+				{Type: lexer.TokenText, Text: "Example"},
+				{Type: lexer.TokenLinkHref, Text: "https://example.com"},
+				{Type: lexer.TokenLinkTitle, Text: "Example"},
+				{Type: lexer.TokenLinkableEnd, Text: ""},
+				{Type: lexer.TokenText, Text: "\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name:   "Unclosed title",
+			source: "# Links\n\nSee [z](http://x \"unterminated).\n\nNext paragraph.\n",
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Links"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "See "},
+				{Type: lexer.TokenLinkableBegin, Text: "["},
+				{Type: lexer.TokenText, Text: "z"},
+				{Type: lexer.TokenLinkHref, Text: "http://x"},
+				{Type: lexer.TokenLinkableEnd, Text: ""},
+				{Type: lexer.TokenText, Text: "unterminated)."},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Next paragraph.\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+			expectedErrors: []string{"link title is not closed, expected: `\"`"},
+		},
+	}
+	RunTests(t, testCases)
+}
+
+func TestLexInlineAttributeLists(t *testing.T) {
+	testCases := []TestCase{
+		{
+			name: "Span with attributes",
+			source: `
+# Spans
+
+[漢字]{.jp lang=ja} reads kanji.
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Spans"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenLinkableBegin, Text: "["},
+				{Type: lexer.TokenText, Text: "漢字"},
+				{Type: lexer.TokenAttributeListBegin, Text: "{"},
+				{Type: lexer.TokenAttributeListKey, Text: ".jp"},
+				{Type: lexer.TokenAttributeListKey, Text: "lang"},
+				{Type: lexer.TokenText, Text: "ja"},
+				{Type: lexer.TokenAttributeListEnd, Text: "}"},
+				{Type: lexer.TokenLinkableEnd, Text: ""},
+				{Type: lexer.TokenText, Text: " reads kanji.\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name: "Paragraph with attributes",
+			source: `
+# Paragraphs
+
+The lead paragraph. {#intro .lead}
+
+Not {an attribute list} here.
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Paragraphs"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "The lead paragraph. "},
+				{Type: lexer.TokenAttributeListBegin, Text: "{"},
+				{Type: lexer.TokenAttributeListID, Text: "intro"},
+				{Type: lexer.TokenAttributeListKey, Text: ".lead"},
+				{Type: lexer.TokenAttributeListEnd, Text: "}"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Not {an attribute list} here.\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name: "Image with attributes",
+			source: `
+# Images
+
+![A cat](/img/cat.jpg "Cat"){#cat .wide}
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Images"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenImageBegin, Text: "!["},
+				{Type: lexer.TokenImageAltText, Text: "A cat"},
+				{Type: lexer.TokenImagePath, Text: "/img/cat.jpg"},
+				{Type: lexer.TokenImageTitle, Text: "Cat"},
+				{Type: lexer.TokenAttributeListBegin, Text: "{"},
+				{Type: lexer.TokenAttributeListID, Text: "cat"},
+				{Type: lexer.TokenAttributeListKey, Text: ".wide"},
+				{Type: lexer.TokenAttributeListEnd, Text: "}"},
+				{Type: lexer.TokenImageEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+	}
+	RunTests(t, testCases)
+}
+
+func TestLexRuby(t *testing.T) {
+	testCases := []TestCase{
+		{
+			name: "Ruby in emphasis",
+			source: `
+# Ruby
+
+*{日本|に|ほん}* is not {a set}.
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Ruby"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenEmphasisBegin, Text: "*"},
+				{Type: lexer.TokenRubyBegin, Text: "{"},
+				{Type: lexer.TokenRubyBase, Text: "日本"},
+				{Type: lexer.TokenRubyText, Text: "に"},
+				{Type: lexer.TokenRubyText, Text: "ほん"},
+				{Type: lexer.TokenRubyEnd, Text: "}"},
+				{Type: lexer.TokenEmphasisEnd, Text: "*"},
+				{Type: lexer.TokenText, Text: " is not {a set}.\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name: "Empty reading",
+			source: `
+# Ruby
+
+{送り|おく|}
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Ruby"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenRubyBegin, Text: "{"},
+				{Type: lexer.TokenRubyBase, Text: "送り"},
+				{Type: lexer.TokenRubyText, Text: "おく"},
+				{Type: lexer.TokenRubyText, Text: ""},
+				{Type: lexer.TokenRubyEnd, Text: "}"},
+				{Type: lexer.TokenText, Text: "\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+	}
+	RunTests(t, testCases)
+}
+
+func TestLexScriptsAndKbd(t *testing.T) {
+	testCases := []TestCase{
+		{
+			name: "Superscript, subscript and non-breaking space",
+			source: `
+# Scripts
+
+The sum over x (~i~) is 2^10^ times 10~km.
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Scripts"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "The sum over x ("},
+				{Type: lexer.TokenSubscript, Text: "i"},
+				{Type: lexer.TokenText, Text: ") is 2"},
+				{Type: lexer.TokenSuperscript, Text: "10"},
+				{Type: lexer.TokenText, Text: " times 10"},
+				{Type: lexer.TokenAmpSpecial, Text: "~"},
+				{Type: lexer.TokenText, Text: "km.\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name: "Chains of non-breaking spaces",
+			source: `
+# Scripts
+
+A 10~km~wide road, by Dr.~A~B and ~x~.
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Scripts"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "A 10"},
+				{Type: lexer.TokenAmpSpecial, Text: "~"},
+				{Type: lexer.TokenText, Text: "km"},
+				{Type: lexer.TokenAmpSpecial, Text: "~"},
+				{Type: lexer.TokenText, Text: "wide road, by Dr."},
+				{Type: lexer.TokenAmpSpecial, Text: "~"},
+				{Type: lexer.TokenText, Text: "A"},
+				{Type: lexer.TokenAmpSpecial, Text: "~"},
+				{Type: lexer.TokenText, Text: "B and "},
+				{Type: lexer.TokenSubscript, Text: "x"},
+				{Type: lexer.TokenText, Text: ".\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name: "Keyboard keys and abbreviation definitions",
+			source: `
+# Keys
+
+Press [[Ctrl]]+[[C]].
+*[HTML]: HyperText Markup Language
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Keys"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Press "},
+				{Type: lexer.TokenKbd, Text: "Ctrl"},
+				{Type: lexer.TokenText, Text: "+"},
+				{Type: lexer.TokenKbd, Text: "C"},
+				{Type: lexer.TokenText, Text: "."},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenAbbreviationDef, Text: "HTML"},
+				{Type: lexer.TokenText, Text: "HyperText Markup Language"},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+	}
+	RunTests(t, testCases)
+}
+
+func TestLexComments(t *testing.T) {
+	testCases := []TestCase{
+		{
+			name: "Line comments",
+			source: `
+%% TODO: pick a better title
+# Comments
+
+First line
+%% whole line comment
+second line, 50\% and %% trailing comment
+third line.
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Comments"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "First line\n"},
+				{Type: lexer.TokenText, Text: "second line, 50"},
+				{Type: lexer.TokenText, Text: "%"},
+				{Type: lexer.TokenText, Text: " and"},
+				{Type: lexer.TokenText, Text: "\nthird line.\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+			expectedComments: []lexer.Token{
+				{Type: lexer.TokenComment, Text: "TODO: pick a better title"},
+				{Type: lexer.TokenComment, Text: "whole line comment"},
+				{Type: lexer.TokenComment, Text: "trailing comment"},
+			},
+		},
+		{
+			name:   "Percent signs in prose",
+			source: "# Comments\n\nWe got 50%% off today.\n",
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Comments"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "We got 50%% off today.\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name: "Block comments",
+			source: `
+# Comments
+
+%%{
+TODO: write this section
+}%%
+
+Some *emphasis* %%{ inline }%% and more.
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Comments"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Some "},
+				{Type: lexer.TokenEmphasisBegin, Text: "*"},
+				{Type: lexer.TokenText, Text: "emphasis"},
+				{Type: lexer.TokenEmphasisEnd, Text: "*"},
+				{Type: lexer.TokenText, Text: " "},
+				{Type: lexer.TokenText, Text: " and more.\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+			expectedComments: []lexer.Token{
+				{Type: lexer.TokenComment, Text: "TODO: write this section"},
+				{Type: lexer.TokenComment, Text: "inline"},
+			},
+		},
+		{
+			name: "Unterminated block comment",
+			source: `
+# Comments
+
+Text.
+%%{ never closed
+`,
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "Comments"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Text.\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+			expectedComments: []lexer.Token{
+				{Type: lexer.TokenComment, Text: "never closed"},
+			},
+			expectedErrors: []string{"unterminated block comment"},
+		},
+	}
+	RunTests(t, testCases)
+}
+
+func TestLexRecovery(t *testing.T) {
+	testCases := []TestCase{
+		{
+			name:   "Unclosed Element Ends at Empty Line",
+			source: "# T\n\nA *b ~~strike\n\nNext.\n",
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "T"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "A "},
+				{Type: lexer.TokenEmphasisBegin, Text: "*"},
+				{Type: lexer.TokenText, Text: "b "},
+				{Type: lexer.TokenStrikethroughBegin, Text: "~~"},
+				{Type: lexer.TokenText, Text: "strike"},
+				{Type: lexer.TokenStrikethroughEnd, Text: ""},
+				{Type: lexer.TokenEmphasisEnd, Text: ""},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Next.\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+			expectedErrors: []string{"expected: `~~`, got: `\\n\\n`"},
+		},
+		{
+			name:   "Unclosed Mono",
+			source: "# T\n\nSome `mono\n\nNext `ok`.\n",
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "T"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Some "},
+				{Type: lexer.TokenMono, Text: "mono"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Next "},
+				{Type: lexer.TokenMono, Text: "ok"},
+				{Type: lexer.TokenText, Text: ".\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+			expectedErrors: []string{"expected: ```, got: `\\n`"},
+		},
+		{
+			name:   "Missing Html Tag Name",
+			source: "# T\n\na < b and <span>c</span>\n",
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "T"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "a "},
+				{Type: lexer.TokenText, Text: " b and "},
+				{Type: lexer.TokenHtmlTagOpen, Text: "span"},
+				{Type: lexer.TokenHtmlTagContent, Text: ""},
+				{Type: lexer.TokenText, Text: "c"},
+				{Type: lexer.TokenHtmlTagClose, Text: ""},
+				{Type: lexer.TokenText, Text: "\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+			expectedErrors: []string{"expected html tag name"},
+		},
+		{
+			name:   "Indented Term",
+			source: "# T\n\n  Term\n: x\n",
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "T"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenDefinitionListBegin, Text: ""},
+				{Type: lexer.TokenDefinitionTerm, Text: "Term"},
+				{Type: lexer.TokenDefinitionExplanationBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "x"},
+				{Type: lexer.TokenDefinitionExplanationEnd, Text: ""},
+				{Type: lexer.TokenDefinitionListEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+		},
+		{
+			name:   "Unclosed Code Block Attribute List",
+			source: "# T\n\n```go {hl=\nfmt.Println()\n```\n\nNext.\n",
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "T"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenCodeBlockBegin, Text: "```"},
+				{Type: lexer.TokenCodeBlockLang, Text: "go"},
+				{Type: lexer.TokenAttributeListBegin, Text: "{"},
+				{Type: lexer.TokenAttributeListKey, Text: "hl"},
+				{Type: lexer.TokenAttributeListEnd, Text: ""},
+				{Type: lexer.TokenText, Text: "fmt.Println()"},
+				{Type: lexer.TokenCodeBlockEnd, Text: "```"},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Next.\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+			expectedErrors: []string{"expected: `}`, got: `\\n`"},
+		},
+		{
+			name:   "Unclosed Code Block Attribute List at the End",
+			source: "# T\n\n```go {hl=",
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "T"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenCodeBlockBegin, Text: "```"},
+				{Type: lexer.TokenCodeBlockLang, Text: "go"},
+				{Type: lexer.TokenAttributeListBegin, Text: "{"},
+				{Type: lexer.TokenAttributeListKey, Text: "hl"},
+				{Type: lexer.TokenAttributeListEnd, Text: ""},
+				{Type: lexer.TokenCodeBlockEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+			expectedErrors: []string{"expected: `}`, got: ``"},
+		},
+		{
+			name:   "Unclosed Image Alt Text",
+			source: "# T\n\nA broken ![image(foo.png\n\nLater a [missing][nope] link.\n",
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "T"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "A broken "},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenImageBegin, Text: "!["},
+				{Type: lexer.TokenImageAltText, Text: "image(foo.png"},
+				{Type: lexer.TokenImageEnd, Text: ""},
+				{Type: lexer.TokenParagraphBegin, Text: ""},
+				{Type: lexer.TokenText, Text: "Later a "},
+				{Type: lexer.TokenLinkableBegin, Text: "["},
+				{Type: lexer.TokenText, Text: "missing"},
+				{Type: lexer.TokenLinkRef, Text: "nope"},
+				{Type: lexer.TokenLinkableEnd, Text: ""},
+				{Type: lexer.TokenText, Text: " link.\n"},
+				{Type: lexer.TokenParagraphEnd, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+			expectedErrors: []string{"expected: `]`, got: `\\n`"},
+		},
+		{
+			name:   "Invalid Content Skipped up to Next Section",
+			source: "garbage [x] here\n# T\n",
+			expected: []lexer.Token{
+				{Type: lexer.TokenSectionBegin, Text: "#"},
+				{Type: lexer.TokenText, Text: "T"},
+				{Type: lexer.TokenSectionContent, Text: ""},
+				{Type: lexer.TokenSectionEnd, Text: ""},
+				{Type: lexer.TokenEOF, Text: ""},
+			},
+			expectedErrors: []string{"content must start with section, html element, or link or sidenote definition"},
+		},
+	}
+	RunTests(t, testCases)
+}
+
+type TestCase struct {
+	name, source     string
+	expected         []lexer.Token
+	expectedComments []lexer.Token
+	expectedErrors   []string
+}
+
+func RunTests(t *testing.T, testCases []TestCase) {
+	lx := lexer.New()
+	for _, testCase := range testCases {
+		t.Log("now testing", testCase.name)
+		lx.LexSource(testCase.name, testCase.source)
+		diffTokens := deep.Equal(lx.Lexemes, testCase.expected)
+		for _, diff := range diffTokens {
+			t.Error(diff)
+		}
+		diffComments := deep.Equal(lx.Comments, testCase.expectedComments)
+		for _, diff := range diffComments {
+			t.Error(diff)
+		}
+		diffErrors := deep.Equal(innerErrorStrings(lx.Errors), testCase.expectedErrors)
+		for _, diff := range diffErrors {
+			t.Error(diff)
+		}
+		lx.Clear()
+	}
+}
+
+func innerErrorStrings(es []error) (ss []string) {
+	for _, e := range es {
+		ss = append(ss, innerErrorString(e))
+	}
+	return ss
+}
+
+func innerErrorString(e error) string {
+	if lxe, ok := e.(lexer.LexerError); ok {
+		return lxe.Inner.Error()
+	}
+	return e.Error()
+}
+
+func TestLexSpans(t *testing.T) {
+	lx := lexer.New()
+	err := lx.LexSource("spans.md", "# Title\n\nSome *text* with 日本語\nover two lines.\n\n> Quoted *text*\n> on two.\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	type span struct {
+		Type       lexer.TokenType
+		Start, End string
+	}
+	expected := []span{
+		{lexer.TokenSectionBegin, "spans.md:1:1", "1:2"},
+		{lexer.TokenText, "spans.md:1:3", "1:8"},
+		{lexer.TokenSectionContent, "spans.md:1:8", "1:8"},
+		{lexer.TokenParagraphBegin, "spans.md:3:1", "3:1"},
+		{lexer.TokenText, "spans.md:3:1", "3:6"},
+		{lexer.TokenEmphasisBegin, "spans.md:3:6", "3:7"},
+		{lexer.TokenText, "spans.md:3:7", "3:11"},
+		{lexer.TokenEmphasisEnd, "spans.md:3:11", "3:12"},
+		{lexer.TokenText, "spans.md:3:12", "4:16"},
+		{lexer.TokenParagraphEnd, "spans.md:4:16", "4:16"},
+		// block quote content is lexed without the `> ` prefix, but located in the original source
+		{lexer.TokenBlockquoteBegin, "spans.md:6:1", "6:1"},
+		{lexer.TokenParagraphBegin, "spans.md:6:3", "6:3"},
+		{lexer.TokenText, "spans.md:6:3", "6:10"},
+		{lexer.TokenEmphasisBegin, "spans.md:6:10", "6:11"},
+		{lexer.TokenText, "spans.md:6:11", "6:15"},
+		{lexer.TokenEmphasisEnd, "spans.md:6:15", "6:16"},
+		{lexer.TokenText, "spans.md:6:16", "8:1"},
+		{lexer.TokenParagraphEnd, "spans.md:8:1", "8:1"},
+		{lexer.TokenBlockquoteEnd, "spans.md:8:1", "8:1"},
+		{lexer.TokenSectionEnd, "spans.md:8:1", "8:1"},
+		{lexer.TokenEOF, "spans.md:8:1", "8:1"},
+	}
+	var got []span
+	for _, token := range lx.Lexemes {
+		got = append(got, span{token.Type, token.Span.String(), token.Span.End.String()})
+	}
+	if diff := deep.Equal(got, expected); diff != nil {
+		t.Error(diff)
+	}
 }
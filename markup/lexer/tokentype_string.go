@@ -17,70 +17,99 @@ func _() {
 	_ = x[TokenHtmlTagAttrVal-6]
 	_ = x[TokenHtmlTagContent-7]
 	_ = x[TokenHtmlTagClose-8]
-	_ = x[TokenSection1Begin-9]
-	_ = x[TokenSection1Content-10]
-	_ = x[TokenSection1End-11]
-	_ = x[TokenSection2Begin-12]
-	_ = x[TokenSection2Content-13]
-	_ = x[TokenSection2End-14]
-	_ = x[TokenParagraphBegin-15]
-	_ = x[TokenParagraphEnd-16]
-	_ = x[TokenText-17]
-	_ = x[TokenLineBreak-18]
-	_ = x[TokenAmpSpecial-19]
-	_ = x[TokenMono-20]
-	_ = x[TokenEmphasisBegin-21]
-	_ = x[TokenEmphasisEnd-22]
-	_ = x[TokenStrikethroughBegin-23]
-	_ = x[TokenStrikethroughEnd-24]
-	_ = x[TokenMarkerBegin-25]
-	_ = x[TokenMarkerEnd-26]
-	_ = x[TokenStrongBegin-27]
-	_ = x[TokenStrongEnd-28]
-	_ = x[TokenEmphasisStrongBegin-29]
-	_ = x[TokenEmphasisStrongEnd-30]
-	_ = x[TokenEnquoteSingleBegin-31]
-	_ = x[TokenEnquoteSingleEnd-32]
-	_ = x[TokenEnquoteDoubleBegin-33]
-	_ = x[TokenEnquoteDoubleEnd-34]
-	_ = x[TokenEnquoteAngledBegin-35]
-	_ = x[TokenEnquoteAngledEnd-36]
-	_ = x[TokenDefinitionTerm-37]
-	_ = x[TokenDefinitionExplanationBegin-38]
-	_ = x[TokenDefinitionExplanationEnd-39]
-	_ = x[TokenHorizontalRule-40]
-	_ = x[TokenBlockquoteBegin-41]
-	_ = x[TokenBlockquoteAttrAuthor-42]
-	_ = x[TokenBlockquoteAttrSource-43]
-	_ = x[TokenBlockquoteAttrEnd-44]
-	_ = x[TokenBlockquoteEnd-45]
-	_ = x[TokenImageBegin-46]
-	_ = x[TokenImageAltText-47]
-	_ = x[TokenImagePath-48]
-	_ = x[TokenImageTitle-49]
-	_ = x[TokenImageEnd-50]
-	_ = x[TokenSidenoteRef-51]
-	_ = x[TokenSidenoteDef-52]
-	_ = x[TokenSidenoteDefEnd-53]
-	_ = x[TokenSidenoteContent-54]
-	_ = x[TokenLinkify-55]
-	_ = x[TokenLinkHref-56]
-	_ = x[TokenLinkRef-57]
-	_ = x[TokenLinkDef-58]
-	_ = x[TokenLinkableBegin-59]
-	_ = x[TokenLinkableEnd-60]
-	_ = x[TokenCodeBlockBegin-61]
-	_ = x[TokenCodeBlockLang-62]
-	_ = x[TokenCodeBlockEnd-63]
-	_ = x[TokenAttributeListBegin-64]
-	_ = x[TokenAttributeListID-65]
-	_ = x[TokenAttributeListKey-66]
-	_ = x[TokenAttributeListEnd-67]
+	_ = x[TokenSectionBegin-9]
+	_ = x[TokenSectionContent-10]
+	_ = x[TokenSectionEnd-11]
+	_ = x[TokenParagraphBegin-12]
+	_ = x[TokenParagraphEnd-13]
+	_ = x[TokenText-14]
+	_ = x[TokenLineBreak-15]
+	_ = x[TokenAmpSpecial-16]
+	_ = x[TokenMono-17]
+	_ = x[TokenMathInline-18]
+	_ = x[TokenMathDisplay-19]
+	_ = x[TokenEmphasisBegin-20]
+	_ = x[TokenEmphasisEnd-21]
+	_ = x[TokenStrikethroughBegin-22]
+	_ = x[TokenStrikethroughEnd-23]
+	_ = x[TokenMarkerBegin-24]
+	_ = x[TokenMarkerEnd-25]
+	_ = x[TokenRubyBegin-26]
+	_ = x[TokenRubyBase-27]
+	_ = x[TokenRubyText-28]
+	_ = x[TokenRubyEnd-29]
+	_ = x[TokenSuperscript-30]
+	_ = x[TokenSubscript-31]
+	_ = x[TokenKbd-32]
+	_ = x[TokenStrongBegin-33]
+	_ = x[TokenStrongEnd-34]
+	_ = x[TokenEmphasisStrongBegin-35]
+	_ = x[TokenEmphasisStrongEnd-36]
+	_ = x[TokenEnquoteSingleBegin-37]
+	_ = x[TokenEnquoteSingleEnd-38]
+	_ = x[TokenEnquoteDoubleBegin-39]
+	_ = x[TokenEnquoteDoubleEnd-40]
+	_ = x[TokenEnquoteAngledBegin-41]
+	_ = x[TokenEnquoteAngledEnd-42]
+	_ = x[TokenDefinitionListBegin-43]
+	_ = x[TokenDefinitionTerm-44]
+	_ = x[TokenDefinitionExplanationBegin-45]
+	_ = x[TokenDefinitionExplanationEnd-46]
+	_ = x[TokenDefinitionListEnd-47]
+	_ = x[TokenHorizontalRule-48]
+	_ = x[TokenBlockquoteBegin-49]
+	_ = x[TokenBlockquoteAttrAuthor-50]
+	_ = x[TokenBlockquoteAttrSource-51]
+	_ = x[TokenBlockquoteAttrEnd-52]
+	_ = x[TokenBlockquoteEnd-53]
+	_ = x[TokenAdmonitionBegin-54]
+	_ = x[TokenAdmonitionType-55]
+	_ = x[TokenAdmonitionTitle-56]
+	_ = x[TokenAdmonitionEnd-57]
+	_ = x[TokenImageBegin-58]
+	_ = x[TokenImageAltText-59]
+	_ = x[TokenImagePath-60]
+	_ = x[TokenImageTitle-61]
+	_ = x[TokenImageEnd-62]
+	_ = x[TokenSidenoteRef-63]
+	_ = x[TokenSidenoteDef-64]
+	_ = x[TokenSidenoteDefEnd-65]
+	_ = x[TokenSidenoteContent-66]
+	_ = x[TokenFootnoteRef-67]
+	_ = x[TokenLinkify-68]
+	_ = x[TokenLinkHref-69]
+	_ = x[TokenLinkRef-70]
+	_ = x[TokenLinkDef-71]
+	_ = x[TokenLinkTitle-72]
+	_ = x[TokenAbbreviationDef-73]
+	_ = x[TokenLinkableBegin-74]
+	_ = x[TokenLinkableEnd-75]
+	_ = x[TokenCodeBlockBegin-76]
+	_ = x[TokenCodeBlockLang-77]
+	_ = x[TokenCodeBlockEnd-78]
+	_ = x[TokenAttributeListBegin-79]
+	_ = x[TokenAttributeListID-80]
+	_ = x[TokenAttributeListKey-81]
+	_ = x[TokenAttributeListEnd-82]
+	_ = x[TokenListUnorderedBegin-83]
+	_ = x[TokenListOrderedBegin-84]
+	_ = x[TokenListItemBegin-85]
+	_ = x[TokenListItemTask-86]
+	_ = x[TokenListItemEnd-87]
+	_ = x[TokenListEnd-88]
+	_ = x[TokenTableBegin-89]
+	_ = x[TokenTableRowBegin-90]
+	_ = x[TokenTableCellBegin-91]
+	_ = x[TokenTableCellEnd-92]
+	_ = x[TokenTableRowEnd-93]
+	_ = x[TokenTableAlignment-94]
+	_ = x[TokenTableEnd-95]
+	_ = x[TokenComment-96]
 }
 
-const _TokenType_name = "EOFMetaBeginMetaKeyMetaEndHtmlTagOpenHtmlTagAttrKeyHtmlTagAttrValHtmlTagContentHtmlTagCloseSection1BeginSection1ContentSection1EndSection2BeginSection2ContentSection2EndParagraphBeginParagraphEndTextLineBreakAmpSpecialMonoEmphasisBeginEmphasisEndStrikethroughBeginStrikethroughEndMarkerBeginMarkerEndStrongBeginStrongEndEmphasisStrongBeginEmphasisStrongEndEnquoteSingleBeginEnquoteSingleEndEnquoteDoubleBeginEnquoteDoubleEndEnquoteAngledBeginEnquoteAngledEndDefinitionTermDefinitionExplanationBeginDefinitionExplanationEndHorizontalRuleBlockquoteBeginBlockquoteAttrAuthorBlockquoteAttrSourceBlockquoteAttrEndBlockquoteEndImageBeginImageAltTextImagePathImageTitleImageEndSidenoteRefSidenoteDefSidenoteDefEndSidenoteContentLinkifyLinkHrefLinkRefLinkDefLinkableBeginLinkableEndCodeBlockBeginCodeBlockLangCodeBlockEndAttributeListBeginAttributeListIDAttributeListKeyAttributeListEnd"
+const _TokenType_name = "EOFMetaBeginMetaKeyMetaEndHtmlTagOpenHtmlTagAttrKeyHtmlTagAttrValHtmlTagContentHtmlTagCloseSectionBeginSectionContentSectionEndParagraphBeginParagraphEndTextLineBreakAmpSpecialMonoMathInlineMathDisplayEmphasisBeginEmphasisEndStrikethroughBeginStrikethroughEndMarkerBeginMarkerEndRubyBeginRubyBaseRubyTextRubyEndSuperscriptSubscriptKbdStrongBeginStrongEndEmphasisStrongBeginEmphasisStrongEndEnquoteSingleBeginEnquoteSingleEndEnquoteDoubleBeginEnquoteDoubleEndEnquoteAngledBeginEnquoteAngledEndDefinitionListBeginDefinitionTermDefinitionExplanationBeginDefinitionExplanationEndDefinitionListEndHorizontalRuleBlockquoteBeginBlockquoteAttrAuthorBlockquoteAttrSourceBlockquoteAttrEndBlockquoteEndAdmonitionBeginAdmonitionTypeAdmonitionTitleAdmonitionEndImageBeginImageAltTextImagePathImageTitleImageEndSidenoteRefSidenoteDefSidenoteDefEndSidenoteContentFootnoteRefLinkifyLinkHrefLinkRefLinkDefLinkTitleAbbreviationDefLinkableBeginLinkableEndCodeBlockBeginCodeBlockLangCodeBlockEndAttributeListBeginAttributeListIDAttributeListKeyAttributeListEndListUnorderedBeginListOrderedBeginListItemBeginListItemTaskListItemEndListEndTableBeginTableRowBeginTableCellBeginTableCellEndTableRowEndTableAlignmentTableEndComment"
 
-var _TokenType_index = [...]uint16{0, 3, 12, 19, 26, 37, 51, 65, 79, 91, 104, 119, 130, 143, 158, 169, 183, 195, 199, 208, 218, 222, 235, 246, 264, 280, 291, 300, 311, 320, 339, 356, 374, 390, 408, 424, 442, 458, 472, 498, 522, 536, 551, 571, 591, 608, 621, 631, 643, 652, 662, 670, 681, 692, 706, 721, 728, 736, 743, 750, 763, 774, 788, 801, 813, 831, 846, 862, 878}
+var _TokenType_index = [...]uint16{0, 3, 12, 19, 26, 37, 51, 65, 79, 91, 103, 117, 127, 141, 153, 157, 166, 176, 180, 190, 201, 214, 225, 243, 259, 270, 279, 288, 296, 304, 311, 322, 331, 334, 345, 354, 373, 390, 408, 424, 442, 458, 476, 492, 511, 525, 551, 575, 592, 606, 621, 641, 661, 678, 691, 706, 720, 735, 748, 758, 770, 779, 789, 797, 808, 819, 833, 848, 859, 866, 874, 881, 888, 897, 912, 925, 936, 950, 963, 975, 993, 1008, 1024, 1040, 1058, 1074, 1087, 1099, 1110, 1117, 1127, 1140, 1154, 1166, 1177, 1191, 1199, 1206}
 
 func (i TokenType) String() string {
 	if i < 0 || i >= TokenType(len(_TokenType_index)-1) {
@@ -0,0 +1,103 @@
+package lsp
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/cvanloo/blog-go/markup/lexer"
+)
+
+// metaKeys understood by the post templates, see page.MakeGenVisitor.VisitBlog.
+var metaKeys = []struct {
+	key, detail string
+}{
+	{"template", "mandatory, post or post-quotes"},
+	{"url-path", "mandatory, path of the post relative to the site address"},
+	{"title", "mandatory"},
+	{"author", "mandatory"},
+	{"lang", "mandatory, like en or ja"},
+	{"alt-title", "title in another script, shown below the title"},
+	{"description", "summary for the head and the feeds"},
+	{"published", "date, 2006-01-02 or RFC3339"},
+	{"revised", "date, 2006-01-02 or RFC3339"},
+	{"draft", "the post is only published if this is false"},
+	{"enable-revision-warning", "true or false"},
+	{"est-reading", "estimated reading time in minutes"},
+	{"toc-depth", "deepest section level listed in the table of contents"},
+	{"series", "name of the series the post belongs to"},
+	{"tags", "space separated, may be repeated"},
+	{"email", "of the author"},
+	{"rel-me", "link to a profile of the author"},
+	{"fedi-creator", "fediverse handle of the author"},
+}
+
+// elements that may appear at the top level of a post, see page.MakeGenVisitor.htmlTopLevel.
+var elements = []struct {
+	name, snippet, detail string
+}{
+	{"Note", "Note type=\"$1\">\n$0\n</Note>", "aside with a note for the reader"},
+	{"Ruby", "Ruby furi=\"$1\">$0</Ruby>", "text with furigana"},
+	{"RelevantBox", "RelevantBox>\n<Relevant href=\"$1\" date=\"${2:2006-01-02}\" title=\"$3\">\n<Author name=\"$4\"></Author>\n<Abstract>\n$0\n</Abstract>\n</Relevant>\n</RelevantBox>", "list of related articles"},
+}
+
+// completions offers meta keys while typing a key in the meta block, and
+// elements after a `<`.
+func (d *document) completions(p Position) []CompletionItem {
+	items := []CompletionItem{}
+	offset := d.offset(p)
+	if p.Line < 0 || p.Line >= len(d.lineStarts) {
+		return items
+	}
+	before := string(d.lx.Source[d.lineStarts[p.Line]:offset])
+	if i := strings.LastIndex(before, "<"); i != -1 && isName(before[i+1:]) {
+		for _, element := range elements {
+			items = append(items, CompletionItem{
+				Label:            element.name,
+				Kind:             CompletionItemKindSnippet,
+				Detail:           element.detail,
+				InsertText:       element.snippet,
+				InsertTextFormat: InsertTextFormatSnippet,
+			})
+		}
+		return items
+	}
+	if d.inMeta(offset) && isName(before) {
+		for _, meta := range metaKeys {
+			items = append(items, CompletionItem{
+				Label:            meta.key,
+				Kind:             CompletionItemKindProperty,
+				Detail:           meta.detail,
+				InsertText:       meta.key + ": ",
+				InsertTextFormat: InsertTextFormatPlainText,
+			})
+		}
+	}
+	return items
+}
+
+// inMeta reports whether the offset lies between the delimiters of the meta
+// block, a block that is still missing its closing delimiter extends to the end.
+func (d *document) inMeta(offset int) bool {
+	inside := false
+	for _, t := range d.lx.Lexemes {
+		switch t.Type {
+		case lexer.TokenMetaBegin:
+			if offset < t.Span.End.Offset {
+				return false
+			}
+			inside = true
+		case lexer.TokenMetaEnd:
+			return inside && offset <= t.Span.Start.Offset
+		}
+	}
+	return inside
+}
+
+func isName(s string) bool {
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' {
+			return false
+		}
+	}
+	return true
+}
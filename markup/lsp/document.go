@@ -0,0 +1,249 @@
+package lsp
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/cvanloo/blog-go/markup/diagnostic"
+	"github.com/cvanloo/blog-go/markup/lexer"
+	"github.com/cvanloo/blog-go/markup/parser"
+)
+
+// document is an open source file, lexed and parsed anew on every change.
+type document struct {
+	uri         string
+	lx          *lexer.Lexer
+	blog        *parser.Blog
+	lineStarts  []int // rune offsets into lx.Source
+	diagnostics []diagnostic.Diagnostic
+}
+
+// reference is the id of a link, sidenote, or footnote, either where it is
+// used or where it is defined.
+type reference struct {
+	namespace  string // link or sidenote, footnotes share their ids with sidenotes
+	id         string
+	span       diagnostic.Span
+	definition bool
+}
+
+func analyze(uri, text string) *document {
+	lx := lexer.New()
+	lx.LexSource(filenameFromURI(uri), text)
+	d := &document{
+		uri:        uri,
+		lx:         lx,
+		lineStarts: []int{0},
+	}
+	for i, r := range lx.Source {
+		if r == '\n' {
+			d.lineStarts = append(d.lineStarts, i+1)
+		}
+	}
+	// like the build, only report what follows from a clean lex, otherwise
+	// most of the parser errors are just echoes of the lexer errors
+	blog, err := parser.Parse(lx)
+	d.blog = blog
+	errs := errors.Join(lx.Errors...)
+	var warnings []diagnostic.Diagnostic
+	if len(lx.Errors) == 0 {
+		errs = err
+		if err == nil {
+			refFixer := &parser.FixReferencesVisitor{}
+			blog.Accept(refFixer)
+			errs = refFixer.Errors
+			warnings = blog.Warnings
+		}
+	}
+	d.diagnostics = append(diagnostic.Collect(errs), warnings...)
+	return d
+}
+
+func filenameFromURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return u.Path
+}
+
+// position converts a location of the lexer to one of the protocol.
+func (d *document) position(p diagnostic.Position) Position {
+	if p.Line < 1 || p.Line > len(d.lineStarts) {
+		return Position{}
+	}
+	start := d.lineStarts[p.Line-1]
+	end := min(max(p.Offset, start), len(d.lx.Source))
+	return Position{
+		Line:      p.Line - 1,
+		Character: len(utf16.Encode(d.lx.Source[start:end])),
+	}
+}
+
+func (d *document) rangeOf(span diagnostic.Span) Range {
+	return Range{
+		Start: d.position(span.Start),
+		End:   d.position(span.End),
+	}
+}
+
+// offset converts a position of the protocol to a rune offset into the source.
+// Positions past the end of a line are clamped to the end of the line.
+func (d *document) offset(p Position) int {
+	if p.Line < 0 {
+		return 0
+	}
+	if p.Line >= len(d.lineStarts) {
+		return len(d.lx.Source)
+	}
+	offset := d.lineStarts[p.Line]
+	for units := 0; offset < len(d.lx.Source) && d.lx.Source[offset] != '\n'; offset++ {
+		units += utf16.RuneLen(d.lx.Source[offset])
+		if units > p.Character {
+			break
+		}
+	}
+	return offset
+}
+
+// references lists all ids of links, sidenotes, and footnotes, in source order.
+func (d *document) references() (refs []reference) {
+	for _, t := range d.lx.Lexemes {
+		ref := reference{id: t.Text, span: t.Span}
+		switch t.Type {
+		default:
+			continue
+		case lexer.TokenLinkRef:
+			ref.namespace = "link"
+		case lexer.TokenLinkDef:
+			ref.namespace, ref.definition = "link", true
+		case lexer.TokenSidenoteRef, lexer.TokenFootnoteRef:
+			ref.namespace = "sidenote"
+		case lexer.TokenSidenoteDef:
+			ref.namespace, ref.definition = "sidenote", true
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// referenceAt finds the id under the cursor, which may also sit right after
+// the id.
+func (d *document) referenceAt(p Position) (reference, bool) {
+	offset := d.offset(p)
+	for _, ref := range d.references() {
+		if ref.span.Contains(offset) || ref.span.End.Offset == offset {
+			return ref, true
+		}
+	}
+	return reference{}, false
+}
+
+func (d *document) definition(ref reference) (diagnostic.Span, bool) {
+	var span diagnostic.Span
+	var ok bool
+	switch ref.namespace {
+	case "link":
+		span, ok = d.blog.Locations.LinkDefinitions[ref.id]
+	case "sidenote":
+		span, ok = d.blog.Locations.SidenoteDefinitions[ref.id]
+	}
+	return span, ok
+}
+
+// definitionText is the source of a definition, as it was written after the
+// `[id]:`.
+func (d *document) definitionText(ref reference) (string, bool) {
+	switch ref.namespace {
+	case "link":
+		href, ok := d.blog.LinkDefinitions[ref.id]
+		return href, ok
+	case "sidenote":
+		for i, t := range d.lx.Lexemes {
+			if t.Type != lexer.TokenSidenoteDef || t.Text != ref.id {
+				continue
+			}
+			end := slices.IndexFunc(d.lx.Lexemes[i:], func(t lexer.Token) bool {
+				return t.Type == lexer.TokenSidenoteDefEnd
+			})
+			if end == -1 {
+				return "", false
+			}
+			text := string(d.lx.Source[t.Span.End.Offset:d.lx.Lexemes[i+end].Span.Start.Offset])
+			text = strings.TrimPrefix(text, "]:")
+			return strings.TrimSpace(text), true
+		}
+	}
+	return "", false
+}
+
+// publishedDiagnostics converts the problems found in the document, those in
+// other files, like included ones, are reported at the start of the document.
+func (d *document) publishedDiagnostics() []Diagnostic {
+	ds := []Diagnostic{}
+	for _, dd := range d.diagnostics {
+		var rng Range
+		if dd.Span.Filename == d.lx.Filename {
+			rng = d.rangeOf(dd.Span)
+		}
+		message := dd.Message
+		for _, hint := range dd.Hints {
+			message += fmt.Sprintf("\nhint: %s", hint)
+		}
+		ds = append(ds, Diagnostic{
+			Range:    rng,
+			Severity: int(dd.Severity) + 1,
+			Code:     dd.Code,
+			Source:   "koneko",
+			Message:  message,
+		})
+	}
+	return ds
+}
+
+// symbols lists the sections with their subsections.
+func (d *document) symbols() []DocumentSymbol {
+	var sectionSymbols func(sections []*parser.Section) []DocumentSymbol
+	sectionSymbols = func(sections []*parser.Section) (symbols []DocumentSymbol) {
+		for _, section := range sections {
+			var subsections []*parser.Section
+			for _, node := range section.Content {
+				if s, ok := node.(*parser.Section); ok {
+					subsections = append(subsections, s)
+				}
+			}
+			heading, headingSpan := d.heading(section)
+			symbols = append(symbols, DocumentSymbol{
+				Name:           heading,
+				Kind:           SymbolKindString,
+				Range:          d.rangeOf(section.Span),
+				SelectionRange: d.rangeOf(headingSpan),
+				Children:       sectionSymbols(subsections),
+			})
+		}
+		return symbols
+	}
+	return sectionSymbols(d.blog.Sections)
+}
+
+// heading is the source line of a section heading, without the level and
+// attribute list, together with the span of the whole line.
+func (d *document) heading(section *parser.Section) (string, diagnostic.Span) {
+	start := section.Span.Start.Offset
+	end := start
+	for end < len(d.lx.Source) && d.lx.Source[end] != '\n' {
+		end++
+	}
+	line := strings.TrimLeft(string(d.lx.Source[start:end]), "#")
+	if i := strings.LastIndex(line, "{"); i != -1 && strings.HasSuffix(strings.TrimSpace(line), "}") {
+		line = line[:i]
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		line = "(untitled)"
+	}
+	return line, d.lx.Span(start, end)
+}
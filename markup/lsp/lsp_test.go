@@ -0,0 +1,287 @@
+package lsp_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/cvanloo/blog-go/markup/lsp"
+)
+
+const uri = "file:///posts/hello.md"
+
+const source = `---
+title: Hello
+---
+
+# Intro {#intro}
+
+See [the docs][docs] and 🐈cat[^sn].
+
+[docs]: https://example.org
+[^sn]: A *side* note.
+
+## Details
+
+Another [link][docs] and [one][nope].
+`
+
+type session struct {
+	in     bytes.Buffer
+	nextID int
+}
+
+func (s *session) send(method string, params any) {
+	s.frame(map[string]any{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+func (s *session) request(method string, params any) int {
+	s.nextID++
+	s.frame(map[string]any{"jsonrpc": "2.0", "id": s.nextID, "method": method, "params": params})
+	return s.nextID
+}
+
+func (s *session) frame(message any) {
+	bs, err := json.Marshal(message)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(&s.in, "Content-Length: %d\r\n\r\n%s", len(bs), bs)
+}
+
+type message struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code int `json:"code"`
+	} `json:"error"`
+}
+
+func readMessages(t *testing.T, out []byte) (messages []message) {
+	r := bufio.NewReader(bytes.NewReader(out))
+	for {
+		header, err := textproto.NewReader(r).ReadMIMEHeader()
+		if err == io.EOF {
+			return messages
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		length, err := strconv.Atoi(header.Get("Content-Length"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		bs := make([]byte, length)
+		if _, err := io.ReadFull(r, bs); err != nil {
+			t.Fatal(err)
+		}
+		var m message
+		if err := json.Unmarshal(bs, &m); err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, m)
+	}
+}
+
+func at(line, character int) map[string]any {
+	return map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"position":     lsp.Position{Line: line, Character: character},
+	}
+}
+
+func rng(line, start, end int) lsp.Range {
+	return lsp.Range{
+		Start: lsp.Position{Line: line, Character: start},
+		End:   lsp.Position{Line: line, Character: end},
+	}
+}
+
+func TestServe(t *testing.T) {
+	var s session
+	s.request("initialize", map[string]any{})
+	s.send("initialized", map[string]any{})
+	s.send("textDocument/didOpen", map[string]any{
+		"textDocument": lsp.TextDocumentItem{URI: uri, LanguageID: "koneko", Version: 1, Text: source},
+	})
+	definition := s.request("textDocument/definition", at(13, 17))
+	references := s.request("textDocument/references", map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"position":     lsp.Position{Line: 8, Character: 2},
+		"context":      map[string]any{"includeDeclaration": true},
+	})
+	hover := s.request("textDocument/hover", at(6, 33))
+	metaCompletion := s.request("textDocument/completion", at(1, 3))
+	symbols := s.request("textDocument/documentSymbol", map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+	})
+	s.send("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri, "version": 2},
+		"contentChanges": []map[string]any{{"text": source + "\n<"}},
+	})
+	elementCompletion := s.request("textDocument/completion", at(15, 1))
+	unknown := s.request("textDocument/unknown", map[string]any{})
+	s.request("shutdown", nil)
+	s.send("exit", nil)
+
+	var out bytes.Buffer
+	if err := lsp.Serve(&s.in, &out); err != nil {
+		t.Fatal(err)
+	}
+	results := map[int]json.RawMessage{}
+	var published []lsp.PublishDiagnosticsParams
+	for _, m := range readMessages(t, out.Bytes()) {
+		switch {
+		case m.Method == "textDocument/publishDiagnostics":
+			var params lsp.PublishDiagnosticsParams
+			if err := json.Unmarshal(m.Params, &params); err != nil {
+				t.Fatal(err)
+			}
+			published = append(published, params)
+		case m.ID != nil && m.Error != nil:
+			results[*m.ID] = json.RawMessage(strconv.Itoa(m.Error.Code))
+		case m.ID != nil:
+			results[*m.ID] = m.Result
+		}
+	}
+	decode := func(id int, v any) {
+		if err := json.Unmarshal(results[id], v); err != nil {
+			t.Fatalf("request %d: %v: %s", id, err, results[id])
+		}
+	}
+
+	if len(published) != 2 {
+		t.Fatalf("expected diagnostics to be published on open and change, got: %v", published)
+	}
+	expectedDiagnostics := []lsp.Diagnostic{{
+		Range:    rng(13, 25, 36),
+		Severity: lsp.SeverityError,
+		Code:     "missing-link-definition",
+		Source:   "koneko",
+		Message:  "missing url definition for link with id: nope\nhint: define the url with [nope]: https://...",
+	}}
+	if diff := deep.Equal(published[0].Diagnostics, expectedDiagnostics); diff != nil {
+		t.Errorf("diagnostics: %v", diff)
+	}
+	if len(published[1].Diagnostics) == 0 {
+		t.Error("expected diagnostics for the stray `<`")
+	}
+
+	var location lsp.Location
+	decode(definition, &location)
+	if diff := deep.Equal(location, lsp.Location{URI: uri, Range: rng(8, 1, 27)}); diff != nil {
+		t.Errorf("definition: %v", diff)
+	}
+
+	var locations []lsp.Location
+	decode(references, &locations)
+	expectedLocations := []lsp.Location{
+		{URI: uri, Range: rng(6, 15, 19)},
+		{URI: uri, Range: rng(8, 1, 5)},
+		{URI: uri, Range: rng(13, 15, 19)},
+	}
+	if diff := deep.Equal(locations, expectedLocations); diff != nil {
+		t.Errorf("references: %v", diff)
+	}
+
+	var preview lsp.Hover
+	decode(hover, &preview)
+	expectedPreview := lsp.Hover{
+		Contents: lsp.MarkupContent{Kind: "markdown", Value: "A *side* note."},
+		Range:    rng(6, 32, 34),
+	}
+	if diff := deep.Equal(preview, expectedPreview); diff != nil {
+		t.Errorf("hover: %v", diff)
+	}
+
+	var items []lsp.CompletionItem
+	decode(metaCompletion, &items)
+	if len(items) == 0 || items[0].Kind != lsp.CompletionItemKindProperty || items[0].InsertText != "template: " {
+		t.Errorf("expected meta keys, got: %v", items)
+	}
+	decode(elementCompletion, &items)
+	var labels []string
+	for _, item := range items {
+		labels = append(labels, item.Label)
+	}
+	if diff := deep.Equal(labels, []string{"Note", "Ruby", "RelevantBox"}); diff != nil {
+		t.Errorf("element completion: %v", diff)
+	}
+
+	var outline []lsp.DocumentSymbol
+	decode(symbols, &outline)
+	if len(outline) != 1 || outline[0].Name != "Intro" || len(outline[0].Children) != 1 || outline[0].Children[0].Name != "Details" {
+		t.Errorf("expected the outline Intro > Details, got: %v", outline)
+	} else if diff := deep.Equal(outline[0].SelectionRange, rng(4, 0, 16)); diff != nil {
+		t.Errorf("outline: %v", diff)
+	}
+
+	if string(results[unknown]) != "-32601" {
+		t.Errorf("expected method not found for an unknown request, got: %s", results[unknown])
+	}
+}
+
+func TestServeEmptyMetaValue(t *testing.T) {
+	var s session
+	s.request("initialize", map[string]any{})
+	s.send("initialized", map[string]any{})
+	s.send("textDocument/didOpen", map[string]any{
+		"textDocument": lsp.TextDocumentItem{URI: uri, LanguageID: "koneko", Version: 1, Text: "---\ntitle:\n---\n\n# Intro\n\nA [link][nope].\n"},
+	})
+	symbols := s.request("textDocument/documentSymbol", map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+	})
+	s.request("shutdown", nil)
+	s.send("exit", nil)
+
+	var out bytes.Buffer
+	done := make(chan error)
+	go func() { done <- lsp.Serve(&s.in, &out) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not answer a document with an empty meta value")
+	}
+	var published []lsp.PublishDiagnosticsParams
+	answered := false
+	for _, m := range readMessages(t, out.Bytes()) {
+		switch {
+		case m.Method == "textDocument/publishDiagnostics":
+			var params lsp.PublishDiagnosticsParams
+			if err := json.Unmarshal(m.Params, &params); err != nil {
+				t.Fatal(err)
+			}
+			published = append(published, params)
+		case m.ID != nil && *m.ID == symbols:
+			answered = m.Error == nil
+		}
+	}
+	if len(published) != 1 || len(published[0].Diagnostics) != 1 || published[0].Diagnostics[0].Code != "missing-link-definition" {
+		t.Errorf("expected the missing link definition to be reported, got: %v", published)
+	}
+	if !answered {
+		t.Error("expected an outline")
+	}
+}
+
+func TestServeExitWithoutShutdown(t *testing.T) {
+	var s session
+	s.request("initialize", map[string]any{})
+	s.send("exit", nil)
+	if err := lsp.Serve(&s.in, io.Discard); err != lsp.ErrExitWithoutShutdown {
+		t.Errorf("expected ErrExitWithoutShutdown, got: %v", err)
+	}
+}
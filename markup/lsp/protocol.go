@@ -0,0 +1,148 @@
+package lsp
+
+import "encoding/json"
+
+// The subset of the language server protocol spoken by Server, see:
+// https://microsoft.github.io/language-server-protocol/specifications/lsp/3.17/specification/
+type (
+	// Position in a text document, both zero-based.
+	// Character counts UTF-16 code units, not runes.
+	Position struct {
+		Line      int `json:"line"`
+		Character int `json:"character"`
+	}
+	Range struct {
+		Start Position `json:"start"`
+		End   Position `json:"end"`
+	}
+	Location struct {
+		URI   string `json:"uri"`
+		Range Range  `json:"range"`
+	}
+
+	TextDocumentIdentifier struct {
+		URI string `json:"uri"`
+	}
+	TextDocumentItem struct {
+		URI        string `json:"uri"`
+		LanguageID string `json:"languageId"`
+		Version    int    `json:"version"`
+		Text       string `json:"text"`
+	}
+	TextDocumentPositionParams struct {
+		TextDocument TextDocumentIdentifier `json:"textDocument"`
+		Position     Position               `json:"position"`
+	}
+	ReferenceParams struct {
+		TextDocumentPositionParams
+		Context struct {
+			IncludeDeclaration bool `json:"includeDeclaration"`
+		} `json:"context"`
+	}
+	DocumentSymbolParams struct {
+		TextDocument TextDocumentIdentifier `json:"textDocument"`
+	}
+
+	DidOpenTextDocumentParams struct {
+		TextDocument TextDocumentItem `json:"textDocument"`
+	}
+	DidChangeTextDocumentParams struct {
+		TextDocument   TextDocumentIdentifier `json:"textDocument"`
+		ContentChanges []struct {
+			Text string `json:"text"` // always the whole document, see TextDocumentSyncFull
+		} `json:"contentChanges"`
+	}
+	DidCloseTextDocumentParams struct {
+		TextDocument TextDocumentIdentifier `json:"textDocument"`
+	}
+
+	PublishDiagnosticsParams struct {
+		URI         string       `json:"uri"`
+		Diagnostics []Diagnostic `json:"diagnostics"`
+	}
+	Diagnostic struct {
+		Range    Range  `json:"range"`
+		Severity int    `json:"severity"`
+		Code     string `json:"code,omitempty"`
+		Source   string `json:"source"`
+		Message  string `json:"message"`
+	}
+
+	MarkupContent struct {
+		Kind  string `json:"kind"`
+		Value string `json:"value"`
+	}
+	Hover struct {
+		Contents MarkupContent `json:"contents"`
+		Range    Range         `json:"range"`
+	}
+
+	CompletionItem struct {
+		Label            string `json:"label"`
+		Kind             int    `json:"kind"`
+		Detail           string `json:"detail,omitempty"`
+		InsertText       string `json:"insertText,omitempty"`
+		InsertTextFormat int    `json:"insertTextFormat,omitempty"`
+	}
+
+	DocumentSymbol struct {
+		Name           string           `json:"name"`
+		Kind           int              `json:"kind"`
+		Range          Range            `json:"range"`
+		SelectionRange Range            `json:"selectionRange"`
+		Children       []DocumentSymbol `json:"children,omitempty"`
+	}
+)
+
+const (
+	TextDocumentSyncFull = 1
+
+	SeverityError       = 1
+	SeverityWarning     = 2
+	SeverityInformation = 3
+	SeverityHint        = 4
+
+	CompletionItemKindProperty = 10
+	CompletionItemKindSnippet  = 15
+
+	InsertTextFormatPlainText = 1
+	InsertTextFormatSnippet   = 2
+
+	SymbolKindString = 15
+)
+
+// JSON-RPC 2.0 messages, see: https://www.jsonrpc.org/specification
+type (
+	request struct {
+		JSONRPC string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id,omitempty"` // absent for notifications
+		Method  string          `json:"method"`
+		Params  json.RawMessage `json:"params,omitempty"`
+	}
+	response struct {
+		JSONRPC string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"`
+		Result  any             `json:"result"`
+	}
+	errorResponse struct {
+		JSONRPC string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"`
+		Error   responseError   `json:"error"`
+	}
+	responseError struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	notification struct {
+		JSONRPC string `json:"jsonrpc"`
+		Method  string `json:"method"`
+		Params  any    `json:"params"`
+	}
+)
+
+const (
+	codeParseError     = -32700
+	codeInvalidParams  = -32602
+	codeMethodNotFound = -32601
+	codeInvalidRequest = -32600
+)
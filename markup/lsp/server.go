@@ -0,0 +1,281 @@
+// Package lsp implements a language server for the markup.
+// It reports the problems in a source as it is edited, navigates between
+// references and their definitions, completes meta keys and html elements,
+// previews sidenotes, and outlines the sections.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/textproto"
+	"strconv"
+)
+
+var (
+	ErrExitWithoutShutdown = errors.New("client exited without asking the server to shut down first")
+	ErrMissingLength       = errors.New("message is missing its Content-Length header")
+)
+
+// rpcError is answered to the client, instead of a result.
+type rpcError struct {
+	code    int
+	message string
+}
+
+func (err rpcError) Error() string {
+	return err.message
+}
+
+type server struct {
+	in        *bufio.Reader
+	out       io.Writer
+	documents map[string]*document
+	shutdown  bool
+}
+
+// Serve answers the requests read from in, until the client asks the server
+// to exit.
+// Documents are synchronized in full, each change re-analyzes the whole source.
+func Serve(in io.Reader, out io.Writer) error {
+	s := &server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		documents: map[string]*document{},
+	}
+	for {
+		bs, err := s.read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				if s.shutdown {
+					return nil
+				}
+				return ErrExitWithoutShutdown
+			}
+			return err
+		}
+		var req request
+		if err := json.Unmarshal(bs, &req); err != nil {
+			if err := s.write(errorResponse{"2.0", json.RawMessage("null"), responseError{codeParseError, err.Error()}}); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return ErrExitWithoutShutdown
+			}
+			return nil
+		}
+		if req.Method == "" {
+			continue // a response, but the server never sends any requests
+		}
+		result, err := s.handle(req)
+		if req.ID == nil {
+			if err != nil {
+				log.Printf("%s: %v", req.Method, err)
+			}
+			continue
+		}
+		if err != nil {
+			rerr := rpcError{codeInvalidParams, err.Error()}
+			errors.As(err, &rerr)
+			err = s.write(errorResponse{"2.0", req.ID, responseError{rerr.code, rerr.message}})
+		} else {
+			err = s.write(response{"2.0", req.ID, result})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *server) handle(req request) (any, error) {
+	if s.shutdown {
+		return nil, rpcError{codeInvalidRequest, "server is shutting down"}
+	}
+	switch req.Method {
+	default:
+		if req.ID == nil {
+			return nil, nil // optional notifications, like $/cancelRequest
+		}
+		return nil, rpcError{codeMethodNotFound, fmt.Sprintf("method not found: %s", req.Method)}
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":       TextDocumentSyncFull,
+				"definitionProvider":     true,
+				"referencesProvider":     true,
+				"hoverProvider":          true,
+				"documentSymbolProvider": true,
+				"completionProvider": map[string]any{
+					"triggerCharacters": []string{"<"},
+				},
+			},
+			"serverInfo": map[string]any{
+				"name": "koneko",
+			},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return nil, s.open(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		if len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		return nil, s.open(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		delete(s.documents, params.TextDocument.URI)
+		return nil, s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []Diagnostic{},
+		})
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		d, err := s.document(req.Params, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		ref, ok := d.referenceAt(params.Position)
+		if !ok {
+			return nil, nil
+		}
+		span, ok := d.definition(ref)
+		if !ok {
+			return nil, nil
+		}
+		return Location{d.uri, d.rangeOf(span)}, nil
+	case "textDocument/references":
+		var params ReferenceParams
+		d, err := s.document(req.Params, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		locations := []Location{}
+		ref, ok := d.referenceAt(params.Position)
+		if !ok {
+			return locations, nil
+		}
+		for _, other := range d.references() {
+			if other.namespace != ref.namespace || other.id != ref.id {
+				continue
+			}
+			if other.definition && !params.Context.IncludeDeclaration {
+				continue
+			}
+			locations = append(locations, Location{d.uri, d.rangeOf(other.span)})
+		}
+		return locations, nil
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		d, err := s.document(req.Params, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		ref, ok := d.referenceAt(params.Position)
+		if !ok {
+			return nil, nil
+		}
+		text, ok := d.definitionText(ref)
+		if !ok {
+			text = fmt.Sprintf("missing definition for %s with id: %s", ref.namespace, ref.id)
+		}
+		return Hover{
+			Contents: MarkupContent{"markdown", text},
+			Range:    d.rangeOf(ref.span),
+		}, nil
+	case "textDocument/completion":
+		var params TextDocumentPositionParams
+		d, err := s.document(req.Params, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return d.completions(params.Position), nil
+	case "textDocument/documentSymbol":
+		var params DocumentSymbolParams
+		d, err := s.document(req.Params, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		symbols := d.symbols()
+		if symbols == nil {
+			symbols = []DocumentSymbol{}
+		}
+		return symbols, nil
+	}
+}
+
+// open analyzes the new content of a document and publishes its problems.
+func (s *server) open(uri, text string) error {
+	d := analyze(uri, text)
+	s.documents[uri] = d
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: d.publishedDiagnostics(),
+	})
+}
+
+// document decodes the params of a request and looks up the open document
+// they are about.
+func (s *server) document(raw json.RawMessage, params any, id *TextDocumentIdentifier) (*document, error) {
+	if err := json.Unmarshal(raw, params); err != nil {
+		return nil, err
+	}
+	d, ok := s.documents[id.URI]
+	if !ok {
+		return nil, fmt.Errorf("document is not open: %s", id.URI)
+	}
+	return d, nil
+}
+
+func (s *server) notify(method string, params any) error {
+	return s.write(notification{"2.0", method, params})
+}
+
+// read the content of the next message, framed by its header.
+func (s *server) read() ([]byte, error) {
+	header, err := textproto.NewReader(s.in).ReadMIMEHeader()
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(header) == 0 {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("reading message header: %w", err)
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, ErrMissingLength
+	}
+	bs := make([]byte, length)
+	if _, err := io.ReadFull(s.in, bs); err != nil {
+		return nil, fmt.Errorf("reading message content: %w", err)
+	}
+	return bs, nil
+}
+
+func (s *server) write(message any) error {
+	bs, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(bs), bs)
+	return err
+}
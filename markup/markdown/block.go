@@ -0,0 +1,812 @@
+package markdown
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cvanloo/blog-go/markup/diagnostic"
+	"github.com/cvanloo/blog-go/markup/parser"
+)
+
+type (
+	// line of the source, without the prefixes of the blocks it is nested in.
+	line struct {
+		text   string
+		number int // starting at 1
+		column int // of the first rune of text, starting at 1
+		offset int // of the first rune of text, in runes
+	}
+
+	// heading is a section heading, before the sections are nested by their
+	// level.
+	heading struct {
+		parser.Located
+		parser.Attributes
+		level   int
+		content parser.TextRich
+	}
+)
+
+func (h *heading) Accept(parser.Visitor) {}
+
+// blank reports whether the line contains only whitespace.
+func (l line) blank() bool {
+	return strings.TrimSpace(l.text) == ""
+}
+
+// indent is the width of the leading whitespace, tabs stop at every 4th
+// column.
+func (l line) indent() int {
+	width := 0
+	for _, r := range l.text {
+		switch r {
+		case ' ':
+			width++
+		case '\t':
+			width += 4 - width%4
+		default:
+			return width
+		}
+	}
+	return width
+}
+
+// dedent removes up to n columns of leading whitespace.
+// A tab that is only partly removed leaves the rest of its columns as spaces.
+func (l line) dedent(n int) line {
+	width := 0
+	for i, r := range l.text {
+		if width >= n || (r != ' ' && r != '\t') {
+			return l.skip(i, strings.Repeat(" ", max(width-n, 0)))
+		}
+		if r == ' ' {
+			width++
+		} else {
+			width += 4 - width%4
+		}
+	}
+	return l.skip(len(l.text), "")
+}
+
+// skip drops the first n bytes of the text, and puts pad in their place.
+func (l line) skip(n int, pad string) line {
+	if n < 0 || pad == "" && n == 0 {
+		return l
+	}
+	runes := utf8.RuneCountInString(l.text[:n]) - len(pad)
+	l.text = pad + l.text[n:]
+	l.column += runes
+	l.offset += runes
+	return l
+}
+
+// trim removes up to 3 spaces of indentation, which don't change the meaning
+// of a line.
+func (l line) trim() line {
+	if l.indent() >= 4 {
+		return l
+	}
+	return l.dedent(3)
+}
+
+func (c *converter) span(first, last line) diagnostic.Span {
+	return diagnostic.Span{
+		Filename: c.filename,
+		Start:    diagnostic.Position{Offset: first.offset, Line: first.number, Column: first.column},
+		End: diagnostic.Position{
+			Offset: last.offset + utf8.RuneCountInString(last.text),
+			Line:   last.number,
+			Column: last.column + utf8.RuneCountInString(last.text),
+		},
+	}
+}
+
+func (c *converter) located(lines []line) parser.Located {
+	return parser.Located{Span: c.span(lines[0], lines[len(lines)-1])}
+}
+
+var (
+	atxHeading    = regexp.MustCompile(`^(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	headingAttrs  = regexp.MustCompile(`[ \t]*\{([^{}]*)\}$`)
+	thematicBreak = regexp.MustCompile(`^(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	setextLine    = regexp.MustCompile(`^(?:=+|-+)[ \t]*$`)
+	bulletItem    = regexp.MustCompile(`^([-*+])(?:[ \t]|$)`)
+	orderedItem   = regexp.MustCompile(`^([0-9]{1,9})([.)])(?:[ \t]|$)`)
+	fence         = regexp.MustCompile("^(`{3,}|~{3,})[ \t]*(.*)$")
+	linkDef       = regexp.MustCompile(`^\[([^\]^][^\]]*)\]:[ \t]*(<[^>\n]*>|\S+)(?:[ \t]+("[^"]*"|'[^']*'|\([^)]*\)))?[ \t]*$`)
+	footnoteDef   = regexp.MustCompile(`^\[\^([^\]\s]+)\]:[ \t]?(.*)$`)
+	tableDelim    = regexp.MustCompile(`^\|?[ \t]*:?-+:?[ \t]*(?:\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+	shortcode     = regexp.MustCompile(`^\{\{([<%])-?[ \t]*(/?)([\w-]+)(.*?)-?[ \t]*[>%]\}\}[ \t]*$`)
+	liquidTag     = regexp.MustCompile(`^\{%-?[ \t]*(\w+)(.*?)[ \t]*-?%\}[ \t]*$`)
+	htmlOpen      = regexp.MustCompile(`^</?([a-zA-Z][a-zA-Z0-9-]*)`)
+	htmlComplete  = regexp.MustCompile(`^(?:<[a-zA-Z][a-zA-Z0-9-]*(?:\s+[a-zA-Z_:][\w.:-]*(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'=<>` + "`" + `]+))?)*\s*/?>|</[a-zA-Z][a-zA-Z0-9-]*\s*>)[ \t]*$`)
+	alert         = regexp.MustCompile(`^\[!(NOTE|TIP|IMPORTANT|WARNING|CAUTION)\][ \t]*$`)
+)
+
+// htmlBlockNames start an html block, even in the middle of a paragraph.
+var htmlBlockNames = []string{
+	"address", "article", "aside", "blockquote", "body", "center", "details", "dialog", "dd", "div", "dl", "dt",
+	"fieldset", "figcaption", "figure", "footer", "form", "h1", "h2", "h3", "h4", "h5", "h6", "header", "hr",
+	"iframe", "li", "main", "nav", "ol", "p", "section", "summary", "table", "tbody", "td", "tfoot", "th",
+	"thead", "tr", "ul", "pre", "script", "style", "textarea", "video", "audio",
+}
+
+// alertTypes maps the types of GitHub alerts onto those of the admonitions.
+var alertTypes = map[string]string{
+	"NOTE":      "info",
+	"TIP":       "tip",
+	"IMPORTANT": "info",
+	"WARNING":   "warning",
+	"CAUTION":   "danger",
+}
+
+// blocks parses the lines into block nodes.
+// Headings are returned as *heading, for the caller to turn into sections.
+func (c *converter) blocks(lines []line) (nodes []parser.Node) {
+	for i := 0; i < len(lines); {
+		l := lines[i]
+		if l.blank() {
+			i++
+			continue
+		}
+		var node parser.Node
+		if l.indent() >= 4 {
+			node, i = c.indentedCode(lines, i)
+		} else {
+			node, i = c.block(lines, i)
+		}
+		if node != nil {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// block parses the block starting at lines[i], and returns the index of the
+// line after it.
+// The node is nil for blocks that only define something, or that are kept as
+// a comment.
+func (c *converter) block(lines []line, i int) (parser.Node, int) {
+	l := lines[i].trim()
+	text := l.text
+	switch {
+	case fence.MatchString(text) && !(text[0] == '`' && strings.Contains(fence.FindStringSubmatch(text)[2], "`")):
+		return c.fencedCode(lines, i)
+	case atxHeading.MatchString(text):
+		return c.atxHeading(l), i + 1
+	case thematicBreak.MatchString(text):
+		return &parser.HorizontalRule{Located: c.located(lines[i : i+1])}, i + 1
+	case strings.HasPrefix(text, ">"):
+		return c.blockQuote(lines, i)
+	case bulletItem.MatchString(text) || orderedItem.MatchString(text):
+		return c.list(lines, i)
+	case strings.HasPrefix(text, "<!--"):
+		return c.htmlComment(lines, i)
+	case c.isHTMLBlock(text, false):
+		return c.htmlBlock(lines, i)
+	case shortcode.MatchString(text):
+		return c.shortcode(lines, i)
+	case liquidTag.MatchString(text):
+		return c.liquidTag(lines, i)
+	case i+1 < len(lines) && strings.Contains(text, "|") && tableDelim.MatchString(lines[i+1].trim().text):
+		if node, next, ok := c.table(lines, i); ok {
+			return node, next
+		}
+	case footnoteDef.MatchString(text):
+		return c.footnoteDefinition(lines, i)
+	case linkDef.MatchString(text):
+		c.linkDefinition(l)
+		return nil, i + 1
+	}
+	return c.paragraph(lines, i)
+}
+
+// interrupts reports whether the line starts a block that ends a paragraph.
+func (c *converter) interrupts(l line) bool {
+	if l.blank() {
+		return true
+	}
+	if l.indent() >= 4 {
+		return false
+	}
+	text := l.trim().text
+	switch {
+	case fence.MatchString(text), atxHeading.MatchString(text), thematicBreak.MatchString(text), strings.HasPrefix(text, ">"):
+		return true
+	case strings.HasPrefix(text, "<!--"), c.isHTMLBlock(text, true):
+		return true
+	case shortcode.MatchString(text), liquidTag.MatchString(text):
+		return true
+	case bulletItem.MatchString(text):
+		// only an item with content interrupts a paragraph
+		return strings.TrimSpace(text[1:]) != ""
+	case orderedItem.MatchString(text):
+		m := orderedItem.FindStringSubmatch(text)
+		return m[1] == "1" && strings.TrimSpace(text[len(m[0]):]) != ""
+	}
+	return false
+}
+
+func (c *converter) isHTMLBlock(text string, interrupting bool) bool {
+	m := htmlOpen.FindStringSubmatch(text)
+	if m == nil {
+		return false
+	}
+	if slices.Contains(htmlBlockNames, strings.ToLower(m[1])) {
+		return true
+	}
+	// any other tag, alone on its line
+	return !interrupting && htmlComplete.MatchString(text)
+}
+
+func (c *converter) paragraph(lines []line, i int) (parser.Node, int) {
+	start := i
+	var content []line
+	for ; i < len(lines); i++ {
+		l := lines[i]
+		if len(content) > 0 {
+			// an underline takes precedence over a thematic break or a list
+			// item, like in CommonMark
+			if trimmed := l.trim().text; setextLine.MatchString(trimmed) && l.indent() < 4 {
+				level := 1
+				if trimmed[0] == '-' {
+					level = 2
+				}
+				h := &heading{Located: c.located(lines[start : i+1]), Attributes: parser.Attributes{}, level: level}
+				c.later(func() { h.content = c.inline(content) })
+				return h, i + 1
+			}
+			if c.interrupts(l) {
+				break
+			}
+			if trimmed := l.trim().text; strings.HasPrefix(trimmed, ": ") && len(content) == 1 {
+				return c.definitionList(lines, start)
+			}
+		}
+		content = append(content, l.trim())
+	}
+	p := &parser.Paragraph{Located: c.located(lines[start:i])}
+	c.later(func() { p.Content = c.paragraphContent(content) })
+	return p, i
+}
+
+func (c *converter) atxHeading(l line) parser.Node {
+	m := atxHeading.FindStringSubmatchIndex(l.text)
+	h := &heading{
+		Located:    c.located([]line{l}),
+		Attributes: parser.Attributes{},
+		level:      m[3] - m[2],
+	}
+	if m[4] < 0 {
+		return h
+	}
+	content := l.skip(m[4], "")
+	content.text = l.text[m[4]:m[5]]
+	if attrs := headingAttrs.FindStringSubmatchIndex(content.text); attrs != nil {
+		h.Attributes = c.attributes(content.text[attrs[2]:attrs[3]])
+		content.text = content.text[:attrs[0]]
+	}
+	c.later(func() { h.content = c.inline([]line{content}) })
+	return h
+}
+
+// attributes parses an attribute list like {#id .class key=value}.
+func (c *converter) attributes(list string) parser.Attributes {
+	attrs := parser.Attributes{}
+	for _, attr := range strings.Fields(list) {
+		switch {
+		case strings.HasPrefix(attr, "#"):
+			attrs["id"] = attr[1:]
+		case strings.HasPrefix(attr, "."):
+			if classes := attrs["class"]; classes != "" {
+				attrs["class"] = classes + " " + attr[1:]
+			} else {
+				attrs["class"] = attr[1:]
+			}
+		default:
+			key, val, _ := strings.Cut(attr, "=")
+			attrs[key] = unquote(val)
+		}
+	}
+	return attrs
+}
+
+func (c *converter) indentedCode(lines []line, i int) (parser.Node, int) {
+	start := i
+	code := &parser.CodeBlock{Attributes: parser.Attributes{}}
+	end := i
+	for ; i < len(lines) && (lines[i].blank() || lines[i].indent() >= 4); i++ {
+		code.Lines = append(code.Lines, lines[i].dedent(4).text)
+		if !lines[i].blank() {
+			end = i + 1
+		}
+	}
+	code.Lines = code.Lines[:end-start]
+	code.Located = c.located(lines[start:end])
+	return c.codeBlock(code, lines[start:end]), end
+}
+
+func (c *converter) fencedCode(lines []line, i int) (parser.Node, int) {
+	start := i
+	indent := lines[i].indent()
+	m := fence.FindStringSubmatch(lines[i].trim().text)
+	delim, info := m[1], strings.TrimSpace(m[2])
+	code := &parser.CodeBlock{Attributes: parser.Attributes{}}
+	if lang, options, _ := strings.Cut(info, " "); lang != "" {
+		code.Attributes["Lang"] = strings.Trim(lang, "{}.")
+		if options = strings.TrimSpace(options); options != "" {
+			c.warn(c.span(lines[i], lines[i]), "code-block-options", fmt.Sprintf("options of the code block were left out: %s", options))
+		}
+	}
+	for i++; i < len(lines); i++ {
+		if closing := lines[i].trim().text; lines[i].indent() < 4 && strings.HasPrefix(closing, delim) && strings.Trim(closing, delim[:1]+" \t") == "" {
+			code.Located = c.located(lines[start : i+1])
+			return c.codeBlock(code, lines[start:i+1]), i + 1
+		}
+		code.Lines = append(code.Lines, lines[i].dedent(indent).text)
+	}
+	// an unclosed code block runs to the end of its container
+	code.Located = c.located(lines[start:])
+	return c.codeBlock(code, lines[start:]), i
+}
+
+// codeBlock keeps the code block as a comment if one of its lines starts with
+// ```, since that would end it early and the markup has no other fence.
+func (c *converter) codeBlock(code *parser.CodeBlock, lines []line) parser.Node {
+	for _, l := range code.Lines {
+		if strings.HasPrefix(strings.TrimSpace(l), "```") {
+			c.unconverted(lines, "code-block-fence", "code block contains a line starting with ```, it was kept as a comment")
+			return nil
+		}
+	}
+	return code
+}
+
+func (c *converter) blockQuote(lines []line, i int) (parser.Node, int) {
+	start := i
+	var content []line
+	lazy := false // whether the previous line continues a paragraph
+	for ; i < len(lines); i++ {
+		l := lines[i].trim()
+		if text, ok := strings.CutPrefix(l.text, ">"); ok && lines[i].indent() < 4 {
+			l = l.skip(1, "")
+			if strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t") {
+				l = l.dedent(1)
+			}
+			content = append(content, l)
+			lazy = !l.blank() && l.indent() < 4 && !fence.MatchString(l.trim().text)
+			continue
+		}
+		if !lazy || c.interrupts(lines[i]) {
+			break
+		}
+		content = append(content, lines[i])
+	}
+	located := c.located(lines[start:i])
+	// a GitHub alert, like > [!NOTE]
+	if first := slices.IndexFunc(content, func(l line) bool { return !l.blank() }); first >= 0 {
+		if m := alert.FindStringSubmatch(content[first].trim().text); m != nil {
+			return &parser.Admonition{
+				Located: located,
+				Type:    alertTypes[m[1]],
+				Content: c.nested(content[first+1:], "admonition"),
+			}, i
+		}
+	}
+	return &parser.BlockQuote{Located: located, Content: c.nested(content, "block quote")}, i
+}
+
+// nested parses the blocks inside of another block, where there can't be any
+// headings.
+func (c *converter) nested(lines []line, container string) []parser.Node {
+	nodes := c.blocks(lines)
+	for i, node := range nodes {
+		if h, ok := node.(*heading); ok {
+			c.warn(h.Span, "nested-heading", fmt.Sprintf("a heading can't be inside of a %s, it was turned into a paragraph of strong text", container))
+			p := &parser.Paragraph{Located: h.Located}
+			c.later(func() {
+				if len(h.content) > 0 {
+					s := parser.Strong{Content: h.content}
+					p.Content = []parser.Node{&s}
+				}
+			})
+			nodes[i] = p
+		}
+	}
+	return nodes
+}
+
+func (c *converter) list(lines []line, i int) (parser.Node, int) {
+	start := i
+	first := lines[i].trim().text
+	list := &parser.List{}
+	var bullet, delim string
+	if m := orderedItem.FindStringSubmatch(first); m != nil {
+		list.Ordered = true
+		list.Start, _ = strconv.Atoi(m[1])
+		delim = m[2]
+	} else {
+		bullet = first[:1]
+	}
+	for i < len(lines) {
+		l := lines[i]
+		if l.indent() >= 4 {
+			break
+		}
+		text := l.trim().text
+		var marker string
+		if list.Ordered {
+			m := orderedItem.FindStringSubmatch(text)
+			if m == nil || m[2] != delim {
+				break
+			}
+			marker = m[1] + m[2]
+		} else {
+			if !bulletItem.MatchString(text) || text[:1] != bullet || thematicBreak.MatchString(text) {
+				break
+			}
+			marker = bullet
+		}
+		var item *parser.ListItem
+		item, i = c.listItem(lines, i, len(marker))
+		list.Items = append(list.Items, item)
+		// blank lines between the items
+		next := i
+		for next < len(lines) && lines[next].blank() {
+			next++
+		}
+		if next == len(lines) || next == i {
+			continue
+		}
+		if text := lines[next].trim().text; lines[next].indent() < 4 && (bulletItem.MatchString(text) || orderedItem.MatchString(text)) {
+			i = next
+			continue
+		}
+		break
+	}
+	end := i
+	for end > start && lines[end-1].blank() {
+		end--
+	}
+	list.Located = c.located(lines[start:end])
+	return list, i
+}
+
+// listItem parses the item at lines[i], whose marker is width bytes long.
+func (c *converter) listItem(lines []line, i, width int) (*parser.ListItem, int) {
+	start := i
+	l := lines[i].trim()
+	markerIndent := lines[i].indent() - l.indent()
+	first := l.skip(width, "")
+	// the content is indented by the marker and up to 4 spaces after it
+	contentIndent := markerIndent + width + 1
+	if spaces := first.indent(); spaces >= 1 && spaces <= 4 && !first.blank() {
+		contentIndent = markerIndent + width + spaces
+	}
+	content := []line{first.dedent(contentIndent - markerIndent - width)}
+	lazy := !first.blank()
+	for i++; i < len(lines); i++ {
+		l := lines[i]
+		switch {
+		case l.blank():
+			content = append(content, l)
+			lazy = false
+			continue
+		case l.indent() >= contentIndent:
+			content = append(content, l.dedent(contentIndent))
+			lazy = !fence.MatchString(l.dedent(contentIndent).trim().text)
+			continue
+		case lazy && !c.interrupts(l) && !orderedItem.MatchString(l.trim().text):
+			// any item of the list ends the one before it
+			content = append(content, l)
+			continue
+		}
+		break
+	}
+	// the blank lines at the end separate the items
+	for len(content) > 1 && content[len(content)-1].blank() {
+		content = content[:len(content)-1]
+		i--
+	}
+	item := &parser.ListItem{Located: c.located(lines[start:i])}
+	if task := content[0].text; len(task) >= 3 && task[0] == '[' && task[2] == ']' && strings.ContainsRune(" xX", rune(task[1])) && (len(task) == 3 || task[3] == ' ') {
+		item.Task = true
+		item.Checked = task[1] != ' '
+		content[0] = content[0].skip(min(4, len(task)), "")
+	}
+	item.Content = c.nested(content, "list item")
+	return item, i
+}
+
+func (c *converter) table(lines []line, i int) (parser.Node, int, bool) {
+	start := i
+	header := splitRow(lines[i].trim())
+	delims := splitRow(lines[i+1].trim())
+	if len(header) != len(delims) {
+		return nil, i, false
+	}
+	t := &parser.Table{Attributes: parser.Attributes{}}
+	for _, d := range delims {
+		d := strings.TrimSpace(d.text)
+		switch {
+		case strings.HasPrefix(d, ":") && strings.HasSuffix(d, ":"):
+			t.Alignments = append(t.Alignments, parser.AlignCenter)
+		case strings.HasPrefix(d, ":"):
+			t.Alignments = append(t.Alignments, parser.AlignLeft)
+		case strings.HasSuffix(d, ":"):
+			t.Alignments = append(t.Alignments, parser.AlignRight)
+		default:
+			t.Alignments = append(t.Alignments, parser.AlignDefault)
+		}
+	}
+	var rows [][]line
+	for i += 2; i < len(lines) && !c.interrupts(lines[i]); i++ {
+		row := splitRow(lines[i].trim())
+		// every row has exactly one cell per column
+		for len(row) < len(header) {
+			row = append(row, line{})
+		}
+		rows = append(rows, row[:len(header)])
+	}
+	t.Located = c.located(lines[start:i])
+	c.later(func() {
+		for _, cell := range header {
+			t.Header = append(t.Header, c.inline([]line{cell}))
+		}
+		for _, row := range rows {
+			var cells []parser.TextRich
+			for _, cell := range row {
+				cells = append(cells, c.inline([]line{cell}))
+			}
+			t.Rows = append(t.Rows, cells)
+		}
+	})
+	return t, i, true
+}
+
+// splitRow splits a table row into its cells, at the pipes that are neither
+// escaped nor inside of code.
+func splitRow(l line) (cells []line) {
+	text := strings.TrimSpace(l.text)
+	l = l.skip(strings.Index(l.text, text), "")
+	if strings.HasPrefix(text, "|") {
+		text = text[1:]
+		l = l.skip(1, "")
+	}
+	if strings.HasSuffix(text, "|") && !strings.HasSuffix(text, "\\|") {
+		text = text[:len(text)-1]
+	}
+	start := 0
+	code := false
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '`':
+			code = !code
+		case '|':
+			if !code {
+				cell := l.skip(start, "")
+				cell.text = strings.TrimSpace(text[start:i])
+				cells = append(cells, cell)
+				start = i + 1
+			}
+		}
+	}
+	cell := l.skip(start, "")
+	cell.text = strings.TrimSpace(text[start:])
+	return append(cells, cell)
+}
+
+func (c *converter) definitionList(lines []line, i int) (parser.Node, int) {
+	start := i
+	list := &parser.DefinitionList{}
+	for i < len(lines) && !lines[i].blank() {
+		term := lines[i].trim()
+		var explanations []line
+		for i++; i < len(lines); i++ {
+			text, ok := strings.CutPrefix(lines[i].trim().text, ": ")
+			if !ok {
+				break
+			}
+			explanation := lines[i].trim()
+			explanation = explanation.skip(len(explanation.text)-len(text), "")
+			explanations = append(explanations, explanation)
+		}
+		if len(explanations) == 0 {
+			break
+		}
+		definition := &parser.Definition{}
+		list.Definitions = append(list.Definitions, definition)
+		c.later(func() {
+			definition.Term = c.inline([]line{term})
+			for _, explanation := range explanations {
+				definition.Explanations = append(definition.Explanations, c.inline([]line{explanation}))
+			}
+		})
+	}
+	list.Located = c.located(lines[start:i])
+	return list, i
+}
+
+func (c *converter) linkDefinition(l line) {
+	m := linkDef.FindStringSubmatch(l.text)
+	label := normalizeLabel(m[1])
+	if _, ok := c.links[label]; ok {
+		return // the first definition wins
+	}
+	href := m[2]
+	if strings.HasPrefix(href, "<") {
+		href = href[1 : len(href)-1]
+	}
+	title := m[3]
+	if title != "" {
+		title = title[1 : len(title)-1]
+	}
+	c.links[label] = linkDefinition{id: strings.TrimSpace(m[1]), href: unescape(href), title: unescape(title)}
+}
+
+func (c *converter) footnoteDefinition(lines []line, i int) (parser.Node, int) {
+	start := i
+	l := lines[i].trim()
+	m := footnoteDef.FindStringSubmatchIndex(l.text)
+	label := l.text[m[2]:m[3]]
+	content := []line{l.skip(m[4], "")}
+	lazy := !content[0].blank()
+	for i++; i < len(lines); i++ {
+		l := lines[i]
+		switch {
+		case l.blank():
+			content = append(content, l)
+			lazy = false
+			continue
+		case l.indent() >= 4:
+			content = append(content, l.dedent(4))
+			lazy = true
+			continue
+		case lazy && !c.interrupts(l) && !footnoteDef.MatchString(l.trim().text):
+			content = append(content, l)
+			continue
+		}
+		break
+	}
+	if _, ok := c.footnotes[label]; !ok {
+		c.footnotes[label] = &footnote{
+			id:     footnoteID(label),
+			span:   c.span(lines[start], lines[start]),
+			blocks: c.nested(content, "footnote"),
+		}
+		c.footnoteOrder = append(c.footnoteOrder, label)
+	}
+	return nil, i
+}
+
+// htmlComment keeps an html comment as a comment.
+func (c *converter) htmlComment(lines []line, i int) (parser.Node, int) {
+	start := i
+	for ; i < len(lines); i++ {
+		if strings.Contains(lines[i].text, "-->") {
+			i++
+			break
+		}
+	}
+	var text []string
+	for _, l := range lines[start:i] {
+		text = append(text, strings.TrimSpace(l.text))
+	}
+	comment := strings.Join(text, "\n")
+	comment = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(comment), "<!--"), "-->"))
+	c.comment(lines[start], comment)
+	return nil, i
+}
+
+// htmlBlock keeps an html block as a comment, since there is no raw html in
+// the markup, except for a lone image.
+func (c *converter) htmlBlock(lines []line, i int) (parser.Node, int) {
+	start := i
+	name := strings.ToLower(htmlOpen.FindStringSubmatch(lines[i].trim().text)[1])
+	closing := ""
+	if slices.Contains([]string{"pre", "script", "style", "textarea"}, name) {
+		closing = "</" + name + ">"
+	}
+	for ; i < len(lines); i++ {
+		if closing == "" && lines[i].blank() {
+			break
+		}
+		if closing != "" && strings.Contains(strings.ToLower(lines[i].text), closing) {
+			i++
+			break
+		}
+	}
+	block := lines[start:i]
+	if name == "img" && len(block) == 1 {
+		if img := c.htmlImage(block[0]); img != nil {
+			return img, i
+		}
+	}
+	c.unconverted(block, "html-block", fmt.Sprintf("html block <%s> was kept as a comment", name))
+	return nil, i
+}
+
+// htmlImage converts an <img> tag with a src attribute.
+func (c *converter) htmlImage(l line) parser.Node {
+	attrs := htmlAttributes(l.trim().text)
+	src, ok := attrs["src"]
+	if !ok {
+		return nil
+	}
+	return c.image(c.span(l, l), src, attrs["alt"], attrs["title"])
+}
+
+var htmlAttribute = regexp.MustCompile(`([a-zA-Z_:][\w.:-]*)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'=<>` + "`" + `]+)))?`)
+
+// htmlAttributes parses the attributes of an html tag, or of a shortcode.
+func htmlAttributes(tag string) map[string]string {
+	attrs := map[string]string{}
+	tag = strings.TrimLeft(tag, "<{%")
+	// skip the name of the tag
+	if i := strings.IndexAny(tag, " \t"); i >= 0 {
+		tag = tag[i:]
+	} else {
+		return attrs
+	}
+	for _, m := range htmlAttribute.FindAllStringSubmatch(tag, -1) {
+		attrs[strings.ToLower(m[1])] = m[2] + m[3] + m[4]
+	}
+	return attrs
+}
+
+// shortcode converts the Hugo shortcodes that have an equivalent, and keeps
+// the others as a comment.
+func (c *converter) shortcode(lines []line, i int) (parser.Node, int) {
+	m := shortcode.FindStringSubmatch(lines[i].trim().text)
+	closing, name, params := m[2] == "/", m[3], m[4]
+	switch {
+	case !closing && name == "figure":
+		attrs := htmlAttributes("figure" + params)
+		if src, ok := attrs["src"]; ok {
+			return c.image(c.span(lines[i], lines[i]), src, attrs["alt"], cmp.Or(attrs["title"], attrs["caption"])), i + 1
+		}
+	case !closing && name == "highlight":
+		lang, _, _ := strings.Cut(strings.TrimSpace(params), " ")
+		return c.codeUntil(lines, i, strings.Trim(lang, `"`), regexp.MustCompile(`^\{\{[<%]-?[ \t]*/highlight[ \t]*-?[>%]\}\}[ \t]*$`))
+	}
+	c.unconverted(lines[i:i+1], "shortcode", fmt.Sprintf("shortcode %s was kept as a comment", name))
+	return nil, i + 1
+}
+
+// liquidTag converts the Jekyll tags that have an equivalent, and keeps the
+// others as a comment.
+func (c *converter) liquidTag(lines []line, i int) (parser.Node, int) {
+	m := liquidTag.FindStringSubmatch(lines[i].trim().text)
+	name, params := m[1], strings.TrimSpace(m[2])
+	switch name {
+	case "raw", "endraw":
+		return nil, i + 1
+	case "highlight":
+		lang, _, _ := strings.Cut(params, " ")
+		return c.codeUntil(lines, i, lang, regexp.MustCompile(`^\{%-?[ \t]*endhighlight[ \t]*-?%\}[ \t]*$`))
+	}
+	c.unconverted(lines[i:i+1], "liquid-tag", fmt.Sprintf("liquid tag %s was kept as a comment", name))
+	return nil, i + 1
+}
+
+// codeUntil makes a code block of the lines after lines[i], up to the line
+// matching end.
+func (c *converter) codeUntil(lines []line, i int, lang string, end *regexp.Regexp) (parser.Node, int) {
+	start := i
+	code := &parser.CodeBlock{Attributes: parser.Attributes{}}
+	if lang != "" {
+		code.Attributes["Lang"] = lang
+	}
+	for i++; i < len(lines) && !end.MatchString(lines[i].trim().text); i++ {
+		code.Lines = append(code.Lines, lines[i].text)
+	}
+	code.Located = c.located(lines[start:min(i+1, len(lines))])
+	return c.codeBlock(code, lines[start:min(i+1, len(lines))]), min(i+1, len(lines))
+}
@@ -0,0 +1,247 @@
+package markdown
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type (
+	// field of the front matter, in the order it was written in.
+	// The value is a string, a []string, or a table for anything nested.
+	field struct {
+		key   string
+		value any
+		line  int // of the key, starting at 1
+	}
+	// table is a nested value, like a YAML mapping or a TOML table, which
+	// the meta has no equivalent for.
+	table struct{}
+)
+
+// splitFrontMatter cuts the front matter off the source.
+// YAML front matter is enclosed in `---`, TOML front matter in `+++`.
+// The lines of the front matter are returned without the delimiters, the body
+// starts at line bodyLine (starting at 1).
+func splitFrontMatter(src string) (delim string, frontMatter []string, body string, bodyLine int, err error) {
+	lines := strings.SplitAfter(src, "\n")
+	if len(lines) == 0 {
+		return "", nil, src, 1, nil
+	}
+	delim = strings.TrimRight(lines[0], " \t\r\n")
+	if delim != "---" && delim != "+++" {
+		return "", nil, src, 1, nil
+	}
+	for i := 1; i < len(lines); i++ {
+		end := strings.TrimRight(lines[i], " \t\r\n")
+		if end == delim || (delim == "---" && end == "...") {
+			for j := 1; j < i; j++ {
+				frontMatter = append(frontMatter, strings.TrimRight(lines[j], "\r\n"))
+			}
+			return delim, frontMatter, strings.Join(lines[i+1:], ""), i + 2, nil
+		}
+	}
+	return "", nil, "", 0, fmt.Errorf("front matter is missing its closing `%s`", delim)
+}
+
+// parseYAML reads the subset of YAML used by front matter: keys with plain or
+// quoted scalars, block scalars, and flow or block sequences.
+func parseYAML(lines []string, firstLine int) (fields []field, err error) {
+	for i := 0; i < len(lines); i++ {
+		l := lines[i]
+		trimmed := strings.TrimSpace(l)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if l[0] == ' ' || l[0] == '\t' {
+			return nil, fmt.Errorf("line %d: unexpected indentation", firstLine+i)
+		}
+		key, rest, ok := cutKey(l, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected `key: value`", firstLine+i)
+		}
+		f := field{key: key, line: firstLine + i}
+		// the indented lines following the key, sequences may also start
+		// right below it
+		j := i + 1
+		for j < len(lines) && (strings.TrimSpace(lines[j]) == "" || lines[j][0] == ' ' || lines[j][0] == '\t' || lines[j][0] == '-') {
+			j++
+		}
+		block := lines[i+1 : j]
+		i = j - 1
+		rest = strings.TrimSpace(stripComment(rest))
+		switch {
+		case rest == "":
+			f.value = yamlBlock(block)
+		case strings.HasPrefix(rest, "|") || strings.HasPrefix(rest, ">"):
+			var content []string
+			for _, l := range block {
+				content = append(content, strings.TrimSpace(l))
+			}
+			sep := "\n"
+			if rest[0] == '>' {
+				sep = " "
+			}
+			f.value = strings.TrimSpace(strings.Join(content, sep))
+		case strings.HasPrefix(rest, "["):
+			flow := rest
+			for _, l := range block {
+				flow += " " + strings.TrimSpace(stripComment(l))
+			}
+			if !strings.HasSuffix(flow, "]") {
+				return nil, fmt.Errorf("line %d: sequence is missing its closing `]`", f.line)
+			}
+			f.value = splitList(flow[1 : len(flow)-1])
+		case strings.HasPrefix(rest, "{"):
+			f.value = table{}
+		default:
+			// plain scalars may continue on the following lines
+			for _, l := range block {
+				if continued := strings.TrimSpace(stripComment(l)); continued != "" {
+					rest += " " + continued
+				}
+			}
+			f.value = unquote(rest)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// yamlBlock is the value written on the lines below its key, either a block
+// sequence, or a nested mapping.
+func yamlBlock(block []string) any {
+	var items []string
+	for _, l := range block {
+		trimmed := strings.TrimSpace(stripComment(l))
+		if trimmed == "" {
+			continue
+		}
+		item, ok := strings.CutPrefix(trimmed, "-")
+		if !ok {
+			return table{}
+		}
+		items = append(items, unquote(strings.TrimSpace(item)))
+	}
+	if items == nil {
+		return ""
+	}
+	return items
+}
+
+// parseTOML reads the subset of TOML used by front matter: keys with strings,
+// numbers, booleans, dates and arrays of them.
+// Keys of tables are prefixed with the name of the table, like params.series.
+func parseTOML(lines []string, firstLine int) (fields []field, err error) {
+	prefix := ""
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(stripComment(lines[i]))
+		if trimmed == "" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "[") {
+			prefix = strings.Trim(trimmed, "[] ") + "."
+			continue
+		}
+		key, rest, ok := cutKey(trimmed, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected `key = value`", firstLine+i)
+		}
+		f := field{key: prefix + key, line: firstLine + i}
+		rest = strings.TrimSpace(rest)
+		switch {
+		case strings.HasPrefix(rest, `"""`) || strings.HasPrefix(rest, `'''`):
+			quote := rest[:3]
+			content := rest[3:]
+			for !strings.Contains(content, quote) {
+				i++
+				if i >= len(lines) {
+					return nil, fmt.Errorf("line %d: string is missing its closing %s", f.line, quote)
+				}
+				content += "\n" + lines[i]
+			}
+			content, _, _ = strings.Cut(content, quote)
+			f.value = strings.TrimSpace(content)
+		case strings.HasPrefix(rest, "["):
+			for strings.Count(rest, "[") > strings.Count(rest, "]") {
+				i++
+				if i >= len(lines) {
+					return nil, fmt.Errorf("line %d: array is missing its closing `]`", f.line)
+				}
+				rest += " " + strings.TrimSpace(stripComment(lines[i]))
+			}
+			rest = strings.TrimSpace(rest)
+			f.value = splitList(rest[1 : len(rest)-1])
+		case strings.HasPrefix(rest, "{"):
+			f.value = table{}
+		default:
+			f.value = unquote(rest)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// cutKey splits a line at the separator following its (possibly quoted) key.
+func cutKey(l, sep string) (key, rest string, ok bool) {
+	key, rest, ok = strings.Cut(l, sep)
+	return unquote(strings.TrimSpace(key)), rest, ok && strings.TrimSpace(key) != ""
+}
+
+// stripComment removes a trailing # comment that is not inside of quotes.
+func stripComment(s string) string {
+	var quote rune
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// splitList splits the items of a flow sequence or array at their commas.
+func splitList(s string) (items []string) {
+	items = []string{}
+	var quote rune
+	start := 0
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			if item := strings.TrimSpace(s[start:i]); item != "" {
+				items = append(items, unquote(item))
+			}
+			start = i + 1
+		}
+	}
+	if item := strings.TrimSpace(s[start:]); item != "" {
+		items = append(items, unquote(item))
+	}
+	return items
+}
+
+// unquote removes the quotes around a scalar, resolving its escapes.
+func unquote(s string) string {
+	switch {
+	case len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"':
+		if unquoted, err := strconv.Unquote(s); err == nil {
+			return unquoted
+		}
+		return s[1 : len(s)-1]
+	case len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'':
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	}
+	return s
+}
@@ -0,0 +1,1032 @@
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/cvanloo/blog-go/markup/diagnostic"
+	"github.com/cvanloo/blog-go/markup/lexer"
+	"github.com/cvanloo/blog-go/markup/parser"
+)
+
+type (
+	// inlineParser parses the text of a paragraph, whose lines are joined
+	// by newlines.
+	inlineParser struct {
+		c      *converter
+		text   string
+		lines  []line
+		starts []int // of the lines in text
+		images bool  // whether images may be part of the content
+	}
+
+	// item of the inline content, before emphasis is resolved.
+	item struct {
+		node parser.Node
+		// a run of delimiters, if node is nil
+		delim       byte
+		count       int
+		open, close bool
+	}
+
+	// footnoteRef is a reference to a footnote, before it is known whether
+	// it can be a sidenote.
+	footnoteRef struct {
+		label string
+		span  diagnostic.Span
+	}
+)
+
+func (f *footnoteRef) Accept(parser.Visitor) {}
+
+// inline parses the lines of a heading, a table cell, or any other text that
+// can't contain images.
+func (c *converter) inline(lines []line) parser.TextRich {
+	return c.inlineText(lines, false)
+}
+
+// paragraphContent parses the lines of a paragraph.
+// Its images are part of its content, until hoistImages splits them off.
+func (c *converter) paragraphContent(lines []line) parser.TextRich {
+	return c.inlineText(lines, true)
+}
+
+func (c *converter) inlineText(lines []line, images bool) parser.TextRich {
+	p := &inlineParser{c: c, images: images}
+	for i, l := range lines {
+		if i > 0 {
+			p.text += "\n"
+		}
+		// the indentation of continuation lines doesn't matter
+		trimmed := strings.TrimLeft(l.text, " \t")
+		l = l.skip(len(l.text)-len(trimmed), "")
+		if i == len(lines)-1 {
+			l.text = strings.TrimRight(l.text, " \t")
+		}
+		p.starts = append(p.starts, len(p.text))
+		p.lines = append(p.lines, l)
+		p.text += l.text
+	}
+	return p.finish(p.parse(0, len(p.text)))
+}
+
+// position of the byte offset i of the text in the source.
+func (p *inlineParser) position(i int) diagnostic.Position {
+	n := 0
+	for n+1 < len(p.starts) && p.starts[n+1] <= i {
+		n++
+	}
+	l := p.lines[n]
+	runes := utf8.RuneCountInString(p.text[p.starts[n]:i])
+	return diagnostic.Position{Offset: l.offset + runes, Line: l.number, Column: l.column + runes}
+}
+
+func (p *inlineParser) span(start, end int) diagnostic.Span {
+	return diagnostic.Span{Filename: p.c.filename, Start: p.position(start), End: p.position(end)}
+}
+
+var (
+	autolink     = regexp.MustCompile(`^<([a-zA-Z][a-zA-Z0-9+.-]{1,31}:[^\s<>]*)>`)
+	emailLink    = regexp.MustCompile(`^<([a-zA-Z0-9.!#$%&'*+/=?^_` + "`" + `{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*)>`)
+	htmlTag      = regexp.MustCompile(`^(?:<([a-zA-Z][a-zA-Z0-9-]*)(?:\s+[a-zA-Z_:][\w.:-]*(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'=<>` + "`" + `]+))?)*\s*(/?)>|</([a-zA-Z][a-zA-Z0-9-]*)\s*>|<!--[\s\S]*?-->)`)
+	entity       = regexp.MustCompile(`^&(?:#[xX][0-9a-fA-F]{1,6}|#[0-9]{1,7}|[a-zA-Z][a-zA-Z0-9]{1,31});`)
+	inlineSyntax = regexp.MustCompile(`^(?:\{\{[<%].*?[>%]\}\}|\{%.*?%\}|\{\{.*?\}\})`)
+)
+
+// htmlInline are the inline html elements with an equivalent, their content
+// is parsed like the surrounding text.
+var htmlInline = map[string]func(parser.TextRich) parser.Node{
+	"em":     func(t parser.TextRich) parser.Node { return &parser.Emphasis{Content: t} },
+	"i":      func(t parser.TextRich) parser.Node { return &parser.Emphasis{Content: t} },
+	"strong": func(t parser.TextRich) parser.Node { return &parser.Strong{Content: t} },
+	"b":      func(t parser.TextRich) parser.Node { return &parser.Strong{Content: t} },
+	"del":    func(t parser.TextRich) parser.Node { return &parser.Strikethrough{Content: t} },
+	"s":      func(t parser.TextRich) parser.Node { return &parser.Strikethrough{Content: t} },
+	"mark":   func(t parser.TextRich) parser.Node { return &parser.Marker{Content: t} },
+	"q":      func(t parser.TextRich) parser.Node { return &parser.EnquoteDouble{Content: t} },
+}
+
+// htmlText are the inline html elements whose content is plain text.
+var htmlText = map[string]func(string) parser.Node{
+	"code": func(s string) parser.Node { return &parser.Mono{Text: s} },
+	"kbd":  func(s string) parser.Node { return &parser.Kbd{Text: s} },
+	"sup":  func(s string) parser.Node { return &parser.Superscript{Text: s} },
+	"sub":  func(s string) parser.Node { return &parser.Subscript{Text: s} },
+}
+
+// parse the text between start and end into inline nodes.
+func (p *inlineParser) parse(start, end int) []parser.Node {
+	var (
+		items []item
+		text  strings.Builder
+	)
+	flush := func() {
+		if text.Len() > 0 {
+			items = append(items, item{node: &parser.Text{Text: text.String()}})
+			text.Reset()
+		}
+	}
+	add := func(node parser.Node) {
+		flush()
+		items = append(items, item{node: node})
+	}
+	s := p.text[:end]
+	for i := start; i < end; {
+		ch := s[i]
+		switch ch {
+		case '\\':
+			if i+1 < end && s[i+1] == '\n' {
+				add(&parser.LineBreak{})
+				i += 2
+				continue
+			}
+			if i+1 < end && isASCIIPunct(s[i+1]) {
+				text.WriteByte(s[i+1])
+				i += 2
+				continue
+			}
+		case '`':
+			n := runLength(s, i, '`')
+			if close := findCodeClose(s, i+n, n); close >= 0 {
+				add(&parser.Mono{Text: codeContent(s[i+n : close])})
+				i = close + n
+				continue
+			}
+			text.WriteString(s[i : i+n])
+			i += n
+			continue
+		case '*', '_', '~':
+			n := runLength(s, i, ch)
+			before, _ := utf8.DecodeLastRuneInString(s[:i])
+			if i == 0 {
+				before = '\n'
+			}
+			after, _ := utf8.DecodeRuneInString(s[i+n:])
+			if i+n >= end {
+				after = '\n'
+			}
+			left := !isSpace(after) && (!isPunct(after) || isSpace(before) || isPunct(before))
+			right := !isSpace(before) && (!isPunct(before) || isSpace(after) || isPunct(after))
+			open, close := left, right
+			if ch == '_' {
+				open = left && (!right || isPunct(before))
+				close = right && (!left || isPunct(after))
+			}
+			if ch == '~' && n != 2 {
+				open, close = false, false
+			}
+			flush()
+			items = append(items, item{delim: ch, count: n, open: open, close: close})
+			i += n
+			continue
+		case '!':
+			if i+1 < end && s[i+1] == '[' {
+				if node, next, ok := p.link(i+1, end, true); ok {
+					add(node)
+					i = next
+					continue
+				}
+			}
+		case '[':
+			if node, next, ok := p.footnote(i, end); ok {
+				add(node)
+				i = next
+				continue
+			}
+			if node, next, ok := p.link(i, end, false); ok {
+				add(node)
+				i = next
+				continue
+			}
+		case '<':
+			if node, next, ok := p.angle(i, end); ok {
+				if node != nil {
+					add(node)
+				}
+				i = next
+				continue
+			}
+		case '&':
+			if m := entity.FindString(s[i:]); m != "" {
+				if slices.Contains(lexer.AmpSpecials, m) {
+					add(&parser.AmpSpecial{Text: m})
+				} else {
+					text.WriteString(html.UnescapeString(m))
+				}
+				i += len(m)
+				continue
+			}
+		case '\n':
+			// two spaces at the end of a line break it
+			if t := text.String(); strings.HasSuffix(t, "  ") {
+				text.Reset()
+				text.WriteString(strings.TrimRight(t, " "))
+				add(&parser.LineBreak{})
+			}
+		case '{':
+			if m := inlineSyntax.FindString(s[i:]); m != "" {
+				p.c.warn(p.span(i, i+len(m)), "template-syntax", fmt.Sprintf("template syntax was kept as text: %s", m))
+				text.WriteString(m)
+				i += len(m)
+				continue
+			}
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		text.WriteString(s[i : i+size])
+		i += size
+	}
+	flush()
+	return resolveEmphasis(items)
+}
+
+// link parses a link, or an image, starting with the bracket at s[i]. The !
+// of an image is at s[i-1].
+func (p *inlineParser) link(i, end int, image bool) (parser.Node, int, bool) {
+	s := p.text[:end]
+	close := matchBracket(s, i)
+	if close < 0 {
+		return nil, 0, false
+	}
+	label := s[i+1 : close]
+	var (
+		href, title string
+		next        int
+		ref         *linkDefinition
+	)
+	if dest, after, ok := parseDestination(s, close+1); ok {
+		href, title, next = dest.href, dest.title, after
+	} else {
+		refLabel := label
+		next = close + 1
+		if close+1 < end && s[close+1] == '[' {
+			if refClose := matchBracket(s, close+1); refClose >= 0 {
+				if inner := s[close+2 : refClose]; inner != "" {
+					refLabel = inner
+				}
+				next = refClose + 1
+			}
+		}
+		def, ok := p.c.links[normalizeLabel(refLabel)]
+		if !ok {
+			return nil, 0, false
+		}
+		ref = &def
+		href, title = def.href, def.title
+	}
+	start := i
+	if image {
+		start-- // at the !
+	}
+	span := p.span(start, next)
+	if image {
+		return p.image(span, href, p.plain(i+1, close), title), next, true
+	}
+	// the name of a link can't contain an image, like a badge
+	images := p.images
+	p.images = false
+	link := &parser.Link{Located: parser.Located{Span: span}, Name: p.parse(i+1, close)}
+	p.images = images
+	if ref != nil && ref.title == "" {
+		link.Ref = ref.id
+	} else {
+		link.Href, link.Title = href, title
+	}
+	return link, next, true
+}
+
+// footnote parses a reference to a defined footnote, like [^1].
+func (p *inlineParser) footnote(i, end int) (parser.Node, int, bool) {
+	s := p.text[:end]
+	if !strings.HasPrefix(s[i:], "[^") {
+		return nil, 0, false
+	}
+	close := strings.IndexAny(s[i:], "] \t\n")
+	if close < 0 || s[i+close] != ']' {
+		return nil, 0, false
+	}
+	label := s[i+2 : i+close]
+	if _, ok := p.c.footnotes[label]; !ok {
+		return nil, 0, false
+	}
+	return &footnoteRef{label: label, span: p.span(i, i+close+1)}, i + close + 1, true
+}
+
+// angle parses what starts with a `<`, an autolink or inline html.
+// The node is nil for html that is left out.
+func (p *inlineParser) angle(i, end int) (parser.Node, int, bool) {
+	s := p.text[:end]
+	if m := autolink.FindStringSubmatch(s[i:]); m != nil {
+		if strings.HasPrefix(m[1], "http://") || strings.HasPrefix(m[1], "https://") {
+			return &parser.Linkify{Text: m[1]}, i + len(m[0]), true
+		}
+		return &parser.Link{Name: parser.TextRich{&parser.Text{Text: m[1]}}, Href: m[1]}, i + len(m[0]), true
+	}
+	if m := emailLink.FindStringSubmatch(s[i:]); m != nil {
+		return &parser.Link{Name: parser.TextRich{&parser.Text{Text: m[1]}}, Href: "mailto:" + m[1]}, i + len(m[0]), true
+	}
+	m := htmlTag.FindStringSubmatchIndex(s[i:])
+	if m == nil {
+		return nil, 0, false
+	}
+	tag := s[i : i+m[1]]
+	next := i + m[1]
+	if strings.HasPrefix(tag, "<!--") {
+		return nil, next, true // a comment
+	}
+	if m[6] >= 0 {
+		p.c.warn(p.span(i, next), "inline-html", fmt.Sprintf("html tag %s was left out", tag))
+		return nil, next, true
+	}
+	name := strings.ToLower(s[i+m[2] : i+m[3]])
+	selfClosing := m[4] >= 0 && m[5] > m[4]
+	if name == "br" {
+		return &parser.LineBreak{}, next, true
+	}
+	if name == "img" {
+		attrs := htmlAttributes(tag)
+		return p.image(p.span(i, next), attrs["src"], attrs["alt"], attrs["title"]), next, true
+	}
+	if !selfClosing {
+		closing := regexp.MustCompile(`(?i)</` + regexp.QuoteMeta(name) + `\s*>`)
+		if c := closing.FindStringIndex(s[next:]); c != nil {
+			if convert, ok := htmlInline[name]; ok {
+				return convert(p.parse(next, next+c[0])), next + c[1], true
+			}
+			if convert, ok := htmlText[name]; ok {
+				text := html.UnescapeString(s[next : next+c[0]])
+				before, _ := utf8.DecodeLastRuneInString(s[:i])
+				after, _ := utf8.DecodeRuneInString(s[next+c[1]:])
+				if name == "sub" && (isWordRune(before) || isWordRune(after)) {
+					p.c.warn(p.span(i, next+c[1]), "inline-html", fmt.Sprintf("subscript %s can't be next to a word, it was kept as text", text))
+					return &parser.Text{Text: text}, next + c[1], true
+				}
+				return convert(text), next + c[1], true
+			}
+		}
+	}
+	p.c.warn(p.span(i, next), "inline-html", fmt.Sprintf("html tag %s was left out", tag))
+	return nil, next, true
+}
+
+// image converts an image, if the content can contain it, or keeps its alt
+// text.
+func (p *inlineParser) image(span diagnostic.Span, src, alt, title string) parser.Node {
+	if !p.images {
+		p.c.warn(span, "inline-image", fmt.Sprintf("image %s can only be part of a paragraph, its alt text was kept", src))
+		return &parser.Text{Text: alt}
+	}
+	img := p.c.image(span, src, alt, title)
+	if paragraph, ok := img.(*parser.Paragraph); ok {
+		return paragraph.Content[0] // the link to the image
+	}
+	return img
+}
+
+// plain is the text between start and end without any markup, as used for
+// the alt text of images.
+func (p *inlineParser) plain(start, end int) string {
+	var b strings.Builder
+	var walk func(nodes []parser.Node)
+	walk = func(nodes []parser.Node) {
+		for _, node := range nodes {
+			switch node := node.(type) {
+			case *parser.Text:
+				b.WriteString(node.Text)
+			case *parser.Mono:
+				b.WriteString(node.Text)
+			case *parser.AmpSpecial:
+				b.WriteString(html.UnescapeString(node.Text))
+			case *parser.Emphasis:
+				walk(node.Content)
+			case *parser.Strong:
+				walk(node.Content)
+			case *parser.EmphasisStrong:
+				walk(node.Content)
+			case *parser.Strikethrough:
+				walk(node.Content)
+			case *parser.Link:
+				walk(node.Name)
+			}
+		}
+	}
+	walk(p.parse(start, end))
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+type destination struct {
+	href, title string
+}
+
+// parseDestination parses the (href "title") after the text of a link.
+func parseDestination(s string, i int) (destination, int, bool) {
+	var d destination
+	if i >= len(s) || s[i] != '(' {
+		return d, 0, false
+	}
+	i = skipSpace(s, i+1)
+	if i < len(s) && s[i] == '<' {
+		close := strings.IndexAny(s[i:], ">\n")
+		if close < 0 || s[i+close] != '>' {
+			return d, 0, false
+		}
+		d.href = unescape(s[i+1 : i+close])
+		i += close + 1
+	} else {
+		start, depth := i, 0
+	href:
+		for ; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case '(':
+				depth++
+			case ')':
+				if depth == 0 {
+					break href
+				}
+				depth--
+			case ' ', '\t', '\n':
+				break href
+			}
+		}
+		d.href = unescape(s[start:min(i, len(s))])
+	}
+	afterHref := i
+	i = skipSpace(s, i)
+	if i < len(s) && i > afterHref && strings.ContainsRune(`"'(`, rune(s[i])) {
+		closing := map[byte]byte{'"': '"', '\'': '\'', '(': ')'}[s[i]]
+		start := i + 1
+		for i = start; i < len(s) && s[i] != closing; i++ {
+			if s[i] == '\\' {
+				i++
+			}
+		}
+		if i >= len(s) {
+			return d, 0, false
+		}
+		d.title = unescape(s[start:i])
+		i = skipSpace(s, i+1)
+	}
+	if i >= len(s) || s[i] != ')' {
+		return d, 0, false
+	}
+	return d, i + 1, true
+}
+
+func skipSpace(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\n') {
+		i++
+	}
+	return i
+}
+
+// matchBracket finds the `]` closing the `[` at s[i], skipping over escapes
+// and code.
+func matchBracket(s string, i int) int {
+	depth := 0
+	for j := i; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '`':
+			n := runLength(s, j, '`')
+			if close := findCodeClose(s, j+n, n); close >= 0 {
+				j = close + n - 1
+			} else {
+				j += n - 1
+			}
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+func runLength(s string, i int, ch byte) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == ch {
+		n++
+	}
+	return n
+}
+
+// findCodeClose finds the run of exactly n backticks closing a code span.
+func findCodeClose(s string, i, n int) int {
+	for i < len(s) {
+		j := strings.IndexByte(s[i:], '`')
+		if j < 0 {
+			return -1
+		}
+		j += i
+		if m := runLength(s, j, '`'); m == n {
+			return j
+		} else {
+			i = j + m
+		}
+	}
+	return -1
+}
+
+// codeContent normalizes the content of a code span, its newlines become
+// spaces, and a single space around it is removed.
+func codeContent(s string) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	if len(s) >= 2 && s[0] == ' ' && s[len(s)-1] == ' ' && strings.Trim(s, " ") != "" {
+		s = s[1 : len(s)-1]
+	}
+	return s
+}
+
+// unescape resolves the backslash escapes and entities in a link destination
+// or title.
+func unescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return html.UnescapeString(b.String())
+}
+
+func unescapeURL(s string) string {
+	if unescaped, err := url.PathUnescape(s); err == nil {
+		return unescaped
+	}
+	return s
+}
+
+func isASCIIPunct(b byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", b) >= 0
+}
+
+// isWordRune reports whether r is part of a word, which a subscript of the
+// markup must not touch.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+func isSpace(r rune) bool {
+	return r == utf8.RuneError || unicode.IsSpace(r)
+}
+
+func isPunct(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+// resolveEmphasis matches the runs of delimiters into emphasis, strong and
+// strikethrough, following the rules of CommonMark.
+func resolveEmphasis(items []item) []parser.Node {
+	for closer := 0; closer < len(items); closer++ {
+		c := &items[closer]
+		if c.node != nil || !c.close || c.count == 0 {
+			continue
+		}
+		opener := -1
+		for j := closer - 1; j >= 0; j-- {
+			o := &items[j]
+			if o.node != nil || !o.open || o.delim != c.delim || o.count == 0 {
+				continue
+			}
+			if c.delim == '~' && o.count != c.count {
+				continue
+			}
+			// the rule of 3
+			if (o.close || c.open) && (o.count+c.count)%3 == 0 && !(o.count%3 == 0 && c.count%3 == 0) {
+				continue
+			}
+			opener = j
+			break
+		}
+		if opener < 0 {
+			continue
+		}
+		o := &items[opener]
+		use := 1
+		if o.count >= 2 && c.count >= 2 {
+			use = 2
+		}
+		content := textOf(items[opener+1 : closer])
+		var node parser.Node
+		switch {
+		case c.delim == '~':
+			node = &parser.Strikethrough{Content: content}
+		case use == 2:
+			node = &parser.Strong{Content: content}
+			if len(content) == 1 {
+				if e, ok := content[0].(*parser.Emphasis); ok {
+					node = &parser.EmphasisStrong{Content: e.Content}
+				}
+			}
+		default:
+			node = &parser.Emphasis{Content: content}
+			if len(content) == 1 {
+				if s, ok := content[0].(*parser.Strong); ok {
+					node = &parser.EmphasisStrong{Content: s.Content}
+				}
+			}
+		}
+		o.count -= use
+		c.count -= use
+		// replace the content between the delimiters with the node
+		items = slices.Replace(items, opener+1, closer, item{node: node})
+		closer = opener + 2
+		if items[opener].count == 0 {
+			items = slices.Delete(items, opener, opener+1)
+			closer--
+		}
+		if items[closer].count == 0 {
+			items = slices.Delete(items, closer, closer+1)
+		}
+		// look at the closer again if it has delimiters left, or else at the
+		// item that followed it
+		closer--
+	}
+	return textOf(items)
+}
+
+// textOf turns the items into nodes, the delimiters that weren't matched are
+// text.
+func textOf(items []item) []parser.Node {
+	var nodes []parser.Node
+	for _, it := range items {
+		if it.node != nil {
+			nodes = append(nodes, it.node)
+		} else if it.count > 0 {
+			nodes = append(nodes, &parser.Text{Text: strings.Repeat(string(it.delim), it.count)})
+		}
+	}
+	return nodes
+}
+
+// finish makes the inline nodes fit the markup.
+// Dashes, ellipses and quotes are typeset like the typographer of Hugo does,
+// and the references to footnotes become sidenotes where possible.
+func (p *inlineParser) finish(nodes []parser.Node) parser.TextRich {
+	var typeset []parser.Node
+	for _, node := range mergeText(nodes) {
+		switch node := node.(type) {
+		case *parser.Text:
+			typeset = append(typeset, typography(node.Text)...)
+			continue
+		case *parser.Emphasis:
+			node.Content = p.finish(node.Content)
+		case *parser.Strong:
+			node.Content = p.finish(node.Content)
+		case *parser.EmphasisStrong:
+			node.Content = p.finish(node.Content)
+		case *parser.Strikethrough:
+			node.Content = p.finish(node.Content)
+		case *parser.Marker:
+			node.Content = p.finish(node.Content)
+		case *parser.EnquoteDouble:
+			node.Content = p.finish(node.Content)
+		case *parser.Link:
+			node.Name = p.finish(node.Name)
+		}
+		typeset = append(typeset, node)
+	}
+	return p.footnotes(quotes(typeset))
+}
+
+// mergeText joins adjacent text nodes.
+func mergeText(nodes []parser.Node) (merged []parser.Node) {
+	for _, node := range nodes {
+		if text, ok := node.(*parser.Text); ok && len(merged) > 0 {
+			if prev, ok := merged[len(merged)-1].(*parser.Text); ok {
+				merged[len(merged)-1] = &parser.Text{Text: prev.Text + text.Text}
+				continue
+			}
+		}
+		merged = append(merged, node)
+	}
+	return merged
+}
+
+// typography splits the dashes and ellipses off the text, as well as any `==`,
+// which would start a marker.
+func typography(text string) (nodes []parser.Node) {
+	start := 0
+	for i := 0; i < len(text); {
+		var node parser.Node
+		n := 0
+		switch {
+		case strings.HasPrefix(text[i:], "---"):
+			node, n = &parser.AmpSpecial{Text: "---"}, 3
+		case strings.HasPrefix(text[i:], "--"):
+			node, n = &parser.AmpSpecial{Text: "--"}, 2
+		case strings.HasPrefix(text[i:], "..."):
+			node, n = &parser.AmpSpecial{Text: "..."}, 3
+		case strings.HasPrefix(text[i:], "=="):
+			node, n = &parser.Mono{Text: "=="}, 2
+		default:
+			i++
+			continue
+		}
+		if start < i {
+			nodes = append(nodes, &parser.Text{Text: text[start:i]})
+		}
+		nodes = append(nodes, node)
+		i += n
+		start = i
+	}
+	if start < len(text) {
+		nodes = append(nodes, &parser.Text{Text: text[start:]})
+	}
+	return nodes
+}
+
+// quote is a double quote, before it is paired.
+type quote struct {
+	open, close bool // whether it can open or close a quotation
+}
+
+func (q *quote) Accept(parser.Visitor) {}
+
+// quotes pairs the double quotes into enquotes, since the markup has no way
+// to write a single double quote other than as &ldquo; or &rdquo;.
+func quotes(nodes []parser.Node) []parser.Node {
+	// split the double quotes off the text
+	var split []parser.Node
+	found := false
+	for _, node := range nodes {
+		text, ok := node.(*parser.Text)
+		if !ok || !strings.Contains(text.Text, `"`) {
+			split = append(split, node)
+			continue
+		}
+		found = true
+		for i, part := range strings.Split(text.Text, `"`) {
+			if i > 0 {
+				split = append(split, &quote{})
+			}
+			if part != "" {
+				split = append(split, &parser.Text{Text: part})
+			}
+		}
+	}
+	if !found {
+		return nodes
+	}
+	// a quote can open if it is followed by a word, and close if it follows
+	// one
+	for i, node := range split {
+		if q, ok := node.(*quote); ok {
+			q.open = i+1 < len(split) && !startsWithSpace(split[i+1])
+			q.close = i > 0 && !endsWithSpace(split[i-1])
+		}
+	}
+	pairs := map[int]int{}
+	open := -1
+	for i, node := range split {
+		q, ok := node.(*quote)
+		switch {
+		case !ok:
+		case open >= 0 && q.close:
+			pairs[open] = i
+			open = -1
+		case q.open:
+			open = i
+		}
+	}
+	var enquote func(from, to int) []parser.Node
+	enquote = func(from, to int) (result []parser.Node) {
+		for i := from; i < to; i++ {
+			q, ok := split[i].(*quote)
+			if !ok {
+				result = append(result, split[i])
+				continue
+			}
+			if end, ok := pairs[i]; ok {
+				result = append(result, &parser.EnquoteDouble{Content: enquote(i+1, end)})
+				i = end
+				continue
+			}
+			if q.open {
+				result = append(result, &parser.AmpSpecial{Text: "&ldquo;"})
+			} else {
+				result = append(result, &parser.AmpSpecial{Text: "&rdquo;"})
+			}
+		}
+		return result
+	}
+	return enquote(0, len(split))
+}
+
+func startsWithSpace(node parser.Node) bool {
+	if text, ok := node.(*parser.Text); ok {
+		r, _ := utf8.DecodeRuneInString(text.Text)
+		return unicode.IsSpace(r)
+	}
+	_, ok := node.(*parser.LineBreak)
+	return ok
+}
+
+func endsWithSpace(node parser.Node) bool {
+	if text, ok := node.(*parser.Text); ok {
+		r, _ := utf8.DecodeLastRuneInString(text.Text)
+		return unicode.IsSpace(r)
+	}
+	_, ok := node.(*parser.LineBreak)
+	return ok
+}
+
+// footnotes resolves the references to footnotes.
+// A footnote of a single paragraph that directly follows a word becomes a
+// sidenote to that word, any other a footnote.
+func (p *inlineParser) footnotes(nodes []parser.Node) (resolved parser.TextRich) {
+	for _, node := range nodes {
+		ref, ok := node.(*footnoteRef)
+		if !ok {
+			resolved = append(resolved, node)
+			continue
+		}
+		fn := p.c.footnotes[ref.label]
+		located := parser.Located{Span: ref.span}
+		var word parser.TextRich
+		if _, ok := singleParagraph(fn.blocks); ok && len(resolved) > 0 {
+			word, resolved = lastWord(resolved)
+		}
+		if word == nil {
+			resolved = append(resolved, &parser.Footnote{Located: located, Ref: fn.id})
+			fn.footnote = true
+			continue
+		}
+		resolved = append(resolved, &parser.Sidenote{Located: located, Ref: fn.id, Word: word})
+		fn.sidenote = true
+	}
+	return resolved
+}
+
+// lastWord cuts the word at the end of the nodes off, or the last node, if it
+// isn't text.
+// The word is nil if the nodes end in whitespace.
+func lastWord(nodes []parser.Node) (word parser.TextRich, rest []parser.Node) {
+	last := nodes[len(nodes)-1]
+	rest = nodes[:len(nodes)-1]
+	switch node := last.(type) {
+	case *parser.Text:
+		text := node.Text
+		i := strings.LastIndexFunc(text, unicode.IsSpace) + 1
+		if i == len(text) {
+			return nil, nodes
+		}
+		if i > 0 {
+			rest = append(rest, &parser.Text{Text: text[:i]})
+		}
+		return parser.TextRich{&parser.Text{Text: text[i:]}}, rest
+	case *parser.LineBreak, *parser.Sidenote, *parser.Footnote, *parser.AmpSpecial, *parser.Image:
+		return nil, nodes
+	}
+	return parser.TextRich{last}, rest
+}
+
+// singleParagraph is the only paragraph of the blocks.
+func singleParagraph(blocks []parser.Node) (*parser.Paragraph, bool) {
+	if len(blocks) != 1 {
+		return nil, false
+	}
+	p, ok := blocks[0].(*parser.Paragraph)
+	return p, ok
+}
+
+// hoistImages splits the images off the paragraphs, since images are blocks
+// of their own in the markup.
+func (c *converter) hoistImages(nodes []parser.Node) (hoisted []parser.Node) {
+	for _, node := range nodes {
+		switch node := node.(type) {
+		case *parser.Paragraph:
+			hoisted = append(hoisted, c.splitParagraph(node)...)
+			continue
+		case *parser.BlockQuote:
+			node.Content = c.hoistImages(node.Content)
+		case *parser.Admonition:
+			node.Content = c.hoistImages(node.Content)
+		case *parser.List:
+			for _, item := range node.Items {
+				item.Content = c.hoistImages(item.Content)
+			}
+		}
+		hoisted = append(hoisted, node)
+	}
+	return hoisted
+}
+
+// splitParagraph splits the paragraph at its images.
+// Images nested in emphasis or quotes can't be split off without splitting
+// their markup across paragraphs, so only their alt text is kept.
+func (c *converter) splitParagraph(p *parser.Paragraph) (blocks []parser.Node) {
+	var content []parser.Node
+	flush := func() {
+		content = trimSpace(content)
+		if len(content) > 0 {
+			blocks = append(blocks, &parser.Paragraph{Located: p.Located, Attributes: p.Attributes, Content: content})
+		}
+		content = nil
+	}
+	for _, node := range p.Content {
+		if img, ok := node.(*parser.Image); ok {
+			flush()
+			blocks = append(blocks, img)
+			continue
+		}
+		content = append(content, c.nestedImages(node))
+	}
+	if len(blocks) == 0 {
+		return []parser.Node{p}
+	}
+	flush()
+	return blocks
+}
+
+// nestedImages replaces the images nested in the node with their alt text.
+func (c *converter) nestedImages(node parser.Node) parser.Node {
+	replace := func(nodes []parser.Node) []parser.Node {
+		for i, n := range nodes {
+			nodes[i] = c.nestedImages(n)
+		}
+		return nodes
+	}
+	switch node := node.(type) {
+	case *parser.Image:
+		c.warn(node.Span, "inline-image", fmt.Sprintf("image %s can only be part of a paragraph, its alt text was kept", node.Name))
+		var alt strings.Builder
+		for _, n := range node.Alt {
+			if text, ok := n.(*parser.Text); ok {
+				alt.WriteString(text.Text)
+			}
+		}
+		return &parser.Text{Text: alt.String()}
+	case *parser.Emphasis:
+		node.Content = replace(node.Content)
+	case *parser.Strong:
+		node.Content = replace(node.Content)
+	case *parser.EmphasisStrong:
+		node.Content = replace(node.Content)
+	case *parser.Strikethrough:
+		node.Content = replace(node.Content)
+	case *parser.Marker:
+		node.Content = replace(node.Content)
+	case *parser.EnquoteDouble:
+		node.Content = replace(node.Content)
+	case *parser.Link:
+		node.Name = replace(node.Name)
+	}
+	return node
+}
+
+// trimSpace removes the whitespace and line breaks around the content.
+func trimSpace(content []parser.Node) []parser.Node {
+	for len(content) > 0 {
+		trimmed := trimText(content[0], strings.TrimLeftFunc)
+		if trimmed == content[0] {
+			break
+		}
+		content = content[1:]
+		if trimmed != nil {
+			content = append([]parser.Node{trimmed}, content...)
+		}
+	}
+	for len(content) > 0 {
+		last := content[len(content)-1]
+		trimmed := trimText(last, strings.TrimRightFunc)
+		if trimmed == last {
+			break
+		}
+		content = content[:len(content)-1]
+		if trimmed != nil {
+			content = append(content, trimmed)
+		}
+	}
+	return content
+}
+
+// trimText trims the text node with trim, it is nil if nothing is left of it.
+// Line breaks are removed, any other node is returned as is.
+func trimText(node parser.Node, trim func(string, func(rune) bool) string) parser.Node {
+	switch node := node.(type) {
+	case *parser.LineBreak:
+		return nil
+	case *parser.Text:
+		text := trim(node.Text, unicode.IsSpace)
+		if text == "" {
+			return nil
+		}
+		if text != node.Text {
+			return &parser.Text{Text: text}
+		}
+	}
+	return node
+}
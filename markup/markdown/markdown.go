@@ -0,0 +1,589 @@
+// Package markdown converts CommonMark documents, like the posts of Hugo and
+// Jekyll sites, into blogs of the markup.
+//
+// The front matter, in YAML or TOML, is mapped onto the meta keys.
+// The content is converted construct by construct: footnotes become sidenotes
+// where possible, fenced code, images, tables and GitHub alerts have direct
+// equivalents, and so do the figure and highlight shortcodes.
+// Everything else, like raw html blocks or unknown shortcodes, is kept as a
+// comment, and reported as a warning.
+package markdown
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/cvanloo/blog-go/markup/diagnostic"
+	"github.com/cvanloo/blog-go/markup/format"
+	"github.com/cvanloo/blog-go/markup/lexer"
+	"github.com/cvanloo/blog-go/markup/parser"
+)
+
+type (
+	// Config fills in the mandatory meta keys that the front matter of a post
+	// may not define.
+	Config struct {
+		Author, Lang string
+	}
+
+	// Document is a converted source.
+	Document struct {
+		Blog *parser.Blog
+		// Comments keep the parts of the source that have no equivalent in
+		// the markup, see format.Config.
+		Comments []lexer.Token
+		// Images are the local files referenced by the images, as written in
+		// the source.
+		// The images of the blog refer to them by their base name.
+		Images []string
+		// Warnings about the constructs that could not be converted, or not
+		// faithfully.
+		Warnings []diagnostic.Diagnostic
+	}
+
+	converter struct {
+		cfg           Config
+		filename      string
+		doc           *Document
+		lineOffsets   []int // rune offset of each line of the source
+		links         map[string]linkDefinition
+		footnotes     map[string]*footnote
+		footnoteOrder []string
+		deferred      []func()
+	}
+
+	linkDefinition struct {
+		id, href, title string
+	}
+
+	footnote struct {
+		id       string // a valid id of the markup
+		span     diagnostic.Span
+		blocks   []parser.Node
+		sidenote bool // used as a sidenote
+		footnote bool // used as a footnote
+	}
+)
+
+// Convert converts a source with the zero Config.
+func Convert(filename string, src []byte) (*Document, error) {
+	return Config{}.Convert(filename, src)
+}
+
+// Convert parses the source and converts it into a blog.
+// Only front matter that can't be read is an error, everything else is
+// converted as well as possible, and warned about.
+func (cfg Config) Convert(filename string, src []byte) (*Document, error) {
+	source := strings.ReplaceAll(string(src), "\r\n", "\n")
+	c := &converter{
+		cfg:      cfg,
+		filename: filename,
+		doc: &Document{
+			Blog: &parser.Blog{
+				Meta:                    parser.Meta{},
+				LinkDefinitions:         map[string]string{},
+				SidenoteDefinitions:     map[string]parser.TextRich{},
+				FootnoteDefinitions:     map[string][]parser.TextRich{},
+				TermDefinitions:         map[string]parser.TextRich{},
+				AbbreviationDefinitions: map[string]string{},
+				Locations: parser.Locations{
+					Meta:                    map[string][]diagnostic.Span{},
+					LinkDefinitions:         map[string]diagnostic.Span{},
+					SidenoteDefinitions:     map[string]diagnostic.Span{},
+					AbbreviationDefinitions: map[string]diagnostic.Span{},
+				},
+			},
+		},
+		links:     map[string]linkDefinition{},
+		footnotes: map[string]*footnote{},
+	}
+	offset := 0
+	for _, l := range strings.SplitAfter(source, "\n") {
+		c.lineOffsets = append(c.lineOffsets, offset)
+		offset += utf8.RuneCountInString(l)
+	}
+
+	delim, frontMatter, body, bodyLine, err := splitFrontMatter(source)
+	if err != nil {
+		return nil, diagnostic.At(c.lineSpan(1), "invalid-front-matter", err)
+	}
+	var fields []field
+	switch delim {
+	case "---":
+		fields, err = parseYAML(frontMatter, 2)
+	case "+++":
+		fields, err = parseTOML(frontMatter, 2)
+	}
+	if err != nil {
+		return nil, diagnostic.At(c.lineSpan(1), "invalid-front-matter", err)
+	}
+
+	var lines []line
+	for i, text := range strings.Split(body, "\n") {
+		number := bodyLine + i
+		if number > len(c.lineOffsets) {
+			break
+		}
+		lines = append(lines, line{text: text, number: number, column: 1, offset: c.lineOffsets[number-1]})
+	}
+	c.doc.Blog.Span = diagnostic.Span{
+		Filename: filename,
+		Start:    diagnostic.Position{Line: 1, Column: 1},
+		End:      diagnostic.Position{Offset: offset, Line: len(c.lineOffsets), Column: 1},
+	}
+	nodes := c.blocks(lines)
+	// inline content is parsed once all link and footnote definitions are
+	// known
+	for len(c.deferred) > 0 {
+		deferred := c.deferred
+		c.deferred = nil
+		for _, f := range deferred {
+			f()
+		}
+	}
+	nodes = c.hoistImages(nodes)
+	for _, fn := range c.footnotes {
+		fn.blocks = c.hoistImages(fn.blocks)
+	}
+	c.meta(fields)
+	c.sections(nodes)
+	c.definitions()
+	return c.doc, nil
+}
+
+// Source prints the document as markup source.
+// The printed source is parsed again, and its problems returned together with
+// it, so that they can be fixed by hand.
+// The filename is where the printed source is going to be written to, the
+// problems refer to it.
+func (d *Document) Source(filename string) ([]byte, error) {
+	var buf bytes.Buffer
+	cfg := format.Config{Width: format.DefaultWidth, Comments: d.Comments}
+	if err := cfg.Fprint(&buf, d.Blog); err != nil {
+		return nil, err
+	}
+	lx := lexer.New()
+	lx.LexSource(filename, buf.String())
+	if len(lx.Errors) > 0 {
+		return buf.Bytes(), errors.Join(lx.Errors...)
+	}
+	_, err := parser.Parse(lx)
+	return buf.Bytes(), err
+}
+
+// later runs f once all blocks are parsed.
+func (c *converter) later(f func()) {
+	c.deferred = append(c.deferred, f)
+}
+
+func (c *converter) warn(span diagnostic.Span, code, message string, hints ...string) {
+	c.doc.Warnings = append(c.doc.Warnings, diagnostic.Diagnostic{
+		Severity: diagnostic.SeverityWarning,
+		Code:     code,
+		Span:     span,
+		Message:  message,
+		Hints:    hints,
+	})
+}
+
+// lineSpan spans the whole line of the source with the number (starting at 1).
+func (c *converter) lineSpan(number int) diagnostic.Span {
+	start := diagnostic.Position{Offset: c.lineOffsets[number-1], Line: number, Column: 1}
+	end := start
+	if number < len(c.lineOffsets) {
+		end.Offset = c.lineOffsets[number] - 1
+		end.Column += end.Offset - start.Offset
+	}
+	return diagnostic.Span{Filename: c.filename, Start: start, End: end}
+}
+
+// comment keeps text as a comment in front of the block following the line.
+func (c *converter) comment(l line, text string) {
+	c.doc.Comments = append(c.doc.Comments, lexer.Token{
+		Type:     lexer.TokenComment,
+		Filename: c.filename,
+		Pos:      l.offset,
+		Span:     c.span(l, l),
+		Text:     strings.ReplaceAll(text, "}%%", "} %%"), // or it ends the comment early
+	})
+}
+
+// unconverted keeps the lines as a comment, and warns about them.
+func (c *converter) unconverted(lines []line, code, message string) {
+	var text []string
+	for _, l := range lines {
+		text = append(text, l.text)
+	}
+	c.comment(lines[0], strings.Join(text, "\n"))
+	c.warn(c.located(lines).Span, code, message)
+}
+
+// metaKeys maps the keys of the front matter onto the meta keys, in the order
+// of preference if more than one key maps onto the same meta key.
+var metaKeys = []struct {
+	meta string
+	keys []string
+}{
+	{"title", []string{"title"}},
+	{"url-path", []string{"url", "permalink", "slug"}},
+	{"published", []string{"date", "publishdate", "publish_date", "published"}},
+	{"revised", []string{"lastmod", "last_modified_at", "updated", "modified"}},
+	{"draft", []string{"draft", "published"}},
+	{"author", []string{"author", "authors"}},
+	{"lang", []string{"lang", "language"}},
+	{"description", []string{"description", "summary", "excerpt"}},
+	{"series", []string{"series"}},
+	{"tags", []string{"tags", "categories", "category"}},
+}
+
+// jekyllPost is the name of a post in the _posts directory of Jekyll.
+var jekyllPost = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})-(.+)$`)
+
+func (c *converter) meta(fields []field) {
+	byKey := map[string]field{}
+	for _, f := range fields {
+		key := strings.ToLower(f.key)
+		if _, ok := byKey[key]; !ok {
+			byKey[key] = f
+		}
+	}
+	// Hugo keeps the keys it doesn't know itself in params
+	for _, f := range fields {
+		key, ok := strings.CutPrefix(strings.ToLower(f.key), "params.")
+		if _, defined := byKey[key]; ok && !defined {
+			byKey[key] = f
+		}
+	}
+	used := map[string]bool{}
+	set := func(key, value string, f field) {
+		c.doc.Blog.Meta[key] = append(c.doc.Blog.Meta[key], parser.TextSimple{&parser.Text{Text: value}})
+		// keys added without a field are printed after the others
+		if f.line > 0 {
+			c.doc.Blog.Locations.Meta[key] = append(c.doc.Blog.Locations.Meta[key], c.lineSpan(f.line))
+		}
+	}
+	// the name of the file, or of the directory of a page bundle
+	name := strings.TrimSuffix(path.Base(c.filename), path.Ext(c.filename))
+	if name == "index" {
+		name = path.Base(path.Dir(c.filename))
+	}
+	var nameDate string
+	if m := jekyllPost.FindStringSubmatch(name); m != nil {
+		nameDate, name = m[1], m[2]
+	}
+
+	for _, mk := range metaKeys {
+		done := false
+		for _, key := range mk.keys {
+			f, ok := byKey[key]
+			if !ok {
+				continue
+			}
+			if done {
+				used[key] = true // superseded by a preferred key
+				continue
+			}
+			value, ok := c.metaValue(mk.meta, f)
+			if !ok {
+				continue
+			}
+			used[key] = true
+			if mk.meta == "tags" {
+				for _, tag := range value {
+					set("tags", tag, f)
+				}
+				continue // all keys add to the tags
+			}
+			set(mk.meta, value[0], f)
+			done = true
+		}
+	}
+	for _, f := range fields {
+		key := strings.ToLower(f.key)
+		if !used[key] && !used[strings.TrimPrefix(key, "params.")] {
+			c.warn(c.lineSpan(f.line), "unconverted-front-matter", fmt.Sprintf("front matter key %s has no equivalent meta key and was left out", f.key))
+		}
+	}
+
+	meta := c.doc.Blog.Meta
+	if _, ok := meta["url-path"]; !ok {
+		set("url-path", name, field{})
+	}
+	if _, ok := meta["published"]; !ok && nameDate != "" {
+		set("published", nameDate, field{})
+	}
+	// a post without a draft key is published by Hugo and Jekyll, but not
+	// by the markup
+	if _, ok := meta["draft"]; !ok {
+		set("draft", "false", field{})
+	}
+	if _, ok := meta["author"]; !ok && c.cfg.Author != "" {
+		set("author", c.cfg.Author, field{})
+	}
+	if _, ok := meta["lang"]; !ok && c.cfg.Lang != "" {
+		set("lang", c.cfg.Lang, field{})
+	}
+	if _, ok := meta["template"]; !ok {
+		set("template", "post", field{})
+	}
+	for _, key := range []string{"title", "author", "lang"} {
+		if _, ok := meta[key]; !ok {
+			c.warn(c.lineSpan(1), "missing-meta-key", fmt.Sprintf("missing mandatory meta key: %s", key), fmt.Sprintf("add %s: ... to the meta of the post", key))
+		}
+	}
+}
+
+// metaValue converts the value of a front matter field for the meta key.
+// Returns false if the value doesn't fit the key, for example the published
+// key of Jekyll, which is a boolean, and not a date.
+func (c *converter) metaValue(meta string, f field) ([]string, bool) {
+	var values []string
+	switch v := f.value.(type) {
+	case string:
+		values = []string{v}
+	case []string:
+		values = v
+	case table:
+		return nil, false
+	}
+	values = slices.DeleteFunc(values, func(v string) bool { return strings.TrimSpace(v) == "" })
+	if len(values) == 0 {
+		return nil, false
+	}
+	switch meta {
+	case "url-path":
+		urlPath := strings.Trim(values[0], "/")
+		if strings.Contains(urlPath, ":") {
+			c.warn(c.lineSpan(f.line), "unconverted-front-matter", fmt.Sprintf("%s %s has placeholders, the url-path is derived from the file name instead", f.key, values[0]))
+			return nil, false
+		}
+		return []string{urlPath}, urlPath != ""
+	case "published", "revised":
+		date, ok := normalizeDate(values[0])
+		if !ok && meta == "published" && strings.EqualFold(f.key, "published") {
+			return nil, false // a Jekyll boolean
+		}
+		if !ok {
+			c.warn(c.lineSpan(f.line), "invalid-front-matter", fmt.Sprintf("%s is not a date: %s", f.key, values[0]), "use 2006-01-02 or RFC3339")
+			return nil, false
+		}
+		return []string{date}, true
+	case "draft":
+		value := strings.ToLower(values[0])
+		if value != "true" && value != "false" {
+			return nil, false
+		}
+		if strings.EqualFold(f.key, "published") {
+			// published: false is a draft in Jekyll
+			value = map[string]string{"true": "false", "false": "true"}[value]
+		}
+		return []string{value}, true
+	case "tags":
+		var tags []string
+		for _, v := range values {
+			if _, ok := f.value.(string); ok {
+				// Jekyll separates tags by spaces
+				tags = append(tags, strings.Fields(v)...)
+				continue
+			}
+			// tags in the meta are separated by spaces
+			tags = append(tags, strings.Join(strings.Fields(v), "-"))
+		}
+		return tags, true
+	case "series", "author":
+		if len(values) > 1 {
+			c.warn(c.lineSpan(f.line), "unconverted-front-matter", fmt.Sprintf("only the first of the %s was kept: %s", f.key, values[0]))
+		}
+		return values[:1], true
+	}
+	return values[:1], true
+}
+
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 -07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04 -0700",
+	"2006-01-02 15:04",
+}
+
+// normalizeDate converts the date into one of the formats of the meta, which
+// are 2006-01-02 and RFC3339.
+func normalizeDate(date string) (string, bool) {
+	if _, err := time.Parse("2006-01-02", date); err == nil {
+		return date, true
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, date); err == nil {
+			return t.Format(time.RFC3339), true
+		}
+	}
+	return "", false
+}
+
+// sections nests the blocks into sections by the level of their headings.
+// The levels are made consecutive, since Markdown allows for skipping levels,
+// and often starts at level 2.
+func (c *converter) sections(nodes []parser.Node) {
+	var (
+		open   []*parser.Section // the innermost last
+		levels []int             // of the headings of the open sections, in the source
+	)
+	for i, node := range nodes {
+		h, ok := node.(*heading)
+		if !ok {
+			if len(open) == 0 {
+				// the introduction is a sibling of the section of the
+				// first heading
+				level := 0
+				if next := slices.IndexFunc(nodes[i:], isHeading); next >= 0 {
+					level = nodes[i+next].(*heading).level
+				}
+				open = append(open, c.introduction(node))
+				levels = append(levels, level)
+				c.doc.Blog.Sections = append(c.doc.Blog.Sections, open[0])
+			}
+			open[len(open)-1].Content = append(open[len(open)-1].Content, node)
+			continue
+		}
+		for len(levels) > 0 && levels[len(levels)-1] >= h.level {
+			open, levels = open[:len(open)-1], levels[:len(levels)-1]
+		}
+		section := &parser.Section{
+			Located:    h.Located,
+			Attributes: h.Attributes,
+			Level:      len(open) + 1,
+			Heading:    h.content,
+		}
+		if len(section.Heading) == 0 {
+			c.warn(h.Span, "empty-heading", "heading is empty, it was named Untitled")
+			section.Heading = parser.TextRich{&parser.Text{Text: "Untitled"}}
+		}
+		if len(open) == 0 {
+			c.doc.Blog.Sections = append(c.doc.Blog.Sections, section)
+		} else {
+			parent := open[len(open)-1]
+			parent.Content = append(parent.Content, section)
+		}
+		open, levels = append(open, section), append(levels, h.level)
+	}
+}
+
+func isHeading(node parser.Node) bool {
+	_, ok := node.(*heading)
+	return ok
+}
+
+// introduction is the section for the content before the first heading,
+// which the markup doesn't allow for.
+func (c *converter) introduction(first parser.Node) *parser.Section {
+	section := &parser.Section{Level: 1, Attributes: parser.Attributes{}}
+	span := c.lineSpan(1)
+	if located, ok := first.(interface{ Location() diagnostic.Span }); ok {
+		span = located.Location()
+		section.Span = span
+	}
+	section.Heading = parser.TextRich{&parser.Text{Text: "Introduction"}}
+	c.warn(span, "missing-heading", "content before the first heading was put into a section named Introduction", "rename the section, or move its content")
+	return section
+}
+
+// definitions adds the used footnotes, and all link definitions to the blog.
+func (c *converter) definitions() {
+	blog := c.doc.Blog
+	for _, def := range c.links {
+		if def.title == "" {
+			blog.LinkDefinitions[def.id] = def.href
+		}
+	}
+	for _, label := range c.footnoteOrder {
+		fn := c.footnotes[label]
+		if !fn.sidenote && !fn.footnote {
+			c.warn(fn.span, "unused-footnote", fmt.Sprintf("footnote %s is never referenced, it was left out", label))
+			continue
+		}
+		var paragraphs []parser.TextRich
+		for _, block := range fn.blocks {
+			if p, ok := block.(*parser.Paragraph); ok {
+				paragraphs = append(paragraphs, p.Content)
+				continue
+			}
+			c.warn(fn.span, "footnote-content", fmt.Sprintf("footnote %s contains a %s, only its paragraphs were kept", label, blockName(block)))
+		}
+		if len(paragraphs) == 0 {
+			paragraphs = []parser.TextRich{{&parser.Text{Text: label}}}
+		}
+		blog.SidenoteDefinitions[fn.id] = paragraphs[0]
+		blog.FootnoteDefinitions[fn.id] = paragraphs
+		blog.Locations.SidenoteDefinitions[fn.id] = fn.span
+	}
+}
+
+func blockName(node parser.Node) string {
+	name := fmt.Sprintf("%T", node)
+	name = name[strings.LastIndex(name, ".")+1:]
+	return strings.ToLower(name)
+}
+
+// footnoteID makes a label of a footnote into an id of the markup, which
+// can't contain whitespace.
+func footnoteID(label string) string {
+	return strings.Join(strings.FieldsFunc(label, unicode.IsSpace), "-")
+}
+
+// normalizeLabel matches link labels case insensitively, and regardless of
+// their whitespace.
+func normalizeLabel(label string) string {
+	return strings.ToLower(strings.Join(strings.Fields(label), " "))
+}
+
+// image converts an image with a local source, or links to any other.
+func (c *converter) image(span diagnostic.Span, src, alt, title string) parser.Node {
+	name := unescapeURL(src)
+	paragraph := func(node parser.Node) parser.Node {
+		return &parser.Paragraph{Located: parser.Located{Span: span}, Content: []parser.Node{node}}
+	}
+	link := &parser.Link{Name: parser.TextRich{&parser.Text{Text: cmp.Or(alt, src)}}, Href: src, Title: title}
+	if strings.Contains(name, "://") || strings.HasPrefix(name, "//") || strings.HasPrefix(name, "data:") {
+		c.warn(span, "remote-image", fmt.Sprintf("image %s is not a local file, it was turned into a link", src))
+		return paragraph(link)
+	}
+	switch ext := strings.ToLower(path.Ext(name)); ext {
+	case ".jpg", ".jpeg", ".jxl", ".avif", ".webp", ".png", ".mp4", ".mkv", ".webm":
+	default:
+		c.warn(span, "image-format", fmt.Sprintf("images of type %s are not supported, %s was turned into a link", cmp.Or(ext, "(none)"), src))
+		return paragraph(link)
+	}
+	if !slices.Contains(c.doc.Images, name) {
+		for _, other := range c.doc.Images {
+			if path.Base(other) == path.Base(name) {
+				c.warn(span, "image-name", fmt.Sprintf("images %s and %s have the same name, only one of them is kept", other, name))
+			}
+		}
+		c.doc.Images = append(c.doc.Images, name)
+	}
+	img := &parser.Image{
+		Located:    parser.Located{Span: span},
+		Attributes: parser.Attributes{},
+		Name:       path.Base(name),
+	}
+	// the alt text and title are printed verbatim
+	if alt = strings.NewReplacer("[", "", "]", "", "\n", " ").Replace(alt); alt != "" {
+		img.Alt = parser.TextSimple{&parser.Text{Text: alt}}
+	}
+	if title = strings.NewReplacer(`"`, "'", "\n", " ").Replace(title); title != "" {
+		img.Title = parser.TextSimple{&parser.Text{Text: title}}
+	}
+	return img
+}
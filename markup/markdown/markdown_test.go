@@ -0,0 +1,361 @@
+package markdown_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cvanloo/blog-go/markup/markdown"
+)
+
+func TestConvertHugo(t *testing.T) {
+	src := `---
+title: "Hello, World"
+date: 2023-04-05T10:00:00+02:00
+slug: hello-world
+tags: [go, "static sites"]
+categories:
+  - Meta
+series: ["Intro"]
+toc: true
+---
+
+Some text with a note[^1] and "quotes" -- and more...
+
+## First heading
+
+A paragraph with *emphasis*, **strong**, ***both***, ` + "`code`" + ` and a [link](https://example.com "Example").
+A [reference][ref] and <https://go.dev>.
+
+![A cat](images/cat.png "The cat")
+
+` + "```go {linenos=true}" + `
+fmt.Println("hi")
+` + "```" + `
+
+{{< youtube abc >}}
+
+#### Deep heading
+
+> [!WARNING]
+> Careful here.
+
+- one
+- two with a footnote [^long]
+
+[ref]: https://example.org
+[^1]: A short note.
+[^long]: First paragraph.
+
+    Second paragraph.
+`
+	expected := `---
+title: Hello, World
+published: 2023-04-05T10:00:00+02:00
+url-path: hello-world
+tags: go
+tags: static-sites
+tags: Meta
+series: Intro
+author: Me
+draft: false
+lang: en
+template: post
+---
+
+# Introduction
+
+Some text with a [note][^1] and "quotes" -- and more...
+
+# First heading
+
+A paragraph with *emphasis*, **strong**, ***both***, ` + "`code`" + ` and a [link](https://example.com "Example").
+A [reference][ref] and <https://go.dev>.
+
+![A cat](cat.png "The cat")
+
+` + "```go" + `
+fmt.Println("hi")
+` + "```" + `
+
+%% {{< youtube abc >}}
+## Deep heading
+
+!!! warning
+    Careful here.
+
+- one
+- two with a footnote [^long]
+
+[ref]: https://example.org
+
+[^1]: A short note.
+
+[^long]: First paragraph.
+
+    Second paragraph.
+`
+	doc, err := markdown.Config{Author: "Me", Lang: "en"}.Convert("content/posts/hello/index.md", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := doc.Source("out.md")
+	if err != nil {
+		t.Errorf("converted source doesn't parse: %v", err)
+	}
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+	if !slices.Equal(doc.Images, []string{"images/cat.png"}) {
+		t.Errorf("expected the image images/cat.png, got: %v", doc.Images)
+	}
+	expectWarnings(t, doc, "code-block-options", "shortcode", "unconverted-front-matter", "missing-heading")
+}
+
+func TestConvertJekyll(t *testing.T) {
+	src := `+++
+title = "A TOML post"
+tags = ["a", "b"]
+aliases = ["/old/"]
+
+[params]
+series = "x"
++++
+
+# Top
+
+A [broken][nowhere] link, a ![gif](anim.gif), <kbd>Ctrl</kbd> and H<sub>2</sub>O.
+A line ending in two spaces  
+and a "dangling quote with == in it.
+
+### Skipped level
+
+1. one
+2. two
+
+<!-- a comment -->
+
+{% highlight ruby %}
+puts 1
+{% endhighlight %}
+
+Sentence[^a] with a sidenote.
+
+[^a]: Note *with* emphasis.
+[^unused]: Never used.
+`
+	expected := `---
+title: A TOML post
+tags: a
+tags: b
+series: x
+draft: false
+published: 2021-03-04
+template: post
+url-path: jekyll-post
+---
+
+# Top
+
+A \[broken\]\[nowhere\] link, a [gif](anim.gif), [[Ctrl]] and H2O. A line ending
+in two spaces\
+and a &ldquo;dangling quote with ` + "`==`" + ` in it.
+
+## Skipped level
+
+1. one
+2. two
+
+%% a comment
+` + "```ruby" + `
+puts 1
+` + "```" + `
+
+[Sentence][^a] with a sidenote.
+
+[^a]: Note *with* emphasis.
+`
+	doc, err := markdown.Convert("_posts/2021-03-04-jekyll-post.md", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := doc.Source("out.md")
+	if err != nil {
+		t.Errorf("converted source doesn't parse: %v", err)
+	}
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+	if len(doc.Images) != 0 {
+		t.Errorf("expected no images, got: %v", doc.Images)
+	}
+	expectWarnings(t, doc, "image-format", "inline-html", "unconverted-front-matter", "missing-meta-key", "missing-meta-key", "unused-footnote")
+}
+
+func TestConvertSetextHeadings(t *testing.T) {
+	src := `---
+title: Setext
+---
+
+Top
+===
+
+Text.
+
+Sub
+---
+
+More text.
+
+---
+
+After a rule.
+`
+	expected := `---
+title: Setext
+author: Me
+draft: false
+lang: en
+template: post
+url-path: setext
+---
+
+# Top
+
+Text.
+
+## Sub
+
+More text.
+
+---
+
+After a rule.
+`
+	doc, err := markdown.Config{Author: "Me", Lang: "en"}.Convert("setext.md", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := doc.Source("out.md")
+	if err != nil {
+		t.Errorf("converted source doesn't parse: %v", err)
+	}
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+}
+
+func TestConvertLeadingImage(t *testing.T) {
+	doc, err := markdown.Convert("test.md", []byte("---\ntitle: Image\n---\n\n![A cat](cat.png)\n\n# Heading\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectWarnings(t, doc, "missing-heading")
+	for _, w := range doc.Warnings {
+		if w.Code == "missing-heading" && (w.Span.Start.Line != 5 || w.Span.Start.Column != 1) {
+			t.Errorf("expected the warning at the ! of the image, 5:1, got: %d:%d", w.Span.Start.Line, w.Span.Start.Column)
+		}
+	}
+}
+
+func TestConvertInvalidFrontMatter(t *testing.T) {
+	if _, err := markdown.Convert("test.md", []byte("---\ntitle: Unclosed\n\n# Heading\n")); err == nil {
+		t.Error("expected an error for the unclosed front matter")
+	}
+}
+
+func TestConvertParses(t *testing.T) {
+	testCases := []struct {
+		name, body, expected string
+		warnings             []string
+	}{
+		{
+			name:     "image in emphasis",
+			body:     "text *![a](b.png)* text\n",
+			expected: "text *a* text\n",
+			warnings: []string{"inline-image"},
+		},
+		{
+			name:     "image in strong",
+			body:     "**![a](b.png) and more**\n",
+			expected: "**a and more**\n",
+			warnings: []string{"inline-image"},
+		},
+		{
+			name:     "image in quotes",
+			body:     "\"![a](b.png)\"\n",
+			expected: "\"a\"\n",
+			warnings: []string{"inline-image"},
+		},
+		{
+			name:     "image after text in quotes",
+			body:     "x \"y ![a](b.png) z\" w\n",
+			expected: "x \"y a z\" w\n",
+			warnings: []string{"inline-image"},
+		},
+		{
+			name:     "image in link",
+			body:     "[![a](b.png)](https://example.org)\n",
+			expected: "[a](https://example.org)\n",
+			warnings: []string{"inline-image"},
+		},
+		{
+			name:     "image before footnote reference",
+			body:     "Text ![a](b.png)[^1]\n\n[^1]: Note.\n",
+			expected: "Text\n\n![a](b.png)\n\n[^1]\n\n[^1]: Note.\n",
+		},
+		{
+			name:     "fence in fenced code",
+			body:     "````md\n```go\nx := 1\n```\n````\n",
+			expected: "%%{\n````md\n```go\nx := 1\n```\n````\n}%%\n",
+			warnings: []string{"code-block-fence"},
+		},
+		{
+			name:     "fence in indented code",
+			body:     "    ```\n    x\n",
+			expected: "%%{\n    ```\n    x\n}%%\n",
+			warnings: []string{"code-block-fence"},
+		},
+		{
+			name:     "opener used up before closer",
+			body:     "_--__\n",
+			expected: "*--*\\_\n",
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			doc, err := markdown.Config{Author: "Me", Lang: "en"}.Convert("test.md", []byte("---\ntitle: Test\n---\n\n# Heading\n\n"+testCase.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := doc.Source("out.md")
+			if err != nil {
+				t.Errorf("converted source doesn't parse: %v", err)
+			}
+			_, content, _ := strings.Cut(string(out), "# Heading\n\n")
+			if content != testCase.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", testCase.expected, content)
+			}
+			expectWarnings(t, doc, testCase.warnings...)
+			if len(doc.Warnings) != len(testCase.warnings) {
+				t.Errorf("expected the warnings %v, got: %v", testCase.warnings, doc.Warnings)
+			}
+		})
+	}
+}
+
+func expectWarnings(t *testing.T, doc *markdown.Document, codes ...string) {
+	t.Helper()
+	var got []string
+	for _, w := range doc.Warnings {
+		got = append(got, w.Code)
+	}
+	for _, code := range codes {
+		i := slices.Index(got, code)
+		if i < 0 {
+			t.Errorf("expected a warning %s, got: %v", code, got)
+			continue
+		}
+		got = slices.Delete(got, i, i+1)
+	}
+}
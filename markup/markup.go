@@ -18,6 +18,7 @@ import (
 	readingtime "github.com/begmaroman/reading-time"
 	"github.com/gorilla/feeds"
 
+	"github.com/cvanloo/blog-go/markup/diagnostic"
 	"github.com/cvanloo/blog-go/markup/lexer"
 	"github.com/cvanloo/blog-go/markup/parser"
 	"github.com/cvanloo/blog-go/page"
@@ -33,6 +34,9 @@ type (
 		Sources       []source
 		StaticSources []string
 		OutDir        string
+		// ReportWarnings receives the problems in the sources that don't stop
+		// the build. Without it, they are logged.
+		ReportWarnings func([]diagnostic.Diagnostic)
 	}
 	MarkupOption func(*Markup)
 	source       struct {
@@ -90,11 +94,20 @@ func OutDir(path string) MarkupOption {
 	}
 }
 
+// ReportWarnings passes the warnings about the sources to report, instead of
+// logging them, so that they can be shown together with the errors.
+func ReportWarnings(report func([]diagnostic.Diagnostic)) MarkupOption {
+	return func(m *Markup) {
+		m.ReportWarnings = report
+	}
+}
+
 func (m Markup) Run() (runErr error) {
 	page.SiteInfo = m.SiteInfo // @todo
 
 	mp := newMarkupProcessor(m.IncludeExt, m.ExcludeExt, m.SourcePaths, m.Sources)
 	runErr = errors.Join(runErr, mp.Run())
+	m.reportWarnings(mp.warnings)
 
 	// @todo: only continue processing error free sources
 	//if runErr != nil {
@@ -122,6 +135,7 @@ func (m Markup) MakeAssets() (runErr error) {
 
 	mp := newMarkupProcessor(m.IncludeExt, m.ExcludeExt, m.SourcePaths, m.Sources)
 	runErr = errors.Join(runErr, mp.Run())
+	m.reportWarnings(mp.warnings)
 
 	tp := newTemplatePreProcessor(mp.results)
 	runErr = errors.Join(runErr, tp.Run())
@@ -132,6 +146,21 @@ func (m Markup) MakeAssets() (runErr error) {
 	return runErr
 }
 
+// reportWarnings passes the warnings to ReportWarnings, or logs them if it is
+// not set.
+func (m Markup) reportWarnings(warnings []diagnostic.Diagnostic) {
+	if len(warnings) == 0 {
+		return
+	}
+	if m.ReportWarnings != nil {
+		m.ReportWarnings(warnings)
+		return
+	}
+	if err := diagnostic.Fprint(log.Writer(), warnings, diagnostic.Files()); err != nil {
+		log.Println(err)
+	}
+}
+
 type (
 	ProcessingStep interface {
 		Run() error
@@ -145,13 +174,17 @@ type (
 		sources     []source
 		results     []markupResult
 		err         error
+		warnings    []diagnostic.Diagnostic
 	}
 	markupResult struct {
-		src source
-		err error
-		lex *lexer.Lexer
-		par *parser.Blog
-		est *readingtime.Result
+		src      source
+		err      error
+		warnings []diagnostic.Diagnostic
+		lex      *lexer.Lexer
+		par      *parser.Blog
+		est      *readingtime.Result
+		// deps are the files (other than src) the result was built from.
+		deps []string
 	}
 
 	templatePreProcessor struct {
@@ -265,49 +298,55 @@ func (p *markupProcessor) collect() {
 			return
 		}
 		p.err = errors.Join(p.err, res.err)
+		p.warnings = append(p.warnings, res.warnings...)
 		p.results = append(p.results, res)
 	}
 }
 
 func (p *markupProcessor) process(src source, wg *sync.WaitGroup) {
 	log.Printf("processing: %s", src.Name)
-	lex, par, est, err := lexAndParse(src)
-	p.c <- markupResult{
-		src: src,
-		err: err,
-		lex: lex,
-		par: par,
-		est: est,
-	}
+	p.c <- lexAndParse(src)
 	wg.Done()
 }
 
-func lexAndParse(src source) (*lexer.Lexer, *parser.Blog, *readingtime.Result, error) {
-	lex := lexer.New()
+func lexAndParse(src source) (res markupResult) {
+	res.src = src
+	res.lex = lexer.New()
 	bs, err := io.ReadAll(src.In)
-	est := readingtime.Estimate(string(bs))
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("processing %s failed while reading: %w", src.Name, err)
+		res.lex = nil
+		res.err = fmt.Errorf("processing %s failed while reading: %w", src.Name, err)
+		return res
 	}
-	lex.LexSource(src.Name, string(bs))
-	if len(lex.Errors) > 0 {
-		return lex, nil, est, fmt.Errorf("processing %s failed while lexing: %w", src.Name, errors.Join(lex.Errors...))
+	res.est = readingtime.Estimate(string(bs))
+	res.lex.LexSource(src.Name, string(bs))
+	if len(res.lex.Errors) > 0 {
+		res.err = fmt.Errorf("processing %s failed while lexing: %w", src.Name, errors.Join(res.lex.Errors...))
+		return res
 	}
-	blog, err := parser.Parse(lex)
+	res.par, err = parser.Parse(res.lex)
 	if err != nil {
-		return lex, blog, est, fmt.Errorf("processing %s failed while parsing: %w", src.Name, err)
+		res.err = fmt.Errorf("processing %s failed while parsing: %w", src.Name, err)
+		return res
+	}
+	res.warnings = res.par.Warnings
+	includer := &IncludeVisitor{Dir: filepath.Dir(src.Name)}
+	res.par.Accept(includer)
+	res.deps = includer.Dependencies
+	if includer.Err != nil {
+		res.err = fmt.Errorf("processing %s failed while including files: %w", src.Name, includer.Err)
+		return res
 	}
 	refFixer := &parser.FixReferencesVisitor{}
-	blog.Accept(refFixer)
+	res.par.Accept(refFixer)
 	if refFixer.Errors != nil {
-		return lex, blog, est, fmt.Errorf("processing %s failed while resolving references: %w", src.Name, refFixer.Errors)
+		res.err = fmt.Errorf("processing %s failed while resolving references: %w", src.Name, refFixer.Errors)
+		return res
 	}
 	if rc, ok := src.In.(io.ReadCloser); ok {
-		if err := rc.Close(); err != nil {
-			return lex, blog, est, err
-		}
+		res.err = rc.Close()
 	}
-	return lex, blog, est, nil
+	return res
 }
 
 func newTemplatePreProcessor(markups []markupResult) templatePreProcessor {
@@ -323,13 +362,16 @@ func newTemplatePreProcessor(markups []markupResult) templatePreProcessor {
 
 func (p *templatePreProcessor) Run() (runErr error) {
 	for _, m := range p.markups {
+		if m.par == nil {
+			continue // failed to lex, the error is already reported by the markup processor
+		}
 		template, ok := m.par.Meta.Template()
 		if !ok {
-			runErr = errors.Join(runErr, fmt.Errorf("missing or invalid template definition for: %s", m.src.Name))
+			runErr = errors.Join(runErr, diagnostic.At(m.par.MetaLocation("template", 0), "missing-template", fmt.Errorf("missing or invalid template definition for: %s", m.src.Name), "set the template with `template: post` in the meta block"))
 		} else {
 			switch template {
 			default:
-				runErr = errors.Join(runErr, fmt.Errorf("unknown template: %s", template))
+				runErr = errors.Join(runErr, diagnostic.At(m.par.MetaLocation("template", 0), "unknown-template", fmt.Errorf("unknown template: %s", template), "the templates are post and post-quotes"))
 			case "post":
 				runErr = errors.Join(runErr, p.processPost(m))
 			case "post-quotes":
@@ -439,7 +481,7 @@ func (p *templatePreProcessor) fixSeriesData() error {
 func (p *templatePreProcessor) processQuotes(m markupResult) error {
 	templateData := page.Post{}
 	makeGen := &page.MakeQuotesVisitor{
-		page.MakeGenVisitor{
+		MakeGenVisitor: page.MakeGenVisitor{
 			TemplateData: &templateData,
 		},
 	}
@@ -655,6 +697,9 @@ func (p assetsProcessor) verifyAssets() (runErr error) {
 	v := &AssetFinderVisitor{}
 	for _, markup := range p.markups {
 		post := markup.par
+		if post == nil {
+			continue
+		}
 		post.Accept(v)
 		runErr = errors.Join(runErr, v.Err)
 		v.Err = nil
@@ -719,6 +764,9 @@ func (p assetsProcessor) generateAssets() (runErr error) {
 	for _, markup := range p.markups {
 		// @todo: can do this in parallel
 		post := markup.par
+		if post == nil {
+			continue
+		}
 		post.Accept(v)
 		for _, asset := range v.Images {
 			src := filepath.Join(filepath.Dir(markup.src.Name), asset)
@@ -0,0 +1,64 @@
+package markup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestProcessDependencies(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "server.go"), []byte("package main\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	src := source{
+		Name: filepath.Join(dir, "post.md"),
+		In: strings.NewReader(`
+# Section 1
+
+` + "```" + `go {include=server.go}
+` + "```" + `
+`),
+	}
+	p := &markupProcessor{c: make(chan markupResult, 1)}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	p.process(src, &wg)
+	result := <-p.c
+	if result.err != nil {
+		t.Fatal(result.err)
+	}
+	expected := []string{filepath.Join(dir, "server.go")}
+	if diff := deep.Equal(result.deps, expected); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestProcessWarnings(t *testing.T) {
+	src := source{
+		Name: "post.md",
+		In: strings.NewReader(`
+# Section 1
+
+| a | b |
+|---|---|
+| 1 | 2 | 3 |
+`),
+	}
+	result := lexAndParse(src)
+	if result.err != nil {
+		t.Fatal(result.err)
+	}
+	var warnings []string
+	for _, w := range result.warnings {
+		warnings = append(warnings, w.Error())
+	}
+	expected := []string{"post.md:6:2: table row has 3 cells, but the table has only 2 columns"}
+	if diff := deep.Equal(warnings, expected); diff != nil {
+		t.Error(diff)
+	}
+}
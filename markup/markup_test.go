@@ -1,13 +1,14 @@
 package markup_test
 
 import (
+	"net/url"
+	"strings"
 	"testing"
 	"github.com/go-test/deep"
 	"github.com/cvanloo/blog-go/markup/lexer"
 	"github.com/cvanloo/blog-go/markup/parser"
-	. "github.com/cvanloo/blog-go/assert"
-	//"github.com/cvanloo/blog-go/page"
-	//"github.com/cvanloo/blog-go/markup"
+	"github.com/cvanloo/blog-go/page"
+	"github.com/cvanloo/blog-go/markup"
 )
 
 type TestCase struct {
@@ -30,9 +31,9 @@ Some [text][^sn1] with a sidenote.
 [^sn1]: This is some [text](https://example.com/hello) with a link.
 `,
 		ExpectedLexemes: []lexer.Token{
-			{Type: lexer.TokenSection1Begin, Text: "#"},
+			{Type: lexer.TokenSectionBegin, Text: "#"},
 			{Type: lexer.TokenText, Text: "Section 1"},
-			{Type: lexer.TokenSection1Content, Text: ""},
+			{Type: lexer.TokenSectionContent, Text: ""},
 			{Type: lexer.TokenParagraphBegin, Text: ""},
 			{Type: lexer.TokenText, Text: "Some "},
 			{Type: lexer.TokenLinkableBegin, Text: "["},
@@ -49,7 +50,7 @@ Some [text][^sn1] with a sidenote.
 			{Type: lexer.TokenLinkableEnd, Text: ""},
 			{Type: lexer.TokenText, Text: " with a link."},
 			{Type: lexer.TokenSidenoteDefEnd, Text: ""},
-			{Type: lexer.TokenSection1End, Text: ""},
+			{Type: lexer.TokenSectionEnd, Text: ""},
 			{Type: lexer.TokenEOF, Text: ""},
 		},
 		ExpectedParseResult: &parser.Blog{
@@ -57,16 +58,16 @@ Some [text][^sn1] with a sidenote.
 			Sections: []*parser.Section{
 				{
 					Level: 1,
-					Heading: parser.TextRich{AsRef(parser.Text("Section 1"))},
+					Heading: parser.TextRich{&parser.Text{Text: "Section 1"}},
 					Content: []parser.Node{
 						&parser.Paragraph{
 							Content: []parser.Node{
-								AsRef(parser.Text("Some ")),
+								&parser.Text{Text: "Some "},
 								&parser.Sidenote{
 									Ref: "sn1",
-									Word: parser.TextRich{AsRef(parser.Text("text"))},
+									Word: parser.TextRich{&parser.Text{Text: "text"}},
 								},
-								AsRef(parser.Text(" with a sidenote.")),
+								&parser.Text{Text: " with a sidenote."},
 							},
 						},
 					},
@@ -75,15 +76,817 @@ Some [text][^sn1] with a sidenote.
 			LinkDefinitions: map[string]string{},
 			SidenoteDefinitions: map[string]parser.TextRich{
 				"sn1": parser.TextRich{
-					AsRef(parser.Text("This is some ")),
+					&parser.Text{Text: "This is some "},
 					&parser.Link{
-						Name: parser.TextRich{AsRef(parser.Text("text"))},
+						Name: parser.TextRich{&parser.Text{Text: "text"}},
 						Href: "https://example.com/hello",
 					},
-					AsRef(parser.Text(" with a link.")),
+					&parser.Text{Text: " with a link."},
 				},
 			},
+			FootnoteDefinitions: map[string][]parser.TextRich{
+				"sn1": []parser.TextRich{
+					parser.TextRich{
+						&parser.Text{Text: "This is some "},
+						&parser.Link{
+							Name: parser.TextRich{&parser.Text{Text: "text"}},
+							Href: "https://example.com/hello",
+						},
+						&parser.Text{Text: " with a link."},
+					},
+				},
+			},
+			TermDefinitions: map[string]parser.TextRich{},
+			AbbreviationDefinitions: map[string]string{},
+		},
+	},
+	{
+		Comment: "Nested lists with task items and multiple paragraphs.",
+		Source: `
+# Section 1
+
+- [x] Done
+- Item
+
+  More.
+
+  2. Nested
+`,
+		ExpectedLexemes: []lexer.Token{
+			{Type: lexer.TokenSectionBegin, Text: "#"},
+			{Type: lexer.TokenText, Text: "Section 1"},
+			{Type: lexer.TokenSectionContent, Text: ""},
+			{Type: lexer.TokenListUnorderedBegin, Text: ""},
+			{Type: lexer.TokenListItemBegin, Text: "-"},
+			{Type: lexer.TokenListItemTask, Text: "[x]"},
+			{Type: lexer.TokenParagraphBegin, Text: ""},
+			{Type: lexer.TokenText, Text: "Done"},
+			{Type: lexer.TokenParagraphEnd, Text: ""},
+			{Type: lexer.TokenListItemEnd, Text: ""},
+			{Type: lexer.TokenListItemBegin, Text: "-"},
+			{Type: lexer.TokenParagraphBegin, Text: ""},
+			{Type: lexer.TokenText, Text: "Item"},
+			{Type: lexer.TokenParagraphEnd, Text: ""},
+			{Type: lexer.TokenParagraphBegin, Text: ""},
+			{Type: lexer.TokenText, Text: "More."},
+			{Type: lexer.TokenParagraphEnd, Text: ""},
+			{Type: lexer.TokenListOrderedBegin, Text: ""},
+			{Type: lexer.TokenListItemBegin, Text: "2."},
+			{Type: lexer.TokenParagraphBegin, Text: ""},
+			{Type: lexer.TokenText, Text: "Nested\n"},
+			{Type: lexer.TokenParagraphEnd, Text: ""},
+			{Type: lexer.TokenListItemEnd, Text: ""},
+			{Type: lexer.TokenListEnd, Text: ""},
+			{Type: lexer.TokenListItemEnd, Text: ""},
+			{Type: lexer.TokenListEnd, Text: ""},
+			{Type: lexer.TokenSectionEnd, Text: ""},
+			{Type: lexer.TokenEOF, Text: ""},
+		},
+		ExpectedParseResult: &parser.Blog{
+			Meta: parser.Meta{},
+			Sections: []*parser.Section{
+				{
+					Level: 1,
+					Heading: parser.TextRich{&parser.Text{Text: "Section 1"}},
+					Content: []parser.Node{
+						&parser.List{
+							Items: []*parser.ListItem{
+								{
+									Task: true,
+									Checked: true,
+									Content: []parser.Node{
+										&parser.Paragraph{Content: []parser.Node{&parser.Text{Text: "Done"}}},
+									},
+								},
+								{
+									Content: []parser.Node{
+										&parser.Paragraph{Content: []parser.Node{&parser.Text{Text: "Item"}}},
+										&parser.Paragraph{Content: []parser.Node{&parser.Text{Text: "More."}}},
+										&parser.List{
+											Ordered: true,
+											Start: 2,
+											Items: []*parser.ListItem{
+												{
+													Content: []parser.Node{
+														&parser.Paragraph{Content: []parser.Node{&parser.Text{Text: "Nested\n"}}},
+													},
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			LinkDefinitions: map[string]string{},
+			SidenoteDefinitions: map[string]parser.TextRich{},
+			FootnoteDefinitions: map[string][]parser.TextRich{},
+			TermDefinitions: map[string]parser.TextRich{},
+			AbbreviationDefinitions: map[string]string{},
+		},
+	},
+	{
+		Comment: "Table with column alignment, a caption, and a short row.",
+		Source: `
+# Section 1
+
+| Name | ns/op |
+|:-----|------:|
+| **Lexer** |
+{caption=Results}
+`,
+		ExpectedLexemes: []lexer.Token{
+			{Type: lexer.TokenSectionBegin, Text: "#"},
+			{Type: lexer.TokenText, Text: "Section 1"},
+			{Type: lexer.TokenSectionContent, Text: ""},
+			{Type: lexer.TokenTableBegin, Text: ""},
+			{Type: lexer.TokenTableRowBegin, Text: ""},
+			{Type: lexer.TokenTableCellBegin, Text: ""},
+			{Type: lexer.TokenText, Text: "Name "},
+			{Type: lexer.TokenTableCellEnd, Text: ""},
+			{Type: lexer.TokenTableCellBegin, Text: ""},
+			{Type: lexer.TokenText, Text: "ns/op "},
+			{Type: lexer.TokenTableCellEnd, Text: ""},
+			{Type: lexer.TokenTableRowEnd, Text: ""},
+			{Type: lexer.TokenTableAlignment, Text: ":-----"},
+			{Type: lexer.TokenTableAlignment, Text: "------:"},
+			{Type: lexer.TokenTableRowBegin, Text: ""},
+			{Type: lexer.TokenTableCellBegin, Text: ""},
+			{Type: lexer.TokenStrongBegin, Text: "**"},
+			{Type: lexer.TokenText, Text: "Lexer"},
+			{Type: lexer.TokenStrongEnd, Text: "**"},
+			{Type: lexer.TokenText, Text: " "},
+			{Type: lexer.TokenTableCellEnd, Text: ""},
+			{Type: lexer.TokenTableRowEnd, Text: ""},
+			{Type: lexer.TokenAttributeListBegin, Text: "{"},
+			{Type: lexer.TokenAttributeListKey, Text: "caption"},
+			{Type: lexer.TokenText, Text: "Results"},
+			{Type: lexer.TokenAttributeListEnd, Text: "}"},
+			{Type: lexer.TokenTableEnd, Text: ""},
+			{Type: lexer.TokenSectionEnd, Text: ""},
+			{Type: lexer.TokenEOF, Text: ""},
+		},
+		ExpectedParseResult: &parser.Blog{
+			Meta: parser.Meta{},
+			Sections: []*parser.Section{
+				{
+					Level: 1,
+					Heading: parser.TextRich{&parser.Text{Text: "Section 1"}},
+					Content: []parser.Node{
+						&parser.Table{
+							Attributes: parser.Attributes{"caption": "Results"},
+							Alignments: []parser.Alignment{parser.AlignLeft, parser.AlignRight},
+							Header: []parser.TextRich{
+								{&parser.Text{Text: "Name"}},
+								{&parser.Text{Text: "ns/op"}},
+							},
+							Rows: [][]parser.TextRich{
+								{
+									{&parser.Strong{Content: parser.TextRich{&parser.Text{Text: "Lexer"}}}},
+									{},
+								},
+							},
+						},
+					},
+				},
+			},
+			LinkDefinitions: map[string]string{},
+			SidenoteDefinitions: map[string]parser.TextRich{},
+			FootnoteDefinitions: map[string][]parser.TextRich{},
 			TermDefinitions: map[string]parser.TextRich{},
+			AbbreviationDefinitions: map[string]string{},
+		},
+	},
+	{
+		Comment: "Sections nest up to level 6, skipping a level is an error.",
+		Source: `
+# One
+## Two
+### Three
+# Other
+### Skipped
+`,
+		ExpectedLexemes: []lexer.Token{
+			{Type: lexer.TokenSectionBegin, Text: "#"},
+			{Type: lexer.TokenText, Text: "One"},
+			{Type: lexer.TokenSectionContent, Text: ""},
+			{Type: lexer.TokenSectionBegin, Text: "##"},
+			{Type: lexer.TokenText, Text: "Two"},
+			{Type: lexer.TokenSectionContent, Text: ""},
+			{Type: lexer.TokenSectionBegin, Text: "###"},
+			{Type: lexer.TokenText, Text: "Three"},
+			{Type: lexer.TokenSectionContent, Text: ""},
+			{Type: lexer.TokenSectionEnd, Text: ""},
+			{Type: lexer.TokenSectionEnd, Text: ""},
+			{Type: lexer.TokenSectionEnd, Text: ""},
+			{Type: lexer.TokenSectionBegin, Text: "#"},
+			{Type: lexer.TokenText, Text: "Other"},
+			{Type: lexer.TokenSectionContent, Text: ""},
+			{Type: lexer.TokenSectionBegin, Text: "###"},
+			{Type: lexer.TokenText, Text: "Skipped"},
+			{Type: lexer.TokenSectionContent, Text: ""},
+			{Type: lexer.TokenSectionEnd, Text: ""},
+			{Type: lexer.TokenSectionEnd, Text: ""},
+			{Type: lexer.TokenEOF, Text: ""},
+		},
+		ExpectedParseResult: &parser.Blog{
+			Meta: parser.Meta{},
+			Sections: []*parser.Section{
+				{
+					Level: 1,
+					Heading: parser.TextRich{&parser.Text{Text: "One"}},
+					Content: []parser.Node{
+						&parser.Section{
+							Level: 2,
+							Heading: parser.TextRich{&parser.Text{Text: "Two"}},
+							Content: []parser.Node{
+								&parser.Section{
+									Level: 3,
+									Heading: parser.TextRich{&parser.Text{Text: "Three"}},
+									Content: []parser.Node{},
+								},
+							},
+						},
+					},
+				},
+				{
+					Level: 1,
+					Heading: parser.TextRich{&parser.Text{Text: "Other"}},
+					Content: []parser.Node{
+						&parser.Section{
+							Level: 3,
+							Heading: parser.TextRich{&parser.Text{Text: "Skipped"}},
+							Content: []parser.Node{},
+						},
+					},
+				},
+			},
+			LinkDefinitions: map[string]string{},
+			SidenoteDefinitions: map[string]parser.TextRich{},
+			FootnoteDefinitions: map[string][]parser.TextRich{},
+			TermDefinitions: map[string]parser.TextRich{},
+			AbbreviationDefinitions: map[string]string{},
+		},
+		ExpectedParserErrors: []string{
+			"section skips a level: level 3 section inside of level 1 section",
+		},
+	},
+	{
+		Comment: "Term definitions keep their position in the section.",
+		Source: `
+# Section 1
+
+RAM
+: Random Access Memory
+: A male sheep
+CPU
+: Cheese Processing Unit
+
+Go buy some.
+`,
+		ExpectedLexemes: []lexer.Token{
+			{Type: lexer.TokenSectionBegin, Text: "#"},
+			{Type: lexer.TokenText, Text: "Section 1"},
+			{Type: lexer.TokenSectionContent, Text: ""},
+			{Type: lexer.TokenDefinitionListBegin, Text: ""},
+			{Type: lexer.TokenDefinitionTerm, Text: "RAM"},
+			{Type: lexer.TokenDefinitionExplanationBegin, Text: ""},
+			{Type: lexer.TokenText, Text: "Random Access Memory"},
+			{Type: lexer.TokenDefinitionExplanationEnd, Text: ""},
+			{Type: lexer.TokenDefinitionExplanationBegin, Text: ""},
+			{Type: lexer.TokenText, Text: "A male sheep"},
+			{Type: lexer.TokenDefinitionExplanationEnd, Text: ""},
+			{Type: lexer.TokenDefinitionTerm, Text: "CPU"},
+			{Type: lexer.TokenDefinitionExplanationBegin, Text: ""},
+			{Type: lexer.TokenText, Text: "Cheese Processing Unit"},
+			{Type: lexer.TokenDefinitionExplanationEnd, Text: ""},
+			{Type: lexer.TokenDefinitionListEnd, Text: ""},
+			{Type: lexer.TokenParagraphBegin, Text: ""},
+			{Type: lexer.TokenText, Text: "Go buy some.\n"},
+			{Type: lexer.TokenParagraphEnd, Text: ""},
+			{Type: lexer.TokenSectionEnd, Text: ""},
+			{Type: lexer.TokenEOF, Text: ""},
+		},
+		ExpectedParseResult: &parser.Blog{
+			Meta: parser.Meta{},
+			Sections: []*parser.Section{
+				{
+					Level: 1,
+					Heading: parser.TextRich{&parser.Text{Text: "Section 1"}},
+					Content: []parser.Node{
+						&parser.DefinitionList{
+							Definitions: []*parser.Definition{
+								{
+									Term: parser.TextRich{&parser.Text{Text: "RAM"}},
+									Explanations: []parser.TextRich{
+										{&parser.Text{Text: "Random Access Memory"}},
+										{&parser.Text{Text: "A male sheep"}},
+									},
+								},
+								{
+									Term: parser.TextRich{&parser.Text{Text: "CPU"}},
+									Explanations: []parser.TextRich{
+										{&parser.Text{Text: "Cheese Processing Unit"}},
+									},
+								},
+							},
+						},
+						&parser.Paragraph{Content: []parser.Node{&parser.Text{Text: "Go buy some.\n"}}},
+					},
+				},
+			},
+			LinkDefinitions: map[string]string{},
+			SidenoteDefinitions: map[string]parser.TextRich{},
+			FootnoteDefinitions: map[string][]parser.TextRich{},
+			TermDefinitions: map[string]parser.TextRich{
+				"RAM": {&parser.Text{Text: "Random Access Memory"}},
+				"CPU": {&parser.Text{Text: "Cheese Processing Unit"}},
+			},
+			AbbreviationDefinitions: map[string]string{},
+		},
+	},
+	{
+		Comment: "The attribute list of a code block ends up in its attributes, next to the language.",
+		Source: `
+# Section 1
+
+` + "```go {file=main.go nonumber}\nx := 1\n```" + `
+`,
+		ExpectedLexemes: []lexer.Token{
+			{Type: lexer.TokenSectionBegin, Text: "#"},
+			{Type: lexer.TokenText, Text: "Section 1"},
+			{Type: lexer.TokenSectionContent, Text: ""},
+			{Type: lexer.TokenCodeBlockBegin, Text: "```"},
+			{Type: lexer.TokenCodeBlockLang, Text: "go"},
+			{Type: lexer.TokenAttributeListBegin, Text: "{"},
+			{Type: lexer.TokenAttributeListKey, Text: "file"},
+			{Type: lexer.TokenText, Text: "main.go"},
+			{Type: lexer.TokenAttributeListKey, Text: "nonumber"},
+			{Type: lexer.TokenAttributeListEnd, Text: "}"},
+			{Type: lexer.TokenText, Text: "x := 1"},
+			{Type: lexer.TokenCodeBlockEnd, Text: "```"},
+			{Type: lexer.TokenSectionEnd, Text: ""},
+			{Type: lexer.TokenEOF, Text: ""},
+		},
+		ExpectedParseResult: &parser.Blog{
+			Meta: parser.Meta{},
+			Sections: []*parser.Section{
+				{
+					Level:   1,
+					Heading: parser.TextRich{&parser.Text{Text: "Section 1"}},
+					Content: []parser.Node{
+						&parser.CodeBlock{
+							Attributes: parser.Attributes{"Lang": "go", "file": "main.go", "nonumber": ""},
+							Lines:      []string{"x := 1"},
+						},
+					},
+				},
+			},
+			LinkDefinitions:         map[string]string{},
+			SidenoteDefinitions:     map[string]parser.TextRich{},
+			FootnoteDefinitions:     map[string][]parser.TextRich{},
+			TermDefinitions:         map[string]parser.TextRich{},
+			AbbreviationDefinitions: map[string]string{},
+		},
+	},
+	{
+		Comment: "Inline and display math become math nodes with the TeX source trimmed.",
+		Source: `
+# Section 1
+
+Area $A = \pi r^2$ and
+$$ \sum_i x_i $$
+`,
+		ExpectedLexemes: []lexer.Token{
+			{Type: lexer.TokenSectionBegin, Text: "#"},
+			{Type: lexer.TokenText, Text: "Section 1"},
+			{Type: lexer.TokenSectionContent, Text: ""},
+			{Type: lexer.TokenParagraphBegin, Text: ""},
+			{Type: lexer.TokenText, Text: "Area "},
+			{Type: lexer.TokenMathInline, Text: "A = \\pi r^2"},
+			{Type: lexer.TokenText, Text: " and\n"},
+			{Type: lexer.TokenMathDisplay, Text: " \\sum_i x_i "},
+			{Type: lexer.TokenText, Text: "\n"},
+			{Type: lexer.TokenParagraphEnd, Text: ""},
+			{Type: lexer.TokenSectionEnd, Text: ""},
+			{Type: lexer.TokenEOF, Text: ""},
+		},
+		ExpectedParseResult: &parser.Blog{
+			Meta: parser.Meta{},
+			Sections: []*parser.Section{
+				{
+					Level:   1,
+					Heading: parser.TextRich{&parser.Text{Text: "Section 1"}},
+					Content: []parser.Node{
+						&parser.Paragraph{Content: []parser.Node{
+							&parser.Text{Text: "Area "},
+							&parser.Math{Inline: true, TeX: "A = \\pi r^2"},
+							&parser.Text{Text: " and\n"},
+							&parser.Math{Inline: false, TeX: "\\sum_i x_i"},
+							&parser.Text{Text: "\n"},
+						}},
+					},
+				},
+			},
+			LinkDefinitions:         map[string]string{},
+			SidenoteDefinitions:     map[string]parser.TextRich{},
+			FootnoteDefinitions:     map[string][]parser.TextRich{},
+			TermDefinitions:         map[string]parser.TextRich{},
+			AbbreviationDefinitions: map[string]string{},
+		},
+	},
+	{
+		Comment: "Single enquotes nest inside TeX style double enquotes.",
+		Source: `
+# Section 1
+
+` + "``" + `Say ` + "`" + `hi' *now*'' ok
+`,
+		ExpectedLexemes: []lexer.Token{
+			{Type: lexer.TokenSectionBegin, Text: "#"},
+			{Type: lexer.TokenText, Text: "Section 1"},
+			{Type: lexer.TokenSectionContent, Text: ""},
+			{Type: lexer.TokenParagraphBegin, Text: ""},
+			{Type: lexer.TokenEnquoteDoubleBegin, Text: "``"},
+			{Type: lexer.TokenText, Text: "Say "},
+			{Type: lexer.TokenEnquoteSingleBegin, Text: "`"},
+			{Type: lexer.TokenText, Text: "hi"},
+			{Type: lexer.TokenEnquoteSingleEnd, Text: "'"},
+			{Type: lexer.TokenText, Text: " "},
+			{Type: lexer.TokenEmphasisBegin, Text: "*"},
+			{Type: lexer.TokenText, Text: "now"},
+			{Type: lexer.TokenEmphasisEnd, Text: "*"},
+			{Type: lexer.TokenEnquoteDoubleEnd, Text: "''"},
+			{Type: lexer.TokenText, Text: " ok\n"},
+			{Type: lexer.TokenParagraphEnd, Text: ""},
+			{Type: lexer.TokenSectionEnd, Text: ""},
+			{Type: lexer.TokenEOF, Text: ""},
+		},
+		ExpectedParseResult: &parser.Blog{
+			Meta: parser.Meta{},
+			Sections: []*parser.Section{
+				{
+					Level:   1,
+					Heading: parser.TextRich{&parser.Text{Text: "Section 1"}},
+					Content: []parser.Node{
+						&parser.Paragraph{Content: []parser.Node{
+							&parser.EnquoteDouble{Content: parser.TextRich{
+								&parser.Text{Text: "Say "},
+								&parser.EnquoteSingle{Content: parser.TextRich{&parser.Text{Text: "hi"}}},
+								&parser.Text{Text: " "},
+								&parser.Emphasis{Content: parser.TextRich{&parser.Text{Text: "now"}}},
+							}},
+							&parser.Text{Text: " ok\n"},
+						}},
+					},
+				},
+			},
+			LinkDefinitions:         map[string]string{},
+			SidenoteDefinitions:     map[string]parser.TextRich{},
+			FootnoteDefinitions:     map[string][]parser.TextRich{},
+			TermDefinitions:         map[string]parser.TextRich{},
+			AbbreviationDefinitions: map[string]string{},
+		},
+	},
+	{
+		Comment: "Links carry their title, parentheses in the href are kept.",
+		Source: `
+# Section 1
+
+See [Go](https://en.wikipedia.org/wiki/Go_(programming_language) "Go (programming language)")
+`,
+		ExpectedLexemes: []lexer.Token{
+			{Type: lexer.TokenSectionBegin, Text: "#"},
+			{Type: lexer.TokenText, Text: "Section 1"},
+			{Type: lexer.TokenSectionContent, Text: ""},
+			{Type: lexer.TokenParagraphBegin, Text: ""},
+			{Type: lexer.TokenText, Text: "See "},
+			{Type: lexer.TokenLinkableBegin, Text: "["},
+			{Type: lexer.TokenText, Text: "Go"},
+			{Type: lexer.TokenLinkHref, Text: "https://en.wikipedia.org/wiki/Go_(programming_language)"},
+			{Type: lexer.TokenLinkTitle, Text: "Go (programming language)"},
+			{Type: lexer.TokenLinkableEnd, Text: ""},
+			{Type: lexer.TokenText, Text: "\n"},
+			{Type: lexer.TokenParagraphEnd, Text: ""},
+			{Type: lexer.TokenSectionEnd, Text: ""},
+			{Type: lexer.TokenEOF, Text: ""},
+		},
+		ExpectedParseResult: &parser.Blog{
+			Meta: parser.Meta{},
+			Sections: []*parser.Section{
+				{
+					Level:   1,
+					Heading: parser.TextRich{&parser.Text{Text: "Section 1"}},
+					Content: []parser.Node{
+						&parser.Paragraph{Content: []parser.Node{
+							&parser.Text{Text: "See "},
+							&parser.Link{
+								Name:  parser.TextRich{&parser.Text{Text: "Go"}},
+								Href:  "https://en.wikipedia.org/wiki/Go_(programming_language)",
+								Title: "Go (programming language)",
+							},
+							&parser.Text{Text: "\n"},
+						}},
+					},
+				},
+			},
+			LinkDefinitions:         map[string]string{},
+			SidenoteDefinitions:     map[string]parser.TextRich{},
+			FootnoteDefinitions:     map[string][]parser.TextRich{},
+			TermDefinitions:         map[string]parser.TextRich{},
+			AbbreviationDefinitions: map[string]string{},
+		},
+	},
+	{
+		Comment: "Attribute lists on spans, paragraphs and images, .name adds a class.",
+		Source: `
+# Section 1
+
+A [span]{.a .b lang=ja} inside. {#intro .lead}
+
+![Alt](/img/cat.jpg){#cat}
+`,
+		ExpectedLexemes: []lexer.Token{
+			{Type: lexer.TokenSectionBegin, Text: "#"},
+			{Type: lexer.TokenText, Text: "Section 1"},
+			{Type: lexer.TokenSectionContent, Text: ""},
+			{Type: lexer.TokenParagraphBegin, Text: ""},
+			{Type: lexer.TokenText, Text: "A "},
+			{Type: lexer.TokenLinkableBegin, Text: "["},
+			{Type: lexer.TokenText, Text: "span"},
+			{Type: lexer.TokenAttributeListBegin, Text: "{"},
+			{Type: lexer.TokenAttributeListKey, Text: ".a"},
+			{Type: lexer.TokenAttributeListKey, Text: ".b"},
+			{Type: lexer.TokenAttributeListKey, Text: "lang"},
+			{Type: lexer.TokenText, Text: "ja"},
+			{Type: lexer.TokenAttributeListEnd, Text: "}"},
+			{Type: lexer.TokenLinkableEnd, Text: ""},
+			{Type: lexer.TokenText, Text: " inside. "},
+			{Type: lexer.TokenAttributeListBegin, Text: "{"},
+			{Type: lexer.TokenAttributeListID, Text: "intro"},
+			{Type: lexer.TokenAttributeListKey, Text: ".lead"},
+			{Type: lexer.TokenAttributeListEnd, Text: "}"},
+			{Type: lexer.TokenParagraphEnd, Text: ""},
+			{Type: lexer.TokenImageBegin, Text: "!["},
+			{Type: lexer.TokenImageAltText, Text: "Alt"},
+			{Type: lexer.TokenImagePath, Text: "/img/cat.jpg"},
+			{Type: lexer.TokenAttributeListBegin, Text: "{"},
+			{Type: lexer.TokenAttributeListID, Text: "cat"},
+			{Type: lexer.TokenAttributeListEnd, Text: "}"},
+			{Type: lexer.TokenImageEnd, Text: ""},
+			{Type: lexer.TokenSectionEnd, Text: ""},
+			{Type: lexer.TokenEOF, Text: ""},
+		},
+		ExpectedParseResult: &parser.Blog{
+			Meta: parser.Meta{},
+			Sections: []*parser.Section{
+				{
+					Level:   1,
+					Heading: parser.TextRich{&parser.Text{Text: "Section 1"}},
+					Content: []parser.Node{
+						&parser.Paragraph{
+							Attributes: parser.Attributes{"id": "intro", "class": "lead"},
+							Content: []parser.Node{
+								&parser.Text{Text: "A "},
+								&parser.Span{
+									Attributes: parser.Attributes{"class": "a b", "lang": "ja"},
+									Content:    parser.TextRich{&parser.Text{Text: "span"}},
+								},
+								&parser.Text{Text: " inside."},
+							},
+						},
+						&parser.Image{
+							Attributes: parser.Attributes{"id": "cat"},
+							Name:       "/img/cat.jpg",
+							Alt:        parser.TextSimple{&parser.Text{Text: "Alt"}},
+						},
+					},
+				},
+			},
+			LinkDefinitions:         map[string]string{},
+			SidenoteDefinitions:     map[string]parser.TextRich{},
+			FootnoteDefinitions:     map[string][]parser.TextRich{},
+			TermDefinitions:         map[string]parser.TextRich{},
+			AbbreviationDefinitions: map[string]string{},
+		},
+	},
+	{
+		Comment: "Ruby annotations need one reading per character or a single reading.",
+		Source: `
+# Section 1
+
+{漢字|かん|じ}, {今日|きょう} and {日本語|に|ほん}
+`,
+		ExpectedLexemes: []lexer.Token{
+			{Type: lexer.TokenSectionBegin, Text: "#"},
+			{Type: lexer.TokenText, Text: "Section 1"},
+			{Type: lexer.TokenSectionContent, Text: ""},
+			{Type: lexer.TokenParagraphBegin, Text: ""},
+			{Type: lexer.TokenRubyBegin, Text: "{"},
+			{Type: lexer.TokenRubyBase, Text: "漢字"},
+			{Type: lexer.TokenRubyText, Text: "かん"},
+			{Type: lexer.TokenRubyText, Text: "じ"},
+			{Type: lexer.TokenRubyEnd, Text: "}"},
+			{Type: lexer.TokenText, Text: ", "},
+			{Type: lexer.TokenRubyBegin, Text: "{"},
+			{Type: lexer.TokenRubyBase, Text: "今日"},
+			{Type: lexer.TokenRubyText, Text: "きょう"},
+			{Type: lexer.TokenRubyEnd, Text: "}"},
+			{Type: lexer.TokenText, Text: " and "},
+			{Type: lexer.TokenRubyBegin, Text: "{"},
+			{Type: lexer.TokenRubyBase, Text: "日本語"},
+			{Type: lexer.TokenRubyText, Text: "に"},
+			{Type: lexer.TokenRubyText, Text: "ほん"},
+			{Type: lexer.TokenRubyEnd, Text: "}"},
+			{Type: lexer.TokenText, Text: "\n"},
+			{Type: lexer.TokenParagraphEnd, Text: ""},
+			{Type: lexer.TokenSectionEnd, Text: ""},
+			{Type: lexer.TokenEOF, Text: ""},
+		},
+		ExpectedParseResult: &parser.Blog{
+			Meta: parser.Meta{},
+			Sections: []*parser.Section{
+				{
+					Level:   1,
+					Heading: parser.TextRich{&parser.Text{Text: "Section 1"}},
+					Content: []parser.Node{
+						&parser.Paragraph{Content: []parser.Node{
+							&parser.Ruby{Kanji: []string{"漢", "字"}, Furigana: []string{"かん", "じ"}},
+							&parser.Text{Text: ", "},
+							&parser.Ruby{Kanji: []string{"今日"}, Furigana: []string{"きょう"}},
+							&parser.Text{Text: " and "},
+							&parser.Ruby{Kanji: []string{"日本語"}, Furigana: []string{"にほん"}},
+							&parser.Text{Text: "\n"},
+						}},
+					},
+				},
+			},
+			LinkDefinitions:         map[string]string{},
+			SidenoteDefinitions:     map[string]parser.TextRich{},
+			FootnoteDefinitions:     map[string][]parser.TextRich{},
+			TermDefinitions:         map[string]parser.TextRich{},
+			AbbreviationDefinitions: map[string]string{},
+		},
+		ExpectedParserErrors: []string{
+			"ruby must have either one reading per character or a single reading",
+		},
+	},
+	{
+		Comment: "Admonitions contain indented block content and can be nested.",
+		Source: `
+# Section 1
+
+!!! warning "Mind the gap"
+    Text inside.
+
+    ` + "```" + `sh
+    ls
+    ` + "```" + `
+
+    ???+ tip
+        Nested.
+
+!!! caution
+    Unknown type.
+`,
+		ExpectedLexemes: []lexer.Token{
+			{Type: lexer.TokenSectionBegin, Text: "#"},
+			{Type: lexer.TokenText, Text: "Section 1"},
+			{Type: lexer.TokenSectionContent, Text: ""},
+			{Type: lexer.TokenAdmonitionBegin, Text: "!!!"},
+			{Type: lexer.TokenAdmonitionType, Text: "warning"},
+			{Type: lexer.TokenAdmonitionTitle, Text: "Mind the gap"},
+			{Type: lexer.TokenParagraphBegin, Text: ""},
+			{Type: lexer.TokenText, Text: "Text inside."},
+			{Type: lexer.TokenParagraphEnd, Text: ""},
+			{Type: lexer.TokenCodeBlockBegin, Text: "```"},
+			{Type: lexer.TokenCodeBlockLang, Text: "sh"},
+			{Type: lexer.TokenText, Text: "ls"},
+			{Type: lexer.TokenCodeBlockEnd, Text: "```"},
+			{Type: lexer.TokenAdmonitionBegin, Text: "???+"},
+			{Type: lexer.TokenAdmonitionType, Text: "tip"},
+			{Type: lexer.TokenParagraphBegin, Text: ""},
+			{Type: lexer.TokenText, Text: "Nested."},
+			{Type: lexer.TokenParagraphEnd, Text: ""},
+			{Type: lexer.TokenAdmonitionEnd, Text: ""},
+			{Type: lexer.TokenAdmonitionEnd, Text: ""},
+			{Type: lexer.TokenAdmonitionBegin, Text: "!!!"},
+			{Type: lexer.TokenAdmonitionType, Text: "caution"},
+			{Type: lexer.TokenParagraphBegin, Text: ""},
+			{Type: lexer.TokenText, Text: "Unknown type.\n"},
+			{Type: lexer.TokenParagraphEnd, Text: ""},
+			{Type: lexer.TokenAdmonitionEnd, Text: ""},
+			{Type: lexer.TokenSectionEnd, Text: ""},
+			{Type: lexer.TokenEOF, Text: ""},
+		},
+		ExpectedParseResult: &parser.Blog{
+			Meta: parser.Meta{},
+			Sections: []*parser.Section{
+				{
+					Level:   1,
+					Heading: parser.TextRich{&parser.Text{Text: "Section 1"}},
+					Content: []parser.Node{
+						&parser.Admonition{
+							Type:  "warning",
+							Title: parser.TextSimple{&parser.Text{Text: "Mind the gap"}},
+							Content: []parser.Node{
+								&parser.Paragraph{Content: []parser.Node{&parser.Text{Text: "Text inside."}}},
+								&parser.CodeBlock{Attributes: parser.Attributes{"Lang": "sh"}, Lines: []string{"ls"}},
+								&parser.Admonition{
+									Type:        "tip",
+									Collapsible: true,
+									Open:        true,
+									Content: []parser.Node{
+										&parser.Paragraph{Content: []parser.Node{&parser.Text{Text: "Nested."}}},
+									},
+								},
+							},
+						},
+						&parser.Admonition{
+							Type: "caution",
+							Content: []parser.Node{
+								&parser.Paragraph{Content: []parser.Node{&parser.Text{Text: "Unknown type.\n"}}},
+							},
+						},
+					},
+				},
+			},
+			LinkDefinitions:         map[string]string{},
+			SidenoteDefinitions:     map[string]parser.TextRich{},
+			FootnoteDefinitions:     map[string][]parser.TextRich{},
+			TermDefinitions:         map[string]parser.TextRich{},
+			AbbreviationDefinitions: map[string]string{},
+		},
+		ExpectedParserErrors: []string{
+			"admonition type must be one of info, warning, danger or tip",
+		},
+	},
+	{
+		Comment: "Blockquotes contain block content and nest, the attribution belongs to the quote it ends.",
+		Source: `
+# Section 1
+
+> Outer quote.
+>
+> > Inner quote.
+> > -- Inner Author
+> -- Outer Author, Outer Source
+`,
+		ExpectedLexemes: []lexer.Token{
+			{Type: lexer.TokenSectionBegin, Text: "#"},
+			{Type: lexer.TokenText, Text: "Section 1"},
+			{Type: lexer.TokenSectionContent, Text: ""},
+			{Type: lexer.TokenBlockquoteBegin, Text: ""},
+			{Type: lexer.TokenParagraphBegin, Text: ""},
+			{Type: lexer.TokenText, Text: "Outer quote."},
+			{Type: lexer.TokenParagraphEnd, Text: ""},
+			{Type: lexer.TokenBlockquoteBegin, Text: ""},
+			{Type: lexer.TokenParagraphBegin, Text: ""},
+			{Type: lexer.TokenText, Text: "Inner quote.\n"},
+			{Type: lexer.TokenParagraphEnd, Text: ""},
+			{Type: lexer.TokenBlockquoteAttrAuthor, Text: ""},
+			{Type: lexer.TokenText, Text: "Inner Author"},
+			{Type: lexer.TokenBlockquoteAttrEnd, Text: ""},
+			{Type: lexer.TokenBlockquoteEnd, Text: ""},
+			{Type: lexer.TokenBlockquoteAttrAuthor, Text: ""},
+			{Type: lexer.TokenText, Text: "Outer Author"},
+			{Type: lexer.TokenBlockquoteAttrSource, Text: ""},
+			{Type: lexer.TokenText, Text: "Outer Source"},
+			{Type: lexer.TokenBlockquoteAttrEnd, Text: ""},
+			{Type: lexer.TokenBlockquoteEnd, Text: ""},
+			{Type: lexer.TokenSectionEnd, Text: ""},
+			{Type: lexer.TokenEOF, Text: ""},
+		},
+		ExpectedParseResult: &parser.Blog{
+			Meta: parser.Meta{},
+			Sections: []*parser.Section{
+				{
+					Level:   1,
+					Heading: parser.TextRich{&parser.Text{Text: "Section 1"}},
+					Content: []parser.Node{
+						&parser.BlockQuote{
+							Content: []parser.Node{
+								&parser.Paragraph{Content: []parser.Node{&parser.Text{Text: "Outer quote."}}},
+								&parser.BlockQuote{
+									Content: []parser.Node{
+										&parser.Paragraph{Content: []parser.Node{&parser.Text{Text: "Inner quote.\n"}}},
+									},
+									Author: parser.TextSimple{&parser.Text{Text: "Inner Author"}},
+								},
+							},
+							Author: parser.TextSimple{&parser.Text{Text: "Outer Author"}},
+							Source: parser.TextRich{&parser.Text{Text: "Outer Source"}},
+						},
+					},
+				},
+			},
+			LinkDefinitions:         map[string]string{},
+			SidenoteDefinitions:     map[string]parser.TextRich{},
+			FootnoteDefinitions:     map[string][]parser.TextRich{},
+			TermDefinitions:         map[string]parser.TextRich{},
+			AbbreviationDefinitions: map[string]string{},
 		},
 	},
 }
@@ -102,8 +905,9 @@ func TestMarkup(t *testing.T) {
 			t.Error(diff)
 		}
 		blog, err := parser.Parse(lx)
-		if err != nil {
-			t.Error(err)
+		diffParseErrors := deep.Equal(parserErrorStrings(err), testCase.ExpectedParserErrors)
+		for _, diff := range diffParseErrors {
+			t.Error(diff)
 		}
 		diffParseResult := deep.Equal(blog, testCase.ExpectedParseResult)
 		for _, diff := range diffParseResult {
@@ -113,6 +917,26 @@ func TestMarkup(t *testing.T) {
 	}
 }
 
+func TestRunLexerError(t *testing.T) {
+	m := markup.New(
+		markup.SiteInfo(page.Site{
+			Address:        &url.URL{Scheme: "https", Host: "example.com"},
+			DefaultTagline: page.StringOnlyContent{page.Text("Test")},
+			Owner:          page.StringOnlyContent{page.Text("Colin")},
+		}),
+		markup.Source("bad.md", strings.NewReader(`
+# Section 1
+
+An `+"`"+`unclosed backtick.
+`)),
+		markup.OutDir(t.TempDir()),
+	)
+	err := m.Run()
+	if err == nil || !strings.Contains(err.Error(), "processing bad.md failed while lexing") {
+		t.Errorf("expected the lexer error to be reported, got: %v", err)
+	}
+}
+
 func innerErrorStrings(es []error) (ss []string) {
 	for _, e := range es {
 		ss = append(ss, innerErrorString(e))
@@ -120,6 +944,22 @@ func innerErrorStrings(es []error) (ss []string) {
 	return ss
 }
 
+func parserErrorStrings(err error) (ss []string) {
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			ss = append(ss, parserErrorStrings(e)...)
+		}
+		return ss
+	}
+	if pe, ok := err.(parser.ParserError); ok {
+		return []string{pe.Inner.Error()}
+	}
+	return []string{err.Error()}
+}
+
 func innerErrorString(e error) string {
 	if lxe, ok := e.(lexer.LexerError); ok {
 		return lxe.Inner.Error()
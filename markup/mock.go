@@ -3,7 +3,6 @@ package markup
 import (
 	//"time"
 
-	. "github.com/cvanloo/blog-go/assert"
 	"github.com/cvanloo/blog-go/markup/lexer"
 	"github.com/cvanloo/blog-go/markup/parser"
 	"github.com/cvanloo/blog-go/page"
@@ -72,12 +71,12 @@ var LexerTestTokens = MockTokens{
 	{Type: lexer.TokenMetaKey, Text: "lang"},
 	{Type: lexer.TokenText, Text: "en"},
 	{Type: lexer.TokenMetaEnd, Text: "---"},
-	{Type: lexer.TokenSection1Begin, Text: "#"},
+	{Type: lexer.TokenSectionBegin, Text: "#"},
 	{Type: lexer.TokenText, Text: "こんにちは、世界！ "},
 	{Type: lexer.TokenAttributeListBegin, Text: "{"},
 	{Type: lexer.TokenAttributeListID, Text: "s1"},
 	{Type: lexer.TokenAttributeListEnd, Text: "}"},
-	{Type: lexer.TokenSection1Content, Text: ""},
+	{Type: lexer.TokenSectionContent, Text: ""},
 	{Type: lexer.TokenParagraphBegin, Text: ""},
 	{Type: lexer.TokenText, Text: "Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua.\nThere is this really cool J-Rock band called "},
 	{Type: lexer.TokenHtmlTagOpen, Text: "Ruby"},
@@ -95,9 +94,9 @@ var LexerTestTokens = MockTokens{
 	{Type: lexer.TokenAmpSpecial, Text: "---"},
 	{Type: lexer.TokenText, Text: "laboris nisi ut aliquip ex ea commodo consequat.\nDuis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur."},
 	{Type: lexer.TokenParagraphEnd, Text: ""},
-	{Type: lexer.TokenSection2Begin, Text: "##"},
+	{Type: lexer.TokenSectionBegin, Text: "##"},
 	{Type: lexer.TokenText, Text: "Lorem Ipsum"},
-	{Type: lexer.TokenSection2Content, Text: ""},
+	{Type: lexer.TokenSectionContent, Text: ""},
 	{Type: lexer.TokenParagraphBegin, Text: ""},
 	{Type: lexer.TokenText, Text: "Ut enim ad minim "},
 	{Type: lexer.TokenLinkableBegin, Text: "["},
@@ -109,13 +108,13 @@ var LexerTestTokens = MockTokens{
 	{Type: lexer.TokenParagraphBegin, Text: ""},
 	{Type: lexer.TokenText, Text: "Duis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur."},
 	{Type: lexer.TokenParagraphEnd, Text: ""},
-	{Type: lexer.TokenSection2End, Text: ""},
-	{Type: lexer.TokenSection2Begin, Text: "##"},
+	{Type: lexer.TokenSectionEnd, Text: ""},
+	{Type: lexer.TokenSectionBegin, Text: "##"},
 	{Type: lexer.TokenText, Text: "Lorem Epsum "},
 	{Type: lexer.TokenAttributeListBegin, Text: "{"},
 	{Type: lexer.TokenAttributeListID, Text: "s2.2"},
 	{Type: lexer.TokenAttributeListEnd, Text: "}"},
-	{Type: lexer.TokenSection2Content, Text: ""},
+	{Type: lexer.TokenSectionContent, Text: ""},
 	{Type: lexer.TokenParagraphBegin, Text: ""},
 	{Type: lexer.TokenText, Text: "Lorem "},
 	{Type: lexer.TokenLinkableBegin, Text: "["},
@@ -127,11 +126,11 @@ var LexerTestTokens = MockTokens{
 	{Type: lexer.TokenSidenoteDef, Text: "1"},
 	{Type: lexer.TokenText, Text: "See what I did there?"},
 	{Type: lexer.TokenSidenoteDefEnd, Text: ""},
-	{Type: lexer.TokenSection2End, Text: ""},
-	{Type: lexer.TokenSection1End, Text: ""},
-	{Type: lexer.TokenSection1Begin, Text: "#"},
+	{Type: lexer.TokenSectionEnd, Text: ""},
+	{Type: lexer.TokenSectionEnd, Text: ""},
+	{Type: lexer.TokenSectionBegin, Text: "#"},
 	{Type: lexer.TokenText, Text: "さようなら"},
-	{Type: lexer.TokenSection1Content, Text: ""},
+	{Type: lexer.TokenSectionContent, Text: ""},
 	{Type: lexer.TokenParagraphBegin, Text: ""},
 	{Type: lexer.TokenText, Text: "Ut enim ad minim "},
 	{Type: lexer.TokenLinkableBegin, Text: "["},
@@ -142,7 +141,7 @@ var LexerTestTokens = MockTokens{
 	{Type: lexer.TokenParagraphEnd, Text: ""},
 	{Type: lexer.TokenLinkDef, Text: "0"},
 	{Type: lexer.TokenText, Text: "https://example.com/"},
-	{Type: lexer.TokenSection1End, Text: ""},
+	{Type: lexer.TokenSectionEnd, Text: ""},
 	{Type: lexer.TokenEOF, Text: ""},
 }
 
@@ -150,24 +149,24 @@ var BlogParserTestStruct = &parser.Blog{
 	Meta: parser.Meta{
 		"url-path": []parser.TextSimple{
 			[]parser.Node{
-				AsRef(parser.Text("hello")),
+				&parser.Text{Text: "hello"},
 			},
 		},
 		"title": []parser.TextSimple{
 			[]parser.Node{
-				AsRef(parser.Text("Hello, World!")),
+				&parser.Text{Text: "Hello, World!"},
 			},
 		},
 		"author": []parser.TextSimple{
 			[]parser.Node{
-				AsRef(parser.Text("Colin van")),
-				AsRef(parser.AmpSpecial("~")),
-				AsRef(parser.Text("Loo")),
+				&parser.Text{Text: "Colin van"},
+				&parser.AmpSpecial{Text: "~"},
+				&parser.Text{Text: "Loo"},
 			},
 		},
 		"lang": []parser.TextSimple{
 			[]parser.Node{
-				AsRef(parser.Text("en")),
+				&parser.Text{Text: "en"},
 			},
 		},
 	},
@@ -178,52 +177,52 @@ var BlogParserTestStruct = &parser.Blog{
 				"id": "s1",
 			},
 			Heading: parser.TextRich{
-				AsRef(parser.Text("こんにちは、世界！ ")),
+				&parser.Text{Text: "こんにちは、世界！ "},
 			},
 			Content: []parser.Node{
 				&parser.Paragraph{
 					Content: []parser.Node{
-						AsRef(parser.Text("Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua.\nThere is this really cool J-Rock band called ")),
+						&parser.Text{Text: "Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua.\nThere is this really cool J-Rock band called "},
 						&parser.Html{
 							Attributes: parser.Attributes{
 								"furi": "あまいぼうりょく",
 							},
 							Name: "Ruby",
 							Content: []parser.Node{
-								AsRef(parser.Text("甘い暴力")),
+								&parser.Text{Text: "甘い暴力"},
 							},
 						},
-						AsRef(parser.Text(", you should check them out.\nDuis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur.")),
+						&parser.Text{Text: ", you should check them out.\nDuis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur."},
 					},
 				},
 				&parser.Paragraph{
 					Content: []parser.Node{
-						AsRef(parser.Text("Ut enim ad minim veniam, quis nostrud")),
-						AsRef(parser.AmpSpecial("---")),
-						AsRef(parser.Text("exercitation ullamco")),
-						AsRef(parser.AmpSpecial("---")),
-						AsRef(parser.Text("laboris nisi ut aliquip ex ea commodo consequat.\nDuis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur.")),
+						&parser.Text{Text: "Ut enim ad minim veniam, quis nostrud"},
+						&parser.AmpSpecial{Text: "---"},
+						&parser.Text{Text: "exercitation ullamco"},
+						&parser.AmpSpecial{Text: "---"},
+						&parser.Text{Text: "laboris nisi ut aliquip ex ea commodo consequat.\nDuis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur."},
 					},
 				},
 				&parser.Section{
 					Level: 2,
 					Heading: parser.TextRich{
-						AsRef(parser.Text("Lorem Ipsum")),
+						&parser.Text{Text: "Lorem Ipsum"},
 					},
 					Content: []parser.Node{
 						&parser.Paragraph{
 							Content: []parser.Node{
-								AsRef(parser.Text("Ut enim ad minim ")),
+								&parser.Text{Text: "Ut enim ad minim "},
 								&parser.Link{
-									Name: parser.TextRich{AsRef(parser.Text("veniam"))},
+									Name: parser.TextRich{&parser.Text{Text: "veniam"}},
 									Href: "https://example.com/",
 								},
-								AsRef(parser.Text(", quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat.")),
+								&parser.Text{Text: ", quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat."},
 							},
 						},
 						&parser.Paragraph{
 							Content: []parser.Node{
-								AsRef(parser.Text("Duis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur.")),
+								&parser.Text{Text: "Duis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur."},
 							},
 						},
 					},
@@ -234,17 +233,17 @@ var BlogParserTestStruct = &parser.Blog{
 						"id": "s2.2",
 					},
 					Heading: parser.TextRich{
-						AsRef(parser.Text("Lorem Epsum ")),
+						&parser.Text{Text: "Lorem Epsum "},
 					},
 					Content: []parser.Node{
 						&parser.Paragraph{
 							Content: []parser.Node{
-								AsRef(parser.Text("Lorem ")),
+								&parser.Text{Text: "Lorem "},
 								&parser.Sidenote{
 									Ref:  "1",
-									Word: parser.TextRich{AsRef(parser.Text("epsum"))},
+									Word: parser.TextRich{&parser.Text{Text: "epsum"}},
 								},
-								AsRef(parser.Text(" dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua.\nUt enim ad minim veniam, quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat.")),
+								&parser.Text{Text: " dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua.\nUt enim ad minim veniam, quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat."},
 							},
 						},
 					},
@@ -254,17 +253,17 @@ var BlogParserTestStruct = &parser.Blog{
 		{
 			Level: 1,
 			Heading: parser.TextRich{
-				AsRef(parser.Text("さようなら")),
+				&parser.Text{Text: "さようなら"},
 			},
 			Content: []parser.Node{
 				&parser.Paragraph{
 					Content: []parser.Node{
-						AsRef(parser.Text("Ut enim ad minim ")),
+						&parser.Text{Text: "Ut enim ad minim "},
 						&parser.Link{
 							Ref:  "0",
-							Name: parser.TextRich{AsRef(parser.Text("veniam"))},
+							Name: parser.TextRich{&parser.Text{Text: "veniam"}},
 						},
-						AsRef(parser.Text(", quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat.")),
+						&parser.Text{Text: ", quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat."},
 					},
 				},
 			},
@@ -274,33 +273,39 @@ var BlogParserTestStruct = &parser.Blog{
 		"0": "https://example.com/",
 	},
 	SidenoteDefinitions: map[string]parser.TextRich{
-		"1": parser.TextRich{AsRef(parser.Text("See what I did there?"))},
+		"1": parser.TextRich{&parser.Text{Text: "See what I did there?"}},
 	},
-	TermDefinitions: map[string]parser.TextRich{},
+	FootnoteDefinitions: map[string][]parser.TextRich{
+		"1": []parser.TextRich{
+			parser.TextRich{&parser.Text{Text: "See what I did there?"}},
+		},
+	},
+	TermDefinitions:         map[string]parser.TextRich{},
+	AbbreviationDefinitions: map[string]string{},
 }
 
 var BlogParserFixedTestStruct = &parser.Blog{
 	Meta: parser.Meta{
 		"url-path": []parser.TextSimple{
 			[]parser.Node{
-				AsRef(parser.Text("hello")),
+				&parser.Text{Text: "hello"},
 			},
 		},
 		"title": []parser.TextSimple{
 			[]parser.Node{
-				AsRef(parser.Text("Hello, World!")),
+				&parser.Text{Text: "Hello, World!"},
 			},
 		},
 		"author": []parser.TextSimple{
 			[]parser.Node{
-				AsRef(parser.Text("Colin van")),
-				AsRef(parser.AmpSpecial("~")),
-				AsRef(parser.Text("Loo")),
+				&parser.Text{Text: "Colin van"},
+				&parser.AmpSpecial{Text: "~"},
+				&parser.Text{Text: "Loo"},
 			},
 		},
 		"lang": []parser.TextSimple{
 			[]parser.Node{
-				AsRef(parser.Text("en")),
+				&parser.Text{Text: "en"},
 			},
 		},
 	},
@@ -311,52 +316,52 @@ var BlogParserFixedTestStruct = &parser.Blog{
 				"id": "s1",
 			},
 			Heading: parser.TextRich{
-				AsRef(parser.Text("こんにちは、世界！ ")),
+				&parser.Text{Text: "こんにちは、世界！ "},
 			},
 			Content: []parser.Node{
 				&parser.Paragraph{
 					Content: []parser.Node{
-						AsRef(parser.Text("Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua.\nThere is this really cool J-Rock band called ")),
+						&parser.Text{Text: "Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua.\nThere is this really cool J-Rock band called "},
 						&parser.Html{
 							Attributes: parser.Attributes{
 								"furi": "あまいぼうりょく",
 							},
 							Name: "Ruby",
 							Content: []parser.Node{
-								AsRef(parser.Text("甘い暴力")),
+								&parser.Text{Text: "甘い暴力"},
 							},
 						},
-						AsRef(parser.Text(", you should check them out.\nDuis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur.")),
+						&parser.Text{Text: ", you should check them out.\nDuis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur."},
 					},
 				},
 				&parser.Paragraph{
 					Content: []parser.Node{
-						AsRef(parser.Text("Ut enim ad minim veniam, quis nostrud")),
-						AsRef(parser.AmpSpecial("---")),
-						AsRef(parser.Text("exercitation ullamco")),
-						AsRef(parser.AmpSpecial("---")),
-						AsRef(parser.Text("laboris nisi ut aliquip ex ea commodo consequat.\nDuis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur.")),
+						&parser.Text{Text: "Ut enim ad minim veniam, quis nostrud"},
+						&parser.AmpSpecial{Text: "---"},
+						&parser.Text{Text: "exercitation ullamco"},
+						&parser.AmpSpecial{Text: "---"},
+						&parser.Text{Text: "laboris nisi ut aliquip ex ea commodo consequat.\nDuis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur."},
 					},
 				},
 				&parser.Section{
 					Level: 2,
 					Heading: parser.TextRich{
-						AsRef(parser.Text("Lorem Ipsum")),
+						&parser.Text{Text: "Lorem Ipsum"},
 					},
 					Content: []parser.Node{
 						&parser.Paragraph{
 							Content: []parser.Node{
-								AsRef(parser.Text("Ut enim ad minim ")),
+								&parser.Text{Text: "Ut enim ad minim "},
 								&parser.Link{
-									Name: parser.TextRich{AsRef(parser.Text("veniam"))},
+									Name: parser.TextRich{&parser.Text{Text: "veniam"}},
 									Href: "https://example.com/",
 								},
-								AsRef(parser.Text(", quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat.")),
+								&parser.Text{Text: ", quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat."},
 							},
 						},
 						&parser.Paragraph{
 							Content: []parser.Node{
-								AsRef(parser.Text("Duis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur.")),
+								&parser.Text{Text: "Duis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur."},
 							},
 						},
 					},
@@ -367,18 +372,18 @@ var BlogParserFixedTestStruct = &parser.Blog{
 						"id": "s2.2",
 					},
 					Heading: parser.TextRich{
-						AsRef(parser.Text("Lorem Epsum ")),
+						&parser.Text{Text: "Lorem Epsum "},
 					},
 					Content: []parser.Node{
 						&parser.Paragraph{
 							Content: []parser.Node{
-								AsRef(parser.Text("Lorem ")),
+								&parser.Text{Text: "Lorem "},
 								&parser.Sidenote{
 									Ref:     "1",
-									Word:    parser.TextRich{AsRef(parser.Text("epsum"))},
-									Content: parser.TextRich{AsRef(parser.Text("See what I did there?"))},
+									Word:    parser.TextRich{&parser.Text{Text: "epsum"}},
+									Content: parser.TextRich{&parser.Text{Text: "See what I did there?"}},
 								},
-								AsRef(parser.Text(" dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua.\nUt enim ad minim veniam, quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat.")),
+								&parser.Text{Text: " dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua.\nUt enim ad minim veniam, quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat."},
 							},
 						},
 					},
@@ -388,18 +393,18 @@ var BlogParserFixedTestStruct = &parser.Blog{
 		{
 			Level: 1,
 			Heading: parser.TextRich{
-				AsRef(parser.Text("さようなら")),
+				&parser.Text{Text: "さようなら"},
 			},
 			Content: []parser.Node{
 				&parser.Paragraph{
 					Content: []parser.Node{
-						AsRef(parser.Text("Ut enim ad minim ")),
+						&parser.Text{Text: "Ut enim ad minim "},
 						&parser.Link{
 							Ref:  "0",
-							Name: parser.TextRich{AsRef(parser.Text("veniam"))},
+							Name: parser.TextRich{&parser.Text{Text: "veniam"}},
 							Href: "https://example.com/",
 						},
-						AsRef(parser.Text(", quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat.")),
+						&parser.Text{Text: ", quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat."},
 					},
 				},
 			},
@@ -409,9 +414,15 @@ var BlogParserFixedTestStruct = &parser.Blog{
 		"0": "https://example.com/",
 	},
 	SidenoteDefinitions: map[string]parser.TextRich{
-		"1": parser.TextRich{AsRef(parser.Text("See what I did there?"))},
+		"1": parser.TextRich{&parser.Text{Text: "See what I did there?"}},
+	},
+	FootnoteDefinitions: map[string][]parser.TextRich{
+		"1": []parser.TextRich{
+			parser.TextRich{&parser.Text{Text: "See what I did there?"}},
+		},
 	},
-	TermDefinitions: map[string]parser.TextRich{},
+	TermDefinitions:         map[string]parser.TextRich{},
+	AbbreviationDefinitions: map[string]string{},
 }
 
 var BlogGenTestStruct = page.Post{
@@ -422,6 +433,7 @@ var BlogGenTestStruct = page.Post{
 	},
 	Lang: "en",
 	TOC: page.TableOfContents{
+		MaxDepth: page.DefaultTOCDepth,
 		Sections: []page.TOCSection{
 			{
 				ID:      "s1",
@@ -0,0 +1,617 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/cvanloo/blog-go/markup/diagnostic"
+)
+
+// JSONVersion is the version of the JSON encoding of blogs and nodes.
+// It changes whenever the encoding changes in a way that older scripts can't
+// read, and decoding any other version fails.
+//
+// A blog is encoded as an object with its version:
+//
+//	{"version": 1, "kind": "blog", "meta": {"title": [[{"kind": "text", "text": "Hello"}]]}, "sections": [...], ...}
+//
+// Nodes are objects tagged with their kind, like section, paragraph, or
+// emphasis-strong, with a span if they have a location, and the fields of
+// their kind:
+//
+//	{"kind": "link", "span": {...}, "name": [{"kind": "text", "text": "link"}], "href": "https://example.org"}
+//
+// Empty fields are left out.
+const JSONVersion = 1
+
+type (
+	// jsonObject is an object being encoded.
+	jsonObject map[string]any
+	// jsonFields is an object being decoded.
+	jsonFields map[string]json.RawMessage
+	// jsonDecoder keeps the first error of decoding, so that the fields can
+	// be decoded one after the other without checking each.
+	jsonDecoder struct {
+		err error
+	}
+)
+
+var alignmentNames = map[Alignment]string{
+	AlignDefault: "default",
+	AlignLeft:    "left",
+	AlignCenter:  "center",
+	AlignRight:   "right",
+}
+
+// MarshalJSON encodes the blog as described by JSONVersion.
+func (b *Blog) MarshalJSON() ([]byte, error) {
+	return json.Marshal(encodeBlog(b))
+}
+
+// UnmarshalJSON decodes a blog encoded by MarshalJSON.
+func (b *Blog) UnmarshalJSON(data []byte) error {
+	d := &jsonDecoder{}
+	decoded := d.blog(data)
+	if d.err != nil {
+		return d.err
+	}
+	*b = *decoded
+	return nil
+}
+
+// MarshalNodeJSON encodes a single node, like it is encoded as part of a blog.
+func MarshalNodeJSON(node Node) ([]byte, error) {
+	return json.Marshal(encodeNode(node))
+}
+
+// UnmarshalNodeJSON decodes a single node encoded by MarshalNodeJSON.
+func UnmarshalNodeJSON(data []byte) (Node, error) {
+	d := &jsonDecoder{}
+	node := d.node(data)
+	return node, d.err
+}
+
+// set adds the field, unless its value is empty.
+func (o jsonObject) set(key string, value any) jsonObject {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return o
+		}
+	case int:
+		if v == 0 {
+			return o
+		}
+	case bool:
+		if !v {
+			return o
+		}
+	case []any:
+		if len(v) == 0 {
+			return o
+		}
+	case []string:
+		if len(v) == 0 {
+			return o
+		}
+	case Attributes:
+		if len(v) == 0 {
+			return o
+		}
+	case jsonObject:
+		if len(v) == 0 {
+			return o
+		}
+	case diagnostic.Span:
+		if v.IsZero() {
+			return o
+		}
+	}
+	o[key] = value
+	return o
+}
+
+func encodeBlog(b *Blog) jsonObject {
+	meta := jsonObject{}
+	for key, values := range b.Meta {
+		meta[key] = encodeTexts(values)
+	}
+	sidenotes := jsonObject{}
+	for ref, content := range b.SidenoteDefinitions {
+		sidenotes[ref] = encodeNodes(content)
+	}
+	footnotes := jsonObject{}
+	for ref, paragraphs := range b.FootnoteDefinitions {
+		footnotes[ref] = encodeTexts(paragraphs)
+	}
+	terms := jsonObject{}
+	for term, definition := range b.TermDefinitions {
+		terms[term] = encodeNodes(definition)
+	}
+	var sections, htmls, endnotes []any
+	for _, s := range b.Sections {
+		sections = append(sections, encodeNode(s))
+	}
+	for _, h := range b.Htmls {
+		htmls = append(htmls, encodeNode(h))
+	}
+	for _, e := range b.Endnotes {
+		endnotes = append(endnotes, jsonObject{}.
+			set("ref", e.Ref).
+			set("number", e.Number).
+			set("uses", e.Uses).
+			set("paragraphs", encodeTexts(e.Paragraphs)))
+	}
+	locations := jsonObject{}.
+		set("meta", spanMap(b.Locations.Meta)).
+		set("linkDefinitions", spanMap(b.Locations.LinkDefinitions)).
+		set("sidenoteDefinitions", spanMap(b.Locations.SidenoteDefinitions)).
+		set("abbreviationDefinitions", spanMap(b.Locations.AbbreviationDefinitions))
+	return jsonObject{"version": JSONVersion, "kind": "blog"}.
+		set("span", b.Span).
+		set("meta", meta).
+		set("sections", sections).
+		set("htmls", htmls).
+		set("linkDefinitions", stringMap(b.LinkDefinitions)).
+		set("sidenoteDefinitions", sidenotes).
+		set("footnoteDefinitions", footnotes).
+		set("termDefinitions", terms).
+		set("abbreviationDefinitions", stringMap(b.AbbreviationDefinitions)).
+		set("endnotes", endnotes).
+		set("locations", locations)
+}
+
+func stringMap(m map[string]string) jsonObject {
+	o := jsonObject{}
+	for key, value := range m {
+		o[key] = value
+	}
+	return o
+}
+
+func spanMap[S diagnostic.Span | []diagnostic.Span](m map[string]S) jsonObject {
+	o := jsonObject{}
+	for key, value := range m {
+		o[key] = value
+	}
+	return o
+}
+
+func encodeNodes[T ~[]Node](nodes T) []any {
+	encoded := []any{}
+	for _, node := range nodes {
+		encoded = append(encoded, encodeNode(node))
+	}
+	return encoded
+}
+
+func encodeTexts[T ~[]Node](texts []T) []any {
+	encoded := []any{}
+	for _, text := range texts {
+		encoded = append(encoded, encodeNodes(text))
+	}
+	return encoded
+}
+
+func encodeNode(node Node) jsonObject {
+	o := func(kind string, span diagnostic.Span) jsonObject {
+		return jsonObject{"kind": kind}.set("span", span)
+	}
+	switch n := node.(type) {
+	case *Section:
+		return o("section", n.Span).
+			set("attributes", n.Attributes).
+			set("level", n.Level).
+			set("heading", encodeNodes(n.Heading)).
+			set("content", encodeNodes(n.Content))
+	case *Paragraph:
+		return o("paragraph", n.Span).
+			set("attributes", n.Attributes).
+			set("content", encodeNodes(n.Content))
+	case *Link:
+		return o("link", n.Span).
+			set("ref", n.Ref).
+			set("name", encodeNodes(n.Name)).
+			set("href", n.Href).
+			set("title", n.Title)
+	case *Sidenote:
+		return o("sidenote", n.Span).
+			set("ref", n.Ref).
+			set("word", encodeNodes(n.Word)).
+			set("content", encodeNodes(n.Content))
+	case *Footnote:
+		return o("footnote", n.Span).
+			set("ref", n.Ref).
+			set("number", n.Number).
+			set("use", n.Use)
+	case *Image:
+		return o("image", n.Span).
+			set("attributes", n.Attributes).
+			set("name", n.Name).
+			set("alt", encodeNodes(n.Alt)).
+			set("title", encodeNodes(n.Title))
+	case *BlockQuote:
+		return o("block-quote", n.Span).
+			set("content", encodeNodes(n.Content)).
+			set("author", encodeNodes(n.Author)).
+			set("source", encodeNodes(n.Source))
+	case *Admonition:
+		return o("admonition", n.Span).
+			set("type", n.Type).
+			set("title", encodeNodes(n.Title)).
+			set("collapsible", n.Collapsible).
+			set("open", n.Open).
+			set("content", encodeNodes(n.Content))
+	case *CodeBlock:
+		return o("code-block", n.Span).
+			set("attributes", n.Attributes).
+			set("lines", n.Lines)
+	case *List:
+		var items []any
+		for _, item := range n.Items {
+			items = append(items, encodeNode(item))
+		}
+		return o("list", n.Span).
+			set("ordered", n.Ordered).
+			set("start", n.Start).
+			set("items", items)
+	case *ListItem:
+		return o("list-item", n.Span).
+			set("task", n.Task).
+			set("checked", n.Checked).
+			set("content", encodeNodes(n.Content))
+	case *Table:
+		var alignments []string
+		for _, a := range n.Alignments {
+			alignments = append(alignments, alignmentNames[a])
+		}
+		var rows []any
+		for _, row := range n.Rows {
+			rows = append(rows, encodeTexts(row))
+		}
+		return o("table", n.Span).
+			set("attributes", n.Attributes).
+			set("alignments", alignments).
+			set("header", encodeTexts(n.Header)).
+			set("rows", rows)
+	case *DefinitionList:
+		var definitions []any
+		for _, d := range n.Definitions {
+			definitions = append(definitions, jsonObject{}.
+				set("term", encodeNodes(d.Term)).
+				set("explanations", encodeTexts(d.Explanations)))
+		}
+		return o("definition-list", n.Span).
+			set("definitions", definitions)
+	case *HorizontalRule:
+		return o("horizontal-rule", n.Span)
+	case *LineBreak:
+		return o("line-break", n.Span)
+	case *Html:
+		return o("html", n.Span).
+			set("attributes", n.Attributes).
+			set("name", n.Name).
+			set("content", encodeNodes(n.Content))
+	case *Math:
+		return o("math", n.Span).
+			set("inline", n.Inline).
+			set("tex", n.TeX)
+	case *Span:
+		return o("span", n.Span).
+			set("attributes", n.Attributes).
+			set("content", encodeNodes(n.Content))
+	case *Ruby:
+		return o("ruby", n.Span).
+			set("kanji", n.Kanji).
+			set("furigana", n.Furigana)
+	case *Abbreviation:
+		return o("abbreviation", n.Span).
+			set("abbr", n.Abbr).
+			set("title", n.Title)
+	case *EnquoteSingle:
+		return o("enquote-single", n.Span).set("content", encodeNodes(n.Content))
+	case *EnquoteDouble:
+		return o("enquote-double", n.Span).set("content", encodeNodes(n.Content))
+	case *EnquoteAngled:
+		return o("enquote-angled", n.Span).set("content", encodeNodes(n.Content))
+	case *Emphasis:
+		return o("emphasis", n.Span).set("content", encodeNodes(n.Content))
+	case *Strong:
+		return o("strong", n.Span).set("content", encodeNodes(n.Content))
+	case *EmphasisStrong:
+		return o("emphasis-strong", n.Span).set("content", encodeNodes(n.Content))
+	case *Strikethrough:
+		return o("strikethrough", n.Span).set("content", encodeNodes(n.Content))
+	case *Marker:
+		return o("marker", n.Span).set("content", encodeNodes(n.Content))
+	case *Text:
+		return o("text", n.Span).set("text", n.Text)
+	case *AmpSpecial:
+		return o("amp-special", n.Span).set("text", n.Text)
+	case *Linkify:
+		return o("linkify", n.Span).set("text", n.Text)
+	case *Mono:
+		return o("mono", n.Span).set("text", n.Text)
+	case *Superscript:
+		return o("superscript", n.Span).set("text", n.Text)
+	case *Subscript:
+		return o("subscript", n.Span).set("text", n.Text)
+	case *Kbd:
+		return o("kbd", n.Span).set("text", n.Text)
+	}
+	panic(fmt.Sprintf("json encoding of %T not implemented", node))
+}
+
+// decode the value into v, absent values are left as they are.
+func (d *jsonDecoder) decode(data json.RawMessage, v any) {
+	if data == nil || d.err != nil {
+		return
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		d.err = err
+	}
+}
+
+func (d *jsonDecoder) fields(data json.RawMessage) (o jsonFields) {
+	d.decode(data, &o)
+	return o
+}
+
+func field[T any](d *jsonDecoder, o jsonFields, key string) (v T) {
+	d.decode(o[key], &v)
+	return v
+}
+
+func (d *jsonDecoder) blog(data json.RawMessage) *Blog {
+	o := d.fields(data)
+	if version := field[int](d, o, "version"); d.err == nil && version != JSONVersion {
+		d.err = fmt.Errorf("unsupported json version %d, expected %d", version, JSONVersion)
+	}
+	if kind := field[string](d, o, "kind"); d.err == nil && kind != "blog" {
+		d.err = fmt.Errorf("expected a blog, got: %q", kind)
+	}
+	b := &Blog{
+		Located:                 Located{Span: field[diagnostic.Span](d, o, "span")},
+		Meta:                    Meta{},
+		LinkDefinitions:         map[string]string{},
+		SidenoteDefinitions:     map[string]TextRich{},
+		FootnoteDefinitions:     map[string][]TextRich{},
+		TermDefinitions:         map[string]TextRich{},
+		AbbreviationDefinitions: map[string]string{},
+		Locations: Locations{
+			Meta:                    map[string][]diagnostic.Span{},
+			LinkDefinitions:         map[string]diagnostic.Span{},
+			SidenoteDefinitions:     map[string]diagnostic.Span{},
+			AbbreviationDefinitions: map[string]diagnostic.Span{},
+		},
+	}
+	for key, values := range field[map[string]json.RawMessage](d, o, "meta") {
+		b.Meta[key] = texts[TextSimple](d, values)
+	}
+	for _, s := range field[[]json.RawMessage](d, o, "sections") {
+		b.Sections = append(b.Sections, nodeOf[*Section](d, s))
+	}
+	for _, h := range field[[]json.RawMessage](d, o, "htmls") {
+		b.Htmls = append(b.Htmls, nodeOf[*Html](d, h))
+	}
+	d.decode(o["linkDefinitions"], &b.LinkDefinitions)
+	for ref, content := range field[map[string]json.RawMessage](d, o, "sidenoteDefinitions") {
+		b.SidenoteDefinitions[ref] = TextRich(d.nodes(content))
+	}
+	for ref, paragraphs := range field[map[string]json.RawMessage](d, o, "footnoteDefinitions") {
+		b.FootnoteDefinitions[ref] = texts[TextRich](d, paragraphs)
+	}
+	for term, definition := range field[map[string]json.RawMessage](d, o, "termDefinitions") {
+		b.TermDefinitions[term] = TextRich(d.nodes(definition))
+	}
+	d.decode(o["abbreviationDefinitions"], &b.AbbreviationDefinitions)
+	for _, e := range field[[]json.RawMessage](d, o, "endnotes") {
+		e := d.fields(e)
+		b.Endnotes = append(b.Endnotes, &Endnote{
+			Ref:        field[string](d, e, "ref"),
+			Number:     field[int](d, e, "number"),
+			Uses:       field[int](d, e, "uses"),
+			Paragraphs: texts[TextRich](d, e["paragraphs"]),
+		})
+	}
+	locations := field[jsonFields](d, o, "locations")
+	d.decode(locations["meta"], &b.Locations.Meta)
+	d.decode(locations["linkDefinitions"], &b.Locations.LinkDefinitions)
+	d.decode(locations["sidenoteDefinitions"], &b.Locations.SidenoteDefinitions)
+	d.decode(locations["abbreviationDefinitions"], &b.Locations.AbbreviationDefinitions)
+	return b
+}
+
+func (d *jsonDecoder) nodes(data json.RawMessage) (nodes []Node) {
+	for _, node := range field[[]json.RawMessage](d, jsonFields{"nodes": data}, "nodes") {
+		nodes = append(nodes, d.node(node))
+	}
+	return nodes
+}
+
+func texts[T ~[]Node](d *jsonDecoder, data json.RawMessage) (texts []T) {
+	for _, text := range field[[]json.RawMessage](d, jsonFields{"texts": data}, "texts") {
+		texts = append(texts, T(d.nodes(text)))
+	}
+	return texts
+}
+
+// nodeOf decodes a node that must be of type T, like the items of a list.
+func nodeOf[T Node](d *jsonDecoder, data json.RawMessage) T {
+	node := d.node(data)
+	t, ok := node.(T)
+	if !ok && d.err == nil {
+		d.err = fmt.Errorf("expected a %T, got: %T", t, node)
+	}
+	return t
+}
+
+func (d *jsonDecoder) node(data json.RawMessage) Node {
+	o := d.fields(data)
+	located := Located{Span: field[diagnostic.Span](d, o, "span")}
+	attributes := field[Attributes](d, o, "attributes")
+	content := func() []Node { return d.nodes(o["content"]) }
+	text := func() string { return field[string](d, o, "text") }
+	kind := field[string](d, o, "kind")
+	switch kind {
+	case "section":
+		return &Section{
+			Located:    located,
+			Attributes: attributes,
+			Level:      field[int](d, o, "level"),
+			Heading:    d.nodes(o["heading"]),
+			Content:    content(),
+		}
+	case "paragraph":
+		return &Paragraph{Located: located, Attributes: attributes, Content: content()}
+	case "link":
+		return &Link{
+			Located: located,
+			Ref:     field[string](d, o, "ref"),
+			Name:    d.nodes(o["name"]),
+			Href:    field[string](d, o, "href"),
+			Title:   field[string](d, o, "title"),
+		}
+	case "sidenote":
+		return &Sidenote{
+			Located: located,
+			Ref:     field[string](d, o, "ref"),
+			Word:    d.nodes(o["word"]),
+			Content: content(),
+		}
+	case "footnote":
+		return &Footnote{
+			Located: located,
+			Ref:     field[string](d, o, "ref"),
+			Number:  field[int](d, o, "number"),
+			Use:     field[int](d, o, "use"),
+		}
+	case "image":
+		return &Image{
+			Located:    located,
+			Attributes: attributes,
+			Name:       field[string](d, o, "name"),
+			Alt:        d.nodes(o["alt"]),
+			Title:      d.nodes(o["title"]),
+		}
+	case "block-quote":
+		return &BlockQuote{
+			Located: located,
+			Content: content(),
+			Author:  d.nodes(o["author"]),
+			Source:  d.nodes(o["source"]),
+		}
+	case "admonition":
+		return &Admonition{
+			Located:     located,
+			Type:        field[string](d, o, "type"),
+			Title:       d.nodes(o["title"]),
+			Collapsible: field[bool](d, o, "collapsible"),
+			Open:        field[bool](d, o, "open"),
+			Content:     content(),
+		}
+	case "code-block":
+		return &CodeBlock{Located: located, Attributes: attributes, Lines: field[[]string](d, o, "lines")}
+	case "list":
+		list := &List{
+			Located: located,
+			Ordered: field[bool](d, o, "ordered"),
+			Start:   field[int](d, o, "start"),
+		}
+		for _, item := range field[[]json.RawMessage](d, o, "items") {
+			list.Items = append(list.Items, nodeOf[*ListItem](d, item))
+		}
+		return list
+	case "list-item":
+		return &ListItem{
+			Located: located,
+			Task:    field[bool](d, o, "task"),
+			Checked: field[bool](d, o, "checked"),
+			Content: content(),
+		}
+	case "table":
+		table := &Table{
+			Located:    located,
+			Attributes: attributes,
+			Header:     texts[TextRich](d, o["header"]),
+		}
+		for _, name := range field[[]string](d, o, "alignments") {
+			alignment, ok := alignmentByName(name)
+			if !ok && d.err == nil {
+				d.err = fmt.Errorf("unknown table alignment: %q", name)
+			}
+			table.Alignments = append(table.Alignments, alignment)
+		}
+		for _, row := range field[[]json.RawMessage](d, o, "rows") {
+			table.Rows = append(table.Rows, texts[TextRich](d, row))
+		}
+		return table
+	case "definition-list":
+		list := &DefinitionList{Located: located}
+		for _, definition := range field[[]json.RawMessage](d, o, "definitions") {
+			definition := d.fields(definition)
+			list.Definitions = append(list.Definitions, &Definition{
+				Term:         d.nodes(definition["term"]),
+				Explanations: texts[TextRich](d, definition["explanations"]),
+			})
+		}
+		return list
+	case "horizontal-rule":
+		return &HorizontalRule{Located: located}
+	case "line-break":
+		return &LineBreak{Located: located}
+	case "html":
+		return &Html{Located: located, Attributes: attributes, Name: field[string](d, o, "name"), Content: content()}
+	case "math":
+		return &Math{Located: located, Inline: field[bool](d, o, "inline"), TeX: field[string](d, o, "tex")}
+	case "span":
+		return &Span{Located: located, Attributes: attributes, Content: content()}
+	case "ruby":
+		return &Ruby{Located: located, Kanji: field[[]string](d, o, "kanji"), Furigana: field[[]string](d, o, "furigana")}
+	case "abbreviation":
+		return &Abbreviation{Located: located, Abbr: field[string](d, o, "abbr"), Title: field[string](d, o, "title")}
+	case "enquote-single":
+		return &EnquoteSingle{Located: located, Content: content()}
+	case "enquote-double":
+		return &EnquoteDouble{Located: located, Content: content()}
+	case "enquote-angled":
+		return &EnquoteAngled{Located: located, Content: content()}
+	case "emphasis":
+		return &Emphasis{Located: located, Content: content()}
+	case "strong":
+		return &Strong{Located: located, Content: content()}
+	case "emphasis-strong":
+		return &EmphasisStrong{Located: located, Content: content()}
+	case "strikethrough":
+		return &Strikethrough{Located: located, Content: content()}
+	case "marker":
+		return &Marker{Located: located, Content: content()}
+	case "text":
+		return &Text{Located: located, Text: text()}
+	case "amp-special":
+		return &AmpSpecial{Located: located, Text: text()}
+	case "linkify":
+		return &Linkify{Located: located, Text: text()}
+	case "mono":
+		return &Mono{Located: located, Text: text()}
+	case "superscript":
+		return &Superscript{Located: located, Text: text()}
+	case "subscript":
+		return &Subscript{Located: located, Text: text()}
+	case "kbd":
+		return &Kbd{Located: located, Text: text()}
+	}
+	if d.err == nil {
+		d.err = fmt.Errorf("unknown node kind: %q", kind)
+	}
+	return &Text{} // keeps the tree walkable until the error is seen
+}
+
+func alignmentByName(name string) (Alignment, bool) {
+	for alignment, n := range alignmentNames {
+		if n == name {
+			return alignment, true
+		}
+	}
+	return AlignDefault, false
+}
@@ -0,0 +1,203 @@
+package parser_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/cvanloo/blog-go/markup"
+	"github.com/cvanloo/blog-go/markup/lexer"
+	"github.com/cvanloo/blog-go/markup/parser"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	lx := lexer.New()
+	lx.LexSource("test.md", markup.BlogTestSource)
+	blog, err := parser.Parse(lx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blog.Accept(&parser.FixReferencesVisitor{})
+	encoded, err := json.Marshal(blog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded parser.Blog
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	// empty fields are left out
+	deep.NilMapsAreEmpty = true
+	deep.NilSlicesAreEmpty = true
+	defer func() {
+		deep.NilMapsAreEmpty = false
+		deep.NilSlicesAreEmpty = false
+	}()
+	if diff := deep.Equal(blog, &decoded); diff != nil {
+		t.Error(diff)
+	}
+	// deep doesn't compare the locations, but encoding them again does
+	again, err := json.Marshal(&decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, again) {
+		t.Errorf("encoding is not stable:\n%s\n--- then:\n%s", encoded, again)
+	}
+}
+
+// everyNodeSource contains every kind of node, so that all of them are
+// encoded and decoded again.
+const everyNodeSource = `---
+url-path: all
+title: Every Node
+author: Colin
+lang: en
+---
+
+# Inline {#inline}
+
+Text with *emphasis*, **strong**, ***both***, ~~struck~~, ==marked==, ` + "`" + `mono` + "`" + `, $e^{i\pi}$ and
+a line break\
+after it, a [link](https://example.org "Example"), a [reference][ref], <https://go.dev>,
+a [span]{.c lang=ja}, {漢字|かん|じ}, [[Ctrl]]+[[C]], 2^10^, x (~i~), HTML, a word[^sn]
+and a footnote [^fn], "double", ` + "``" + `also double'', ` + "`" + `single' and <<angled>>---done.
+{#para .lead}
+
+$$
+\sum_i x_i
+$$
+
+*[HTML]: HyperText Markup Language
+
+[ref]: https://example.org/ref
+[^sn]: A sidenote.
+[^fn]: A footnote.
+
+    With a second paragraph.
+
+## Blocks
+
+<Note type="info">
+A note.
+</Note>
+
+- one
+- two
+
+1. first
+2. second
+
+| Name | Value |
+|:-----|------:|
+| a | 1 |
+{#t caption="Table"}
+
+Term
+: Explanation.
+
+!!! warning "Careful"
+    Inside.
+
+> Quoted.
+> -- Someone, Somewhere
+
+` + "``" + `` + "`" + `go {hl=1}
+fmt.Println("hi")
+` + "``" + `` + "`" + `
+
+![Alt](cat.jpg "Title")
+
+---
+
+After the rule.
+`
+
+func TestJSONRoundTripEveryNode(t *testing.T) {
+	lx := lexer.New()
+	lx.LexSource("every.md", everyNodeSource)
+	blog, err := parser.Parse(lx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refFixer := &parser.FixReferencesVisitor{}
+	blog.Accept(refFixer)
+	if refFixer.Errors != nil {
+		t.Fatal(refFixer.Errors)
+	}
+	encoded, err := json.Marshal(blog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := []string{
+		"section", "paragraph", "link", "sidenote", "footnote", "image", "block-quote", "admonition",
+		"code-block", "list", "list-item", "table", "definition-list", "horizontal-rule", "line-break",
+		"html", "math", "span", "ruby", "abbreviation", "enquote-single", "enquote-double",
+		"enquote-angled", "emphasis", "strong", "emphasis-strong", "strikethrough", "marker", "text",
+		"amp-special", "linkify", "mono", "superscript", "subscript", "kbd",
+	}
+	for _, kind := range kinds {
+		if !bytes.Contains(encoded, []byte(`"kind":"`+kind+`"`)) {
+			t.Errorf("the source contains no node of kind %s", kind)
+		}
+	}
+	var decoded parser.Blog
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	deep.NilMapsAreEmpty = true
+	deep.NilSlicesAreEmpty = true
+	defer func() {
+		deep.NilMapsAreEmpty = false
+		deep.NilSlicesAreEmpty = false
+	}()
+	if diff := deep.Equal(blog, &decoded); diff != nil {
+		t.Error(diff)
+	}
+	again, err := json.Marshal(&decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, again) {
+		t.Errorf("encoding is not stable:\n%s\n--- then:\n%s", encoded, again)
+	}
+}
+
+func TestJSONNode(t *testing.T) {
+	link := &parser.Link{
+		Name: parser.TextRich{&parser.Text{Text: "a "}, &parser.Emphasis{Content: parser.TextRich{&parser.Text{Text: "link"}}}},
+		Href: "https://example.org",
+	}
+	expected := `{"href":"https://example.org","kind":"link","name":[{"kind":"text","text":"a "},{"content":[{"kind":"text","text":"link"}],"kind":"emphasis"}]}`
+	encoded, err := parser.MarshalNodeJSON(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(encoded) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, encoded)
+	}
+	decoded, err := parser.UnmarshalNodeJSON(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(link, decoded); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	for _, src := range []string{
+		`{"version": 2, "kind": "blog"}`,
+		`{"version": 1, "kind": "section"}`,
+		`{"version": 1, "kind": "blog", "sections": [{"kind": "paragraph"}]}`,
+		`{"version": 1, "kind": "blog", "sections": [{"kind": "section", "content": [{"kind": "unknown"}]}]}`,
+		`{"version": 1, "kind": "blog", "meta": {"title": "not a list"}}`,
+	} {
+		var blog parser.Blog
+		if err := json.Unmarshal([]byte(src), &blog); err == nil {
+			t.Errorf("expected an error decoding: %s", src)
+		}
+	}
+}
@@ -1,13 +1,20 @@
 package parser
 
 import (
+	"cmp"
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	//"github.com/kr/pretty"
 
 	. "github.com/cvanloo/blog-go/assert"
+	"github.com/cvanloo/blog-go/markup/diagnostic"
 	"github.com/cvanloo/blog-go/markup/lexer"
 )
 
@@ -51,6 +58,8 @@ type (
 		LeaveParagraph(*Paragraph)
 		VisitLink(*Link)
 		VisitSidenote(*Sidenote)
+		VisitFootnote(*Footnote)
+		VisitEnquoteSingle(*EnquoteSingle)
 		VisitEnquoteDouble(*EnquoteDouble)
 		VisitEnquoteAngled(*EnquoteAngled)
 		VisitEmphasis(*Emphasis)
@@ -58,65 +67,220 @@ type (
 		VisitEmphasisStrong(*EmphasisStrong)
 		VisitStrikethrough(*Strikethrough)
 		VisitMarker(*Marker)
+		VisitSpan(*Span)
+		VisitRuby(*Ruby)
+		VisitSuperscript(*Superscript)
+		VisitSubscript(*Subscript)
+		VisitKbd(*Kbd)
+		VisitAbbreviation(*Abbreviation)
 		VisitMono(*Mono)
+		VisitMath(*Math)
 		VisitText(*Text)
 		VisitAmpSpecial(*AmpSpecial)
 		VisitLinkify(*Linkify)
 		VisitImage(*Image)
 		VisitBlockQuote(*BlockQuote)
+		LeaveBlockQuote(*BlockQuote)
+		VisitAdmonition(*Admonition)
+		LeaveAdmonition(*Admonition)
 		VisitCodeBlock(*CodeBlock)
 		VisitHorizontalRule(*HorizontalRule)
 		VisitLineBreak(*LineBreak)
 		VisitHtml(*Html)
 		LeaveHtml(*Html)
+		VisitList(*List)
+		LeaveList(*List)
+		VisitListItem(*ListItem)
+		LeaveListItem(*ListItem)
+		VisitTable(*Table)
+		LeaveTable(*Table)
+		VisitDefinitionList(*DefinitionList)
+		LeaveDefinitionList(*DefinitionList)
 	}
 
 	Attributes map[string]string
-	Section    struct {
+	// Located records the part of the source a node was parsed from.
+	// The span is zero for nodes that were not made by the parser.
+	Located struct {
+		Span diagnostic.Span `deep:"-"`
+	}
+	Section struct {
+		Located
 		Attributes
 		Level   int
 		Heading TextRich
 		Content []Node
 	}
 	Paragraph struct {
+		Located
+		Attributes
 		Content []Node
 	}
 	Link struct {
-		Ref  string
-		Name TextRich
-		Href string
+		Located
+		Ref   string
+		Name  TextRich
+		Href  string
+		Title string
 	}
 	Sidenote struct {
+		Located
 		Ref           string
 		Word, Content TextRich
 	}
+	Footnote struct {
+		Located
+		Ref    string
+		Number int // assigned by FixReferencesVisitor, in order of first use
+		Use    int // counts the references to the same footnote, starting at 1
+	}
+	Endnote struct {
+		Ref        string
+		Number     int
+		Uses       int // how often the footnote is referenced
+		Paragraphs []TextRich
+	}
 	Image struct {
+		Located
+		Attributes
 		Name       string
 		Alt, Title TextSimple
 	}
 	BlockQuote struct {
-		QuoteText TextRich
-		Author    TextSimple
-		Source    TextRich
+		Located
+		Content []Node // any block content, including nested block quotes
+		Author  TextSimple
+		Source  TextRich
+	}
+	// Admonition is a box calling out its content, like a note or a warning.
+	Admonition struct {
+		Located
+		Type        string     // one of info, warning, danger or tip
+		Title       TextSimple // optional, defaults to the type
+		Collapsible bool
+		Open        bool // whether a collapsible admonition is initially expanded
+		Content     []Node
 	}
 	CodeBlock struct {
+		Located
 		Attributes
 		Lines []string
 	}
-	HorizontalRule struct{}
-	LineBreak      struct{}
-	EnquoteDouble  TextRich
-	EnquoteAngled  TextRich
-	Emphasis       TextRich
-	Strong         TextRich
-	EmphasisStrong TextRich
-	Strikethrough  TextRich
-	Marker         TextRich
-	Mono           string
-	Text           string
-	AmpSpecial     string
-	Linkify        string
-	Html           struct {
+	List struct {
+		Located
+		Ordered bool
+		Start   int // number of the first item of an ordered list
+		Items   []*ListItem
+	}
+	ListItem struct {
+		Located
+		Task, Checked bool
+		Content       []Node
+	}
+	Table struct {
+		Located
+		Attributes
+		Alignments []Alignment // one per column
+		Header     []TextRich
+		Rows       [][]TextRich // each row has exactly one cell per column
+	}
+	Alignment      int
+	DefinitionList struct {
+		Located
+		Definitions []*Definition
+	}
+	Definition struct {
+		Term         TextRich
+		Explanations []TextRich
+	}
+	HorizontalRule struct {
+		Located
+	}
+	LineBreak struct {
+		Located
+	}
+	EnquoteSingle struct {
+		Located
+		Content TextRich
+	}
+	EnquoteDouble struct {
+		Located
+		Content TextRich
+	}
+	EnquoteAngled struct {
+		Located
+		Content TextRich
+	}
+	Emphasis struct {
+		Located
+		Content TextRich
+	}
+	Strong struct {
+		Located
+		Content TextRich
+	}
+	EmphasisStrong struct {
+		Located
+		Content TextRich
+	}
+	Strikethrough struct {
+		Located
+		Content TextRich
+	}
+	Marker struct {
+		Located
+		Content TextRich
+	}
+	Mono struct {
+		Located
+		Text string
+	}
+	Math struct {
+		Located
+		Inline bool
+		TeX    string
+	}
+	Span struct {
+		Located
+		Attributes
+		Content TextRich
+	}
+	// Ruby annotates each Kanji with the Furigana of the same index.
+	Ruby struct {
+		Located
+		Kanji, Furigana []string
+	}
+	// Abbreviation is an occurrence of an abbreviation defined as *[Abbr]: Title
+	Abbreviation struct {
+		Located
+		Abbr, Title string
+	}
+	Text struct {
+		Located
+		Text string
+	}
+	AmpSpecial struct {
+		Located
+		Text string
+	}
+	Linkify struct {
+		Located
+		Text string
+	}
+	Superscript struct {
+		Located
+		Text string
+	}
+	Subscript struct {
+		Located
+		Text string
+	}
+	Kbd struct {
+		Located
+		Text string
+	}
+	Html struct {
+		Located
 		Attributes
 		Name    string
 		Content []Node
@@ -125,28 +289,106 @@ type (
 	NopVisitor           struct{}
 	FixReferencesVisitor struct {
 		NopVisitor
-		Errors              error
-		LinkDefinitions     map[string]string
-		SidenoteDefinitions map[string]TextRich
-		TermDefinitions     map[string]TextRich
+		Errors                  error
+		LinkDefinitions         map[string]string
+		SidenoteDefinitions     map[string]TextRich
+		FootnoteDefinitions     map[string][]TextRich
+		TermDefinitions         map[string]TextRich
+		AbbreviationDefinitions map[string]string
+		abbreviations           []string        // defined abbreviations, longest first
+		used                    map[string]bool // sidenote and footnote definitions that are referenced
+		resolved                map[string]bool // sidenote and footnote definitions whose content has been visited, false while it is being visited
+		definitionLocations     map[string]diagnostic.Span
+		endnotes                map[string]*Endnote
+		orderedEndnotes         []*Endnote
 	}
 
 	Blog struct {
-		Meta                Meta
-		Sections            []*Section
-		Htmls               []*Html
-		LinkDefinitions     map[string]string
-		SidenoteDefinitions map[string]TextRich
-		TermDefinitions     map[string]TextRich
+		Located                 // the whole document
+		Meta                    Meta
+		Sections                []*Section
+		Htmls                   []*Html
+		LinkDefinitions         map[string]string
+		SidenoteDefinitions     map[string]TextRich
+		FootnoteDefinitions     map[string][]TextRich // all paragraphs of a [^ref]: definition
+		TermDefinitions         map[string]TextRich
+		AbbreviationDefinitions map[string]string
+		Endnotes                []*Endnote              // referenced footnotes ordered by number, filled in by FixReferencesVisitor
+		Locations               Locations               `deep:"-"`
+		Warnings                []diagnostic.Diagnostic `deep:"-"` // problems found while parsing that don't stop the build, like excess table cells
+	}
+	// Locations records where the parts of a blog that aren't nodes were defined.
+	Locations struct {
+		Meta                    map[string][]diagnostic.Span // the keys, in the same order as their values in Blog.Meta
+		LinkDefinitions         map[string]diagnostic.Span
+		SidenoteDefinitions     map[string]diagnostic.Span // also footnote definitions
+		AbbreviationDefinitions map[string]diagnostic.Span
 	}
 	Meta map[string][]TextSimple // slice value to allow for duplicate keys
 )
 
+const (
+	AlignDefault Alignment = iota
+	AlignLeft
+	AlignCenter
+	AlignRight
+)
+
+// alignmentFromDelimiter determines the column alignment from a table delimiter, like `:--`, `:-:`, or `--:`.
+func alignmentFromDelimiter(delim string) Alignment {
+	left := strings.HasPrefix(delim, ":")
+	right := strings.HasSuffix(delim, ":")
+	switch {
+	default:
+		return AlignDefault
+	case left && right:
+		return AlignCenter
+	case left:
+		return AlignLeft
+	case right:
+		return AlignRight
+	}
+}
+
+// fitColumns pads or truncates a table row to the given number of cells.
+func fitColumns(row []TextRich, columns int) []TextRich {
+	for len(row) < columns {
+		row = append(row, TextRich{})
+	}
+	return row[:columns]
+}
+
+// AdmonitionTypes are the types an Admonition can have.
+var AdmonitionTypes = []string{"info", "warning", "danger", "tip"}
+
+// newAdmonition makes an admonition from its begin marker, which is one of `!!!`, `???` or `???+`.
+func newAdmonition(begin lexer.Token) *Admonition {
+	return &Admonition{
+		Collapsible: begin.Text != "!!!",
+		Open:        begin.Text == "???+",
+	}
+}
+
+// trimTrailingSpace removes whitespace from the end of the last text node.
+func trimTrailingSpace(t TextRich) TextRich {
+	if len(t) == 0 {
+		return t
+	}
+	if text, ok := t[len(t)-1].(*Text); ok {
+		trimmed := strings.TrimRight(text.Text, " \t\n")
+		if len(trimmed) == 0 {
+			return t[:len(t)-1]
+		}
+		t[len(t)-1] = &Text{Located: text.Located, Text: trimmed}
+	}
+	return t
+}
+
 func getText(t TextSimple) (string, bool) {
 	var builder strings.Builder
 	for _, n := range t {
 		if e, ok := n.(*Text); ok {
-			builder.WriteString(string(*e))
+			builder.WriteString(e.Text)
 		} else {
 			return builder.String(), false
 		}
@@ -154,6 +396,15 @@ func getText(t TextSimple) (string, bool) {
 	return builder.String(), true
 }
 
+// MetaLocation is the location of the i-th definition of the meta key, or of
+// the whole document if there is no such definition.
+func (b *Blog) MetaLocation(key string, i int) diagnostic.Span {
+	if spans := b.Locations.Meta[key]; i < len(spans) {
+		return spans[i]
+	}
+	return b.Location()
+}
+
 func (m Meta) Template() (string, bool) {
 	ts, ok := m["template"]
 	if !ok {
@@ -165,6 +416,26 @@ func (m Meta) Template() (string, bool) {
 	return getText(ts[0])
 }
 
+// Merge copies all attributes from other into a, overwriting existing keys.
+func (a Attributes) Merge(other Attributes) {
+	for k, v := range other {
+		a[k] = v
+	}
+}
+
+// set assigns val to key.
+// A key of the form .name without value adds name to the class attribute instead.
+func (a Attributes) set(key, val string) {
+	if class, ok := strings.CutPrefix(key, "."); ok && len(class) > 0 && len(val) == 0 {
+		if classes := a["class"]; len(classes) > 0 {
+			class = classes + " " + class
+		}
+		a["class"] = class
+		return
+	}
+	a[key] = val
+}
+
 func (t *TextSimple) Append(n Node) bool {
 	switch n.(type) {
 	default:
@@ -179,9 +450,14 @@ func (t *TextRich) Append(n Node) bool {
 	switch n.(type) {
 	default:
 		return false
-	case *Text, *AmpSpecial, *Emphasis, *Strong, *EmphasisStrong, *Link, *Sidenote, *Strikethrough, *Marker, *Mono, *Linkify, *EnquoteDouble, *EnquoteAngled, *LineBreak:
+	case *Text, *AmpSpecial, *Emphasis, *Strong, *EmphasisStrong, *Link, *Sidenote, *Strikethrough, *Marker, *Span, *Ruby, *Superscript, *Subscript, *Kbd, *Abbreviation, *Mono, *Math, *Linkify, *EnquoteSingle, *EnquoteDouble, *EnquoteAngled, *LineBreak:
 		*t = append(*t, n)
 		return true
+	case *Footnote:
+		// the marker is separated by a space from the preceding word (to
+		// distinguish it from a sidenote), but rendered right after it
+		*t = append(trimTrailingSpace(*t), n)
+		return true
 	}
 }
 
@@ -189,32 +465,45 @@ func isTextNode(token lexer.Token) bool {
 	switch token.Type {
 	default:
 		return false
-	case lexer.TokenMono, lexer.TokenText, lexer.TokenAmpSpecial, lexer.TokenLinkify, lexer.TokenLineBreak, lexer.TokenImageAltText, lexer.TokenImageTitle:
+	case lexer.TokenMono, lexer.TokenSuperscript, lexer.TokenSubscript, lexer.TokenKbd, lexer.TokenMathInline, lexer.TokenMathDisplay, lexer.TokenFootnoteRef, lexer.TokenText, lexer.TokenAmpSpecial, lexer.TokenLinkify, lexer.TokenLineBreak, lexer.TokenImageAltText, lexer.TokenImageTitle, lexer.TokenAdmonitionTitle:
 		// @todo: what else is a text node?
 		return true
 	}
-	panic("unreachable")
 }
 
 func newTextNode(lexeme lexer.Token) Node {
 	Assert(isTextNode(lexeme), fmt.Sprintf("cannot make text node out of %s", lexeme.Type))
 	switch lexeme.Type {
 	case lexer.TokenMono:
-		return AsRef(Mono(lexeme.Text))
+		return &Mono{Located: located(lexeme, lexeme), Text: lexeme.Text}
+	case lexer.TokenSuperscript:
+		return &Superscript{Located: located(lexeme, lexeme), Text: lexeme.Text}
+	case lexer.TokenSubscript:
+		return &Subscript{Located: located(lexeme, lexeme), Text: lexeme.Text}
+	case lexer.TokenKbd:
+		return &Kbd{Located: located(lexeme, lexeme), Text: strings.TrimSpace(lexeme.Text)}
+	case lexer.TokenMathInline:
+		return &Math{Located: located(lexeme, lexeme), Inline: true, TeX: strings.TrimSpace(lexeme.Text)}
+	case lexer.TokenMathDisplay:
+		return &Math{Located: located(lexeme, lexeme), Inline: false, TeX: strings.TrimSpace(lexeme.Text)}
+	case lexer.TokenFootnoteRef:
+		return &Footnote{Located: located(lexeme, lexeme), Ref: lexeme.Text}
 	case lexer.TokenText:
-		return AsRef(Text(lexeme.Text))
+		return &Text{Located: located(lexeme, lexeme), Text: lexeme.Text}
 	case lexer.TokenLinkify:
-		return AsRef(Linkify(lexeme.Text))
+		return &Linkify{Located: located(lexeme, lexeme), Text: lexeme.Text}
 	case lexer.TokenAmpSpecial:
-		return AsRef(AmpSpecial(lexeme.Text))
+		return &AmpSpecial{Located: located(lexeme, lexeme), Text: lexeme.Text}
 	case lexer.TokenLineBreak:
-		return AsRef(LineBreak{})
+		return &LineBreak{Located: located(lexeme, lexeme)}
 	case lexer.TokenImageAltText:
 		// @todo: really? ^
-		return AsRef(Text(lexeme.Text))
+		return &Text{Located: located(lexeme, lexeme), Text: lexeme.Text}
 	case lexer.TokenImageTitle:
 		// @todo: really? ^
-		return AsRef(Text(lexeme.Text))
+		return &Text{Located: located(lexeme, lexeme), Text: lexeme.Text}
+	case lexer.TokenAdmonitionTitle:
+		return &Text{Located: located(lexeme, lexeme), Text: lexeme.Text}
 	}
 	panic("unreachable")
 }
@@ -254,6 +543,14 @@ func (s *Sidenote) Accept(v Visitor) {
 	v.VisitSidenote(s)
 }
 
+func (f *Footnote) Accept(v Visitor) {
+	v.VisitFootnote(f)
+}
+
+func (e *EnquoteSingle) Accept(v Visitor) {
+	v.VisitEnquoteSingle(e)
+}
+
 func (e *EnquoteDouble) Accept(v Visitor) {
 	v.VisitEnquoteDouble(e)
 }
@@ -282,10 +579,38 @@ func (m *Marker) Accept(v Visitor) {
 	v.VisitMarker(m)
 }
 
+func (s *Span) Accept(v Visitor) {
+	v.VisitSpan(s)
+}
+
+func (r *Ruby) Accept(v Visitor) {
+	v.VisitRuby(r)
+}
+
+func (s *Superscript) Accept(v Visitor) {
+	v.VisitSuperscript(s)
+}
+
+func (s *Subscript) Accept(v Visitor) {
+	v.VisitSubscript(s)
+}
+
+func (k *Kbd) Accept(v Visitor) {
+	v.VisitKbd(k)
+}
+
+func (a *Abbreviation) Accept(v Visitor) {
+	v.VisitAbbreviation(a)
+}
+
 func (m *Mono) Accept(v Visitor) {
 	v.VisitMono(m)
 }
 
+func (m *Math) Accept(v Visitor) {
+	v.VisitMath(m)
+}
+
 func (t *Text) Accept(v Visitor) {
 	v.VisitText(t)
 }
@@ -304,6 +629,18 @@ func (i *Image) Accept(v Visitor) {
 
 func (b *BlockQuote) Accept(v Visitor) {
 	v.VisitBlockQuote(b)
+	for _, c := range b.Content {
+		c.Accept(v)
+	}
+	v.LeaveBlockQuote(b)
+}
+
+func (a *Admonition) Accept(v Visitor) {
+	v.VisitAdmonition(a)
+	for _, c := range a.Content {
+		c.Accept(v)
+	}
+	v.LeaveAdmonition(a)
 }
 
 func (c *CodeBlock) Accept(v Visitor) {
@@ -326,6 +663,36 @@ func (h *Html) Accept(v Visitor) {
 	v.LeaveHtml(h)
 }
 
+func (l *List) Accept(v Visitor) {
+	v.VisitList(l)
+	for _, i := range l.Items {
+		i.Accept(v)
+	}
+	v.LeaveList(l)
+}
+
+func (i *ListItem) Accept(v Visitor) {
+	v.VisitListItem(i)
+	for _, c := range i.Content {
+		c.Accept(v)
+	}
+	v.LeaveListItem(i)
+}
+
+// Accept visits the table, the visitor passes itself on to the cells, if it
+// needs to.
+func (t *Table) Accept(v Visitor) {
+	v.VisitTable(t)
+	v.LeaveTable(t)
+}
+
+// Accept visits the definition list, the visitor passes itself on to the
+// terms and explanations, if it needs to.
+func (d *DefinitionList) Accept(v Visitor) {
+	v.VisitDefinitionList(d)
+	v.LeaveDefinitionList(d)
+}
+
 func (v NopVisitor) VisitBlog(b *Blog) {
 }
 
@@ -350,12 +717,27 @@ func (v NopVisitor) VisitLink(*Link) {
 func (v NopVisitor) VisitSidenote(*Sidenote) {
 }
 
+func (v NopVisitor) VisitFootnote(*Footnote) {
+}
+
 func (v NopVisitor) VisitImage(*Image) {
 }
 
 func (v NopVisitor) VisitBlockQuote(*BlockQuote) {
 }
 
+func (v NopVisitor) LeaveBlockQuote(*BlockQuote) {
+}
+
+func (v NopVisitor) VisitAdmonition(*Admonition) {
+}
+
+func (v NopVisitor) LeaveAdmonition(*Admonition) {
+}
+
+func (v NopVisitor) VisitEnquoteSingle(*EnquoteSingle) {
+}
+
 func (v NopVisitor) VisitEnquoteDouble(*EnquoteDouble) {
 }
 
@@ -377,9 +759,30 @@ func (v NopVisitor) VisitStrikethrough(*Strikethrough) {
 func (v NopVisitor) VisitMarker(*Marker) {
 }
 
+func (v NopVisitor) VisitSpan(*Span) {
+}
+
+func (v NopVisitor) VisitRuby(*Ruby) {
+}
+
+func (v NopVisitor) VisitSuperscript(*Superscript) {
+}
+
+func (v NopVisitor) VisitSubscript(*Subscript) {
+}
+
+func (v NopVisitor) VisitKbd(*Kbd) {
+}
+
+func (v NopVisitor) VisitAbbreviation(*Abbreviation) {
+}
+
 func (v NopVisitor) VisitMono(*Mono) {
 }
 
+func (v NopVisitor) VisitMath(*Math) {
+}
+
 func (v NopVisitor) VisitText(*Text) {
 }
 
@@ -404,10 +807,206 @@ func (v NopVisitor) VisitHtml(*Html) {
 func (v NopVisitor) LeaveHtml(*Html) {
 }
 
+func (v NopVisitor) VisitList(*List) {
+}
+
+func (v NopVisitor) LeaveList(*List) {
+}
+
+func (v NopVisitor) VisitListItem(*ListItem) {
+}
+
+func (v NopVisitor) LeaveListItem(*ListItem) {
+}
+
+func (v NopVisitor) VisitTable(*Table) {
+}
+
+func (v NopVisitor) LeaveTable(*Table) {
+}
+
+func (v NopVisitor) VisitDefinitionList(*DefinitionList) {
+}
+
+func (v NopVisitor) LeaveDefinitionList(*DefinitionList) {
+}
+
 func (v *FixReferencesVisitor) VisitBlog(b *Blog) {
 	v.LinkDefinitions = b.LinkDefinitions
 	v.SidenoteDefinitions = b.SidenoteDefinitions
+	v.FootnoteDefinitions = b.FootnoteDefinitions
 	v.TermDefinitions = b.TermDefinitions
+	v.AbbreviationDefinitions = b.AbbreviationDefinitions
+	v.definitionLocations = b.Locations.SidenoteDefinitions
+	v.abbreviations = slices.Collect(maps.Keys(b.AbbreviationDefinitions))
+	slices.SortFunc(v.abbreviations, func(a, b string) int {
+		return cmp.Or(len(b)-len(a), strings.Compare(a, b)) // prefer the longest match
+	})
+	v.used = map[string]bool{}
+	v.resolved = map[string]bool{}
+	v.endnotes = map[string]*Endnote{}
+	v.orderedEndnotes = nil
+}
+
+// LeaveBlog reports sidenote and footnote definitions that are never referenced,
+// and stores the referenced footnotes in the blog.
+// Which of the two a definition is follows only from its references, so an
+// unused definition is reported as a footnote if it has more than one
+// paragraph, which only footnotes can have. Either way it is an error, the
+// note would silently be missing from the post.
+func (v *FixReferencesVisitor) LeaveBlog(b *Blog) {
+	var unused []string
+	for ref := range v.SidenoteDefinitions {
+		if !v.used[ref] {
+			unused = append(unused, ref)
+		}
+	}
+	slices.Sort(unused) // report in a stable order
+	for _, ref := range unused {
+		kind := "sidenote or footnote"
+		if len(v.FootnoteDefinitions[ref]) > 1 {
+			kind = "footnote"
+		}
+		v.Errors = errors.Join(v.Errors, diagnostic.At(v.definitionLocations[ref], "unused-definition", fmt.Errorf("unused definition for %s with id: %s", kind, ref)))
+	}
+	b.Endnotes = v.orderedEndnotes
+}
+
+// visitText passes the visitor on to the content of inline elements, so that
+// references nested in them are resolved too.
+// Defined abbreviations in the text are replaced by Abbreviation nodes.
+func (v *FixReferencesVisitor) visitText(t TextRich) TextRich {
+	t = v.abbreviate(t)
+	for _, n := range t {
+		n.Accept(v)
+	}
+	return t
+}
+
+// abbreviate splits the text nodes of t at every word that is a defined abbreviation.
+func (v *FixReferencesVisitor) abbreviate(t TextRich) TextRich {
+	if len(v.abbreviations) == 0 {
+		return t
+	}
+	abbreviated := make(TextRich, 0, len(t))
+	for _, n := range t {
+		text, ok := n.(*Text)
+		if !ok {
+			abbreviated = append(abbreviated, n)
+			continue
+		}
+		s := text.Text
+		start := 0
+		for i := 0; i < len(s); {
+			if abbr, ok := v.abbreviationAt(s, i); ok {
+				if start < i {
+					abbreviated = append(abbreviated, &Text{Located: text.within(start, i), Text: s[start:i]})
+				}
+				abbreviated = append(abbreviated, &Abbreviation{
+					Located: text.within(i, i+len(abbr)),
+					Abbr:    abbr,
+					Title:   v.AbbreviationDefinitions[abbr],
+				})
+				i += len(abbr)
+				start = i
+				continue
+			}
+			_, size := utf8.DecodeRuneInString(s[i:])
+			i += size
+		}
+		if start == 0 {
+			abbreviated = append(abbreviated, n)
+		} else if start < len(s) {
+			abbreviated = append(abbreviated, &Text{Located: text.within(start, len(s)), Text: s[start:]})
+		}
+	}
+	return abbreviated
+}
+
+// within locates the bytes t.Text[i:j] in the source.
+// If the text is not exactly the source it spans, the part is located at the
+// span of the whole text.
+func (t *Text) within(i, j int) Located {
+	span := t.Span
+	if span.IsZero() || span.End.Offset-span.Start.Offset != utf8.RuneCountInString(t.Text) {
+		return t.Located
+	}
+	advance := func(pos diagnostic.Position, s string) diagnostic.Position {
+		for _, r := range s {
+			pos.Offset++
+			if r == '\n' {
+				pos.Line++
+				pos.Column = 1
+			} else {
+				pos.Column++
+			}
+		}
+		return pos
+	}
+	span.Start = advance(span.Start, t.Text[:i])
+	span.End = advance(span.Start, t.Text[i:j])
+	return Located{Span: span}
+}
+
+// abbreviationAt returns the abbreviation that is a whole word starting at s[i:].
+func (v *FixReferencesVisitor) abbreviationAt(s string, i int) (string, bool) {
+	isWordRune := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+	}
+	if before, _ := utf8.DecodeLastRuneInString(s[:i]); i > 0 && isWordRune(before) {
+		return "", false
+	}
+	for _, abbr := range v.abbreviations {
+		if !strings.HasPrefix(s[i:], abbr) {
+			continue
+		}
+		if after, _ := utf8.DecodeRuneInString(s[i+len(abbr):]); i+len(abbr) < len(s) && isWordRune(after) {
+			continue
+		}
+		return abbr, true
+	}
+	return "", false
+}
+
+func (v *FixReferencesVisitor) VisitParagraph(p *Paragraph) {
+	// the children are visited by the paragraph itself
+	p.Content = v.abbreviate(p.Content)
+}
+
+func (v *FixReferencesVisitor) VisitEmphasis(e *Emphasis) {
+	e.Content = v.visitText(e.Content)
+}
+
+func (v *FixReferencesVisitor) VisitStrong(s *Strong) {
+	s.Content = v.visitText(s.Content)
+}
+
+func (v *FixReferencesVisitor) VisitEmphasisStrong(e *EmphasisStrong) {
+	e.Content = v.visitText(e.Content)
+}
+
+func (v *FixReferencesVisitor) VisitStrikethrough(s *Strikethrough) {
+	s.Content = v.visitText(s.Content)
+}
+
+func (v *FixReferencesVisitor) VisitMarker(m *Marker) {
+	m.Content = v.visitText(m.Content)
+}
+
+func (v *FixReferencesVisitor) VisitSpan(s *Span) {
+	s.Content = v.visitText(s.Content)
+}
+
+func (v *FixReferencesVisitor) VisitEnquoteSingle(e *EnquoteSingle) {
+	e.Content = v.visitText(e.Content)
+}
+
+func (v *FixReferencesVisitor) VisitEnquoteDouble(e *EnquoteDouble) {
+	e.Content = v.visitText(e.Content)
+}
+
+func (v *FixReferencesVisitor) VisitEnquoteAngled(e *EnquoteAngled) {
+	e.Content = v.visitText(e.Content)
 }
 
 func (v *FixReferencesVisitor) VisitLink(l *Link) {
@@ -416,7 +1015,27 @@ func (v *FixReferencesVisitor) VisitLink(l *Link) {
 		if hasHref {
 			l.Href = href
 		} else {
-			v.Errors = errors.Join(v.Errors, fmt.Errorf("missing url definition for link with id: %s", l.Ref))
+			v.Errors = errors.Join(v.Errors, diagnostic.At(l.Location(), "missing-link-definition", fmt.Errorf("missing url definition for link with id: %s", l.Ref), fmt.Sprintf("define the url with [%s]: https://...", l.Ref)))
+		}
+	}
+}
+
+func (v *FixReferencesVisitor) VisitTable(t *Table) {
+	for i, cell := range t.Header {
+		t.Header[i] = v.visitText(cell)
+	}
+	for _, row := range t.Rows {
+		for i, cell := range row {
+			row[i] = v.visitText(cell)
+		}
+	}
+}
+
+func (v *FixReferencesVisitor) VisitDefinitionList(d *DefinitionList) {
+	for _, def := range d.Definitions {
+		def.Term = v.visitText(def.Term)
+		for i, explanation := range def.Explanations {
+			def.Explanations[i] = v.visitText(explanation)
 		}
 	}
 }
@@ -424,15 +1043,69 @@ func (v *FixReferencesVisitor) VisitLink(l *Link) {
 func (v *FixReferencesVisitor) VisitSidenote(sn *Sidenote) {
 	if sn.Ref == "" {
 		if len(sn.Content) <= 0 {
-			v.Errors = errors.Join(v.Errors, fmt.Errorf("inline sidenote has empty content")) // @todo: we really need to keep information of where in the source these elements are coming from!
+			v.Errors = errors.Join(v.Errors, diagnostic.At(sn.Location(), "empty-sidenote", fmt.Errorf("inline sidenote has empty content")))
 		}
+		sn.Content = v.visitText(sn.Content)
 	} else {
-		content, hasContent := v.SidenoteDefinitions[sn.Ref]
-		if hasContent {
-			sn.Content = content
+		_, hasContent := v.SidenoteDefinitions[sn.Ref]
+		if done, seen := v.resolved[sn.Ref]; seen && !done {
+			v.Errors = errors.Join(v.Errors, diagnostic.At(sn.Location(), "recursive-sidenote", fmt.Errorf("sidenote with id %s is referenced from its own definition", sn.Ref)))
+		} else if hasContent {
+			v.resolveDefinition(sn.Ref)
+			sn.Content = v.SidenoteDefinitions[sn.Ref]
+			v.used[sn.Ref] = true
+			if len(v.FootnoteDefinitions[sn.Ref]) > 1 {
+				v.Errors = errors.Join(v.Errors, diagnostic.At(sn.Location(), "sidenote-paragraphs", fmt.Errorf("sidenote with id %s: definition has more than one paragraph, only footnotes can have multiple paragraphs", sn.Ref), fmt.Sprintf("separate [^%s] from the word before it to make it a footnote", sn.Ref)))
+			}
 		} else {
-			v.Errors = errors.Join(v.Errors, fmt.Errorf("missing content definition for sidenote with id: %s", sn.Ref))
+			v.Errors = errors.Join(v.Errors, diagnostic.At(sn.Location(), "missing-sidenote-definition", fmt.Errorf("missing content definition for sidenote with id: %s", sn.Ref), fmt.Sprintf("define the content with [^%s]: ...", sn.Ref)))
+		}
+	}
+}
+
+// VisitFootnote numbers footnotes in the order they are first referenced in.
+func (v *FixReferencesVisitor) VisitFootnote(f *Footnote) {
+	paragraphs, hasContent := v.FootnoteDefinitions[f.Ref]
+	if !hasContent {
+		v.Errors = errors.Join(v.Errors, diagnostic.At(f.Location(), "missing-footnote-definition", fmt.Errorf("missing content definition for footnote with id: %s", f.Ref), fmt.Sprintf("define the content with [^%s]: ...", f.Ref)))
+		return
+	}
+	v.used[f.Ref] = true
+	note, seen := v.endnotes[f.Ref]
+	if !seen {
+		note = &Endnote{
+			Ref:        f.Ref,
+			Number:     len(v.orderedEndnotes) + 1,
+			Paragraphs: paragraphs,
 		}
+		v.endnotes[f.Ref] = note
+		v.orderedEndnotes = append(v.orderedEndnotes, note)
+		v.resolveDefinition(f.Ref) // after numbering, so that a footnote referencing itself doesn't recurse
+	}
+	note.Uses++
+	f.Number = note.Number
+	f.Use = note.Uses
+}
+
+// resolveDefinition visits the content of a sidenote or footnote definition
+// the first time it is referenced, so that the references nested in it are
+// resolved exactly once, no matter how often the definition is used.
+func (v *FixReferencesVisitor) resolveDefinition(ref string) {
+	if _, seen := v.resolved[ref]; seen {
+		return
+	}
+	v.resolved[ref] = false
+	defer func() { v.resolved[ref] = true }()
+	paragraphs, isFootnote := v.FootnoteDefinitions[ref]
+	if !isFootnote {
+		v.SidenoteDefinitions[ref] = v.visitText(v.SidenoteDefinitions[ref])
+		return
+	}
+	for i, p := range paragraphs {
+		paragraphs[i] = v.visitText(p)
+	}
+	if _, isSidenote := v.SidenoteDefinitions[ref]; isSidenote && len(paragraphs) > 0 {
+		v.SidenoteDefinitions[ref] = paragraphs[0] // a definition with a single paragraph is shared by both maps
 	}
 }
 
@@ -445,6 +1118,12 @@ type (
 		Token lexer.Token
 		Inner error
 	}
+	// Transition of the parser from one state into another, caused by a
+	// token, see ParseTrace.
+	Transition struct {
+		Token    lexer.Token
+		From, To ParseState
+	}
 )
 
 // @todo: make parser a type like with the lexer?
@@ -459,18 +1138,93 @@ func newError(lexeme lexer.Token, state ParseState, inner error) error {
 	}
 }
 
+// located spans the source from the start of begin to the end of end.
+func located(begin, end lexer.Token) Located {
+	return Located{
+		Span: diagnostic.Span{
+			Filename: begin.Span.Filename,
+			Start:    begin.Span.Start,
+			End:      end.Span.End,
+		},
+	}
+}
+
+// documentLocation spans the whole document, up to its eof token.
+func documentLocation(eof lexer.Token) Located {
+	return Located{
+		Span: diagnostic.Span{
+			Filename: eof.Span.Filename,
+			Start:    diagnostic.Position{Line: 1, Column: 1},
+			End:      eof.Span.End,
+		},
+	}
+}
+
+// Location is the span of the source the node was parsed from.
+func (l Located) Location() diagnostic.Span {
+	return l.Span
+}
+
 func (err ParserError) Error() string {
-	return fmt.Sprintf("[%s] %s: %s", err.State, err.Token, err.Inner)
+	return fmt.Sprintf("%s: [%s] %s: `%s`: %s", err.Token.Span, err.State, err.Token.Type, err.Token.Text, err.Inner)
+}
+
+func (err ParserError) Unwrap() error {
+	return err.Inner
+}
+
+// errorCodes identify the kinds of parser errors in diagnostics, and give a
+// hint on how to fix them.
+var errorCodes = []struct {
+	err        error
+	code, hint string
+}{
+	{ErrInvalidToken, "invalid-token", ""},
+	{ErrSectionMissingHeading, "missing-heading", "write the heading on the same line as the #"},
+	{ErrSectionSkipsLevel, "section-level", "a section must be exactly one level deeper than the section it is in"},
+	{ErrInvalidListNumber, "list-number", ""},
+	{ErrTableColumnCount, "table-columns", "the delimiter row needs a --- for each column of the header"},
+	{ErrAttributeListAlone, "attribute-list-alone", "write the attribute list on the last line of the paragraph, not on a line of its own"},
+	{ErrExplanationMissingTerm, "missing-term", "write the term on the line before its first `: explanation`"},
+	{ErrRubyReadings, "ruby-readings", "write {漢字|かん|じ} for per-character readings or {漢字|かんじ} for a single one"},
+	{ErrAdmonitionType, "admonition-type", ""},
+	{ErrInternal, "internal", "this is a bug in the parser, please report it together with the source"},
+}
+
+func (err ParserError) Diagnostic() diagnostic.Diagnostic {
+	d := diagnostic.Diagnostic{
+		Severity: diagnostic.SeverityError,
+		Span:     err.Token.Span,
+		Message:  fmt.Sprintf("%s: %s `%s`", err.Inner, err.Token.Type, err.Token.Text),
+		Err:      err,
+	}
+	for _, c := range errorCodes {
+		if errors.Is(err.Inner, c.err) {
+			d.Code = c.code
+			if c.hint != "" {
+				d.Hints = append(d.Hints, c.hint)
+			}
+			break
+		}
+	}
+	return d
 }
 
 type (
 	Level struct {
-		ReturnToState ParseState
-		Strings       []string
-		TextSimple    TextSimple
-		TextRich      TextRich
-		Content       []Node
-		Html          *Html
+		Begin          lexer.Token // the token that opened the level
+		ReturnToState  ParseState
+		Strings        []string
+		TextSimple     TextSimple
+		TextRich       TextRich
+		Content        []Node
+		Html           *Html
+		Section        *Section
+		DefinitionList *DefinitionList
+		List           *List
+		ListItem       *ListItem
+		Admonition     *Admonition
+		BlockQuote     *BlockQuote
 	}
 	Levels struct {
 		levels []*Level
@@ -526,121 +1280,245 @@ const (
 	ParsingHtmlElement
 	ParsingHtmlElementAttributes
 	ParsingHtmlElementContent
-	ParsingTermDefinition
+	ParsingDefinitionList
 	ParsingTermExplanation
 	ParsingSidenoteDefinition
 	ParsingLinkDefinition
+	ParsingAbbreviationDefinition
 	ParsingAttributeList
 	ParsingAttributeListAfterID
 	ParsingAttributeListVal
-	ParsingSection1
-	ParsingSection1AfterAttributeList
-	ParsingSection1Content
-	ParsingSection2
-	ParsingSection2AfterAttributeList
-	ParsingSection2Content
+	ParsingSection
+	ParsingSectionAfterAttributeList
+	ParsingSectionContent
 	ParsingCodeBlock
 	ParsingCodeBlockAfterAttr
 	ParsingImage
+	ParsingImageAfterAttributeList
 	ParsingBlockquote
 	ParsingBlockquoteAuthor
 	ParsingBlockquoteSource
 	ParsingBlockquoteAfterAttrEnd
+	ParsingAdmonition
 	ParsingParagraph
+	ParsingParagraphAfterAttributeList
 	ParsingEmphasis
 	ParsingStrong
 	ParsingStrikethrough
 	ParsingMarker
+	ParsingRuby
 	ParsingEmphasisStrong
+	ParsingEnquoteSingle
 	ParsingEnquoteDouble
 	ParsingEnquoteAngled
 	ParsingLinkable
+	ParsingSpanAfterAttributeList
 	ParsingLinkableAfterHref
+	ParsingLinkableAfterTitle
 	ParsingLinkableAfterRef
 	ParsingSidenoteAfterRef
 	ParsingSidenoteContent
+	ParsingList
+	ParsingListItem
+	ParsingTable
+	ParsingTableRow
+	ParsingTableCell
 )
 
 var (
-	ErrInvalidToken          = errors.New("invalid token")
-	ErrSectionMissingHeading = errors.New("section must have a heading")
+	ErrInvalidToken           = errors.New("invalid token")
+	ErrSectionMissingHeading  = errors.New("section must have a heading")
+	ErrSectionSkipsLevel      = errors.New("section skips a level")
+	ErrContentOutsideSection  = errors.New("content must start with section, html element, or link or sidenote definition")
+	ErrInvalidListNumber      = errors.New("invalid list item number")
+	ErrTableColumnCount       = errors.New("table header and delimiter row must have the same number of columns")
+	ErrAttributeListIDs       = errors.New("attribute list must have at most one id")
+	ErrAttributeListAlone     = errors.New("attribute list must end the paragraph it applies to")
+	ErrExplanationMissingTerm = errors.New("explanation must follow a term")
+	ErrRubyReadings           = errors.New("ruby must have either one reading per character or a single reading")
+	ErrAdmonitionType         = errors.New("admonition type must be one of info, warning, danger or tip")
+	ErrInternal               = errors.New("internal parser error")
 )
 
+// closingTokens maps the tokens that begin an element to the token that ends
+// it, so that an element that isn't allowed can be skipped as a whole.
+var closingTokens = map[lexer.TokenType]lexer.TokenType{
+	lexer.TokenMetaBegin:                  lexer.TokenMetaEnd,
+	lexer.TokenHtmlTagOpen:                lexer.TokenHtmlTagClose,
+	lexer.TokenSectionBegin:               lexer.TokenSectionEnd,
+	lexer.TokenParagraphBegin:             lexer.TokenParagraphEnd,
+	lexer.TokenEmphasisBegin:              lexer.TokenEmphasisEnd,
+	lexer.TokenStrikethroughBegin:         lexer.TokenStrikethroughEnd,
+	lexer.TokenMarkerBegin:                lexer.TokenMarkerEnd,
+	lexer.TokenRubyBegin:                  lexer.TokenRubyEnd,
+	lexer.TokenStrongBegin:                lexer.TokenStrongEnd,
+	lexer.TokenEmphasisStrongBegin:        lexer.TokenEmphasisStrongEnd,
+	lexer.TokenEnquoteSingleBegin:         lexer.TokenEnquoteSingleEnd,
+	lexer.TokenEnquoteDoubleBegin:         lexer.TokenEnquoteDoubleEnd,
+	lexer.TokenEnquoteAngledBegin:         lexer.TokenEnquoteAngledEnd,
+	lexer.TokenDefinitionListBegin:        lexer.TokenDefinitionListEnd,
+	lexer.TokenDefinitionExplanationBegin: lexer.TokenDefinitionExplanationEnd,
+	lexer.TokenBlockquoteBegin:            lexer.TokenBlockquoteEnd,
+	lexer.TokenAdmonitionBegin:            lexer.TokenAdmonitionEnd,
+	lexer.TokenImageBegin:                 lexer.TokenImageEnd,
+	lexer.TokenSidenoteDef:                lexer.TokenSidenoteDefEnd,
+	lexer.TokenLinkableBegin:              lexer.TokenLinkableEnd,
+	lexer.TokenCodeBlockBegin:             lexer.TokenCodeBlockEnd,
+	lexer.TokenAttributeListBegin:         lexer.TokenAttributeListEnd,
+	lexer.TokenListUnorderedBegin:         lexer.TokenListEnd,
+	lexer.TokenListOrderedBegin:           lexer.TokenListEnd,
+	lexer.TokenListItemBegin:              lexer.TokenListItemEnd,
+	lexer.TokenTableBegin:                 lexer.TokenTableEnd,
+	lexer.TokenTableRowBegin:              lexer.TokenTableRowEnd,
+	lexer.TokenTableCellBegin:             lexer.TokenTableCellEnd,
+}
+
 func Parse(lx LexResult) (blog *Blog, err error) {
+	return parse(lx, nil)
+}
+
+// ParseTrace parses like Parse, and reports every transition between the
+// states of the parser to trace, for debugging.
+func ParseTrace(lx LexResult, trace func(Transition)) (blog *Blog, err error) {
+	return parse(lx, trace)
+}
+
+func parse(lx LexResult, trace func(Transition)) (blog *Blog, err error) {
 	blog = &Blog{}
 	// kinda sad how the zero value of a map isn't useable ;-(
 	blog.LinkDefinitions = map[string]string{}
 	blog.SidenoteDefinitions = map[string]TextRich{}
+	blog.FootnoteDefinitions = map[string][]TextRich{}
 	blog.TermDefinitions = map[string]TextRich{}
+	blog.AbbreviationDefinitions = map[string]string{}
 	blog.Meta = Meta{}
+	blog.Locations = Locations{
+		Meta:                    map[string][]diagnostic.Span{},
+		LinkDefinitions:         map[string]diagnostic.Span{},
+		SidenoteDefinitions:     map[string]diagnostic.Span{},
+		AbbreviationDefinitions: map[string]diagnostic.Span{},
+	}
 	// parser setup
 	state := ParsingStart
 	levels := Levels{}
 	levels.Push(&Level{ReturnToState: ParsingStart})
 	var (
-		currentSection1, currentSection2 *Section
-		currentAttributes                = Attributes{}
-		currentCodeBlock                 = &CodeBlock{Attributes: Attributes{}}
-		currentImage                     = &Image{}
-		currentBlockquote                = &BlockQuote{}
-		currentSidenote                  = &Sidenote{}
-		currentDefinition                string
-		currentTerm                      string
+		currentAttributes = Attributes{}
+		currentCodeBlock  = &CodeBlock{Attributes: Attributes{}}
+		currentImage      = &Image{}
+		currentTable      = &Table{}
+		currentTableRow   []TextRich
+		currentRowBegin   lexer.Token
+		currentSidenote   = &Sidenote{}
+		currentDefinition string
+		currentParagraphs []TextRich // preceding paragraphs of a multi paragraph footnote definition
+		current           lexer.Token
+		skipUntil         lexer.TokenType // end of the element being skipped, while skipDepth > 0
+		skipDepth         int
 	)
+	// invalid reports a token that isn't allowed in the current state.
+	// If the token begins an element, the whole element is skipped, so that
+	// there is only one error for it and parsing resumes after its end.
+	invalid := func(lexeme lexer.Token) error {
+		if end, ok := closingTokens[lexeme.Type]; ok {
+			skipUntil, skipDepth = end, 1
+		}
+		return newError(lexeme, state, ErrInvalidToken)
+	}
+	defer func() {
+		// the parser is confused, which is a bug, but shouldn't crash the build
+		if r := recover(); r != nil {
+			err = errors.Join(err, newError(current, state, fmt.Errorf("%w: %v", ErrInternal, r)))
+		}
+	}()
+	traced := state
+	// report the transition caused by the current token, if any
+	report := func() {
+		if trace != nil && state != traced {
+			trace(Transition{Token: current, From: traced, To: state})
+			traced = state
+		}
+	}
+	defer report()
 	for lexeme := range lx.Tokens() {
+		report()
+		current = lexeme
+		if skipDepth > 0 && lexeme.Type != lexer.TokenEOF {
+			if closingTokens[lexeme.Type] == skipUntil {
+				skipDepth++
+			} else if lexeme.Type == skipUntil {
+				skipDepth--
+			}
+			continue
+		}
 		level := levels.Top()
 		switch state {
 		default:
-			panic(fmt.Errorf("parser state not implemented: %s", state))
+			panic(fmt.Errorf("parser state not implemented: %s", state)) // recovered above
 		case ParsingStart:
 			switch lexeme.Type {
 			default:
-				err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+				err = errors.Join(err, invalid(lexeme))
 			case lexer.TokenMetaBegin:
-				levels.Push(&Level{ReturnToState: ParsingDocument})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingDocument})
 				state = ParsingMeta
 			case lexer.TokenHtmlTagOpen:
-				levels.Push(&Level{ReturnToState: ParsingDocument, Html: &Html{Name: lexeme.Text}})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingDocument, Html: &Html{Name: lexeme.Text}})
 				state = ParsingHtmlElement
-			case lexer.TokenSection1Begin:
-				levels.Push(&Level{ReturnToState: ParsingDocument})
-				state = ParsingSection1
-			case lexer.TokenDefinitionTerm:
-				levels.Push(&Level{ReturnToState: ParsingDocument})
-				currentTerm = lexeme.Text
-				state = ParsingTermDefinition
+			case lexer.TokenSectionBegin:
+				section := &Section{Level: len(lexeme.Text)}
+				if section.Level != 1 {
+					err = errors.Join(err, newError(lexeme, state, fmt.Errorf("%w: level %d section at the top level", ErrSectionSkipsLevel, section.Level)))
+				}
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingDocument, Section: section})
+				state = ParsingSection
+			case lexer.TokenDefinitionListBegin:
+				err = errors.Join(err, newError(lexeme, state, ErrContentOutsideSection))
+				skipUntil, skipDepth = lexer.TokenDefinitionListEnd, 1
 			case lexer.TokenLinkDef:
-				levels.Push(&Level{ReturnToState: ParsingDocument})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingDocument})
 				currentDefinition = lexeme.Text
 				state = ParsingLinkDefinition
+			case lexer.TokenAbbreviationDef:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingDocument})
+				currentDefinition = lexeme.Text
+				state = ParsingAbbreviationDefinition
 			case lexer.TokenSidenoteDef:
-				levels.Push(&Level{ReturnToState: ParsingDocument})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingDocument})
 				currentDefinition = lexeme.Text
 				state = ParsingSidenoteDefinition
 			case lexer.TokenEOF:
+				blog.Located = documentLocation(lexeme)
 				levels.Pop()
 				Assert(levels.Len() == 0, "not all levels popped")
 			}
 		case ParsingDocument:
 			switch lexeme.Type {
 			default:
-				err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+				err = errors.Join(err, invalid(lexeme))
 			case lexer.TokenHtmlTagOpen:
-				levels.Push(&Level{ReturnToState: ParsingDocument, Html: &Html{Name: lexeme.Text}})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingDocument, Html: &Html{Name: lexeme.Text}})
 				state = ParsingHtmlElement
-			case lexer.TokenSection1Begin:
-				levels.Push(&Level{ReturnToState: ParsingDocument})
-				state = ParsingSection1
-			case lexer.TokenDefinitionTerm:
-				levels.Push(&Level{ReturnToState: ParsingDocument})
-				currentTerm = lexeme.Text
-				state = ParsingTermDefinition
+			case lexer.TokenSectionBegin:
+				section := &Section{Level: len(lexeme.Text)}
+				if section.Level != 1 {
+					err = errors.Join(err, newError(lexeme, state, fmt.Errorf("%w: level %d section at the top level", ErrSectionSkipsLevel, section.Level)))
+				}
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingDocument, Section: section})
+				state = ParsingSection
+			case lexer.TokenDefinitionListBegin:
+				err = errors.Join(err, newError(lexeme, state, ErrContentOutsideSection))
+				skipUntil, skipDepth = lexer.TokenDefinitionListEnd, 1
 			case lexer.TokenLinkDef:
-				levels.Push(&Level{ReturnToState: ParsingDocument})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingDocument})
 				currentDefinition = lexeme.Text
 				state = ParsingLinkDefinition
+			case lexer.TokenAbbreviationDef:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingDocument})
+				currentDefinition = lexeme.Text
+				state = ParsingAbbreviationDefinition
 			case lexer.TokenSidenoteDef:
-				levels.Push(&Level{ReturnToState: ParsingDocument})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingDocument})
 				currentDefinition = lexeme.Text
 				state = ParsingSidenoteDefinition
 			case lexer.TokenEOF:
@@ -650,15 +1528,17 @@ func Parse(lx LexResult) (blog *Blog, err error) {
 						blog.Htmls = append(blog.Htmls, h)
 					}
 				}
+				blog.Located = documentLocation(lexeme)
 				levels.Pop()
 				Assert(levels.Len() == 0, "not all levels popped")
 			}
 		case ParsingMeta:
 			switch lexeme.Type {
 			default:
-				err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+				err = errors.Join(err, invalid(lexeme))
 			case lexer.TokenMetaKey:
 				level.PushString(lexeme.Text)
+				blog.Locations.Meta[lexeme.Text] = append(blog.Locations.Meta[lexeme.Text], lexeme.Span)
 				state = ParsingMetaVal
 			case lexer.TokenMetaEnd:
 				levels.Pop()
@@ -668,7 +1548,7 @@ func Parse(lx LexResult) (blog *Blog, err error) {
 			switch lexeme.Type {
 			default:
 				if !(isTextNode(lexeme) && level.TextSimple.Append(newTextNode(lexeme))) {
-					err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+					err = errors.Join(err, invalid(lexeme))
 				}
 			case lexer.TokenMetaKey:
 				// finish current key
@@ -677,6 +1557,7 @@ func Parse(lx LexResult) (blog *Blog, err error) {
 				level.Clear()
 				// start next key
 				level.PushString(lexeme.Text)
+				blog.Locations.Meta[lexeme.Text] = append(blog.Locations.Meta[lexeme.Text], lexeme.Span)
 			case lexer.TokenMetaEnd:
 				// finish last key
 				key := level.PopString()
@@ -689,7 +1570,7 @@ func Parse(lx LexResult) (blog *Blog, err error) {
 		case ParsingAttributeList:
 			switch lexeme.Type {
 			default:
-				err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+				err = errors.Join(err, invalid(lexeme))
 			case lexer.TokenAttributeListID:
 				currentAttributes["id"] = lexeme.Text
 				state = ParsingAttributeListAfterID
@@ -703,7 +1584,9 @@ func Parse(lx LexResult) (blog *Blog, err error) {
 		case ParsingAttributeListAfterID:
 			switch lexeme.Type {
 			default:
-				err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+				err = errors.Join(err, invalid(lexeme))
+			case lexer.TokenAttributeListID:
+				err = errors.Join(err, newError(lexeme, state, ErrAttributeListIDs))
 			case lexer.TokenAttributeListKey:
 				level.PushString(lexeme.Text)
 				state = ParsingAttributeListVal
@@ -714,10 +1597,10 @@ func Parse(lx LexResult) (blog *Blog, err error) {
 		case ParsingAttributeListVal:
 			switch lexeme.Type {
 			default:
-				err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+				err = errors.Join(err, invalid(lexeme))
 			case lexer.TokenText:
 				level.PushString(lexeme.Text)
-			case lexer.TokenAttributeListKey:
+			case lexer.TokenAttributeListID:
 				// finish previous key
 				Assert(len(level.Strings) == 1 || len(level.Strings) == 2, "")
 				var val string
@@ -725,11 +1608,26 @@ func Parse(lx LexResult) (blog *Blog, err error) {
 					val = level.PopString()
 				}
 				key := level.PopString()
-				currentAttributes[key] = val
+				currentAttributes.set(key, val)
 				level.Clear()
-				// start next key
-				level.PushString(lexeme.Text)
-			case lexer.TokenAttributeListEnd:
+				if _, ok := currentAttributes["id"]; ok {
+					err = errors.Join(err, newError(lexeme, state, ErrAttributeListIDs))
+				}
+				currentAttributes["id"] = lexeme.Text
+				state = ParsingAttributeListAfterID
+			case lexer.TokenAttributeListKey:
+				// finish previous key
+				Assert(len(level.Strings) == 1 || len(level.Strings) == 2, "")
+				var val string
+				if len(level.Strings) > 1 {
+					val = level.PopString()
+				}
+				key := level.PopString()
+				currentAttributes.set(key, val)
+				level.Clear()
+				// start next key
+				level.PushString(lexeme.Text)
+			case lexer.TokenAttributeListEnd:
 				// finish last key
 				Assert(len(level.Strings) == 1 || len(level.Strings) == 2, "")
 				var val string
@@ -737,282 +1635,297 @@ func Parse(lx LexResult) (blog *Blog, err error) {
 					val = level.PopString()
 				}
 				key := level.PopString()
-				currentAttributes[key] = val
+				currentAttributes.set(key, val)
 				level.Clear()
 				// finish level
 				levels.Pop()
 				state = level.ReturnToState
 			}
-		case ParsingSection1:
+		case ParsingSection:
 			switch {
 			default:
-				err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+				err = errors.Join(err, invalid(lexeme))
 			case isTextNode(lexeme):
 				ok := level.TextRich.Append(newTextNode(lexeme))
 				Assert(ok, "all text nodes must fit into rich text")
 			case lexeme.Type == lexer.TokenAttributeListBegin:
-				levels.Push(&Level{ReturnToState: ParsingSection1AfterAttributeList})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSectionAfterAttributeList})
 				state = ParsingAttributeList
-			case lexeme.Type == lexer.TokenSection1Content:
+			case lexeme.Type == lexer.TokenSectionContent:
 				if len(level.TextRich) == 0 {
 					err = errors.Join(err, newError(lexeme, state, ErrSectionMissingHeading))
 				}
-				currentSection1 = &Section{
-					Level:   1,
-					Heading: level.TextRich,
-				}
+				level.Section.Heading = level.TextRich
 				level.Clear()
-				state = ParsingSection1Content
+				state = ParsingSectionContent
 			}
-		case ParsingSection1AfterAttributeList:
+		case ParsingSectionAfterAttributeList:
 			switch lexeme.Type {
 			default:
-				err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
-			case lexer.TokenSection1Content:
+				err = errors.Join(err, invalid(lexeme))
+			case lexer.TokenSectionContent:
 				if len(level.TextRich) == 0 {
 					err = errors.Join(err, newError(lexeme, state, ErrSectionMissingHeading))
 				}
-				currentSection1 = &Section{
-					Attributes: currentAttributes,
-					Level:      1,
-					Heading:    level.TextRich,
-				}
+				level.Section.Attributes = currentAttributes
+				level.Section.Heading = level.TextRich
 				level.Clear()
 				currentAttributes = Attributes{}
-				state = ParsingSection1Content
+				state = ParsingSectionContent
 			}
-		case ParsingSection1Content:
+		case ParsingSectionContent:
 			switch lexeme.Type {
 			default:
-				err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
-			case lexer.TokenDefinitionTerm:
-				levels.Push(&Level{ReturnToState: ParsingSection1Content})
-				currentTerm = lexeme.Text
-				state = ParsingTermDefinition
+				err = errors.Join(err, invalid(lexeme))
+			case lexer.TokenDefinitionListBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSectionContent, DefinitionList: &DefinitionList{}})
+				state = ParsingDefinitionList
 			case lexer.TokenHorizontalRule:
-				level.Content = append(level.Content, &HorizontalRule{})
+				level.Content = append(level.Content, &HorizontalRule{Located: located(lexeme, lexeme)})
 			case lexer.TokenCodeBlockBegin:
-				levels.Push(&Level{ReturnToState: ParsingSection1Content})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSectionContent})
 				state = ParsingCodeBlock
-			case lexer.TokenSection2Begin:
-				levels.Push(&Level{ReturnToState: ParsingSection1Content})
-				state = ParsingSection2
-			case lexer.TokenImageBegin:
-				levels.Push(&Level{ReturnToState: ParsingSection1Content})
-				state = ParsingImage
-			case lexer.TokenBlockquoteBegin:
-				levels.Push(&Level{ReturnToState: ParsingSection1Content})
-				currentBlockquote = &BlockQuote{}
-				state = ParsingBlockquote
-			case lexer.TokenHtmlTagOpen:
-				levels.Push(&Level{ReturnToState: ParsingSection1Content, Html: &Html{Name: lexeme.Text}})
-				state = ParsingHtmlElement
-			case lexer.TokenLinkDef:
-				levels.Push(&Level{ReturnToState: ParsingSection1Content})
-				currentDefinition = lexeme.Text
-				state = ParsingLinkDefinition
-			case lexer.TokenSidenoteDef:
-				levels.Push(&Level{ReturnToState: ParsingSection1Content})
-				currentDefinition = lexeme.Text
-				state = ParsingSidenoteDefinition
-			case lexer.TokenParagraphBegin:
-				levels.Push(&Level{ReturnToState: ParsingSection1Content})
-				state = ParsingParagraph
-			case lexer.TokenSection1End:
-				currentSection1.Content = level.Content
-				blog.Sections = append(blog.Sections, currentSection1)
-				currentSection1 = &Section{}
-				levels.Pop()
-				state = level.ReturnToState
-			}
-		case ParsingSection2:
-			switch {
-			default:
-				err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
-			case isTextNode(lexeme):
-				ok := level.TextRich.Append(newTextNode(lexeme))
-				Assert(ok, "all text nodes must fit into rich text")
-			case lexeme.Type == lexer.TokenAttributeListBegin:
-				levels.Push(&Level{ReturnToState: ParsingSection2AfterAttributeList})
-				state = ParsingAttributeList
-			case lexeme.Type == lexer.TokenSection2Content:
-				if len(level.TextRich) == 0 {
-					err = errors.Join(err, newError(lexeme, state, ErrSectionMissingHeading))
-				}
-				currentSection2 = &Section{
-					Level:   2,
-					Heading: level.TextRich,
-				}
-				level.Clear()
-				state = ParsingSection2Content
-			}
-		case ParsingSection2AfterAttributeList:
-			switch lexeme.Type {
-			default:
-				err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
-			case lexer.TokenSection2Content:
-				if len(level.TextRich) == 0 {
-					err = errors.Join(err, newError(lexeme, state, ErrSectionMissingHeading))
-				}
-				currentSection2 = &Section{
-					Attributes: currentAttributes,
-					Level:      2,
-					Heading:    level.TextRich,
+			case lexer.TokenSectionBegin:
+				section := &Section{Level: len(lexeme.Text)}
+				if section.Level != level.Section.Level+1 {
+					err = errors.Join(err, newError(lexeme, state, fmt.Errorf("%w: level %d section inside of level %d section", ErrSectionSkipsLevel, section.Level, level.Section.Level)))
 				}
-				level.Clear()
-				currentAttributes = Attributes{}
-				state = ParsingSection2Content
-			}
-		case ParsingSection2Content:
-			switch lexeme.Type {
-			default:
-				err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
-			case lexer.TokenDefinitionTerm:
-				levels.Push(&Level{ReturnToState: ParsingSection2Content})
-				currentTerm = lexeme.Text
-				state = ParsingTermDefinition
-			case lexer.TokenHorizontalRule:
-				level.Content = append(level.Content, &HorizontalRule{})
-			case lexer.TokenCodeBlockBegin:
-				levels.Push(&Level{ReturnToState: ParsingSection2Content})
-				state = ParsingCodeBlock
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSectionContent, Section: section})
+				state = ParsingSection
 			case lexer.TokenImageBegin:
-				levels.Push(&Level{ReturnToState: ParsingSection2Content})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSectionContent})
 				state = ParsingImage
 			case lexer.TokenBlockquoteBegin:
-				levels.Push(&Level{ReturnToState: ParsingSection2Content})
-				currentBlockquote = &BlockQuote{}
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSectionContent, BlockQuote: &BlockQuote{}})
 				state = ParsingBlockquote
 			case lexer.TokenHtmlTagOpen:
-				levels.Push(&Level{ReturnToState: ParsingSection2Content, Html: &Html{Name: lexeme.Text}})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSectionContent, Html: &Html{Name: lexeme.Text}})
 				state = ParsingHtmlElement
 			case lexer.TokenLinkDef:
-				levels.Push(&Level{ReturnToState: ParsingSection2Content})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSectionContent})
 				currentDefinition = lexeme.Text
 				state = ParsingLinkDefinition
+			case lexer.TokenAbbreviationDef:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSectionContent})
+				currentDefinition = lexeme.Text
+				state = ParsingAbbreviationDefinition
 			case lexer.TokenSidenoteDef:
-				levels.Push(&Level{ReturnToState: ParsingSection2Content})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSectionContent})
 				currentDefinition = lexeme.Text
 				state = ParsingSidenoteDefinition
 			case lexer.TokenParagraphBegin:
-				levels.Push(&Level{ReturnToState: ParsingSection2Content})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSectionContent})
 				state = ParsingParagraph
-			case lexer.TokenSection2End:
-				currentSection2.Content = level.Content
+			case lexer.TokenListUnorderedBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSectionContent, List: &List{}})
+				state = ParsingList
+			case lexer.TokenListOrderedBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSectionContent, List: &List{Ordered: true}})
+				state = ParsingList
+			case lexer.TokenTableBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSectionContent})
+				state = ParsingTable
+			case lexer.TokenAdmonitionBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSectionContent, Admonition: newAdmonition(lexeme)})
+				state = ParsingAdmonition
+			case lexer.TokenSectionEnd:
+				level.Section.Content = level.Content
+				level.Section.Located = located(level.Begin, lexeme)
 				levels.Pop()
 				parent := levels.Top()
-				parent.Content = append(parent.Content, currentSection2)
-				currentSection2 = &Section{}
+				if parent.Section != nil {
+					parent.Content = append(parent.Content, level.Section)
+				} else {
+					blog.Sections = append(blog.Sections, level.Section)
+				}
 				state = level.ReturnToState
 			}
 		case ParsingParagraph:
-			// @todo: case lexer.TokenEnquoteSingleBegin:
 			switch lexeme.Type {
 			default:
 				if !(isTextNode(lexeme) && level.TextRich.Append(newTextNode(lexeme))) {
-					err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+					err = errors.Join(err, invalid(lexeme))
 				}
 			case lexer.TokenEmphasisBegin:
-				levels.Push(&Level{ReturnToState: ParsingParagraph})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingParagraph})
 				state = ParsingEmphasis
 			case lexer.TokenStrongBegin:
-				levels.Push(&Level{ReturnToState: ParsingParagraph})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingParagraph})
 				state = ParsingStrong
 			case lexer.TokenEmphasisStrongBegin:
-				levels.Push(&Level{ReturnToState: ParsingParagraph})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingParagraph})
 				state = ParsingEmphasisStrong
 			case lexer.TokenEnquoteDoubleBegin:
-				levels.Push(&Level{ReturnToState: ParsingParagraph})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingParagraph})
 				state = ParsingEnquoteDouble
+			case lexer.TokenEnquoteSingleBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingParagraph})
+				state = ParsingEnquoteSingle
 			case lexer.TokenEnquoteAngledBegin:
-				levels.Push(&Level{ReturnToState: ParsingParagraph})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingParagraph})
 				state = ParsingEnquoteAngled
 			case lexer.TokenStrikethroughBegin:
-				levels.Push(&Level{ReturnToState: ParsingParagraph})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingParagraph})
 				state = ParsingStrikethrough
 			case lexer.TokenMarkerBegin:
-				levels.Push(&Level{ReturnToState: ParsingParagraph})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingParagraph})
 				state = ParsingMarker
+			case lexer.TokenRubyBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingParagraph})
+				state = ParsingRuby
 			case lexer.TokenHtmlTagOpen:
-				levels.Push(&Level{ReturnToState: ParsingParagraph, Html: &Html{Name: lexeme.Text}})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingParagraph, Html: &Html{Name: lexeme.Text}})
 				state = ParsingHtmlElement
 			case lexer.TokenLinkableBegin:
-				levels.Push(&Level{ReturnToState: ParsingParagraph})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingParagraph})
 				state = ParsingLinkable
+			case lexer.TokenAttributeListBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingParagraphAfterAttributeList})
+				state = ParsingAttributeList
 			case lexer.TokenParagraphEnd:
 				levels.Pop()
 				parent := levels.Top()
 				parent.Content = append(parent.Content, &Paragraph{
+					Located: located(level.Begin, lexeme),
 					Content: level.TextRich,
 				})
 				state = level.ReturnToState
 			}
+		case ParsingParagraphAfterAttributeList:
+			switch lexeme.Type {
+			default:
+				err = errors.Join(err, invalid(lexeme))
+			case lexer.TokenParagraphEnd:
+				levels.Pop()
+				if content := trimTrailingSpace(level.TextRich); len(content) == 0 {
+					err = errors.Join(err, newError(level.Begin, state, ErrAttributeListAlone))
+				} else {
+					parent := levels.Top()
+					parent.Content = append(parent.Content, &Paragraph{
+						Located:    located(level.Begin, lexeme),
+						Attributes: currentAttributes,
+						Content:    content,
+					})
+				}
+				currentAttributes = Attributes{}
+				state = level.ReturnToState
+			}
 		case ParsingEnquoteDouble:
 			switch lexeme.Type {
 			default:
 				if !(isTextNode(lexeme) && level.TextRich.Append(newTextNode(lexeme))) {
-					err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+					err = errors.Join(err, invalid(lexeme))
 				}
 			case lexer.TokenEmphasisBegin:
-				levels.Push(&Level{ReturnToState: ParsingEnquoteDouble})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEnquoteDouble})
 				state = ParsingEmphasis
 			case lexer.TokenEmphasisStrongBegin:
-				levels.Push(&Level{ReturnToState: ParsingEnquoteDouble})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEnquoteDouble})
 				state = ParsingEmphasisStrong
 			case lexer.TokenStrongBegin:
-				levels.Push(&Level{ReturnToState: ParsingEnquoteDouble})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEnquoteDouble})
 				state = ParsingStrong
 			case lexer.TokenStrikethroughBegin:
-				levels.Push(&Level{ReturnToState: ParsingEnquoteDouble})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEnquoteDouble})
 				state = ParsingStrikethrough
 			case lexer.TokenMarkerBegin:
-				levels.Push(&Level{ReturnToState: ParsingEnquoteDouble})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEnquoteDouble})
 				state = ParsingMarker
+			case lexer.TokenRubyBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEnquoteDouble})
+				state = ParsingRuby
 			case lexer.TokenHtmlTagOpen:
-				levels.Push(&Level{ReturnToState: ParsingEnquoteDouble})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEnquoteDouble})
 				state = ParsingHtmlElement
 			case lexer.TokenLinkableBegin:
-				levels.Push(&Level{ReturnToState: ParsingEnquoteDouble})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEnquoteDouble})
 				state = ParsingLinkable
+			case lexer.TokenEnquoteSingleBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEnquoteDouble})
+				state = ParsingEnquoteSingle
 				// @todo: EnquoteAngled?
 			case lexer.TokenEnquoteDoubleEnd:
 				levels.Pop()
 				parent := levels.Top()
-				ok := parent.TextRich.Append(AsRef(EnquoteDouble(level.TextRich)))
+				ok := parent.TextRich.Append(&EnquoteDouble{Located: located(level.Begin, lexeme), Content: level.TextRich})
 				Assert(ok, "enquote double must be accepted as rich text")
 				state = level.ReturnToState
 			}
+		case ParsingEnquoteSingle:
+			switch lexeme.Type {
+			default:
+				if !(isTextNode(lexeme) && level.TextRich.Append(newTextNode(lexeme))) {
+					err = errors.Join(err, invalid(lexeme))
+				}
+			case lexer.TokenEmphasisBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEnquoteSingle})
+				state = ParsingEmphasis
+			case lexer.TokenEmphasisStrongBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEnquoteSingle})
+				state = ParsingEmphasisStrong
+			case lexer.TokenStrongBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEnquoteSingle})
+				state = ParsingStrong
+			case lexer.TokenStrikethroughBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEnquoteSingle})
+				state = ParsingStrikethrough
+			case lexer.TokenMarkerBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEnquoteSingle})
+				state = ParsingMarker
+			case lexer.TokenRubyBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEnquoteSingle})
+				state = ParsingRuby
+			case lexer.TokenHtmlTagOpen:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEnquoteSingle})
+				state = ParsingHtmlElement
+			case lexer.TokenLinkableBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEnquoteSingle})
+				state = ParsingLinkable
+			case lexer.TokenEnquoteDoubleBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEnquoteSingle})
+				state = ParsingEnquoteDouble
+				// @todo: EnquoteAngled?
+			case lexer.TokenEnquoteSingleEnd:
+				levels.Pop()
+				parent := levels.Top()
+				ok := parent.TextRich.Append(&EnquoteSingle{Located: located(level.Begin, lexeme), Content: level.TextRich})
+				Assert(ok, "enquote single must be accepted as rich text")
+				state = level.ReturnToState
+			}
 		case ParsingEnquoteAngled:
 			switch lexeme.Type {
 			default:
 				if !(isTextNode(lexeme) && level.TextRich.Append(newTextNode(lexeme))) {
-					err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+					err = errors.Join(err, invalid(lexeme))
 				}
 			case lexer.TokenEmphasisBegin:
-				levels.Push(&Level{ReturnToState: ParsingEnquoteAngled})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEnquoteAngled})
 				state = ParsingEmphasis
 			case lexer.TokenEmphasisStrongBegin:
-				levels.Push(&Level{ReturnToState: ParsingEnquoteAngled})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEnquoteAngled})
 				state = ParsingEmphasisStrong
 			case lexer.TokenStrongBegin:
-				levels.Push(&Level{ReturnToState: ParsingEnquoteAngled})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEnquoteAngled})
 				state = ParsingStrong
 			case lexer.TokenStrikethroughBegin:
-				levels.Push(&Level{ReturnToState: ParsingEnquoteAngled})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEnquoteAngled})
 				state = ParsingStrikethrough
 			case lexer.TokenMarkerBegin:
-				levels.Push(&Level{ReturnToState: ParsingEnquoteAngled})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEnquoteAngled})
 				state = ParsingMarker
+			case lexer.TokenRubyBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEnquoteAngled})
+				state = ParsingRuby
 			case lexer.TokenHtmlTagOpen:
-				levels.Push(&Level{ReturnToState: ParsingEnquoteAngled})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEnquoteAngled})
 				state = ParsingHtmlElement
 			case lexer.TokenLinkableBegin:
-				levels.Push(&Level{ReturnToState: ParsingEnquoteAngled})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEnquoteAngled})
 				state = ParsingLinkable
 			case lexer.TokenEnquoteAngledEnd:
 				levels.Pop()
 				parent := levels.Top()
-				ok := parent.TextRich.Append(AsRef(EnquoteAngled(level.TextRich)))
+				ok := parent.TextRich.Append(&EnquoteAngled{Located: located(level.Begin, lexeme), Content: level.TextRich})
 				Assert(ok, "enquote angled must be accepted as rich text")
 				state = level.ReturnToState
 			}
@@ -1020,36 +1933,42 @@ func Parse(lx LexResult) (blog *Blog, err error) {
 			switch lexeme.Type {
 			default:
 				if !(isTextNode(lexeme) && level.TextRich.Append(newTextNode(lexeme))) {
-					err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+					err = errors.Join(err, invalid(lexeme))
 				}
 			case lexer.TokenEmphasisStrongBegin:
-				levels.Push(&Level{ReturnToState: ParsingEmphasis})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEmphasis})
 				state = ParsingStrong // instead of ParsingEmphasisStrong, because we're already inside an emphasis
 			case lexer.TokenStrongBegin:
-				levels.Push(&Level{ReturnToState: ParsingEmphasis})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEmphasis})
 				state = ParsingStrong
 			case lexer.TokenStrikethroughBegin:
-				levels.Push(&Level{ReturnToState: ParsingEmphasis})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEmphasis})
 				state = ParsingStrikethrough
 			case lexer.TokenMarkerBegin:
-				levels.Push(&Level{ReturnToState: ParsingEmphasis})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEmphasis})
 				state = ParsingMarker
+			case lexer.TokenRubyBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEmphasis})
+				state = ParsingRuby
 			case lexer.TokenHtmlTagOpen:
-				levels.Push(&Level{ReturnToState: ParsingEmphasis})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEmphasis})
 				state = ParsingHtmlElement
 			case lexer.TokenLinkableBegin:
-				levels.Push(&Level{ReturnToState: ParsingEmphasis})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEmphasis})
 				state = ParsingLinkable
 			case lexer.TokenEnquoteDoubleBegin:
-				levels.Push(&Level{ReturnToState: ParsingEmphasis})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEmphasis})
 				state = ParsingEnquoteDouble
+			case lexer.TokenEnquoteSingleBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEmphasis})
+				state = ParsingEnquoteSingle
 			case lexer.TokenEnquoteAngledBegin:
-				levels.Push(&Level{ReturnToState: ParsingEmphasis})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEmphasis})
 				state = ParsingEnquoteAngled
 			case lexer.TokenEmphasisEnd:
 				levels.Pop()
 				parent := levels.Top()
-				ok := parent.TextRich.Append(AsRef(Emphasis(level.TextRich)))
+				ok := parent.TextRich.Append(&Emphasis{Located: located(level.Begin, lexeme), Content: level.TextRich})
 				Assert(ok, "emphasis must be accepted as rich text")
 				state = level.ReturnToState
 			}
@@ -1057,36 +1976,42 @@ func Parse(lx LexResult) (blog *Blog, err error) {
 			switch lexeme.Type {
 			default:
 				if !(isTextNode(lexeme) && level.TextRich.Append(newTextNode(lexeme))) {
-					err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+					err = errors.Join(err, invalid(lexeme))
 				}
 			case lexer.TokenEmphasisStrongBegin:
-				levels.Push(&Level{ReturnToState: ParsingStrong})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingStrong})
 				state = ParsingEmphasis // intead of ParsingEmphasisStrong, because we're already inside a strong
 			case lexer.TokenEmphasisBegin:
-				levels.Push(&Level{ReturnToState: ParsingStrong})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingStrong})
 				state = ParsingEmphasis
 			case lexer.TokenStrikethroughBegin:
-				levels.Push(&Level{ReturnToState: ParsingStrong})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingStrong})
 				state = ParsingStrikethrough
 			case lexer.TokenMarkerBegin:
-				levels.Push(&Level{ReturnToState: ParsingStrong})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingStrong})
 				state = ParsingMarker
+			case lexer.TokenRubyBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingStrong})
+				state = ParsingRuby
 			case lexer.TokenHtmlTagOpen:
-				levels.Push(&Level{ReturnToState: ParsingStrong})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingStrong})
 				state = ParsingHtmlElement
 			case lexer.TokenLinkableBegin:
-				levels.Push(&Level{ReturnToState: ParsingStrong})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingStrong})
 				state = ParsingLinkable
 			case lexer.TokenEnquoteDoubleBegin:
-				levels.Push(&Level{ReturnToState: ParsingStrong})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingStrong})
 				state = ParsingEnquoteDouble
+			case lexer.TokenEnquoteSingleBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingStrong})
+				state = ParsingEnquoteSingle
 			case lexer.TokenEnquoteAngledBegin:
-				levels.Push(&Level{ReturnToState: ParsingStrong})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingStrong})
 				state = ParsingEnquoteAngled
 			case lexer.TokenStrongEnd:
 				levels.Pop()
 				parent := levels.Top()
-				ok := parent.TextRich.Append(AsRef(Strong(level.TextRich)))
+				ok := parent.TextRich.Append(&Strong{Located: located(level.Begin, lexeme), Content: level.TextRich})
 				Assert(ok, "strong must be accepted as rich text")
 				state = level.ReturnToState
 			}
@@ -1094,7 +2019,7 @@ func Parse(lx LexResult) (blog *Blog, err error) {
 			switch lexeme.Type {
 			default:
 				if !(isTextNode(lexeme) && level.TextRich.Append(newTextNode(lexeme))) {
-					err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+					err = errors.Join(err, invalid(lexeme))
 				}
 			case lexer.TokenStrongBegin:
 				// ignore the token
@@ -1105,27 +2030,33 @@ func Parse(lx LexResult) (blog *Blog, err error) {
 			case lexer.TokenEmphasisEnd:
 				// ignore the token
 			case lexer.TokenStrikethroughBegin:
-				levels.Push(&Level{ReturnToState: ParsingEmphasisStrong})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEmphasisStrong})
 				state = ParsingStrikethrough
 			case lexer.TokenMarkerBegin:
-				levels.Push(&Level{ReturnToState: ParsingEmphasisStrong})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEmphasisStrong})
 				state = ParsingMarker
+			case lexer.TokenRubyBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEmphasisStrong})
+				state = ParsingRuby
 			case lexer.TokenHtmlTagOpen:
-				levels.Push(&Level{ReturnToState: ParsingEmphasisStrong})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEmphasisStrong})
 				state = ParsingHtmlElement
 			case lexer.TokenLinkableBegin:
-				levels.Push(&Level{ReturnToState: ParsingEmphasisStrong})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEmphasisStrong})
 				state = ParsingLinkable
 			case lexer.TokenEnquoteDoubleBegin:
-				levels.Push(&Level{ReturnToState: ParsingEmphasisStrong})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEmphasisStrong})
 				state = ParsingEnquoteDouble
+			case lexer.TokenEnquoteSingleBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEmphasisStrong})
+				state = ParsingEnquoteSingle
 			case lexer.TokenEnquoteAngledBegin:
-				levels.Push(&Level{ReturnToState: ParsingEmphasisStrong})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingEmphasisStrong})
 				state = ParsingEnquoteAngled
 			case lexer.TokenEmphasisStrongEnd:
 				levels.Pop()
 				parent := levels.Top()
-				ok := parent.TextRich.Append(AsRef(EmphasisStrong(level.TextRich)))
+				ok := parent.TextRich.Append(&EmphasisStrong{Located: located(level.Begin, lexeme), Content: level.TextRich})
 				Assert(ok, "emphasis strong must be accepted as rich text")
 				state = level.ReturnToState
 			}
@@ -1133,36 +2064,42 @@ func Parse(lx LexResult) (blog *Blog, err error) {
 			switch lexeme.Type {
 			default:
 				if !(isTextNode(lexeme) && level.TextRich.Append(newTextNode(lexeme))) {
-					err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+					err = errors.Join(err, invalid(lexeme))
 				}
 			case lexer.TokenEmphasisBegin:
-				levels.Push(&Level{ReturnToState: ParsingStrikethrough})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingStrikethrough})
 				state = ParsingEmphasis
 			case lexer.TokenStrongBegin:
-				levels.Push(&Level{ReturnToState: ParsingStrikethrough})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingStrikethrough})
 				state = ParsingStrong
 			case lexer.TokenEmphasisStrongBegin:
-				levels.Push(&Level{ReturnToState: ParsingStrikethrough})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingStrikethrough})
 				state = ParsingEmphasisStrong
 			case lexer.TokenEnquoteDoubleBegin:
-				levels.Push(&Level{ReturnToState: ParsingStrikethrough})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingStrikethrough})
 				state = ParsingEnquoteDouble
+			case lexer.TokenEnquoteSingleBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingStrikethrough})
+				state = ParsingEnquoteSingle
 			case lexer.TokenEnquoteAngledBegin:
-				levels.Push(&Level{ReturnToState: ParsingStrikethrough})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingStrikethrough})
 				state = ParsingEnquoteAngled
 			case lexer.TokenMarkerBegin:
-				levels.Push(&Level{ReturnToState: ParsingStrikethrough})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingStrikethrough})
 				state = ParsingMarker
+			case lexer.TokenRubyBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingStrikethrough})
+				state = ParsingRuby
 			case lexer.TokenHtmlTagOpen:
-				levels.Push(&Level{ReturnToState: ParsingStrikethrough, Html: &Html{Name: lexeme.Text}})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingStrikethrough, Html: &Html{Name: lexeme.Text}})
 				state = ParsingHtmlElement
 			case lexer.TokenLinkableBegin:
-				levels.Push(&Level{ReturnToState: ParsingStrikethrough})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingStrikethrough})
 				state = ParsingLinkable
 			case lexer.TokenStrikethroughEnd:
 				levels.Pop()
 				parent := levels.Top()
-				ok := parent.TextRich.Append(AsRef(Strikethrough(level.TextRich)))
+				ok := parent.TextRich.Append(&Strikethrough{Located: located(level.Begin, lexeme), Content: level.TextRich})
 				Assert(ok, "strikethrough must be accepted as rich text")
 				state = level.ReturnToState
 			}
@@ -1170,44 +2107,71 @@ func Parse(lx LexResult) (blog *Blog, err error) {
 			switch lexeme.Type {
 			default:
 				if !(isTextNode(lexeme) && level.TextRich.Append(newTextNode(lexeme))) {
-					err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+					err = errors.Join(err, invalid(lexeme))
 				}
 			case lexer.TokenEmphasisBegin:
-				levels.Push(&Level{ReturnToState: ParsingParagraph})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingMarker})
 				state = ParsingEmphasis
 			case lexer.TokenStrongBegin:
-				levels.Push(&Level{ReturnToState: ParsingParagraph})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingMarker})
 				state = ParsingStrong
 			case lexer.TokenEmphasisStrongBegin:
-				levels.Push(&Level{ReturnToState: ParsingParagraph})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingMarker})
 				state = ParsingEmphasisStrong
 			case lexer.TokenEnquoteDoubleBegin:
-				levels.Push(&Level{ReturnToState: ParsingParagraph})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingMarker})
 				state = ParsingEnquoteDouble
+			case lexer.TokenEnquoteSingleBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingMarker})
+				state = ParsingEnquoteSingle
 			case lexer.TokenEnquoteAngledBegin:
-				levels.Push(&Level{ReturnToState: ParsingParagraph})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingMarker})
 				state = ParsingEnquoteAngled
 			case lexer.TokenStrikethroughBegin:
-				levels.Push(&Level{ReturnToState: ParsingParagraph})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingMarker})
 				state = ParsingStrikethrough
 			case lexer.TokenHtmlTagOpen:
-				levels.Push(&Level{ReturnToState: ParsingParagraph, Html: &Html{Name: lexeme.Text}})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingMarker, Html: &Html{Name: lexeme.Text}})
 				state = ParsingHtmlElement
 			case lexer.TokenLinkableBegin:
-				levels.Push(&Level{ReturnToState: ParsingParagraph})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingMarker})
 				state = ParsingLinkable
 			case lexer.TokenMarkerEnd:
 				levels.Pop()
 				parent := levels.Top()
-				ok := parent.TextRich.Append(AsRef(Marker(level.TextRich)))
+				ok := parent.TextRich.Append(&Marker{Located: located(level.Begin, lexeme), Content: level.TextRich})
 				Assert(ok, "marker must be accepted as rich text")
 				state = level.ReturnToState
 			}
+		case ParsingRuby:
+			switch lexeme.Type {
+			default:
+				err = errors.Join(err, invalid(lexeme))
+			case lexer.TokenRubyBase, lexer.TokenRubyText:
+				level.PushString(lexeme.Text)
+			case lexer.TokenRubyEnd:
+				levels.Pop()
+				parent := levels.Top()
+				Assert(len(level.Strings) >= 2, "ruby must have a base and a reading")
+				base, readings := level.Strings[0], level.Strings[1:]
+				ruby := &Ruby{Located: located(level.Begin, lexeme), Kanji: []string{base}, Furigana: readings}
+				if len(readings) > 1 {
+					if len(readings) == utf8.RuneCountInString(base) {
+						ruby.Kanji = strings.Split(base, "")
+					} else {
+						err = errors.Join(err, newError(lexeme, state, ErrRubyReadings))
+						ruby.Furigana = []string{strings.Join(readings, "")}
+					}
+				}
+				ok := parent.TextRich.Append(ruby)
+				Assert(ok, "ruby must be accepted as rich text")
+				state = level.ReturnToState
+			}
 		case ParsingLinkable:
 			switch lexeme.Type {
 			default:
 				if !(isTextNode(lexeme) && level.TextRich.Append(newTextNode(lexeme))) {
-					err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+					err = errors.Join(err, invalid(lexeme))
 				}
 			case lexer.TokenLinkHref:
 				level.PushString(lexeme.Text)
@@ -1224,25 +2188,66 @@ func Parse(lx LexResult) (blog *Blog, err error) {
 				currentSidenote.Word = level.TextRich
 				level.Clear()
 				state = ParsingSidenoteContent
+			case lexer.TokenAttributeListBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSpanAfterAttributeList})
+				state = ParsingAttributeList
 			case lexer.TokenLinkableEnd:
 				levels.Pop()
 				parent := levels.Top()
 				ok := parent.TextRich.Append(AsRef(Link{
-					Name: level.TextRich,
+					Located: located(level.Begin, lexeme),
+					Name:    level.TextRich,
 				}))
 				Assert(ok, "link must be accepted as rich text")
 				state = level.ReturnToState
 			}
+		case ParsingSpanAfterAttributeList:
+			switch lexeme.Type {
+			default:
+				err = errors.Join(err, invalid(lexeme))
+			case lexer.TokenLinkableEnd:
+				levels.Pop()
+				parent := levels.Top()
+				ok := parent.TextRich.Append(&Span{
+					Located:    located(level.Begin, lexeme),
+					Attributes: currentAttributes,
+					Content:    level.TextRich,
+				})
+				Assert(ok, "span must be accepted as rich text")
+				currentAttributes = Attributes{}
+				state = level.ReturnToState
+			}
 		case ParsingLinkableAfterHref:
 			switch lexeme.Type {
 			default:
-				err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+				err = errors.Join(err, invalid(lexeme))
+			case lexer.TokenLinkTitle:
+				level.PushString(lexeme.Text)
+				state = ParsingLinkableAfterTitle
+			case lexer.TokenLinkableEnd:
+				levels.Pop()
+				parent := levels.Top()
+				ok := parent.TextRich.Append(AsRef(Link{
+					Located: located(level.Begin, lexeme),
+					Href:    level.PopString(),
+					Name:    level.TextRich,
+				}))
+				Assert(ok, "link must be accepted as rich text")
+				state = level.ReturnToState
+			}
+		case ParsingLinkableAfterTitle:
+			switch lexeme.Type {
+			default:
+				err = errors.Join(err, invalid(lexeme))
 			case lexer.TokenLinkableEnd:
 				levels.Pop()
 				parent := levels.Top()
+				title := level.PopString()
 				ok := parent.TextRich.Append(AsRef(Link{
-					Href: level.PopString(),
-					Name: level.TextRich,
+					Located: located(level.Begin, lexeme),
+					Href:    level.PopString(),
+					Title:   title,
+					Name:    level.TextRich,
 				}))
 				Assert(ok, "link must be accepted as rich text")
 				state = level.ReturnToState
@@ -1250,13 +2255,14 @@ func Parse(lx LexResult) (blog *Blog, err error) {
 		case ParsingLinkableAfterRef:
 			switch lexeme.Type {
 			default:
-				err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+				err = errors.Join(err, invalid(lexeme))
 			case lexer.TokenLinkableEnd:
 				levels.Pop()
 				parent := levels.Top()
 				ok := parent.TextRich.Append(AsRef(Link{
-					Ref:  level.PopString(),
-					Name: level.TextRich,
+					Located: located(level.Begin, lexeme),
+					Ref:     level.PopString(),
+					Name:    level.TextRich,
 				}))
 				Assert(ok, "link must be accepted as rich text")
 				state = level.ReturnToState
@@ -1264,10 +2270,11 @@ func Parse(lx LexResult) (blog *Blog, err error) {
 		case ParsingSidenoteAfterRef:
 			switch lexeme.Type {
 			default:
-				err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+				err = errors.Join(err, invalid(lexeme))
 			case lexer.TokenLinkableEnd:
 				levels.Pop()
 				parent := levels.Top()
+				currentSidenote.Located = located(level.Begin, lexeme)
 				ok := parent.TextRich.Append(currentSidenote)
 				Assert(ok, "sidenote must be accepted as rich text")
 				currentSidenote = &Sidenote{}
@@ -1277,28 +2284,185 @@ func Parse(lx LexResult) (blog *Blog, err error) {
 			switch lexeme.Type {
 			default:
 				if !(isTextNode(lexeme) && level.TextRich.Append(newTextNode(lexeme))) {
-					err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+					err = errors.Join(err, invalid(lexeme))
 				}
 			case lexer.TokenEnquoteDoubleBegin:
-				levels.Push(&Level{ReturnToState: ParsingSidenoteContent})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSidenoteContent})
 				state = ParsingEnquoteDouble
+			case lexer.TokenEnquoteSingleBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSidenoteContent})
+				state = ParsingEnquoteSingle
 			case lexer.TokenLinkableEnd:
 				levels.Pop()
 				parent := levels.Top()
 				currentSidenote.Content = level.TextRich
+				currentSidenote.Located = located(level.Begin, lexeme)
 				ok := parent.TextRich.Append(currentSidenote)
 				Assert(ok, "sidenote must be accepted as rich text")
 				currentSidenote = &Sidenote{}
 				state = level.ReturnToState
 			}
+		case ParsingList:
+			switch lexeme.Type {
+			default:
+				err = errors.Join(err, invalid(lexeme))
+			case lexer.TokenListItemBegin:
+				if level.List.Ordered && len(level.List.Items) == 0 {
+					start, convErr := strconv.Atoi(strings.TrimSuffix(lexeme.Text, "."))
+					if convErr != nil {
+						err = errors.Join(err, newError(lexeme, state, ErrInvalidListNumber))
+					}
+					level.List.Start = start
+				}
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingList, ListItem: &ListItem{}})
+				state = ParsingListItem
+			case lexer.TokenListEnd:
+				levels.Pop()
+				parent := levels.Top()
+				level.List.Located = located(level.Begin, lexeme)
+				parent.Content = append(parent.Content, level.List)
+				state = level.ReturnToState
+			}
+		case ParsingListItem:
+			switch lexeme.Type {
+			default:
+				err = errors.Join(err, invalid(lexeme))
+			case lexer.TokenListItemTask:
+				level.ListItem.Task = true
+				level.ListItem.Checked = lexeme.Text != "[ ]"
+			case lexer.TokenParagraphBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingListItem})
+				state = ParsingParagraph
+			case lexer.TokenHorizontalRule:
+				level.Content = append(level.Content, &HorizontalRule{Located: located(lexeme, lexeme)})
+			case lexer.TokenCodeBlockBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingListItem})
+				state = ParsingCodeBlock
+			case lexer.TokenImageBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingListItem})
+				state = ParsingImage
+			case lexer.TokenBlockquoteBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingListItem, BlockQuote: &BlockQuote{}})
+				state = ParsingBlockquote
+			case lexer.TokenTableBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingListItem})
+				state = ParsingTable
+			case lexer.TokenAdmonitionBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingListItem, Admonition: newAdmonition(lexeme)})
+				state = ParsingAdmonition
+			case lexer.TokenListUnorderedBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingListItem, List: &List{}})
+				state = ParsingList
+			case lexer.TokenListOrderedBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingListItem, List: &List{Ordered: true}})
+				state = ParsingList
+			case lexer.TokenListItemEnd:
+				levels.Pop()
+				parent := levels.Top()
+				level.ListItem.Content = level.Content
+				level.ListItem.Located = located(level.Begin, lexeme)
+				parent.List.Items = append(parent.List.Items, level.ListItem)
+				state = level.ReturnToState
+			}
+		case ParsingTable:
+			switch lexeme.Type {
+			default:
+				err = errors.Join(err, invalid(lexeme))
+			case lexer.TokenTableRowBegin:
+				currentRowBegin = lexeme
+				state = ParsingTableRow
+			case lexer.TokenTableAlignment:
+				currentTable.Alignments = append(currentTable.Alignments, alignmentFromDelimiter(lexeme.Text))
+			case lexer.TokenAttributeListBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingTable})
+				state = ParsingAttributeList
+			case lexer.TokenTableEnd:
+				columns := len(currentTable.Alignments)
+				if len(currentTable.Header) != columns {
+					err = errors.Join(err, newError(lexeme, state, ErrTableColumnCount))
+				}
+				// missing cells are left empty, excess cells are dropped
+				currentTable.Header = fitColumns(currentTable.Header, columns)
+				for i, row := range currentTable.Rows {
+					currentTable.Rows[i] = fitColumns(row, columns)
+				}
+				currentTable.Attributes = currentAttributes
+				currentTable.Located = located(level.Begin, lexeme)
+				currentAttributes = Attributes{}
+				levels.Pop()
+				parent := levels.Top()
+				parent.Content = append(parent.Content, currentTable)
+				currentTable = &Table{}
+				state = level.ReturnToState
+			}
+		case ParsingTableRow:
+			switch lexeme.Type {
+			default:
+				err = errors.Join(err, invalid(lexeme))
+			case lexer.TokenTableCellBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingTableRow})
+				state = ParsingTableCell
+			case lexer.TokenTableRowEnd:
+				if currentTable.Alignments == nil {
+					currentTable.Header = currentTableRow
+				} else {
+					if columns := len(currentTable.Alignments); len(currentTableRow) > columns {
+						blog.Warnings = append(blog.Warnings, diagnostic.Warn(located(currentRowBegin, lexeme).Span, "excess-table-cells", fmt.Errorf("table row has %d cells, but the table has only %d columns", len(currentTableRow), columns), "the excess cells are dropped"))
+					}
+					currentTable.Rows = append(currentTable.Rows, currentTableRow)
+				}
+				currentTableRow = nil
+				state = ParsingTable
+			}
+		case ParsingTableCell:
+			switch lexeme.Type {
+			default:
+				if !(isTextNode(lexeme) && level.TextRich.Append(newTextNode(lexeme))) {
+					err = errors.Join(err, invalid(lexeme))
+				}
+			case lexer.TokenEmphasisBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingTableCell})
+				state = ParsingEmphasis
+			case lexer.TokenStrongBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingTableCell})
+				state = ParsingStrong
+			case lexer.TokenEmphasisStrongBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingTableCell})
+				state = ParsingEmphasisStrong
+			case lexer.TokenEnquoteDoubleBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingTableCell})
+				state = ParsingEnquoteDouble
+			case lexer.TokenEnquoteSingleBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingTableCell})
+				state = ParsingEnquoteSingle
+			case lexer.TokenEnquoteAngledBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingTableCell})
+				state = ParsingEnquoteAngled
+			case lexer.TokenStrikethroughBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingTableCell})
+				state = ParsingStrikethrough
+			case lexer.TokenMarkerBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingTableCell})
+				state = ParsingMarker
+			case lexer.TokenRubyBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingTableCell})
+				state = ParsingRuby
+			case lexer.TokenLinkableBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingTableCell})
+				state = ParsingLinkable
+			case lexer.TokenTableCellEnd:
+				levels.Pop()
+				currentTableRow = append(currentTableRow, trimTrailingSpace(level.TextRich))
+				state = level.ReturnToState
+			}
 		case ParsingCodeBlock:
 			switch lexeme.Type {
 			default:
-				err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+				err = errors.Join(err, invalid(lexeme))
 			case lexer.TokenCodeBlockLang:
 				currentCodeBlock.Attributes["Lang"] = lexeme.Text
 			case lexer.TokenAttributeListBegin:
-				levels.Push(&Level{ReturnToState: ParsingCodeBlockAfterAttr})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingCodeBlockAfterAttr})
 				state = ParsingAttributeList
 			case lexer.TokenText:
 				level.PushString(lexeme.Text)
@@ -1307,6 +2471,9 @@ func Parse(lx LexResult) (blog *Blog, err error) {
 				// empty code block
 				levels.Pop()
 				parent := levels.Top()
+				currentCodeBlock.Attributes.Merge(currentAttributes)
+				currentAttributes = Attributes{}
+				currentCodeBlock.Located = located(level.Begin, lexeme)
 				parent.Content = append(parent.Content, currentCodeBlock)
 				currentCodeBlock = &CodeBlock{Attributes: Attributes{}}
 				state = level.ReturnToState
@@ -1314,13 +2481,16 @@ func Parse(lx LexResult) (blog *Blog, err error) {
 		case ParsingCodeBlockAfterAttr:
 			switch lexeme.Type {
 			default:
-				err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+				err = errors.Join(err, invalid(lexeme))
 			case lexer.TokenText:
 				level.PushString(lexeme.Text)
 			case lexer.TokenCodeBlockEnd:
 				levels.Pop()
 				parent := levels.Top()
 				currentCodeBlock.Lines = level.Strings
+				currentCodeBlock.Attributes.Merge(currentAttributes)
+				currentAttributes = Attributes{}
+				currentCodeBlock.Located = located(level.Begin, lexeme)
 				parent.Content = append(parent.Content, currentCodeBlock)
 				currentCodeBlock = &CodeBlock{Attributes: Attributes{}}
 				state = level.ReturnToState
@@ -1328,76 +2498,135 @@ func Parse(lx LexResult) (blog *Blog, err error) {
 		case ParsingImage:
 			switch lexeme.Type {
 			default:
-				err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+				err = errors.Join(err, invalid(lexeme))
 			case lexer.TokenImageAltText:
 				currentImage.Alt = TextSimple{newTextNode(lexeme)}
 			case lexer.TokenImagePath:
 				currentImage.Name = lexeme.Text
 			case lexer.TokenImageTitle:
 				currentImage.Title = TextSimple{newTextNode(lexeme)}
+			case lexer.TokenAttributeListBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingImageAfterAttributeList})
+				state = ParsingAttributeList
+			case lexer.TokenImageEnd:
+				levels.Pop()
+				parent := levels.Top()
+				currentImage.Located = located(level.Begin, lexeme)
+				parent.Content = append(parent.Content, currentImage)
+				currentImage = &Image{}
+				state = level.ReturnToState
+			}
+		case ParsingImageAfterAttributeList:
+			switch lexeme.Type {
+			default:
+				err = errors.Join(err, invalid(lexeme))
 			case lexer.TokenImageEnd:
 				levels.Pop()
 				parent := levels.Top()
+				currentImage.Attributes = currentAttributes
+				currentImage.Located = located(level.Begin, lexeme)
 				parent.Content = append(parent.Content, currentImage)
 				currentImage = &Image{}
+				currentAttributes = Attributes{}
 				state = level.ReturnToState
 			}
 		case ParsingBlockquote:
 			switch lexeme.Type {
 			default:
-				if !(isTextNode(lexeme) && level.TextRich.Append(newTextNode(lexeme))) {
-					err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
-				}
-			case lexer.TokenEmphasisBegin:
-				levels.Push(&Level{ReturnToState: ParsingBlockquote})
-				state = ParsingEmphasis
-			case lexer.TokenStrongBegin:
-				levels.Push(&Level{ReturnToState: ParsingBlockquote})
-				state = ParsingStrong
-			case lexer.TokenEmphasisStrongBegin:
-				levels.Push(&Level{ReturnToState: ParsingBlockquote})
-				state = ParsingEmphasisStrong
-			case lexer.TokenEnquoteDoubleBegin:
-				levels.Push(&Level{ReturnToState: ParsingBlockquote})
-				state = ParsingEnquoteDouble
-			case lexer.TokenEnquoteAngledBegin:
-				levels.Push(&Level{ReturnToState: ParsingBlockquote})
-				state = ParsingEnquoteAngled
-			case lexer.TokenStrikethroughBegin:
-				levels.Push(&Level{ReturnToState: ParsingBlockquote})
-				state = ParsingStrikethrough
-			case lexer.TokenHtmlTagOpen:
-				levels.Push(&Level{ReturnToState: ParsingBlockquote, Html: &Html{Name: lexeme.Text}})
-				state = ParsingHtmlElement
-			case lexer.TokenLinkableBegin:
-				levels.Push(&Level{ReturnToState: ParsingBlockquote})
-				state = ParsingLinkable
-			case lexer.TokenMarkerBegin:
-				levels.Push(&Level{ReturnToState: ParsingBlockquote})
-				state = ParsingMarker
+				err = errors.Join(err, invalid(lexeme))
+			case lexer.TokenHorizontalRule:
+				level.Content = append(level.Content, &HorizontalRule{Located: located(lexeme, lexeme)})
+			case lexer.TokenParagraphBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingBlockquote})
+				state = ParsingParagraph
+			case lexer.TokenCodeBlockBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingBlockquote})
+				state = ParsingCodeBlock
+			case lexer.TokenImageBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingBlockquote})
+				state = ParsingImage
+			case lexer.TokenBlockquoteBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingBlockquote, BlockQuote: &BlockQuote{}})
+			case lexer.TokenListUnorderedBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingBlockquote, List: &List{}})
+				state = ParsingList
+			case lexer.TokenListOrderedBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingBlockquote, List: &List{Ordered: true}})
+				state = ParsingList
+			case lexer.TokenTableBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingBlockquote})
+				state = ParsingTable
+			case lexer.TokenAdmonitionBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingBlockquote, Admonition: newAdmonition(lexeme)})
+				state = ParsingAdmonition
 			case lexer.TokenBlockquoteAttrAuthor:
-				currentBlockquote.QuoteText = level.TextRich
+				level.BlockQuote.Content = level.Content
 				level.Clear()
 				state = ParsingBlockquoteAuthor
 			case lexer.TokenBlockquoteEnd:
 				levels.Pop()
 				parent := levels.Top()
-				currentBlockquote.QuoteText = level.TextRich
-				parent.Content = append(parent.Content, currentBlockquote)
+				level.BlockQuote.Content = level.Content
+				level.BlockQuote.Located = located(level.Begin, lexeme)
+				parent.Content = append(parent.Content, level.BlockQuote)
+				state = level.ReturnToState
+			}
+		case ParsingAdmonition:
+			switch lexeme.Type {
+			default:
+				err = errors.Join(err, invalid(lexeme))
+			case lexer.TokenAdmonitionType:
+				if !slices.Contains(AdmonitionTypes, lexeme.Text) {
+					err = errors.Join(err, newError(lexeme, state, ErrAdmonitionType))
+				}
+				level.Admonition.Type = lexeme.Text
+			case lexer.TokenAdmonitionTitle:
+				level.Admonition.Title = TextSimple{newTextNode(lexeme)}
+			case lexer.TokenHorizontalRule:
+				level.Content = append(level.Content, &HorizontalRule{Located: located(lexeme, lexeme)})
+			case lexer.TokenParagraphBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingAdmonition})
+				state = ParsingParagraph
+			case lexer.TokenCodeBlockBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingAdmonition})
+				state = ParsingCodeBlock
+			case lexer.TokenImageBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingAdmonition})
+				state = ParsingImage
+			case lexer.TokenBlockquoteBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingAdmonition, BlockQuote: &BlockQuote{}})
+				state = ParsingBlockquote
+			case lexer.TokenListUnorderedBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingAdmonition, List: &List{}})
+				state = ParsingList
+			case lexer.TokenListOrderedBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingAdmonition, List: &List{Ordered: true}})
+				state = ParsingList
+			case lexer.TokenTableBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingAdmonition})
+				state = ParsingTable
+			case lexer.TokenAdmonitionBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingAdmonition, Admonition: newAdmonition(lexeme)})
+			case lexer.TokenAdmonitionEnd:
+				levels.Pop()
+				parent := levels.Top()
+				level.Admonition.Content = level.Content
+				level.Admonition.Located = located(level.Begin, lexeme)
+				parent.Content = append(parent.Content, level.Admonition)
 				state = level.ReturnToState
 			}
 		case ParsingBlockquoteAuthor:
 			switch lexeme.Type {
 			default:
 				if !(isTextNode(lexeme) && level.TextSimple.Append(newTextNode(lexeme))) {
-					err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+					err = errors.Join(err, invalid(lexeme))
 				}
 			case lexer.TokenBlockquoteAttrSource:
-				currentBlockquote.Author = level.TextSimple
+				level.BlockQuote.Author = level.TextSimple
 				level.Clear()
 				state = ParsingBlockquoteSource
 			case lexer.TokenBlockquoteAttrEnd:
-				currentBlockquote.Author = level.TextSimple
+				level.BlockQuote.Author = level.TextSimple
 				level.Clear()
 				state = ParsingBlockquoteAfterAttrEnd
 			}
@@ -1405,32 +2634,44 @@ func Parse(lx LexResult) (blog *Blog, err error) {
 			switch lexeme.Type {
 			default:
 				if !(isTextNode(lexeme) && level.TextRich.Append(newTextNode(lexeme))) {
-					err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+					err = errors.Join(err, invalid(lexeme))
 				}
 			case lexer.TokenLinkableBegin:
-				levels.Push(&Level{ReturnToState: ParsingBlockquoteSource})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingBlockquoteSource})
 				state = ParsingLinkable
 			case lexer.TokenBlockquoteAttrEnd:
-				currentBlockquote.Source = level.TextRich
+				level.BlockQuote.Source = level.TextRich
 				level.Clear()
 				state = ParsingBlockquoteAfterAttrEnd
 			}
 		case ParsingBlockquoteAfterAttrEnd:
 			switch lexeme.Type {
 			default:
-				err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+				err = errors.Join(err, invalid(lexeme))
 			case lexer.TokenBlockquoteEnd:
 				levels.Pop()
 				parent := levels.Top()
-				parent.Content = append(parent.Content, currentBlockquote)
+				level.BlockQuote.Located = located(level.Begin, lexeme)
+				parent.Content = append(parent.Content, level.BlockQuote)
 				state = level.ReturnToState
 			}
 		case ParsingLinkDefinition:
 			switch lexeme.Type {
 			default:
-				err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+				err = errors.Join(err, invalid(lexeme))
 			case lexer.TokenText:
 				blog.LinkDefinitions[currentDefinition] = lexeme.Text
+				blog.Locations.LinkDefinitions[currentDefinition] = located(level.Begin, lexeme).Span
+				levels.Pop()
+				state = level.ReturnToState
+			}
+		case ParsingAbbreviationDefinition:
+			switch lexeme.Type {
+			default:
+				err = errors.Join(err, invalid(lexeme))
+			case lexer.TokenText:
+				blog.AbbreviationDefinitions[currentDefinition] = strings.TrimSpace(lexeme.Text)
+				blog.Locations.AbbreviationDefinitions[currentDefinition] = located(level.Begin, lexeme).Span
 				levels.Pop()
 				state = level.ReturnToState
 			}
@@ -1438,54 +2679,121 @@ func Parse(lx LexResult) (blog *Blog, err error) {
 			switch lexeme.Type {
 			default:
 				if !(isTextNode(lexeme) && level.TextRich.Append(newTextNode(lexeme))) {
-					err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+					err = errors.Join(err, invalid(lexeme))
 				}
 			case lexer.TokenEmphasisBegin:
-				levels.Push(&Level{ReturnToState: ParsingSidenoteDefinition})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSidenoteDefinition})
 				state = ParsingEmphasis
 			case lexer.TokenStrongBegin:
-				levels.Push(&Level{ReturnToState: ParsingSidenoteDefinition})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSidenoteDefinition})
 				state = ParsingStrong
 			case lexer.TokenEmphasisStrongBegin:
-				levels.Push(&Level{ReturnToState: ParsingSidenoteDefinition})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSidenoteDefinition})
 				state = ParsingEmphasisStrong
 			case lexer.TokenEnquoteDoubleBegin:
-				levels.Push(&Level{ReturnToState: ParsingSidenoteDefinition})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSidenoteDefinition})
 				state = ParsingEnquoteDouble
+			case lexer.TokenEnquoteSingleBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSidenoteDefinition})
+				state = ParsingEnquoteSingle
 			case lexer.TokenEnquoteAngledBegin:
-				levels.Push(&Level{ReturnToState: ParsingSidenoteDefinition})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSidenoteDefinition})
 				state = ParsingEnquoteAngled
 			case lexer.TokenStrikethroughBegin:
-				levels.Push(&Level{ReturnToState: ParsingSidenoteDefinition})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSidenoteDefinition})
 				state = ParsingStrikethrough
 			case lexer.TokenMarkerBegin:
-				levels.Push(&Level{ReturnToState: ParsingSidenoteDefinition})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSidenoteDefinition})
 				state = ParsingMarker
+			case lexer.TokenRubyBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSidenoteDefinition})
+				state = ParsingRuby
 			case lexer.TokenLinkableBegin:
-				levels.Push(&Level{ReturnToState: ParsingSidenoteDefinition})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingSidenoteDefinition})
 				state = ParsingLinkable
+			case lexer.TokenParagraphBegin:
+				currentParagraphs = append(currentParagraphs, level.TextRich)
+				level.TextRich = nil
+			case lexer.TokenParagraphEnd:
+				// the paragraph is finished by the next TokenParagraphBegin or TokenSidenoteDefEnd
 			case lexer.TokenSidenoteDefEnd:
-				blog.SidenoteDefinitions[currentDefinition] = level.TextRich
+				paragraphs := append(currentParagraphs, level.TextRich)
+				blog.SidenoteDefinitions[currentDefinition] = paragraphs[0]
+				blog.FootnoteDefinitions[currentDefinition] = paragraphs
+				blog.Locations.SidenoteDefinitions[currentDefinition] = located(level.Begin, lexeme).Span
+				currentParagraphs = nil
 				levels.Pop()
 				state = level.ReturnToState
 			}
-		case ParsingTermDefinition:
+		case ParsingDefinitionList:
 			switch lexeme.Type {
 			default:
-				err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+				err = errors.Join(err, invalid(lexeme))
+			case lexer.TokenDefinitionTerm:
+				level.DefinitionList.Definitions = append(level.DefinitionList.Definitions, &Definition{
+					Term: TextRich{&Text{Located: located(lexeme, lexeme), Text: lexeme.Text}},
+				})
+				level.PushString(lexeme.Text)
 			case lexer.TokenDefinitionExplanationBegin:
+				if len(level.DefinitionList.Definitions) == 0 {
+					err = errors.Join(err, newError(lexeme, state, ErrExplanationMissingTerm))
+					level.DefinitionList.Definitions = append(level.DefinitionList.Definitions, &Definition{})
+					level.PushString("")
+				}
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingDefinitionList})
 				state = ParsingTermExplanation
+			case lexer.TokenDefinitionListEnd:
+				levels.Pop()
+				parent := levels.Top()
+				level.DefinitionList.Located = located(level.Begin, lexeme)
+				parent.Content = append(parent.Content, level.DefinitionList)
+				state = level.ReturnToState
 			}
 		case ParsingTermExplanation:
 			switch lexeme.Type {
 			default:
 				if !(isTextNode(lexeme) && level.TextRich.Append(newTextNode(lexeme))) {
-					err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+					err = errors.Join(err, invalid(lexeme))
 				}
+			case lexer.TokenEmphasisBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingTermExplanation})
+				state = ParsingEmphasis
+			case lexer.TokenStrongBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingTermExplanation})
+				state = ParsingStrong
+			case lexer.TokenEmphasisStrongBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingTermExplanation})
+				state = ParsingEmphasisStrong
+			case lexer.TokenEnquoteDoubleBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingTermExplanation})
+				state = ParsingEnquoteDouble
+			case lexer.TokenEnquoteSingleBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingTermExplanation})
+				state = ParsingEnquoteSingle
+			case lexer.TokenEnquoteAngledBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingTermExplanation})
+				state = ParsingEnquoteAngled
+			case lexer.TokenStrikethroughBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingTermExplanation})
+				state = ParsingStrikethrough
+			case lexer.TokenMarkerBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingTermExplanation})
+				state = ParsingMarker
+			case lexer.TokenRubyBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingTermExplanation})
+				state = ParsingRuby
+			case lexer.TokenLinkableBegin:
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingTermExplanation})
+				state = ParsingLinkable
 			case lexer.TokenDefinitionExplanationEnd:
 				levels.Pop()
-				blog.TermDefinitions[currentTerm] = level.TextRich
-				currentTerm = ""
+				parent := levels.Top()
+				definition := parent.DefinitionList.Definitions[len(parent.DefinitionList.Definitions)-1]
+				definition.Explanations = append(definition.Explanations, level.TextRich)
+				term := parent.Strings[len(parent.Strings)-1]
+				if _, exists := blog.TermDefinitions[term]; !exists {
+					blog.TermDefinitions[term] = level.TextRich // first explanation of the term
+				}
 				state = level.ReturnToState
 			}
 		case ParsingHtmlElement:
@@ -1504,8 +2812,7 @@ func Parse(lx LexResult) (blog *Blog, err error) {
 			case lexer.TokenHtmlTagAttrKey:
 				// finish current key
 				var val string
-				if len(level.Strings) > 0 {
-					Assert(len(level.Strings) == 2, "")
+				if len(level.Strings) == 2 { // attributes without value, like hidden, only push their key
 					val = level.PopString()
 				}
 				key := level.PopString()
@@ -1517,8 +2824,7 @@ func Parse(lx LexResult) (blog *Blog, err error) {
 			case lexer.TokenHtmlTagContent:
 				// finish last key
 				var val string
-				if len(level.Strings) > 0 {
-					Assert(len(level.Strings) == 2, "")
+				if len(level.Strings) == 2 { // attributes without value, like hidden, only push their key
 					val = level.PopString()
 				}
 				key := level.PopString()
@@ -1530,17 +2836,18 @@ func Parse(lx LexResult) (blog *Blog, err error) {
 			switch lexeme.Type {
 			default:
 				if !(isTextNode(lexeme) && level.TextRich.Append(newTextNode(lexeme))) {
-					err = errors.Join(err, newError(lexeme, state, ErrInvalidToken))
+					err = errors.Join(err, invalid(lexeme))
 				}
 			case lexer.TokenParagraphBegin:
-				levels.Push(&Level{ReturnToState: ParsingHtmlElementContent})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingHtmlElementContent})
 				state = ParsingParagraph
 			case lexer.TokenHtmlTagOpen:
-				levels.Push(&Level{ReturnToState: ParsingHtmlElementContent, Html: &Html{Name: lexeme.Text}})
+				levels.Push(&Level{Begin: lexeme, ReturnToState: ParsingHtmlElementContent, Html: &Html{Name: lexeme.Text}})
 				state = ParsingHtmlElement
 			case lexer.TokenHtmlTagClose:
 				levels.Pop()
 				parent := levels.Top()
+				level.Html.Located = located(level.Begin, lexeme)
 				if len(level.TextRich) > 0 { // inline html element
 					level.Html.Content = level.TextRich
 					parent.TextRich = append(parent.TextRich, level.Html)
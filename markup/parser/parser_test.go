@@ -1,12 +1,17 @@
 package parser_test
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/go-test/deep"
 	//"github.com/kr/pretty"
 
 	"github.com/cvanloo/blog-go/markup"
+	"github.com/cvanloo/blog-go/markup/diagnostic"
+	"github.com/cvanloo/blog-go/markup/lexer"
 	"github.com/cvanloo/blog-go/markup/parser"
 )
 
@@ -38,3 +43,405 @@ func TestParsingFixReferences(t *testing.T) {
 		t.Error(diff)
 	}
 }
+
+func TestParsingFixReferencesFootnotes(t *testing.T) {
+	lx := lexer.New()
+	err := lx.LexSource("footnotes", `
+# Footnotes
+
+First [^b], second [^a], first again [^b].
+
+[^a]: Note a.
+
+[^b]: Note b.
+
+    Continued.
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blog, err := parser.Parse(lx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refFixer := &parser.FixReferencesVisitor{}
+	blog.Accept(refFixer)
+	if refFixer.Errors != nil {
+		t.Error(refFixer.Errors)
+	}
+	var footnotes []parser.Footnote
+	for _, n := range blog.Sections[0].Content[0].(*parser.Paragraph).Content {
+		if f, ok := n.(*parser.Footnote); ok {
+			footnotes = append(footnotes, *f)
+		}
+	}
+	expectedFootnotes := []parser.Footnote{
+		{Ref: "b", Number: 1, Use: 1},
+		{Ref: "a", Number: 2, Use: 1},
+		{Ref: "b", Number: 1, Use: 2},
+	}
+	if diff := deep.Equal(footnotes, expectedFootnotes); diff != nil {
+		t.Error(diff)
+	}
+	text := func(s string) parser.TextRich {
+		return parser.TextRich{&parser.Text{Text: s}}
+	}
+	expectedEndnotes := []*parser.Endnote{
+		{Ref: "b", Number: 1, Uses: 2, Paragraphs: []parser.TextRich{text("Note b."), text("Continued.\n")}},
+		{Ref: "a", Number: 2, Uses: 1, Paragraphs: []parser.TextRich{text("Note a.")}},
+	}
+	if diff := deep.Equal(blog.Endnotes, expectedEndnotes); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestParsingFixReferencesFootnoteErrors(t *testing.T) {
+	lx := lexer.New()
+	err := lx.LexSource("footnotes", `
+# Footnotes
+
+Undefined [^missing] and a word[^long] with a sidenote.
+
+[^unused]: Never referenced.
+
+[^long]: Too long for a sidenote.
+
+    Second paragraph.
+
+[^unused-long]: Never referenced either.
+
+    Second paragraph.
+
+A loop[^loop].
+
+[^loop]: Refers to its own [loop][^loop].
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blog, err := parser.Parse(lx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refFixer := &parser.FixReferencesVisitor{}
+	blog.Accept(refFixer)
+	if refFixer.Errors == nil {
+		t.Fatal("expected errors")
+	}
+	errs := strings.Split(refFixer.Errors.Error(), "\n")
+	expected := []string{
+		"footnotes:4:13: missing content definition for footnote with id: missing",
+		"footnotes:4:28: sidenote with id long: definition has more than one paragraph, only footnotes can have multiple paragraphs",
+		"footnotes:18:28: sidenote with id loop is referenced from its own definition",
+		"footnotes:6:3: unused definition for sidenote or footnote with id: unused",
+		"footnotes:12:3: unused definition for footnote with id: unused-long",
+	}
+	if diff := deep.Equal(errs, expected); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestParsingTableColumns(t *testing.T) {
+	lx := lexer.New()
+	err := lx.LexSource("table", `
+# Section 1
+
+| Tool | Notes | Extra |
+|------|-------|
+| [Go][go] |
+| a | b | c |
+
+[go]: https://go.dev
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blog, err := parser.Parse(lx)
+	var parserErr parser.ParserError
+	if !errors.As(err, &parserErr) || parserErr.Inner != parser.ErrTableColumnCount {
+		t.Errorf("expected error %v, got: %v", parser.ErrTableColumnCount, err)
+	}
+	refFixer := &parser.FixReferencesVisitor{}
+	blog.Accept(refFixer)
+	if refFixer.Errors != nil {
+		t.Error(refFixer.Errors)
+	}
+	table := blog.Sections[0].Content[0].(*parser.Table)
+	if len(table.Header) != 2 {
+		t.Errorf("expected header to have 2 cells, got: %d", len(table.Header))
+	}
+	for i, row := range table.Rows {
+		if len(row) != 2 {
+			t.Errorf("expected row %d to have 2 cells, got: %d", i, len(row))
+		}
+	}
+	link := table.Rows[0][0][0].(*parser.Link)
+	if link.Href != "https://go.dev" {
+		t.Errorf("expected link in table cell to be resolved, got: %q", link.Href)
+	}
+	var warnings []string
+	for _, w := range blog.Warnings {
+		warnings = append(warnings, w.Error())
+	}
+	expectedWarnings := []string{
+		"table:7:2: table row has 3 cells, but the table has only 2 columns",
+	}
+	if diff := deep.Equal(warnings, expectedWarnings); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestParsingFixReferencesAbbreviations(t *testing.T) {
+	lx := lexer.New()
+	err := lx.LexSource("abbreviations", `
+# Abbreviations
+
+HTML and XHTML, but not HTMLish, *in HTML too*.
+*[HTML]: HyperText Markup Language
+*[XHTML]: Extensible HyperText Markup Language
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blog, err := parser.Parse(lx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refFixer := &parser.FixReferencesVisitor{}
+	blog.Accept(refFixer)
+	if refFixer.Errors != nil {
+		t.Error(refFixer.Errors)
+	}
+	html := &parser.Abbreviation{Abbr: "HTML", Title: "HyperText Markup Language"}
+	expected := []parser.Node{
+		html,
+		&parser.Text{Text: " and "},
+		&parser.Abbreviation{Abbr: "XHTML", Title: "Extensible HyperText Markup Language"},
+		&parser.Text{Text: ", but not HTMLish, "},
+		&parser.Emphasis{Content: parser.TextRich{&parser.Text{Text: "in "}, html, &parser.Text{Text: " too"}}},
+		&parser.Text{Text: "."},
+	}
+	if diff := deep.Equal(blog.Sections[0].Content[0].(*parser.Paragraph).Content, expected); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestParsingAbbreviationLocations(t *testing.T) {
+	lx := lexer.New()
+	err := lx.LexSource("abbreviations.md", `
+# Abbreviations
+
+Say HTML,
+or XHTML.
+*[HTML]: HyperText Markup Language
+*[XHTML]: Extensible HyperText Markup Language
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blog, err := parser.Parse(lx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refFixer := &parser.FixReferencesVisitor{}
+	blog.Accept(refFixer)
+	if refFixer.Errors != nil {
+		t.Fatal(refFixer.Errors)
+	}
+	var spans []string
+	for _, block := range blog.Sections[0].Content {
+		for _, n := range block.(*parser.Paragraph).Content {
+			span := n.(interface{ Location() diagnostic.Span }).Location()
+			spans = append(spans, span.String()+" "+span.End.String())
+		}
+	}
+	expected := []string{
+		"abbreviations.md:4:1 4:5",  // "Say "
+		"abbreviations.md:4:5 4:9",  // HTML
+		"abbreviations.md:4:9 5:4",  // ",\nor "
+		"abbreviations.md:5:4 5:9",  // XHTML
+		"abbreviations.md:5:9 5:10", // "."
+	}
+	if diff := deep.Equal(spans, expected); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestParsingLocations(t *testing.T) {
+	lx := lexer.New()
+	err := lx.LexSource("locations.md", `
+# Locations
+
+A [link][missing] in a *paragraph*.
+
+> Quoted.
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blog, err := parser.Parse(lx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	section := blog.Sections[0]
+	paragraph := section.Content[0].(*parser.Paragraph)
+	text := paragraph.Content[0].(*parser.Text)
+	link := paragraph.Content[1].(*parser.Link)
+	emphasis := paragraph.Content[3].(*parser.Emphasis)
+	quote := section.Content[1].(*parser.BlockQuote)
+	locations := map[string]diagnostic.Span{
+		"blog":      blog.Location(),
+		"section":   section.Location(),
+		"paragraph": paragraph.Location(),
+		"text":      text.Location(),
+		"link":      link.Location(),
+		"emphasis":  emphasis.Location(),
+		"quote":     quote.Location(),
+	}
+	expected := map[string]string{
+		"blog":      "locations.md:1:1 7:1",
+		"section":   "locations.md:2:1 7:1",
+		"paragraph": "locations.md:4:1 4:36",
+		"text":      "locations.md:4:1 4:3",
+		"link":      "locations.md:4:3 4:18",
+		"emphasis":  "locations.md:4:24 4:35",
+		"quote":     "locations.md:6:1 7:1",
+	}
+	for name, span := range locations {
+		if got := span.String() + " " + span.End.String(); got != expected[name] {
+			t.Errorf("%s: expected span %s, got: %s", name, expected[name], got)
+		}
+	}
+	refFixer := &parser.FixReferencesVisitor{}
+	blog.Accept(refFixer)
+	expectedError := "locations.md:4:3: missing url definition for link with id: missing"
+	if refFixer.Errors == nil || refFixer.Errors.Error() != expectedError {
+		t.Errorf("expected error %q, got: %v", expectedError, refFixer.Errors)
+	}
+}
+
+func TestParsingRecovery(t *testing.T) {
+	lx := lexer.New()
+	err := lx.LexSource("recovery.md", `
+# Recovery
+
+> Quoted.
+> -- *Some* one
+
+<div hidden class="note">
+A ==marked *word*== in a paragraph.
+</div>
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blog, err := parser.Parse(lx)
+	ds := diagnostic.Collect(err)
+	if len(ds) != 1 || !errors.Is(ds[0], parser.ErrInvalidToken) || ds[0].Span.String() != "recovery.md:5:6" {
+		t.Fatalf("expected a single invalid token error at recovery.md:5:6, got: %v", ds)
+	}
+	section := blog.Sections[0]
+	if len(section.Content) != 2 {
+		t.Fatalf("expected parsing to resume after the block quote, got: %v", section.Content)
+	}
+	html := section.Content[1].(*parser.Html)
+	if diff := deep.Equal(html.Attributes, parser.Attributes{"hidden": "", "class": "note"}); diff != nil {
+		t.Error(diff)
+	}
+	paragraph := html.Content[0].(*parser.Paragraph)
+	if _, ok := paragraph.Content[1].(*parser.Marker); !ok {
+		t.Errorf("expected marker, got: %#v", paragraph.Content[1])
+	}
+}
+
+func TestParsingDefinitionListOutsideSection(t *testing.T) {
+	// the lexer doesn't lex definition lists outside of sections, but the
+	// parser must not silently drop one either
+	lx := &lexer.Lexer{Lexemes: []lexer.Token{
+		{Type: lexer.TokenDefinitionListBegin},
+		{Type: lexer.TokenDefinitionTerm, Text: "Term"},
+		{Type: lexer.TokenDefinitionListEnd},
+		{Type: lexer.TokenSectionBegin, Text: "#"},
+		{Type: lexer.TokenText, Text: "Section"},
+		{Type: lexer.TokenSectionContent},
+		{Type: lexer.TokenSectionEnd},
+		{Type: lexer.TokenEOF},
+	}}
+	blog, err := parser.Parse(lx)
+	var parserErr parser.ParserError
+	if !errors.As(err, &parserErr) || parserErr.Inner != parser.ErrContentOutsideSection {
+		t.Errorf("expected error %v, got: %v", parser.ErrContentOutsideSection, err)
+	}
+	if len(blog.Sections) != 1 {
+		t.Errorf("expected parsing to resume after the definition list, got: %v", blog.Sections)
+	}
+}
+
+func TestParseTrace(t *testing.T) {
+	lx := lexer.New()
+	err := lx.LexSource("trace.md", "# Trace\n\nSome *text*.\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var transitions []string
+	_, err = parser.ParseTrace(lx, func(tr parser.Transition) {
+		transitions = append(transitions, fmt.Sprintf("%s: %s -> %s", tr.Token.Type, tr.From, tr.To))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"SectionBegin: ParsingStart -> ParsingSection",
+		"SectionContent: ParsingSection -> ParsingSectionContent",
+		"ParagraphBegin: ParsingSectionContent -> ParsingParagraph",
+		"EmphasisBegin: ParsingParagraph -> ParsingEmphasis",
+		"EmphasisEnd: ParsingEmphasis -> ParsingParagraph",
+		"ParagraphEnd: ParsingParagraph -> ParsingSectionContent",
+		"SectionEnd: ParsingSectionContent -> ParsingDocument",
+	}
+	if diff := deep.Equal(transitions, expected); diff != nil {
+		t.Error(diff, transitions)
+	}
+}
+
+func TestParsingAttributeListID(t *testing.T) {
+	lx := lexer.New()
+	if err := lx.LexSource("attributes", "# Section {caption=\"Benchmarks\" #bench .wide}\n"); err != nil {
+		t.Fatal(err)
+	}
+	blog, err := parser.Parse(lx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := parser.Attributes{"caption": "Benchmarks", "id": "bench", "class": "wide"}
+	if diff := deep.Equal(blog.Sections[0].Attributes, expected); diff != nil {
+		t.Error(diff)
+	}
+	lx = lexer.New()
+	if err := lx.LexSource("attributes", "# Section {#one caption=Benchmarks #two}\n"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = parser.Parse(lx)
+	var parserErr parser.ParserError
+	if !errors.As(err, &parserErr) || parserErr.Inner != parser.ErrAttributeListIDs {
+		t.Errorf("expected error %v, got: %v", parser.ErrAttributeListIDs, err)
+	}
+}
+
+func TestParsingAttributeListAlone(t *testing.T) {
+	lx := lexer.New()
+	if err := lx.LexSource("attributes", "# Section\n\nSome text.\n\n{.just-attrs}\n\nMore.\n"); err != nil {
+		t.Fatal(err)
+	}
+	blog, err := parser.Parse(lx)
+	var parserErr parser.ParserError
+	if !errors.As(err, &parserErr) || parserErr.Inner != parser.ErrAttributeListAlone {
+		t.Fatalf("expected error %v, got: %v", parser.ErrAttributeListAlone, err)
+	}
+	if line := parserErr.Token.Span.Start.Line; line != 5 {
+		t.Errorf("expected error on line 5, got: %d", line)
+	}
+	if n := len(blog.Sections[0].Content); n != 2 {
+		t.Errorf("expected the empty paragraph to be dropped, got %d paragraphs", n)
+	}
+}
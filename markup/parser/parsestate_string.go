@@ -15,44 +15,54 @@ func _() {
 	_ = x[ParsingHtmlElement-4]
 	_ = x[ParsingHtmlElementAttributes-5]
 	_ = x[ParsingHtmlElementContent-6]
-	_ = x[ParsingTermDefinition-7]
+	_ = x[ParsingDefinitionList-7]
 	_ = x[ParsingTermExplanation-8]
 	_ = x[ParsingSidenoteDefinition-9]
 	_ = x[ParsingLinkDefinition-10]
-	_ = x[ParsingAttributeList-11]
-	_ = x[ParsingAttributeListAfterID-12]
-	_ = x[ParsingAttributeListVal-13]
-	_ = x[ParsingSection1-14]
-	_ = x[ParsingSection1AfterAttributeList-15]
-	_ = x[ParsingSection1Content-16]
-	_ = x[ParsingSection2-17]
-	_ = x[ParsingSection2AfterAttributeList-18]
-	_ = x[ParsingSection2Content-19]
-	_ = x[ParsingCodeBlock-20]
-	_ = x[ParsingCodeBlockAfterAttr-21]
-	_ = x[ParsingImage-22]
-	_ = x[ParsingBlockquote-23]
-	_ = x[ParsingBlockquoteAuthor-24]
-	_ = x[ParsingBlockquoteSource-25]
-	_ = x[ParsingBlockquoteAfterAttrEnd-26]
+	_ = x[ParsingAbbreviationDefinition-11]
+	_ = x[ParsingAttributeList-12]
+	_ = x[ParsingAttributeListAfterID-13]
+	_ = x[ParsingAttributeListVal-14]
+	_ = x[ParsingSection-15]
+	_ = x[ParsingSectionAfterAttributeList-16]
+	_ = x[ParsingSectionContent-17]
+	_ = x[ParsingCodeBlock-18]
+	_ = x[ParsingCodeBlockAfterAttr-19]
+	_ = x[ParsingImage-20]
+	_ = x[ParsingImageAfterAttributeList-21]
+	_ = x[ParsingBlockquote-22]
+	_ = x[ParsingBlockquoteAuthor-23]
+	_ = x[ParsingBlockquoteSource-24]
+	_ = x[ParsingBlockquoteAfterAttrEnd-25]
+	_ = x[ParsingAdmonition-26]
 	_ = x[ParsingParagraph-27]
-	_ = x[ParsingEmphasis-28]
-	_ = x[ParsingStrong-29]
-	_ = x[ParsingStrikethrough-30]
-	_ = x[ParsingMarker-31]
-	_ = x[ParsingEmphasisStrong-32]
-	_ = x[ParsingEnquoteDouble-33]
-	_ = x[ParsingEnquoteAngled-34]
-	_ = x[ParsingLinkable-35]
-	_ = x[ParsingLinkableAfterHref-36]
-	_ = x[ParsingLinkableAfterRef-37]
-	_ = x[ParsingSidenoteAfterRef-38]
-	_ = x[ParsingSidenoteContent-39]
+	_ = x[ParsingParagraphAfterAttributeList-28]
+	_ = x[ParsingEmphasis-29]
+	_ = x[ParsingStrong-30]
+	_ = x[ParsingStrikethrough-31]
+	_ = x[ParsingMarker-32]
+	_ = x[ParsingRuby-33]
+	_ = x[ParsingEmphasisStrong-34]
+	_ = x[ParsingEnquoteSingle-35]
+	_ = x[ParsingEnquoteDouble-36]
+	_ = x[ParsingEnquoteAngled-37]
+	_ = x[ParsingLinkable-38]
+	_ = x[ParsingSpanAfterAttributeList-39]
+	_ = x[ParsingLinkableAfterHref-40]
+	_ = x[ParsingLinkableAfterTitle-41]
+	_ = x[ParsingLinkableAfterRef-42]
+	_ = x[ParsingSidenoteAfterRef-43]
+	_ = x[ParsingSidenoteContent-44]
+	_ = x[ParsingList-45]
+	_ = x[ParsingListItem-46]
+	_ = x[ParsingTable-47]
+	_ = x[ParsingTableRow-48]
+	_ = x[ParsingTableCell-49]
 }
 
-const _ParseState_name = "ParsingStartParsingDocumentParsingMetaParsingMetaValParsingHtmlElementParsingHtmlElementAttributesParsingHtmlElementContentParsingTermDefinitionParsingTermExplanationParsingSidenoteDefinitionParsingLinkDefinitionParsingAttributeListParsingAttributeListAfterIDParsingAttributeListValParsingSection1ParsingSection1AfterAttributeListParsingSection1ContentParsingSection2ParsingSection2AfterAttributeListParsingSection2ContentParsingCodeBlockParsingCodeBlockAfterAttrParsingImageParsingBlockquoteParsingBlockquoteAuthorParsingBlockquoteSourceParsingBlockquoteAfterAttrEndParsingParagraphParsingEmphasisParsingStrongParsingStrikethroughParsingMarkerParsingEmphasisStrongParsingEnquoteDoubleParsingEnquoteAngledParsingLinkableParsingLinkableAfterHrefParsingLinkableAfterRefParsingSidenoteAfterRefParsingSidenoteContent"
+const _ParseState_name = "ParsingStartParsingDocumentParsingMetaParsingMetaValParsingHtmlElementParsingHtmlElementAttributesParsingHtmlElementContentParsingDefinitionListParsingTermExplanationParsingSidenoteDefinitionParsingLinkDefinitionParsingAbbreviationDefinitionParsingAttributeListParsingAttributeListAfterIDParsingAttributeListValParsingSectionParsingSectionAfterAttributeListParsingSectionContentParsingCodeBlockParsingCodeBlockAfterAttrParsingImageParsingImageAfterAttributeListParsingBlockquoteParsingBlockquoteAuthorParsingBlockquoteSourceParsingBlockquoteAfterAttrEndParsingAdmonitionParsingParagraphParsingParagraphAfterAttributeListParsingEmphasisParsingStrongParsingStrikethroughParsingMarkerParsingRubyParsingEmphasisStrongParsingEnquoteSingleParsingEnquoteDoubleParsingEnquoteAngledParsingLinkableParsingSpanAfterAttributeListParsingLinkableAfterHrefParsingLinkableAfterTitleParsingLinkableAfterRefParsingSidenoteAfterRefParsingSidenoteContentParsingListParsingListItemParsingTableParsingTableRowParsingTableCell"
 
-var _ParseState_index = [...]uint16{0, 12, 27, 38, 52, 70, 98, 123, 144, 166, 191, 212, 232, 259, 282, 297, 330, 352, 367, 400, 422, 438, 463, 475, 492, 515, 538, 567, 583, 598, 611, 631, 644, 665, 685, 705, 720, 744, 767, 790, 812}
+var _ParseState_index = [...]uint16{0, 12, 27, 38, 52, 70, 98, 123, 144, 166, 191, 212, 241, 261, 288, 311, 325, 357, 378, 394, 419, 431, 461, 478, 501, 524, 553, 570, 586, 620, 635, 648, 668, 681, 692, 713, 733, 753, 773, 788, 817, 841, 866, 889, 912, 934, 945, 960, 972, 987, 1003}
 
 func (i ParseState) String() string {
 	if i < 0 || i >= ParseState(len(_ParseState_index)-1) {
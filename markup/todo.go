@@ -0,0 +1,66 @@
+package markup
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Todo is a note left for the author in a source comment, see Markup.Todos.
+type Todo struct {
+	Filename     string
+	Pos          int
+	Line, Column int
+	Text         string
+}
+
+func (t Todo) String() string {
+	return fmt.Sprintf("%s:%d:%d: TODO: %s", t.Filename, t.Line, t.Column, t.Text)
+}
+
+// Todos lexes all sources and lists the comment lines marked with `TODO:`,
+// ordered by file and position.
+// Sources that fail to lex or parse are still searched, their errors are
+// returned together with the todos.
+func (m Markup) Todos() (todos []Todo, runErr error) {
+	mp := newMarkupProcessor(m.IncludeExt, m.ExcludeExt, m.SourcePaths, m.Sources)
+	runErr = mp.Run()
+	m.reportWarnings(mp.warnings)
+	for _, res := range mp.results {
+		if res.lex == nil {
+			continue
+		}
+		for _, comment := range res.lex.Comments {
+			// the text of the comment is trimmed, the lines of a block
+			// comment are located in the source instead
+			raw := string(res.lex.Source[comment.Pos:comment.Span.End.Offset])
+			offset := 0
+			for i, line := range strings.Split(raw, "\n") {
+				if before, todo, ok := strings.Cut(line, "TODO:"); ok {
+					t := Todo{
+						Filename: comment.Filename,
+						Pos:      comment.Pos,
+						Line:     comment.Span.Start.Line,
+						Column:   comment.Span.Start.Column,
+						Text:     strings.TrimSpace(todo),
+					}
+					if i > 0 {
+						t.Pos += offset + utf8.RuneCountInString(before)
+						t.Line += i
+						t.Column = utf8.RuneCountInString(before) + 1
+					}
+					todos = append(todos, t)
+				}
+				offset += utf8.RuneCountInString(line) + 1
+			}
+		}
+	}
+	slices.SortStableFunc(todos, func(a, b Todo) int {
+		if a.Filename != b.Filename {
+			return strings.Compare(a.Filename, b.Filename)
+		}
+		return a.Pos - b.Pos
+	})
+	return todos, runErr
+}
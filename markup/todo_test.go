@@ -0,0 +1,45 @@
+package markup_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/cvanloo/blog-go/markup"
+)
+
+func TestTodos(t *testing.T) {
+	first := `
+# First
+
+%% TODO: better title
+Text. %% not a todo
+
+%%{
+TODO: expand on this
+  TODO: and on that
+}%%
+`
+	second := `
+%% TODO: broken, but still searched
+*no section
+`
+	m := markup.New(
+		markup.Source("b.md", strings.NewReader(second)),
+		markup.Source("a.md", strings.NewReader(first)),
+	)
+	todos, err := m.Todos()
+	if err == nil {
+		t.Error("expected an error for the broken source")
+	}
+	expected := []markup.Todo{
+		{Filename: "a.md", Pos: 10, Line: 4, Column: 1, Text: "better title"},
+		{Filename: "a.md", Pos: 57, Line: 8, Column: 1, Text: "expand on this"},
+		{Filename: "a.md", Pos: 80, Line: 9, Column: 3, Text: "and on that"},
+		{Filename: "b.md", Pos: 1, Line: 2, Column: 1, Text: "broken, but still searched"},
+	}
+	if diff := deep.Equal(todos, expected); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,38 @@
+package highlight
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Styles maps token classes to css declarations.
+// Colours use light-dark() to follow the site's color scheme.
+var Styles = []struct {
+	Class Class
+	Style string
+}{
+	{ClassKeyword, "color: light-dark(#8b008b, #c586c0); font-weight: bold;"},
+	{ClassType, "color: light-dark(#00688b, #4ec9b0);"},
+	{ClassBuiltin, "color: light-dark(#00688b, #4fc1ff);"},
+	{ClassConstant, "color: light-dark(#b8860b, #d7ba7d);"},
+	{ClassFunction, "color: light-dark(#1a5fb4, #dcdcaa);"},
+	{ClassString, "color: light-dark(#2e7d32, #ce9178);"},
+	{ClassNumber, "color: light-dark(#b8860b, #b5cea8);"},
+	{ClassComment, "color: light-dark(#6a6a6a, #7f848e); font-style: italic;"},
+	{ClassVariable, "color: light-dark(#a0522d, #9cdcfe);"},
+	{ClassProperty, "color: light-dark(#1a5fb4, #9cdcfe);"},
+	{ClassSymbol, "color: light-dark(#a0522d, #d7ba7d);"},
+	{ClassMeta, "color: light-dark(#6a6a6a, #7f848e); font-weight: bold;"},
+	{ClassInserted, "color: light-dark(#2e7d32, #81c784); background-color: light-dark(#e6ffec, #12261e);"},
+	{ClassDeleted, "color: light-dark(#c62828, #e57373); background-color: light-dark(#ffebe9, #2d1517);"},
+}
+
+// CSS returns a stylesheet for the token classes produced by Highlight.
+func CSS() string {
+	var b strings.Builder
+	b.WriteString("/* Generated by koneko highlight-css, do not edit. */\n")
+	for _, s := range Styles {
+		fmt.Fprintf(&b, "code.block .%s { %s }\n", s.Class, s.Style)
+	}
+	return b.String()
+}
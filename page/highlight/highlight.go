@@ -0,0 +1,137 @@
+// Package highlight implements syntax highlighting for code blocks.
+//
+// Highlighting happens at build time and produces plain html: every token is
+// wrapped in a span with a class (see Class), the colours are defined in the
+// stylesheet returned by CSS.
+package highlight
+
+import (
+	"html/template"
+	"sort"
+	"strings"
+)
+
+type (
+	// Class is the css class of a highlighted token.
+	Class string
+
+	// Token is a piece of source code that is rendered in a single style.
+	Token struct {
+		Class Class
+		Text  string
+	}
+
+	// Language knows how to split source code into tokens.
+	Language struct {
+		// Label is the human readable name shown above the code block.
+		Label string
+		// Names lists the code block languages (```go) that select this language.
+		Names    []string
+		Tokenize func(src string) []Token
+	}
+)
+
+const (
+	ClassNone     Class = ""
+	ClassKeyword  Class = "hl-keyword"
+	ClassType     Class = "hl-type"
+	ClassBuiltin  Class = "hl-builtin"
+	ClassConstant Class = "hl-constant"
+	ClassFunction Class = "hl-function"
+	ClassString   Class = "hl-string"
+	ClassNumber   Class = "hl-number"
+	ClassComment  Class = "hl-comment"
+	ClassVariable Class = "hl-variable"
+	ClassProperty Class = "hl-property"
+	ClassSymbol   Class = "hl-symbol"
+	ClassMeta     Class = "hl-meta"
+	ClassInserted Class = "hl-inserted"
+	ClassDeleted  Class = "hl-deleted"
+)
+
+var languages = map[string]*Language{}
+
+// Register makes a language available to Highlight under all of its names.
+// Names are case insensitive.
+// A language registered later replaces an earlier one with the same name.
+func Register(lang *Language) {
+	for _, name := range lang.Names {
+		languages[strings.ToLower(name)] = lang
+	}
+}
+
+// Lookup finds the language registered under name.
+func Lookup(name string) (*Language, bool) {
+	lang, ok := languages[strings.ToLower(name)]
+	return lang, ok
+}
+
+// Names returns all registered language names in sorted order.
+func Names() (names []string) {
+	for name := range languages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Highlight renders lines of source code written in lang.
+// The result contains one (escaped) html fragment per input line, spans never
+// cross line boundaries.
+// The label is the human readable name of the language; for an unknown
+// language the lines are only escaped and the label is lang itself.
+// An empty code block stays empty.
+func Highlight(lang string, lines []string) (label string, out []template.HTML) {
+	language, ok := Lookup(lang)
+	if !ok || len(lines) == 0 {
+		for _, line := range lines {
+			out = append(out, template.HTML(template.HTMLEscapeString(line)))
+		}
+		if ok {
+			return language.Label, out
+		}
+		return lang, out
+	}
+	return language.Label, Render(language.Tokenize(strings.Join(lines, "\n")))
+}
+
+// Render turns tokens into html, one fragment per line.
+// A token containing a newline is split into one span per line.
+func Render(tokens []Token) (out []template.HTML) {
+	var line strings.Builder
+	for _, tok := range tokens {
+		parts := strings.Split(tok.Text, "\n")
+		for i, part := range parts {
+			if i > 0 {
+				out = append(out, template.HTML(line.String()))
+				line.Reset()
+			}
+			if part == "" {
+				continue
+			}
+			if tok.Class == ClassNone {
+				line.WriteString(template.HTMLEscapeString(part))
+			} else {
+				line.WriteString(`<span class="`)
+				line.WriteString(string(tok.Class))
+				line.WriteString(`">`)
+				line.WriteString(template.HTMLEscapeString(part))
+				line.WriteString(`</span>`)
+			}
+		}
+	}
+	return append(out, template.HTML(line.String()))
+}
+
+// appendToken appends tok to tokens, merging it with the previous token if
+// both share the same class.
+func appendToken(tokens []Token, tok Token) []Token {
+	if tok.Text == "" {
+		return tokens
+	}
+	if l := len(tokens); l > 0 && tokens[l-1].Class == tok.Class {
+		tokens[l-1].Text += tok.Text
+		return tokens
+	}
+	return append(tokens, tok)
+}
@@ -0,0 +1,97 @@
+package highlight_test
+
+import (
+	"html/template"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/cvanloo/blog-go/page/highlight"
+)
+
+func TestHighlight(t *testing.T) {
+	testCases := []struct {
+		name, lang    string
+		lines         []string
+		expectedLabel string
+		expected      []template.HTML
+	}{
+		{
+			name:          "Go with a comment spanning lines",
+			lang:          "go",
+			lines:         []string{"/* a", "b */", `x := len("<s>")`},
+			expectedLabel: "Go",
+			expected: []template.HTML{
+				`<span class="hl-comment">/* a</span>`,
+				`<span class="hl-comment">b */</span>`,
+				`x := <span class="hl-builtin">len</span>(<span class="hl-string">&#34;&lt;s&gt;&#34;</span>)`,
+			},
+		},
+		{
+			name:          "C preprocessor and types",
+			lang:          "C",
+			lines:         []string{"#include <stdio.h>", "", "int x = 0x1f;"},
+			expectedLabel: "C",
+			expected: []template.HTML{
+				`<span class="hl-meta">#include &lt;stdio.h&gt;</span>`,
+				``,
+				`<span class="hl-type">int</span> x = <span class="hl-number">0x1f</span>;`,
+			},
+		},
+		{
+			name:          "Lisp calls and keywords",
+			lang:          "lisp",
+			lines:         []string{`(defun greet (name) (format t "hi ~a" name)) ; hi`},
+			expectedLabel: "Lisp",
+			expected: []template.HTML{
+				`(<span class="hl-keyword">defun</span> greet (<span class="hl-function">name</span>) (<span class="hl-function">format</span> <span class="hl-constant">t</span> <span class="hl-string">&#34;hi ~a&#34;</span> name)) <span class="hl-comment">; hi</span>`,
+			},
+		},
+		{
+			name:          "Shell comments only at the start of a word",
+			lang:          "sh",
+			lines:         []string{`echo a#b $1 # done`},
+			expectedLabel: "Shell",
+			expected: []template.HTML{
+				`<span class="hl-builtin">echo</span> a#b <span class="hl-variable">$1</span> <span class="hl-comment"># done</span>`,
+			},
+		},
+		{
+			name:          "JSON keys and values",
+			lang:          "json",
+			lines:         []string{`{"k" : null}`},
+			expectedLabel: "JSON",
+			expected: []template.HTML{
+				`{<span class="hl-property">&#34;k&#34;</span> : <span class="hl-constant">null</span>}`,
+			},
+		},
+		{
+			name:          "Diff lines",
+			lang:          "patch",
+			lines:         []string{"@@ -1 +1 @@", " same", "-old", "+new"},
+			expectedLabel: "Diff",
+			expected: []template.HTML{
+				`<span class="hl-function">@@ -1 +1 @@</span>`,
+				` same`,
+				`<span class="hl-deleted">-old</span>`,
+				`<span class="hl-inserted">+new</span>`,
+			},
+		},
+		{
+			name:          "Unknown languages are only escaped",
+			lang:          "brainfuck",
+			lines:         []string{"<>+-"},
+			expectedLabel: "brainfuck",
+			expected:      []template.HTML{"&lt;&gt;+-"},
+		},
+	}
+	for _, testCase := range testCases {
+		label, lines := highlight.Highlight(testCase.lang, testCase.lines)
+		if label != testCase.expectedLabel {
+			t.Errorf("%s: label: got %q, want %q", testCase.name, label, testCase.expectedLabel)
+		}
+		if diff := deep.Equal(lines, testCase.expected); diff != nil {
+			t.Errorf("%s: %v", testCase.name, diff)
+		}
+	}
+}
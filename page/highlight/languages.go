@@ -0,0 +1,184 @@
+package highlight
+
+import (
+	"strings"
+	"unicode"
+)
+
+func init() {
+	Register(&Language{
+		Label:    "Go",
+		Names:    []string{"go", "golang"},
+		Tokenize: golang.Tokenize,
+	})
+	Register(&Language{
+		Label:    "C",
+		Names:    []string{"c", "h"},
+		Tokenize: clang.Tokenize,
+	})
+	Register(&Language{
+		Label:    "Lisp",
+		Names:    []string{"lisp", "elisp", "scheme", "clojure"},
+		Tokenize: lisp.Tokenize,
+	})
+	Register(&Language{
+		Label:    "Janet",
+		Names:    []string{"janet"},
+		Tokenize: janet.Tokenize,
+	})
+	Register(&Language{
+		Label:    "Shell",
+		Names:    []string{"sh", "shell", "bash", "zsh", "console"},
+		Tokenize: shell.Tokenize,
+	})
+	Register(&Language{
+		Label:    "JSON",
+		Names:    []string{"json"},
+		Tokenize: json.Tokenize,
+	})
+	Register(&Language{
+		Label:    "Diff",
+		Names:    []string{"diff", "patch"},
+		Tokenize: tokenizeDiff,
+	})
+}
+
+var golang = scanner{
+	lineComments:  []string{"//"},
+	blockComments: [][2]string{{"/*", "*/"}},
+	quotes:        `"'`,
+	rawQuotes:     "`",
+	calls:         true,
+	keywords: newWords(
+		"break", "case", "chan", "const", "continue", "default", "defer", "else",
+		"fallthrough", "for", "func", "go", "goto", "if", "import", "interface",
+		"map", "package", "range", "return", "select", "struct", "switch", "type", "var",
+	),
+	types: newWords(
+		"any", "bool", "byte", "comparable", "complex64", "complex128", "error",
+		"float32", "float64", "int", "int8", "int16", "int32", "int64", "rune",
+		"string", "uint", "uint8", "uint16", "uint32", "uint64", "uintptr",
+	),
+	builtins: newWords(
+		"append", "cap", "clear", "close", "complex", "copy", "delete", "imag",
+		"len", "make", "max", "min", "new", "panic", "print", "println", "real", "recover",
+	),
+	constants:  newWords("true", "false", "iota", "nil"),
+	identStart: isIdentStart,
+	ident:      isIdent,
+}
+
+var clang = scanner{
+	lineComments:  []string{"//"},
+	blockComments: [][2]string{{"/*", "*/"}},
+	preprocessor:  true,
+	quotes:        `"'`,
+	calls:         true,
+	keywords: newWords(
+		"auto", "break", "case", "const", "continue", "default", "do", "else",
+		"enum", "extern", "for", "goto", "if", "inline", "register", "restrict",
+		"return", "sizeof", "static", "struct", "switch", "typedef", "union",
+		"volatile", "while",
+	),
+	types: newWords(
+		"void", "char", "short", "int", "long", "float", "double", "signed",
+		"unsigned", "bool", "_Bool", "size_t", "ssize_t", "ptrdiff_t", "intptr_t",
+		"uintptr_t", "int8_t", "int16_t", "int32_t", "int64_t", "uint8_t",
+		"uint16_t", "uint32_t", "uint64_t", "FILE",
+	),
+	constants:  newWords("NULL", "true", "false"),
+	identStart: isIdentStart,
+	ident:      isIdent,
+}
+
+func isLispIdent(r rune) bool {
+	return isIdent(r) || strings.ContainsRune("-+*/<>=!?%&$^~.", r)
+}
+
+func isLispIdentStart(r rune) bool {
+	return isLispIdent(r) && !unicode.IsDigit(r)
+}
+
+var lisp = scanner{
+	lineComments:  []string{";"},
+	blockComments: [][2]string{{"#|", "|#"}},
+	quotes:        `"`,
+	lisp:          true,
+	keywords: newWords(
+		"and", "begin", "case", "cond", "define", "defmacro", "defn", "defparameter",
+		"defun", "defvar", "do", "dolist", "dotimes", "fn", "if", "lambda", "let",
+		"let*", "letrec", "loop", "not", "or", "progn", "quote", "setf", "setq",
+		"unless", "when",
+	),
+	constants:  newWords("nil", "t", "true", "false"),
+	identStart: isLispIdentStart,
+	ident:      isLispIdent,
+}
+
+var janet = scanner{
+	lineComments: []string{"#"},
+	quotes:       `"`,
+	rawQuotes:    "`",
+	lisp:         true,
+	keywords: newWords(
+		"break", "case", "cond", "def", "def-", "defmacro", "defmacro-", "defn",
+		"defn-", "do", "each", "eachk", "eachp", "fn", "for", "if", "if-let",
+		"let", "loop", "match", "quasiquote", "quote", "seq", "set", "splice",
+		"try", "unless", "unquote", "upscope", "var", "when", "when-let", "while",
+	),
+	constants:  newWords("nil", "true", "false"),
+	identStart: isLispIdentStart,
+	ident:      isLispIdent,
+}
+
+var shell = scanner{
+	lineComments:      []string{"#"},
+	commentAfterSpace: true,
+	quotes:            `"`,
+	rawQuotes:         `'`,
+	variables:         true,
+	keywords: newWords(
+		"case", "do", "done", "elif", "else", "esac", "fi", "for", "function",
+		"if", "in", "select", "then", "until", "while",
+	),
+	builtins: newWords(
+		"alias", "break", "cd", "continue", "declare", "echo", "eval", "exec",
+		"exit", "export", "local", "printf", "pwd", "read", "readonly", "return",
+		"set", "shift", "source", "test", "trap", "unset",
+	),
+	identStart: isIdentStart,
+	ident: func(r rune) bool {
+		return isIdent(r) || r == '-'
+	},
+}
+
+var json = scanner{
+	quotes:     `"`,
+	keys:       true,
+	constants:  newWords("true", "false", "null"),
+	identStart: isIdentStart,
+	ident:      isIdent,
+}
+
+// tokenizeDiff highlights unified diffs line by line.
+func tokenizeDiff(src string) (tokens []Token) {
+	for i, line := range strings.Split(src, "\n") {
+		if i > 0 {
+			tokens = appendToken(tokens, Token{ClassNone, "\n"})
+		}
+		class := ClassNone
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"),
+			strings.HasPrefix(line, "diff "), strings.HasPrefix(line, "index "):
+			class = ClassMeta
+		case strings.HasPrefix(line, "@@"):
+			class = ClassFunction
+		case strings.HasPrefix(line, "+"):
+			class = ClassInserted
+		case strings.HasPrefix(line, "-"):
+			class = ClassDeleted
+		}
+		tokens = appendToken(tokens, Token{class, line})
+	}
+	return tokens
+}
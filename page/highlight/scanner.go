@@ -0,0 +1,198 @@
+package highlight
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type (
+	words map[string]struct{}
+
+	// scanner is a configurable tokenizer, good enough for most c-like and
+	// lisp-like languages.
+	scanner struct {
+		lineComments  []string
+		blockComments [][2]string
+		// commentAfterSpace requires line comments to be at the start of a word (shell).
+		commentAfterSpace bool
+		// preprocessor highlights lines starting with # as meta (c).
+		preprocessor bool
+		// quotes are string delimiters supporting backslash escapes.
+		quotes string
+		// rawQuotes are string delimiters without escapes.
+		rawQuotes string
+		// keys highlights strings followed by a colon as properties (json).
+		keys bool
+		// variables highlights $name and ${name} (shell).
+		variables bool
+		// calls highlights identifiers followed by a paren as functions.
+		calls bool
+		// lisp highlights the first symbol in a list as function and :keywords as symbols.
+		lisp bool
+
+		keywords, types, builtins, constants words
+		identStart, ident                    func(r rune) bool
+	}
+)
+
+func newWords(ws ...string) words {
+	m := words{}
+	for _, w := range ws {
+		m[w] = struct{}{}
+	}
+	return m
+}
+
+func (ws words) has(w string) bool {
+	_, ok := ws[w]
+	return ok
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdent(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isDigit(r rune) bool {
+	return '0' <= r && r <= '9'
+}
+
+func (s scanner) Tokenize(src string) (tokens []Token) {
+	for i := 0; i < len(src); {
+		tok := s.next(src, i)
+		tokens = appendToken(tokens, tok)
+		i += len(tok.Text)
+	}
+	return tokens
+}
+
+// next returns the token starting at src[i:], the token is never empty.
+func (s scanner) next(src string, i int) Token {
+	rest := src[i:]
+	r, size := utf8.DecodeRuneInString(rest)
+	prev, _ := utf8.DecodeLastRuneInString(src[:i])
+	atWordStart := i == 0 || unicode.IsSpace(prev)
+
+	if s.preprocessor && r == '#' && atLineStart(src, i) {
+		return Token{ClassMeta, rest[:lineLen(rest)]}
+	}
+	for _, c := range s.lineComments {
+		if strings.HasPrefix(rest, c) && (!s.commentAfterSpace || atWordStart) {
+			return Token{ClassComment, rest[:lineLen(rest)]}
+		}
+	}
+	for _, c := range s.blockComments {
+		if strings.HasPrefix(rest, c[0]) {
+			end := strings.Index(rest[len(c[0]):], c[1])
+			if end < 0 {
+				return Token{ClassComment, rest}
+			}
+			return Token{ClassComment, rest[:len(c[0])+end+len(c[1])]}
+		}
+	}
+	if strings.ContainsRune(s.quotes, r) || strings.ContainsRune(s.rawQuotes, r) {
+		n := stringLen(rest, r, strings.ContainsRune(s.quotes, r))
+		if s.keys && strings.HasPrefix(strings.TrimLeft(rest[n:], " \t"), ":") {
+			return Token{ClassProperty, rest[:n]}
+		}
+		return Token{ClassString, rest[:n]}
+	}
+	if s.variables && r == '$' {
+		return Token{ClassVariable, rest[:variableLen(rest)]}
+	}
+	if isDigit(r) || (s.lisp && (r == '-' || r == '+') && len(rest) > 1 && isDigit(rune(rest[1]))) {
+		n := size + wordLen(rest[size:], func(r rune) bool {
+			return isIdent(r) || r == '.'
+		})
+		return Token{ClassNumber, rest[:n]}
+	}
+	if s.lisp && r == ':' {
+		return Token{ClassSymbol, rest[:size+wordLen(rest[size:], s.ident)]}
+	}
+	if s.identStart(r) {
+		word := rest[:size+wordLen(rest[size:], s.ident)]
+		return Token{s.classify(word, src[:i], rest[len(word):]), word}
+	}
+	return Token{ClassNone, rest[:size]}
+}
+
+func (s scanner) classify(word, before, after string) Class {
+	switch {
+	case s.keywords.has(word):
+		return ClassKeyword
+	case s.types.has(word):
+		return ClassType
+	case s.builtins.has(word):
+		return ClassBuiltin
+	case s.constants.has(word):
+		return ClassConstant
+	case s.calls && strings.HasPrefix(after, "("):
+		return ClassFunction
+	case s.lisp && strings.HasSuffix(before, "("):
+		return ClassFunction
+	}
+	return ClassNone
+}
+
+// atLineStart reports whether only whitespace precedes src[i] on its line.
+func atLineStart(src string, i int) bool {
+	lineStart := strings.LastIndexByte(src[:i], '\n') + 1
+	return strings.TrimSpace(src[lineStart:i]) == ""
+}
+
+// lineLen returns the length of the first line in s, excluding the newline.
+func lineLen(s string) int {
+	if n := strings.IndexByte(s, '\n'); n >= 0 {
+		return n
+	}
+	return len(s)
+}
+
+// wordLen returns the length of the prefix of s consisting of runes matching valid.
+func wordLen(s string, valid func(r rune) bool) int {
+	for i, r := range s {
+		if !valid(r) {
+			return i
+		}
+	}
+	return len(s)
+}
+
+// stringLen returns the length of the string literal at the start of s,
+// including both quotes.
+// An unterminated string extends to the end of s.
+func stringLen(s string, quote rune, escapes bool) int {
+	escaped := false
+	for i, r := range s[1:] {
+		switch {
+		case escaped:
+			escaped = false
+		case escapes && r == '\\':
+			escaped = true
+		case r == quote:
+			return i + 2
+		}
+	}
+	return len(s)
+}
+
+// variableLen returns the length of the shell variable at the start of s.
+func variableLen(s string) int {
+	if strings.HasPrefix(s, "${") {
+		if end := strings.IndexByte(s, '}'); end >= 0 {
+			return end + 1
+		}
+		return len(s)
+	}
+	if n := wordLen(s[1:], isIdent); n > 0 {
+		return n + 1
+	}
+	if len(s) > 1 && strings.IndexByte("?@#*$!0123456789-", s[1]) >= 0 {
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,354 @@
+package mathml
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+var greek = map[string]string{
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ϵ",
+	"varepsilon": "ε", "zeta": "ζ", "eta": "η", "theta": "θ", "vartheta": "ϑ",
+	"iota": "ι", "kappa": "κ", "lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ",
+	"pi": "π", "varpi": "ϖ", "rho": "ρ", "varrho": "ϱ", "sigma": "σ",
+	"varsigma": "ς", "tau": "τ", "upsilon": "υ", "phi": "ϕ", "varphi": "φ",
+	"chi": "χ", "psi": "ψ", "omega": "ω",
+	"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ",
+	"Pi": "Π", "Sigma": "Σ", "Upsilon": "Υ", "Phi": "Φ", "Psi": "Ψ", "Omega": "Ω",
+}
+
+// identifiers are symbols rendered as <mi>.
+var identifiers = map[string]string{
+	"infty": "∞", "partial": "∂", "nabla": "∇", "emptyset": "∅", "varnothing": "∅",
+	"ell": "ℓ", "hbar": "ℏ", "Re": "ℜ", "Im": "ℑ", "aleph": "ℵ",
+}
+
+// operators are symbols rendered as <mo>.
+var operators = map[string]string{
+	"le": "≤", "leq": "≤", "ge": "≥", "geq": "≥", "ne": "≠", "neq": "≠",
+	"ll": "≪", "gg": "≫", "approx": "≈", "equiv": "≡", "sim": "∼", "simeq": "≃",
+	"cong": "≅", "propto": "∝", "times": "×", "cdot": "⋅", "div": "÷",
+	"pm": "±", "mp": "∓", "ast": "∗", "star": "⋆", "circ": "∘", "bullet": "∙",
+	"oplus": "⊕", "otimes": "⊗",
+	"to": "→", "rightarrow": "→", "leftarrow": "←", "leftrightarrow": "↔",
+	"Rightarrow": "⇒", "Leftarrow": "⇐", "Leftrightarrow": "⇔",
+	"implies": "⟹", "iff": "⟺", "mapsto": "↦", "gets": "←",
+	"uparrow": "↑", "downarrow": "↓",
+	"in": "∈", "notin": "∉", "ni": "∋", "subset": "⊂", "subseteq": "⊆",
+	"supset": "⊃", "supseteq": "⊇", "cup": "∪", "cap": "∩", "setminus": "∖",
+	"forall": "∀", "exists": "∃", "nexists": "∄", "neg": "¬", "lnot": "¬",
+	"land": "∧", "wedge": "∧", "lor": "∨", "vee": "∨", "mid": "∣",
+	"parallel": "∥", "perp": "⊥", "vdash": "⊢", "models": "⊨",
+	"ldots": "…", "cdots": "⋯", "vdots": "⋮", "ddots": "⋱", "dots": "…",
+	"langle": "⟨", "rangle": "⟩", "lfloor": "⌊", "rfloor": "⌋",
+	"lceil": "⌈", "rceil": "⌉", "vert": "|", "Vert": "‖",
+	"{": "{", "}": "}", "|": "‖", "%": "%", "$": "$", "#": "#", "&": "&", "_": "_",
+}
+
+// bigOperators have their limits below and above in display mode, except
+// for integrals.
+var bigOperators = map[string]string{
+	"sum": "∑", "prod": "∏", "coprod": "∐", "bigcup": "⋃", "bigcap": "⋂",
+	"bigoplus": "⨁", "bigotimes": "⨂", "bigvee": "⋁", "bigwedge": "⋀",
+}
+
+var integrals = map[string]string{
+	"int": "∫", "iint": "∬", "iiint": "∭", "oint": "∮",
+}
+
+var functions = []string{
+	"sin", "cos", "tan", "cot", "sec", "csc", "arcsin", "arccos", "arctan",
+	"sinh", "cosh", "tanh", "log", "ln", "lg", "exp", "det", "dim", "ker",
+	"deg", "gcd", "arg", "hom", "Pr",
+}
+
+// limitFunctions are functions which, like big operators, take limits.
+var limitFunctions = []string{
+	"lim", "liminf", "limsup", "max", "min", "sup", "inf", "argmax", "argmin",
+}
+
+var spaces = map[string]string{
+	",": "0.167em", ":": "0.222em", ";": "0.278em", " ": "0.25em",
+	"quad": "1em", "qquad": "2em", "!": "-0.167em",
+}
+
+var fonts = map[string]string{
+	"mathbb": "double-struck", "mathbf": "bold", "mathcal": "script",
+	"mathfrak": "fraktur", "mathit": "italic", "mathrm": "normal",
+	"mathsf": "sans-serif", "mathtt": "monospace", "boldsymbol": "bold-italic",
+}
+
+var accents = map[string]string{
+	"hat": "^", "widehat": "^", "bar": "¯", "overline": "¯", "vec": "→",
+	"overrightarrow": "→", "dot": "˙", "ddot": "¨", "tilde": "~",
+	"widetilde": "~", "check": "ˇ", "breve": "˘", "acute": "´", "grave": "`",
+}
+
+var underAccents = map[string]string{
+	"underline": "_", "underbrace": "⏟",
+}
+
+// environments maps matrix like environments to their left and right
+// delimiters and column alignment.
+var environments = map[string]struct{ left, right, align string }{
+	"matrix":  {"", "", ""},
+	"pmatrix": {"(", ")", ""},
+	"bmatrix": {"[", "]", ""},
+	"Bmatrix": {"{", "}", ""},
+	"vmatrix": {"|", "|", ""},
+	"Vmatrix": {"‖", "‖", ""},
+	"cases":   {"{", "", "left left"},
+	"aligned": {"", "", "right left"},
+	"align":   {"", "", "right left"},
+	"align*":  {"", "", "right left"},
+}
+
+func contains(ss []string, s string) bool {
+	for _, e := range ss {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *mathParser) parseCommand(t token) (node string, movable bool, err error) {
+	name := strings.TrimPrefix(t.text, `\`)
+	if s, ok := greek[name]; ok {
+		if strings.ToUpper(name[:1]) == name[:1] {
+			return `<mi mathvariant="normal">` + s + "</mi>", false, nil
+		}
+		return "<mi>" + s + "</mi>", false, nil
+	}
+	if s, ok := identifiers[name]; ok {
+		return "<mi>" + s + "</mi>", false, nil
+	}
+	if s, ok := operators[name]; ok {
+		return mo(s), false, nil
+	}
+	if s, ok := bigOperators[name]; ok {
+		return `<mo largeop="true" movablelimits="true">` + s + "</mo>", true, nil
+	}
+	if s, ok := integrals[name]; ok {
+		return `<mo largeop="true">` + s + "</mo>", false, nil
+	}
+	if contains(functions, name) {
+		return "<mi>" + name + "</mi>", false, nil
+	}
+	if contains(limitFunctions, name) {
+		return "<mo movablelimits=\"true\">" + name + "</mo>", true, nil
+	}
+	if width, ok := spaces[name]; ok {
+		return `<mspace width="` + width + `"></mspace>`, false, nil
+	}
+	if variant, ok := fonts[name]; ok {
+		raw, err := p.rawGroup()
+		if err != nil {
+			return "", false, fmt.Errorf("%s: %w", t.text, err)
+		}
+		if variant == "double-struck" || variant == "script" || variant == "fraktur" {
+			return fontLetters(raw, variant), false, nil
+		}
+		return `<mi mathvariant="` + variant + `">` + html.EscapeString(strings.TrimSpace(raw)) + "</mi>", false, nil
+	}
+	if accent, ok := accents[name]; ok {
+		arg, err := p.parseArg()
+		if err != nil {
+			return "", false, fmt.Errorf("%s: %w", t.text, err)
+		}
+		return `<mover accent="true">` + arg + `<mo>` + html.EscapeString(accent) + `</mo></mover>`, false, nil
+	}
+	if accent, ok := underAccents[name]; ok {
+		arg, err := p.parseArg()
+		if err != nil {
+			return "", false, fmt.Errorf("%s: %w", t.text, err)
+		}
+		return `<munder accentunder="true">` + arg + `<mo>` + html.EscapeString(accent) + `</mo></munder>`, false, nil
+	}
+	switch name {
+	case "frac", "dfrac", "tfrac", "cfrac":
+		num, err := p.parseArg()
+		if err != nil {
+			return "", false, fmt.Errorf("%s numerator: %w", t.text, err)
+		}
+		den, err := p.parseArg()
+		if err != nil {
+			return "", false, fmt.Errorf("%s denominator: %w", t.text, err)
+		}
+		frac := "<mfrac>" + num + den + "</mfrac>"
+		switch name {
+		case "dfrac":
+			frac = `<mstyle displaystyle="true">` + frac + "</mstyle>"
+		case "tfrac":
+			frac = `<mstyle displaystyle="false">` + frac + "</mstyle>"
+		}
+		return frac, false, nil
+	case "binom":
+		n, err := p.parseArg()
+		if err != nil {
+			return "", false, fmt.Errorf("%s: %w", t.text, err)
+		}
+		k, err := p.parseArg()
+		if err != nil {
+			return "", false, fmt.Errorf("%s: %w", t.text, err)
+		}
+		return `<mrow><mo>(</mo><mfrac linethickness="0">` + n + k + `</mfrac><mo>)</mo></mrow>`, false, nil
+	case "sqrt":
+		var index string
+		if p.peek().kind == tokenOther && p.peek().text == "[" {
+			p.next()
+			nodes, err := p.parseRow(func(t token) bool { return t.kind == tokenOther && t.text == "]" })
+			if err != nil {
+				return "", false, err
+			}
+			if _, err := p.expect(tokenOther, "]"); err != nil {
+				return "", false, fmt.Errorf("%s: %w", t.text, err)
+			}
+			index = mrow(nodes)
+		}
+		radicand, err := p.parseArg()
+		if err != nil {
+			return "", false, fmt.Errorf("%s: %w", t.text, err)
+		}
+		if index != "" {
+			return "<mroot>" + radicand + index + "</mroot>", false, nil
+		}
+		return "<msqrt>" + radicand + "</msqrt>", false, nil
+	case "text", "textrm", "textit", "textbf", "mbox":
+		raw, err := p.rawGroup()
+		if err != nil {
+			return "", false, fmt.Errorf("%s: %w", t.text, err)
+		}
+		// browsers trim whitespace in mtext, but \text{if } means it
+		return "<mtext>" + strings.ReplaceAll(html.EscapeString(raw), " ", "\u00a0") + "</mtext>", false, nil
+	case "operatorname":
+		raw, err := p.rawGroup()
+		if err != nil {
+			return "", false, fmt.Errorf("%s: %w", t.text, err)
+		}
+		return "<mi>" + html.EscapeString(strings.TrimSpace(raw)) + "</mi>", false, nil
+	case "left":
+		return p.parseFenced(t)
+	case "right":
+		return "", false, fmt.Errorf("%w: \\right without \\left", ErrUnexpected)
+	case "begin":
+		return p.parseEnvironment(t)
+	case "end":
+		return "", false, fmt.Errorf("%w: \\end without \\begin", ErrUnexpected)
+	}
+	return "", false, fmt.Errorf("%w: %s", ErrUnknownCommand, t.text)
+}
+
+// fontLetters renders each letter separately, so that \mathbb{RN} yields two
+// identifiers.
+func fontLetters(raw, variant string) string {
+	var nodes []string
+	for _, r := range strings.TrimSpace(raw) {
+		if r == ' ' {
+			continue
+		}
+		nodes = append(nodes, `<mi mathvariant="`+variant+`">`+html.EscapeString(string(r))+"</mi>")
+	}
+	return mrow(nodes)
+}
+
+// parseDelimiter parses the delimiter after \left or \right, a dot means
+// no delimiter.
+func (p *mathParser) parseDelimiter(after string) (string, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenOther:
+		if t.text == "." {
+			return "", nil
+		}
+		return t.text, nil
+	case tokenCommand:
+		name := strings.TrimPrefix(t.text, `\`)
+		if s, ok := operators[name]; ok {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("%w: invalid delimiter after %s: %q", ErrUnexpected, after, t.text)
+}
+
+func (p *mathParser) parseFenced(left token) (string, bool, error) {
+	open, err := p.parseDelimiter(left.text)
+	if err != nil {
+		return "", false, err
+	}
+	nodes, err := p.parseRow(func(t token) bool { return t.kind == tokenCommand && t.text == `\right` })
+	if err != nil {
+		return "", false, err
+	}
+	if _, err := p.expect(tokenCommand, `\right`); err != nil {
+		return "", false, err
+	}
+	close, err := p.parseDelimiter(`\right`)
+	if err != nil {
+		return "", false, err
+	}
+	return "<mrow>" + fence(open) + strings.Join(nodes, "") + fence(close) + "</mrow>", false, nil
+}
+
+func fence(delim string) string {
+	if delim == "" {
+		return ""
+	}
+	return `<mo fence="true">` + html.EscapeString(delim) + "</mo>"
+}
+
+func (p *mathParser) parseEnvironment(begin token) (string, bool, error) {
+	name, err := p.rawGroup()
+	if err != nil {
+		return "", false, fmt.Errorf("%s: %w", begin.text, err)
+	}
+	env, ok := environments[name]
+	if !ok {
+		return "", false, fmt.Errorf("%w: %s", ErrUnknownEnvironment, name)
+	}
+	cellEnd := func(t token) bool {
+		return t.kind == tokenAmp || t.kind == tokenNewRow || (t.kind == tokenCommand && t.text == `\end`)
+	}
+	var rows []string
+	var cells []string
+	for {
+		nodes, err := p.parseRow(cellEnd)
+		if err != nil {
+			return "", false, fmt.Errorf("%s: %w", name, err)
+		}
+		cells = append(cells, "<mtd>"+mrow(nodes)+"</mtd>")
+		t := p.next()
+		switch {
+		case t.kind == tokenEOF:
+			return "", false, fmt.Errorf("%w: missing \\end{%s}", ErrUnbalanced, name)
+		case t.kind == tokenAmp:
+			continue
+		case t.kind == tokenNewRow:
+			rows = append(rows, "<mtr>"+strings.Join(cells, "")+"</mtr>")
+			cells = nil
+			continue
+		}
+		// \end
+		endName, err := p.rawGroup()
+		if err != nil {
+			return "", false, fmt.Errorf("\\end: %w", err)
+		}
+		if endName != name {
+			return "", false, fmt.Errorf("%w: \\begin{%s} ended by \\end{%s}", ErrUnbalanced, name, endName)
+		}
+		// a trailing \\ does not start a new row
+		if len(cells) > 1 || cells[0] != "<mtd><mrow></mrow></mtd>" {
+			rows = append(rows, "<mtr>"+strings.Join(cells, "")+"</mtr>")
+		}
+		break
+	}
+	table := "<mtable>"
+	if env.align != "" {
+		table = `<mtable columnalign="` + env.align + `">`
+	}
+	table += strings.Join(rows, "") + "</mtable>"
+	if env.left == "" && env.right == "" {
+		return table, false, nil
+	}
+	return "<mrow>" + fence(env.left) + table + fence(env.right) + "</mrow>", false, nil
+}
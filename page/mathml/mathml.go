@@ -0,0 +1,378 @@
+// Package mathml converts a subset of LaTeX math to MathML.
+//
+// Supported are:
+// - numbers, variables and operators
+// - sub- and superscripts: x_i, x^2, x_i^{n+1}
+// - fractions and binomials: \frac{a}{b}, \dfrac, \tfrac, \binom{n}{k}
+// - roots: \sqrt{x}, \sqrt[n]{x}
+// - greek letters and common symbols: \alpha, \Omega, \le, \infty, \to, ...
+// - big operators with limits: \sum, \prod, \int, \oint, \lim, ...
+// - functions: \sin, \log, \max, \operatorname{foo}, ...
+// - fonts and text: \mathbb{R}, \mathbf{x}, \mathcal{O}, \text{if }
+// - accents: \hat{x}, \bar{x}, \vec{v}, \overline{AB}, ...
+// - delimiters: \left( ... \right), \langle, \lfloor, ...
+// - spacing: \, \: \; \quad \qquad
+// - environments: matrix, pmatrix, bmatrix, Bmatrix, vmatrix, Vmatrix, cases, aligned
+package mathml
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type (
+	tokenKind int
+	token     struct {
+		kind       tokenKind
+		text       string
+		start, end int
+	}
+	mathParser struct {
+		src     string
+		tokens  []token
+		pos     int
+		display bool
+	}
+)
+
+const (
+	tokenEOF tokenKind = iota
+	tokenCommand
+	tokenOpen
+	tokenClose
+	tokenSup
+	tokenSub
+	tokenAmp
+	tokenNewRow
+	tokenNumber
+	tokenLetter
+	tokenPrime
+	tokenOther
+)
+
+var (
+	ErrUnknownCommand     = errors.New("unknown command")
+	ErrUnknownEnvironment = errors.New("unknown environment")
+	ErrUnbalanced         = errors.New("unbalanced braces")
+	ErrMissingArgument    = errors.New("missing argument")
+	ErrDoubleScript       = errors.New("double script")
+	ErrUnexpected         = errors.New("unexpected token")
+)
+
+// Convert renders the LaTeX math expression tex as a MathML <math> element.
+// Display math is rendered as a block with limits above and below big
+// operators, inline math flows with the surrounding text.
+// The original tex source is kept as annotation.
+func Convert(tex string, display bool) (string, error) {
+	p := &mathParser{
+		src:     tex,
+		tokens:  tokenize(tex),
+		display: display,
+	}
+	nodes, err := p.parseRow(func(t token) bool { return false })
+	if err != nil {
+		return "", err
+	}
+	b := &strings.Builder{}
+	if display {
+		b.WriteString(`<math display="block">`)
+	} else {
+		b.WriteString(`<math>`)
+	}
+	b.WriteString("<semantics>")
+	b.WriteString(mrow(nodes))
+	b.WriteString(`<annotation encoding="application/x-tex">`)
+	b.WriteString(html.EscapeString(tex))
+	b.WriteString("</annotation></semantics></math>")
+	return b.String(), nil
+}
+
+func tokenize(src string) (tokens []token) {
+	// at decodes the rune at byte offset i, it is utf8.RuneError past the end.
+	at := func(i int) (rune, int) {
+		return utf8.DecodeRuneInString(src[i:])
+	}
+	isDigitAt := func(i int) bool {
+		r, _ := at(i)
+		return unicode.IsDigit(r)
+	}
+	for i := 0; i < len(src); {
+		r, w := at(i)
+		start := i
+		var kind tokenKind
+		switch {
+		case unicode.IsSpace(r):
+			i += w
+			continue
+		case r == '\\':
+			i += w
+			if r, w := at(i); unicode.IsLetter(r) {
+				for r, w := at(i); unicode.IsLetter(r); r, w = at(i) {
+					i += w
+				}
+				kind = tokenCommand
+			} else if r == '\\' {
+				i += w
+				kind = tokenNewRow
+			} else {
+				i += w
+				kind = tokenCommand
+			}
+		case r == '{':
+			i += w
+			kind = tokenOpen
+		case r == '}':
+			i += w
+			kind = tokenClose
+		case r == '^':
+			i += w
+			kind = tokenSup
+		case r == '_':
+			i += w
+			kind = tokenSub
+		case r == '&':
+			i += w
+			kind = tokenAmp
+		case r == '\'':
+			i += w
+			kind = tokenPrime
+		case unicode.IsDigit(r) || (r == '.' && isDigitAt(i+w)):
+			for r, w := at(i); unicode.IsDigit(r) || (r == '.' && isDigitAt(i+w)); r, w = at(i) {
+				i += w
+			}
+			kind = tokenNumber
+		case unicode.IsLetter(r):
+			i += w
+			kind = tokenLetter
+		default:
+			i += w
+			kind = tokenOther
+		}
+		tokens = append(tokens, token{
+			kind:  kind,
+			text:  strings.ToValidUTF8(src[start:i], string(utf8.RuneError)),
+			start: start,
+			end:   i,
+		})
+	}
+	return tokens
+}
+
+func (p *mathParser) peek() token {
+	if p.pos >= len(p.tokens) {
+		return token{kind: tokenEOF, start: len(p.src), end: len(p.src)}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *mathParser) next() token {
+	t := p.peek()
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *mathParser) expect(kind tokenKind, what string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		if t.kind == tokenEOF {
+			return t, fmt.Errorf("%w: expected %s at end of input", ErrMissingArgument, what)
+		}
+		return t, fmt.Errorf("%w: expected %s, got %q", ErrUnexpected, what, t.text)
+	}
+	return t, nil
+}
+
+// parseRow parses atoms until the end of input or stop returns true for the
+// next token (which is not consumed).
+func (p *mathParser) parseRow(stop func(t token) bool) (nodes []string, err error) {
+	for {
+		t := p.peek()
+		if t.kind == tokenEOF || stop(t) {
+			return nodes, nil
+		}
+		node, err := p.parseAtom()
+		if err != nil {
+			return nodes, err
+		}
+		nodes = append(nodes, node)
+	}
+}
+
+// parseGroup parses the content of {...}, the opening brace must be next.
+func (p *mathParser) parseGroup() (string, error) {
+	if _, err := p.expect(tokenOpen, "{"); err != nil {
+		return "", err
+	}
+	nodes, err := p.parseRow(func(t token) bool { return t.kind == tokenClose })
+	if err != nil {
+		return "", err
+	}
+	if p.next().kind != tokenClose {
+		return "", ErrUnbalanced
+	}
+	return mrow(nodes), nil
+}
+
+// rawGroup returns the unparsed source of {...}, the opening brace must be next.
+func (p *mathParser) rawGroup() (string, error) {
+	open, err := p.expect(tokenOpen, "{")
+	if err != nil {
+		return "", err
+	}
+	depth := 1
+	for {
+		t := p.next()
+		switch t.kind {
+		case tokenEOF:
+			return "", ErrUnbalanced
+		case tokenOpen:
+			depth++
+		case tokenClose:
+			depth--
+			if depth == 0 {
+				return p.src[open.end:t.start], nil
+			}
+		}
+	}
+}
+
+// parseArg parses a command or script argument: either a group or a single
+// token.
+func (p *mathParser) parseArg() (string, error) {
+	switch p.peek().kind {
+	case tokenEOF, tokenClose, tokenAmp, tokenNewRow:
+		return "", ErrMissingArgument
+	case tokenOpen:
+		return p.parseGroup()
+	}
+	node, _, err := p.parseBase()
+	return node, err
+}
+
+// parseAtom parses a base with optional sub- and superscripts.
+func (p *mathParser) parseAtom() (string, error) {
+	base, movable, err := p.parseBase()
+	if err != nil {
+		return "", err
+	}
+	return p.parseScripts(base, movable && p.display)
+}
+
+func (p *mathParser) parseScripts(base string, limits bool) (string, error) {
+	var sub, sup string
+	hasSub, hasSup := false, false
+	for {
+		switch p.peek().kind {
+		default:
+			return scripted(base, sub, sup, hasSub, hasSup, limits), nil
+		case tokenPrime:
+			p.next()
+			if hasSup {
+				return "", fmt.Errorf("%w: prime after superscript", ErrDoubleScript)
+			}
+			primes := "′"
+			for p.peek().kind == tokenPrime {
+				p.next()
+				primes += "′"
+			}
+			sup = "<mo>" + primes + "</mo>"
+			hasSup = true
+		case tokenSub:
+			p.next()
+			if hasSub {
+				return "", fmt.Errorf("%w: subscript", ErrDoubleScript)
+			}
+			arg, err := p.parseArg()
+			if err != nil {
+				return "", fmt.Errorf("subscript: %w", err)
+			}
+			sub, hasSub = arg, true
+		case tokenSup:
+			p.next()
+			if hasSup && !strings.HasPrefix(sup, "<mo>′") {
+				return "", fmt.Errorf("%w: superscript", ErrDoubleScript)
+			}
+			arg, err := p.parseArg()
+			if err != nil {
+				return "", fmt.Errorf("superscript: %w", err)
+			}
+			if hasSup {
+				sup = "<mrow>" + sup + arg + "</mrow>"
+			} else {
+				sup = arg
+			}
+			hasSup = true
+		}
+	}
+}
+
+func scripted(base, sub, sup string, hasSub, hasSup, limits bool) string {
+	switch {
+	case hasSub && hasSup && limits:
+		return "<munderover>" + base + sub + sup + "</munderover>"
+	case hasSub && hasSup:
+		return "<msubsup>" + base + sub + sup + "</msubsup>"
+	case hasSub && limits:
+		return "<munder>" + base + sub + "</munder>"
+	case hasSub:
+		return "<msub>" + base + sub + "</msub>"
+	case hasSup && limits:
+		return "<mover>" + base + sup + "</mover>"
+	case hasSup:
+		return "<msup>" + base + sup + "</msup>"
+	}
+	return base
+}
+
+// parseBase parses a single element without scripts.
+// movable reports whether scripts of the element are placed below and above
+// it in display mode.
+func (p *mathParser) parseBase() (node string, movable bool, err error) {
+	t := p.peek()
+	switch t.kind {
+	case tokenOpen:
+		node, err = p.parseGroup()
+		return node, false, err
+	case tokenClose:
+		return "", false, ErrUnbalanced
+	case tokenSup, tokenSub, tokenPrime:
+		// script without base, like {}^2 or ^2
+		return "<mrow></mrow>", false, nil
+	case tokenAmp, tokenNewRow:
+		p.next()
+		return "", false, fmt.Errorf("%w: %q outside of environment", ErrUnexpected, t.text)
+	case tokenNumber:
+		p.next()
+		return "<mn>" + t.text + "</mn>", false, nil
+	case tokenLetter:
+		p.next()
+		return "<mi>" + html.EscapeString(t.text) + "</mi>", false, nil
+	case tokenOther:
+		p.next()
+		return mo(t.text), false, nil
+	case tokenCommand:
+		p.next()
+		return p.parseCommand(t)
+	}
+	return "", false, fmt.Errorf("%w: %q", ErrUnexpected, t.text)
+}
+
+func mo(op string) string {
+	if op == "-" {
+		op = "−"
+	}
+	return "<mo>" + html.EscapeString(op) + "</mo>"
+}
+
+func mrow(nodes []string) string {
+	if len(nodes) == 1 {
+		return nodes[0]
+	}
+	return "<mrow>" + strings.Join(nodes, "") + "</mrow>"
+}
@@ -0,0 +1,85 @@
+package mathml_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cvanloo/blog-go/page/mathml"
+)
+
+func TestConvert(t *testing.T) {
+	testCases := []struct {
+		tex      string
+		display  bool
+		expected string
+	}{
+		{
+			tex:      `x^2 + y_i`,
+			expected: `<mrow><msup><mi>x</mi><mn>2</mn></msup><mo>+</mo><msub><mi>y</mi><mi>i</mi></msub></mrow>`,
+		},
+		{
+			tex:      `\frac{1}{\alpha} \le \sqrt[3]{x}`,
+			expected: `<mrow><mfrac><mn>1</mn><mi>α</mi></mfrac><mo>≤</mo><mroot><mi>x</mi><mn>3</mn></mroot></mrow>`,
+		},
+		{
+			tex:      `\sum_{i=1}^n i`,
+			expected: `<mrow><msubsup><mo largeop="true" movablelimits="true">∑</mo><mrow><mi>i</mi><mo>=</mo><mn>1</mn></mrow><mi>n</mi></msubsup><mi>i</mi></mrow>`,
+		},
+		{
+			tex:      `\sum_{i=1}^n i`,
+			display:  true,
+			expected: `<mrow><munderover><mo largeop="true" movablelimits="true">∑</mo><mrow><mi>i</mi><mo>=</mo><mn>1</mn></mrow><mi>n</mi></munderover><mi>i</mi></mrow>`,
+		},
+		{
+			tex:      `\int_0^\infty e^{-x}\,dx`,
+			display:  true,
+			expected: `<mrow><msubsup><mo largeop="true">∫</mo><mn>0</mn><mi>∞</mi></msubsup><msup><mi>e</mi><mrow><mo>−</mo><mi>x</mi></mrow></msup><mspace width="0.167em"></mspace><mi>d</mi><mi>x</mi></mrow>`,
+		},
+		{
+			tex:      `\begin{pmatrix} a & b \\ c & d \\ \end{pmatrix}`,
+			display:  true,
+			expected: `<mrow><mo fence="true">(</mo><mtable><mtr><mtd><mi>a</mi></mtd><mtd><mi>b</mi></mtd></mtr><mtr><mtd><mi>c</mi></mtd><mtd><mi>d</mi></mtd></mtr></mtable><mo fence="true">)</mo></mrow>`,
+		},
+		{
+			tex:      `\left\langle \mathbb{R}, \text{a b} \right.`,
+			expected: `<mrow><mo fence="true">⟨</mo><mi mathvariant="double-struck">R</mi><mo>,</mo><mtext>a` + "\u00a0" + `b</mtext></mrow>`,
+		},
+		{
+			tex:      "\xff\\text{ab}",
+			expected: `<mrow><mo>` + "\uFFFD" + `</mo><mtext>ab</mtext></mrow>`,
+		},
+	}
+	for _, testCase := range testCases {
+		got, err := mathml.Convert(testCase.tex, testCase.display)
+		if err != nil {
+			t.Errorf("%s: %v", testCase.tex, err)
+			continue
+		}
+		if !strings.Contains(got, "<semantics>"+testCase.expected+"<annotation") {
+			t.Errorf("%s:\ngot:  %s\nwant: %s", testCase.tex, got, testCase.expected)
+		}
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	testCases := []struct {
+		tex      string
+		expected error
+	}{
+		{`\foo`, mathml.ErrUnknownCommand},
+		{`\frac{a}`, mathml.ErrMissingArgument},
+		{`{x`, mathml.ErrUnbalanced},
+		{`x}`, mathml.ErrUnbalanced},
+		{`x_1_2`, mathml.ErrDoubleScript},
+		{`\begin{matrix} a \end{pmatrix}`, mathml.ErrUnbalanced},
+		{`\begin{tabular} a \end{tabular}`, mathml.ErrUnknownEnvironment},
+		{`a & b`, mathml.ErrUnexpected},
+	}
+	for _, testCase := range testCases {
+		_, err := mathml.Convert(testCase.tex, false)
+		if !errors.Is(err, testCase.expected) {
+			t.Errorf("%s: expected error %v, got: %v", testCase.tex, testCase.expected, err)
+		}
+	}
+}
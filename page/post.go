@@ -10,14 +10,20 @@ import (
 	"html/template"
 	"io"
 	"log"
+	"maps"
 	"net/url"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	. "github.com/cvanloo/blog-go/assert"
+	"github.com/cvanloo/blog-go/markup/diagnostic"
 	"github.com/cvanloo/blog-go/markup/parser"
+	"github.com/cvanloo/blog-go/page/highlight"
+	"github.com/cvanloo/blog-go/page/mathml"
+	"github.com/cvanloo/blog-go/stack"
 )
 
 //go:embed post
@@ -60,6 +66,7 @@ type (
 		EnableRevisionWarning bool
 		TOC                   TableOfContents
 		Sections              []Section
+		Footnotes             Footnotes
 		Relevant              *RelevantBox // @todo: implement: need html custom functions first
 	}
 	Author struct {
@@ -78,6 +85,7 @@ type (
 		Link  string
 	}
 	TableOfContents struct {
+		MaxDepth int // deepest section level to include
 		Sections []TOCSection
 	}
 	TOCSection struct {
@@ -92,10 +100,22 @@ type (
 		Content []Renderable
 	}
 	Paragraph struct {
+		Attributes
 		Content StringRenderable
 	}
-	Text              string
-	Mono              string
+	Text         string
+	Mono         string
+	Superscript  string
+	Subscript    string
+	Kbd          string
+	Abbreviation struct {
+		Abbr, Title string
+	}
+	Math struct {
+		Inline bool
+		TeX    string
+		MathML template.HTML
+	}
 	EscapedString     string
 	StringOnlyContent []StringRenderable
 	Strong            struct {
@@ -107,8 +127,17 @@ type (
 	EmphasisStrong struct {
 		StringOnlyContent
 	}
+	// QuotationMarks are the opening and closing marks of a quote, see QuotationMarksFor.
+	QuotationMarks struct {
+		Open, Close EscapedString
+	}
+	EnquoteSingle struct {
+		StringOnlyContent
+		QuotationMarks
+	}
 	EnquoteDouble struct {
 		StringOnlyContent
+		QuotationMarks
 	}
 	EnquoteAngled struct {
 		StringOnlyContent
@@ -119,36 +148,97 @@ type (
 	Marker struct {
 		StringOnlyContent
 	}
+	Span struct {
+		Attributes
+		Content StringRenderable
+	}
 	Link struct {
-		Name StringRenderable
-		Href string
+		Name  StringRenderable
+		Href  string
+		Title string
 	}
 	CodeBlock struct {
 		Attributes
-		Lines []string
+		// Label is the human readable name of the language, empty if none was given.
+		Label    string
+		File     string
+		NoNumber bool
+		Lines    []CodeLine
+	}
+	CodeLine struct {
+		Number      int
+		Highlighted bool
+		Content     template.HTML
 	}
 	Sidenote struct {
 		// @todo: For the title attribute we can't have <b> and stuff...
 		Word, Content StringRenderable
 	}
-	Note struct {
+	// FootnoteRef is the numbered marker referencing a footnote.
+	FootnoteRef struct {
+		Number, Use int
+	}
+	// Footnote is an entry in the notes section at the end of the post.
+	Footnote struct {
+		Number, Uses int
+		Content      []Renderable
+	}
+	Footnotes []Footnote
+	Note      struct {
 		Type string
 		Content []Renderable
 	}
+	// Admonition is a call-out box, optionally collapsible.
+	Admonition struct {
+		Type        string
+		Title       StringRenderable // the type is shown if empty
+		Collapsible bool
+		Open        bool
+		Content     []Renderable
+	}
 	Ruby struct {
 		Kanji, Furigana StringRenderable
 	}
 	Image struct {
+		Attributes
 		Name       string
 		Title, Alt StringRenderable
 	}
 	Video struct {
+		Attributes
 		Name       string
 		Title, Alt StringRenderable
 	}
 	Blockquote struct {
 		Attributes
-		QuoteText, Author, Source StringRenderable
+		Content        []Renderable
+		Author, Source StringRenderable
+	}
+	List struct {
+		Ordered bool
+		Start   int
+		Items   []ListItem
+	}
+	ListItem struct {
+		Task, Checked bool
+		Content       []Renderable
+	}
+	Table struct {
+		Attributes
+		Caption string
+		Header  []TableCell
+		Rows    [][]TableCell
+	}
+	TableCell struct {
+		Align   string // left, center, right, or empty for the default alignment
+		Content StringRenderable
+	}
+	DefinitionList struct {
+		Definitions []Definition
+	}
+	Definition struct {
+		Term         StringRenderable
+		Explanations []StringRenderable
 	}
 	HorizontalRule struct{}
 	LineBreak      struct{}
@@ -164,6 +254,10 @@ type (
 	}
 )
 
+// DefaultTOCDepth is the deepest section level included in the table of contents,
+// unless configured otherwise using the toc-depth meta key.
+const DefaultTOCDepth = 2
+
 func WritePost(w io.Writer, p Post) error {
 	p.Site = SiteInfo // @todo
 	return post.Execute(w, "post.gohtml", p)
@@ -232,6 +326,30 @@ func (e EmphasisStrong) Text() string {
 	return fmt.Sprintf("<em><strong>%s</strong></em>", e.StringOnlyContent.Text())
 }
 
+// newMath converts the TeX source of m to MathML.
+// If the conversion fails, the returned Math renders the TeX source instead.
+func newMath(m *parser.Math) (Math, error) {
+	math := Math{
+		Inline: m.Inline,
+		TeX:    m.TeX,
+	}
+	mml, err := mathml.Convert(m.TeX, !m.Inline)
+	if err != nil {
+		math.MathML = template.HTML(fmt.Sprintf(`<code class="math-error">%s</code>`, template.HTMLEscapeString(m.TeX)))
+		return math, err
+	}
+	math.MathML = template.HTML(mml)
+	return math, nil
+}
+
+func (m Math) Render() (template.HTML, error) {
+	return m.MathML, nil
+}
+
+func (m Math) Text() string {
+	return string(m.MathML)
+}
+
 func (m Mono) Render() (template.HTML, error) {
 	return template.HTML(m.Text()), nil
 }
@@ -242,12 +360,97 @@ func (m Mono) Text() string {
 	return strings.TrimSpace(bs.String())
 }
 
+func (s Superscript) Render() (template.HTML, error) {
+	return template.HTML(s.Text()), nil
+}
+
+func (s Superscript) Text() string {
+	return fmt.Sprintf("<sup>%s</sup>", template.HTMLEscapeString(string(s)))
+}
+
+func (s Subscript) Render() (template.HTML, error) {
+	return template.HTML(s.Text()), nil
+}
+
+func (s Subscript) Text() string {
+	return fmt.Sprintf("<sub>%s</sub>", template.HTMLEscapeString(string(s)))
+}
+
+func (k Kbd) Render() (template.HTML, error) {
+	return template.HTML(k.Text()), nil
+}
+
+func (k Kbd) Text() string {
+	return fmt.Sprintf("<kbd>%s</kbd>", template.HTMLEscapeString(string(k)))
+}
+
+func (a Abbreviation) Render() (template.HTML, error) {
+	return template.HTML(a.Text()), nil
+}
+
+func (a Abbreviation) Text() string {
+	return fmt.Sprintf(`<abbr title="%s">%s</abbr>`, template.HTMLEscapeString(a.Title), template.HTMLEscapeString(a.Abbr))
+}
+
+// quotationMarks maps a language (or just its primary subtag) to its double and
+// single quotation marks.
+var quotationMarks = map[string][2]QuotationMarks{
+	"en":    {{AmpLeftDoubleQuote, AmpRightDoubleQuote}, {AmpLeftSingleQuote, AmpRightSingleQuoteOrApostrophe}},
+	"de":    {{"&bdquo;", AmpLeftDoubleQuote}, {"&sbquo;", AmpLeftSingleQuote}},
+	"de-ch": {{AmpLeftAngledQuote, AmpRightAngledQuote}, {"&lsaquo;", "&rsaquo;"}},
+	"fr":    {{"&laquo;&nbsp;", "&nbsp;&raquo;"}, {"&lsaquo;&nbsp;", "&nbsp;&rsaquo;"}},
+	"it":    {{AmpLeftAngledQuote, AmpRightAngledQuote}, {AmpLeftDoubleQuote, AmpRightDoubleQuote}},
+	"es":    {{AmpLeftAngledQuote, AmpRightAngledQuote}, {AmpLeftDoubleQuote, AmpRightDoubleQuote}},
+	"pt":    {{AmpLeftAngledQuote, AmpRightAngledQuote}, {AmpLeftDoubleQuote, AmpRightDoubleQuote}},
+	"ru":    {{AmpLeftAngledQuote, AmpRightAngledQuote}, {"&bdquo;", AmpLeftDoubleQuote}},
+	"pl":    {{"&bdquo;", AmpRightDoubleQuote}, {AmpLeftAngledQuote, AmpRightAngledQuote}},
+	"cs":    {{"&bdquo;", AmpLeftDoubleQuote}, {"&sbquo;", AmpLeftSingleQuote}},
+	"nl":    {{AmpLeftDoubleQuote, AmpRightDoubleQuote}, {AmpLeftSingleQuote, AmpRightSingleQuoteOrApostrophe}},
+	"sv":    {{AmpRightDoubleQuote, AmpRightDoubleQuote}, {AmpRightSingleQuoteOrApostrophe, AmpRightSingleQuoteOrApostrophe}},
+	"fi":    {{AmpRightDoubleQuote, AmpRightDoubleQuote}, {AmpRightSingleQuoteOrApostrophe, AmpRightSingleQuoteOrApostrophe}},
+	"ja":    {{"「", "」"}, {"『", "』"}},
+	"zh":    {{AmpLeftDoubleQuote, AmpRightDoubleQuote}, {AmpLeftSingleQuote, AmpRightSingleQuoteOrApostrophe}},
+	"zh-tw": {{"「", "」"}, {"『", "』"}},
+}
+
+// QuotationMarksFor returns the double and single quotation marks used by lang
+// (a language tag like en, de-CH, or ja).
+// Languages that aren't known use the English quotation marks.
+func QuotationMarksFor(lang string) (double, single QuotationMarks) {
+	lang = strings.ToLower(strings.ReplaceAll(lang, "_", "-"))
+	marks, ok := quotationMarks[lang]
+	if !ok {
+		primary, _, _ := strings.Cut(lang, "-")
+		marks, ok = quotationMarks[primary]
+	}
+	if !ok {
+		marks = quotationMarks["en"]
+	}
+	return marks[0], marks[1]
+}
+
+func (q EnquoteSingle) Render() (template.HTML, error) {
+	return template.HTML(q.Text()), nil
+}
+
+func (q EnquoteSingle) Text() string {
+	marks := q.QuotationMarks
+	if marks == (QuotationMarks{}) {
+		_, marks = QuotationMarksFor("")
+	}
+	return string(marks.Open) + q.StringOnlyContent.Text() + string(marks.Close)
+}
+
 func (q EnquoteDouble) Render() (template.HTML, error) {
 	return template.HTML(q.Text()), nil
 }
 
 func (q EnquoteDouble) Text() string {
-	return fmt.Sprintf("&ldquo;%s&rdquo;", q.StringOnlyContent.Text())
+	marks := q.QuotationMarks
+	if marks == (QuotationMarks{}) {
+		marks, _ = QuotationMarksFor("")
+	}
+	return string(marks.Open) + q.StringOnlyContent.Text() + string(marks.Close)
 }
 
 func (q EnquoteAngled) Render() (template.HTML, error) {
@@ -274,6 +477,17 @@ func (m Marker) Render() (template.HTML, error) {
 	return template.HTML(m.Text()), nil
 }
 
+func (s Span) Text() string {
+	if attrs := s.Attributes.HTML(); len(attrs) > 0 {
+		return fmt.Sprintf("<span %s>%s</span>", attrs, s.Content.Text())
+	}
+	return fmt.Sprintf("<span>%s</span>", s.Content.Text())
+}
+
+func (s Span) Render() (template.HTML, error) {
+	return template.HTML(s.Text()), nil
+}
+
 func (n Note) Render() (template.HTML, error) {
 	bs := &bytes.Buffer{}
 	PanicIf(post.Execute(bs, "note.gohtml", n))
@@ -287,6 +501,16 @@ func (n Note) TypeOrDefault() string {
 	return strings.ToLower(n.Type)
 }
 
+func (a *Admonition) Append(r Renderable) {
+	a.Content = append(a.Content, r)
+}
+
+func (a Admonition) Render() (template.HTML, error) {
+	bs := &bytes.Buffer{}
+	PanicIf(post.Execute(bs, "admonition.gohtml", a))
+	return template.HTML(bs.String()), nil
+}
+
 func (r Ruby) Text() string {
 	bs := &bytes.Buffer{}
 	PanicIf(post.Execute(bs, "ruby.gohtml", r))
@@ -373,6 +597,41 @@ func (sn Sidenote) Text() string {
 	return strings.TrimSpace(bs.String())
 }
 
+func (f FootnoteRef) Render() (template.HTML, error) {
+	return template.HTML(f.Text()), nil
+}
+
+func (f FootnoteRef) Text() string {
+	return fmt.Sprintf(`<sup class="footnote-ref" id="%s"><a href="#%s" role="doc-noteref">%d</a></sup>`, footnoteRefID(f.Number, f.Use), footnoteID(f.Number), f.Number)
+}
+
+func footnoteID(number int) string {
+	return fmt.Sprintf("footnote-%d", number)
+}
+
+func footnoteRefID(number, use int) string {
+	return fmt.Sprintf("footnote-%d-ref-%d", number, use)
+}
+
+func (f Footnote) ID() string {
+	return footnoteID(f.Number)
+}
+
+// BackRefs returns the ids of all references to the footnote, in order.
+func (f Footnote) BackRefs() []string {
+	refs := make([]string, f.Uses)
+	for i := range refs {
+		refs[i] = footnoteRefID(f.Number, i+1)
+	}
+	return refs
+}
+
+func (fs Footnotes) Render() (template.HTML, error) {
+	bs := &bytes.Buffer{}
+	err := post.Execute(bs, "footnotes.gohtml", fs)
+	return template.HTML(bs.String()), err
+}
+
 func (p Post) Canonical() string {
 	path := p.UrlPath
 	return fmt.Sprintf("%s://%s/%s", SiteInfo.Address.Scheme, SiteInfo.Address.Host, path)
@@ -418,6 +677,16 @@ func (t TableOfContents) Render() (template.HTML, error) {
 	return template.HTML(bs.String()), err
 }
 
+// Add appends a section of the given level to the table of contents,
+// nesting it below the last section of the previous level.
+func (t *TableOfContents) Add(level int, s TOCSection) {
+	sections := &t.Sections
+	for i := 1; i < level && len(*sections) > 0; i++ {
+		sections = &(*sections)[len(*sections)-1].NextLevel
+	}
+	*sections = append(*sections, s)
+}
+
 func (s *TOCSection) HasNextLevel() bool {
 	return len(s.NextLevel) > 0
 }
@@ -430,13 +699,10 @@ func (s Section) ID() string {
 	return strings.ReplaceAll(strings.ToLower(s.Heading.SanitizedText()), " ", "-")
 }
 
-func (s Section) SectionLevel1() bool {
-	return s.Level == 1
-}
-
-// @todo: separate template, separate type
-func (s Section) SectionLevel2() bool {
-	return s.Level == 2
+// HeadingLevel returns the html heading level of the section.
+// The title of the post is the only h1, so a level 1 section starts out at h2.
+func (s Section) HeadingLevel() int {
+	return s.Level + 1
 }
 
 func (s Section) Render() (template.HTML, error) {
@@ -469,12 +735,82 @@ func (v Video) Render() (template.HTML, error) {
 	return template.HTML(bs.String()), err
 }
 
+func (b *Blockquote) Append(r Renderable) {
+	b.Content = append(b.Content, r)
+}
+
 func (b Blockquote) Render() (template.HTML, error) {
 	bs := &bytes.Buffer{}
 	err := post.Execute(bs, "blockquote.gohtml", b)
 	return template.HTML(bs.String()), err
 }
 
+func (l List) Render() (template.HTML, error) {
+	bs := &bytes.Buffer{}
+	err := post.Execute(bs, "list.gohtml", l)
+	return template.HTML(bs.String()), err
+}
+
+func (l List) HasTasks() bool {
+	for _, i := range l.Items {
+		if i.Task {
+			return true
+		}
+	}
+	return false
+}
+
+// HasStart reports whether an ordered list starts at a number other than 1.
+func (l List) HasStart() bool {
+	return l.Ordered && l.Start != 1
+}
+
+func (t Table) Render() (template.HTML, error) {
+	bs := &bytes.Buffer{}
+	err := post.Execute(bs, "table.gohtml", t)
+	return template.HTML(bs.String()), err
+}
+
+func (d DefinitionList) Render() (template.HTML, error) {
+	bs := &bytes.Buffer{}
+	err := post.Execute(bs, "definition-list.gohtml", d)
+	return template.HTML(bs.String()), err
+}
+
+func (i ListItem) Render() (template.HTML, error) {
+	bs := &bytes.Buffer{}
+	err := post.Execute(bs, "list-item.gohtml", i)
+	return template.HTML(bs.String()), err
+}
+
+// Blocks returns the content of the list item.
+// Unless the item consists of multiple paragraphs, the paragraph is unwrapped,
+// so that short items don't end up with a <p> inside each <li>.
+func (i ListItem) Blocks() []Renderable {
+	paragraphs := 0
+	for _, c := range i.Content {
+		if _, ok := c.(Paragraph); ok {
+			paragraphs++
+		}
+	}
+	if paragraphs > 1 {
+		return i.Content
+	}
+	blocks := make([]Renderable, 0, len(i.Content))
+	for _, c := range i.Content {
+		if p, ok := c.(Paragraph); ok {
+			blocks = append(blocks, p.Content)
+		} else {
+			blocks = append(blocks, c)
+		}
+	}
+	return blocks
+}
+
+func (i *ListItem) Append(r Renderable) {
+	i.Content = append(i.Content, r)
+}
+
 func (hr HorizontalRule) Render() (template.HTML, error) {
 	return template.HTML("\n<hr>\n"), nil
 }
@@ -537,13 +873,28 @@ type (
 		//parser.NopVisitor
 		TemplateData     *Post
 		Errors           error
-		currentSection1  *Section
-		currentSection2  *Section
+		sections         stack.Stack[*Section]
 		currentParagraph *Paragraph
 		currentSOC       StringOnlyContent
 
 		currentContainer Container
 		htmlState        HtmlState
+		lists            stack.Stack[*listBuilder]
+		admonitions      stack.Stack[*admonitionBuilder]
+		blockquotes      stack.Stack[*blockquoteBuilder]
+	}
+	listBuilder struct {
+		parentContainer Container
+		list            List
+		currentItem     *ListItem
+	}
+	admonitionBuilder struct {
+		parentContainer Container
+		admonition      Admonition
+	}
+	blockquoteBuilder struct {
+		parentContainer Container
+		blockquote      Blockquote
 	}
 	Container interface {
 		Append(r Renderable)
@@ -554,6 +905,54 @@ type (
 	}
 )
 
+// HTML renders the attributes that are safe to pass on to an element: id,
+// class, lang and data-*.
+// Other attributes configure the generator and are not rendered.
+func (a Attributes) HTML() template.HTMLAttr {
+	keys := []string{"id", "class", "lang"}
+	var data []string
+	for key := range a {
+		if isDataAttribute(key) {
+			data = append(data, key)
+		}
+	}
+	slices.Sort(data)
+	var attrs []string
+	for _, key := range append(keys, data...) {
+		if val, ok := a[key]; ok {
+			attrs = append(attrs, fmt.Sprintf(`%s="%s"`, key, template.HTMLEscapeString(val)))
+		}
+	}
+	return template.HTMLAttr(strings.Join(attrs, " "))
+}
+
+// WithClass returns a copy of the attributes with class added in front of the
+// classes of the attribute list, for elements that always have a class.
+func (a Attributes) WithClass(class string) Attributes {
+	merged := maps.Clone(a)
+	if merged == nil {
+		merged = Attributes{}
+	}
+	if other, ok := merged["class"]; ok && other != "" {
+		class += " " + other
+	}
+	merged["class"] = class
+	return merged
+}
+
+func isDataAttribute(key string) bool {
+	name, ok := strings.CutPrefix(key, "data-")
+	if !ok || len(name) == 0 {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
 func (s *Section) Append(r Renderable) {
 	s.Content = append(s.Content, r)
 }
@@ -561,7 +960,7 @@ func (s *Section) Append(r Renderable) {
 func (v *MakeGenVisitor) VisitBlog(b *parser.Blog) {
 	if draft, ok := b.Meta["draft"]; ok {
 		if len(draft) > 1 {
-			v.Errors = errors.Join(v.Errors, errors.New("multiple definitions of meta key: draft"))
+			v.Errors = errors.Join(v.Errors, diagnostic.At(b.MetaLocation("draft", 1), "duplicate-meta-key", errors.New("multiple definitions of meta key: draft")))
 		}
 		draftVal := stringFromTextSimple(draft[0])
 		if draftVal == "false" {
@@ -571,55 +970,55 @@ func (v *MakeGenVisitor) VisitBlog(b *parser.Blog) {
 
 	if urlPath, ok := b.Meta["url-path"]; ok {
 		if len(urlPath) > 1 {
-			v.Errors = errors.Join(v.Errors, errors.New("multiple definitions of meta key: url-path"))
+			v.Errors = errors.Join(v.Errors, diagnostic.At(b.MetaLocation("url-path", 1), "duplicate-meta-key", errors.New("multiple definitions of meta key: url-path")))
 		}
 		v.TemplateData.UrlPath = stringFromTextSimple(urlPath[0])
 	} else {
-		v.Errors = errors.Join(v.Errors, errors.New("missing mandatory meta key: url-path"))
+		v.Errors = errors.Join(v.Errors, diagnostic.At(b.Location(), "missing-meta-key", errors.New("missing mandatory meta key: url-path")))
 	}
 
 	if author, ok := b.Meta["author"]; ok {
 		if len(author) > 1 {
-			v.Errors = errors.Join(v.Errors, errors.New("multiple definitions of meta key: author"))
+			v.Errors = errors.Join(v.Errors, diagnostic.At(b.MetaLocation("author", 1), "duplicate-meta-key", errors.New("multiple definitions of meta key: author")))
 		}
 		v.TemplateData.Author.Name = stringRenderableFromTextSimple(author[0])
 	} else {
-		v.Errors = errors.Join(v.Errors, errors.New("missing mandatory meta key: author"))
+		v.Errors = errors.Join(v.Errors, diagnostic.At(b.Location(), "missing-meta-key", errors.New("missing mandatory meta key: author")))
 	}
 
 	if title, ok := b.Meta["title"]; ok {
 		if len(title) > 1 {
-			v.Errors = errors.Join(v.Errors, errors.New("multiple definitions of meta key: title"))
+			v.Errors = errors.Join(v.Errors, diagnostic.At(b.MetaLocation("title", 1), "duplicate-meta-key", errors.New("multiple definitions of meta key: title")))
 		}
 		v.TemplateData.Title = stringRenderableFromTextSimple(title[0])
 	} else {
-		v.Errors = errors.Join(v.Errors, errors.New("missing mandatory meta key: title"))
+		v.Errors = errors.Join(v.Errors, diagnostic.At(b.Location(), "missing-meta-key", errors.New("missing mandatory meta key: title")))
 	}
 
 	if lang, ok := b.Meta["lang"]; ok {
 		if len(lang) > 1 {
-			v.Errors = errors.Join(v.Errors, errors.New("multiple definitions of meta key: lang"))
+			v.Errors = errors.Join(v.Errors, diagnostic.At(b.MetaLocation("lang", 1), "duplicate-meta-key", errors.New("multiple definitions of meta key: lang")))
 		}
 		v.TemplateData.Lang = stringFromTextSimple(lang[0])
 	} else {
-		v.Errors = errors.Join(v.Errors, errors.New("missing mandatory meta key: lang"))
+		v.Errors = errors.Join(v.Errors, diagnostic.At(b.Location(), "missing-meta-key", errors.New("missing mandatory meta key: lang")))
 	}
 
 	if email, ok := b.Meta["email"]; ok {
 		if len(email) > 1 {
-			v.Errors = errors.Join(v.Errors, errors.New("multiple definitions of meta key: email"))
+			v.Errors = errors.Join(v.Errors, diagnostic.At(b.MetaLocation("email", 1), "duplicate-meta-key", errors.New("multiple definitions of meta key: email")))
 		}
 		v.TemplateData.Author.Email = stringRenderableFromTextSimple(email[0])
 	}
 	if relMe, ok := b.Meta["rel-me"]; ok {
 		if len(relMe) > 1 {
-			v.Errors = errors.Join(v.Errors, errors.New("multiple definitions of meta key: rel-me"))
+			v.Errors = errors.Join(v.Errors, diagnostic.At(b.MetaLocation("rel-me", 1), "duplicate-meta-key", errors.New("multiple definitions of meta key: rel-me")))
 		}
 		v.TemplateData.Author.RelMe = stringRenderableFromTextSimple(relMe[0])
 	}
 	if fediCreator, ok := b.Meta["fedi-creator"]; ok {
 		if len(fediCreator) > 1 {
-			v.Errors = errors.Join(v.Errors, errors.New("multiple definitions of meta key: fedi-creator"))
+			v.Errors = errors.Join(v.Errors, diagnostic.At(b.MetaLocation("fedi-creator", 1), "duplicate-meta-key", errors.New("multiple definitions of meta key: fedi-creator")))
 		}
 		v.TemplateData.Author.FediCreator = stringRenderableFromTextSimple(fediCreator[0])
 	}
@@ -631,49 +1030,64 @@ func (v *MakeGenVisitor) VisitBlog(b *parser.Blog) {
 	//}
 	if description, ok := b.Meta["description"]; ok {
 		if len(description) > 1 {
-			v.Errors = errors.Join(v.Errors, errors.New("multiple definitions of meta key: description"))
+			v.Errors = errors.Join(v.Errors, diagnostic.At(b.MetaLocation("description", 1), "duplicate-meta-key", errors.New("multiple definitions of meta key: description")))
 		}
 		v.TemplateData.Description = stringFromTextSimple(description[0])
 	}
 	if altTitle, ok := b.Meta["alt-title"]; ok {
 		if len(altTitle) > 1 {
-			v.Errors = errors.Join(v.Errors, errors.New("multiple definitions of meta key: alt-title"))
+			v.Errors = errors.Join(v.Errors, diagnostic.At(b.MetaLocation("alt-title", 1), "duplicate-meta-key", errors.New("multiple definitions of meta key: alt-title")))
 		}
 		v.TemplateData.AltTitle = stringRenderableFromTextSimple(altTitle[0])
 	}
 	if published, ok := b.Meta["published"]; ok {
 		if len(published) > 1 {
-			v.Errors = errors.Join(v.Errors, errors.New("multiple definitions of meta key: published"))
+			v.Errors = errors.Join(v.Errors, diagnostic.At(b.MetaLocation("published", 1), "duplicate-meta-key", errors.New("multiple definitions of meta key: published")))
 		}
 		date, err := dateFromTextSimple(published[0])
 		if err != nil {
-			v.Errors = errors.Join(v.Errors, fmt.Errorf("published: %w", err))
+			v.Errors = errors.Join(v.Errors, diagnostic.At(b.MetaLocation("published", 0), "invalid-meta-value", fmt.Errorf("published: %w", err)))
 		}
 		v.TemplateData.Published.Published = date
 	}
 	if revised, ok := b.Meta["revised"]; ok {
 		if len(revised) > 1 {
-			v.Errors = errors.Join(v.Errors, errors.New("multiple definitions of meta key: revised"))
+			v.Errors = errors.Join(v.Errors, diagnostic.At(b.MetaLocation("revised", 1), "duplicate-meta-key", errors.New("multiple definitions of meta key: revised")))
 		}
 		date, err := dateFromTextSimple(revised[0])
 		if err != nil {
-			v.Errors = errors.Join(v.Errors, fmt.Errorf("revised: %w", err))
+			v.Errors = errors.Join(v.Errors, diagnostic.At(b.MetaLocation("revised", 0), "invalid-meta-value", fmt.Errorf("revised: %w", err)))
 		}
 		v.TemplateData.Published.Revised = &date
 	}
+	v.TemplateData.TOC.MaxDepth = DefaultTOCDepth
+	if tocDepth, ok := b.Meta["toc-depth"]; ok {
+		if len(tocDepth) > 1 {
+			v.Errors = errors.Join(v.Errors, diagnostic.At(b.MetaLocation("toc-depth", 1), "duplicate-meta-key", errors.New("multiple definitions of meta key: toc-depth")))
+		}
+		i, err := intFromTextSimple(tocDepth[0])
+		if err == nil && (i < 1 || i > 6) {
+			err = fmt.Errorf("%d is not a section level between 1 and 6", i)
+		}
+		if err != nil {
+			v.Errors = errors.Join(v.Errors, diagnostic.At(b.MetaLocation("toc-depth", 0), "invalid-meta-value", fmt.Errorf("toc-depth: %w", err)))
+		} else {
+			v.TemplateData.TOC.MaxDepth = i
+		}
+	}
 	if estReading, ok := b.Meta["est-reading"]; ok {
 		if len(estReading) > 1 {
-			v.Errors = errors.Join(v.Errors, errors.New("multiple definitions of meta key: est-reading"))
+			v.Errors = errors.Join(v.Errors, diagnostic.At(b.MetaLocation("est-reading", 1), "duplicate-meta-key", errors.New("multiple definitions of meta key: est-reading")))
 		}
 		i, err := intFromTextSimple(estReading[0])
 		if err != nil {
-			v.Errors = errors.Join(v.Errors, fmt.Errorf("est-reading: %w", err))
+			v.Errors = errors.Join(v.Errors, diagnostic.At(b.MetaLocation("est-reading", 0), "invalid-meta-value", fmt.Errorf("est-reading: %w", err)))
 		}
 		v.TemplateData.EstReading = i
 	}
 	if series, ok := b.Meta["series"]; ok {
 		if len(series) > 1 {
-			v.Errors = errors.Join(v.Errors, errors.New("multiple definitions of meta key: series"))
+			v.Errors = errors.Join(v.Errors, diagnostic.At(b.MetaLocation("series", 1), "duplicate-meta-key", errors.New("multiple definitions of meta key: series")))
 		}
 		v.TemplateData.Series = &Series{
 			Name: stringRenderableFromTextSimple(series[0]),
@@ -682,13 +1096,13 @@ func (v *MakeGenVisitor) VisitBlog(b *parser.Blog) {
 	}
 	if enableRevisionWarning, ok := b.Meta["enable-revision-warning"]; ok {
 		if len(enableRevisionWarning) > 1 {
-			v.Errors = errors.Join(v.Errors, errors.New("multiple definitions of meta key: enable-revision-warning"))
+			v.Errors = errors.Join(v.Errors, diagnostic.At(b.MetaLocation("enable-revision-warning", 1), "duplicate-meta-key", errors.New("multiple definitions of meta key: enable-revision-warning")))
 		}
-		b, err := boolFromTextSimple(enableRevisionWarning[0])
+		enabled, err := boolFromTextSimple(enableRevisionWarning[0])
 		if err != nil {
-			v.Errors = errors.Join(v.Errors, fmt.Errorf("enable-revision-warning: %w", err))
+			v.Errors = errors.Join(v.Errors, diagnostic.At(b.MetaLocation("enable-revision-warning", 0), "invalid-meta-value", fmt.Errorf("enable-revision-warning: %w", err)))
 		}
-		v.TemplateData.EnableRevisionWarning = b
+		v.TemplateData.EnableRevisionWarning = enabled
 	}
 	if tags, ok := b.Meta["tags"]; ok {
 		var tagStrs []string
@@ -702,103 +1116,156 @@ func (v *MakeGenVisitor) VisitBlog(b *parser.Blog) {
 }
 
 func (v *MakeGenVisitor) VisitSection(s *parser.Section) {
-	switch s.Level {
-	default:
-		panic(fmt.Errorf("invalid section level: %d", s.Level))
-	case 1:
-		v.currentSection1 = &Section{
-			Attributes: Attributes(s.Attributes),
-			Level:      s.Level,
-			Heading:    stringRenderableFromTextRich(s.Heading),
-		}
-		v.currentContainer = v.currentSection1
-		v.TemplateData.TOC.Sections = append(v.TemplateData.TOC.Sections, TOCSection{
-			ID:      v.currentSection1.ID(),
-			Heading: v.currentSection1.Heading,
+	section := &Section{
+		Attributes: Attributes(s.Attributes),
+		Level:      s.Level,
+		Heading:    v.stringRenderableFromTextRich(s.Heading),
+	}
+	v.sections = v.sections.Push(section)
+	v.currentContainer = section
+	if s.Level <= v.TemplateData.TOC.MaxDepth {
+		v.TemplateData.TOC.Add(s.Level, TOCSection{
+			ID:      section.ID(),
+			Heading: section.Heading,
 		})
-	case 2:
-		v.currentSection2 = &Section{
-			Attributes: Attributes(s.Attributes),
-			Level:      s.Level,
-			Heading:    stringRenderableFromTextRich(s.Heading),
-		}
-		v.currentContainer = v.currentSection2
-		{
-			l := len(v.TemplateData.TOC.Sections)
-			v.TemplateData.TOC.Sections[l-1].NextLevel = append(v.TemplateData.TOC.Sections[l-1].NextLevel, TOCSection{
-				ID:      v.currentSection2.ID(),
-				Heading: v.currentSection2.Heading,
-			})
-		}
 	}
 }
 
 func (v *MakeGenVisitor) VisitParagraph(p *parser.Paragraph) {
-	v.currentParagraph = &Paragraph{}
+	v.currentParagraph = &Paragraph{Attributes: Attributes(p.Attributes)}
 }
 
 func (v *MakeGenVisitor) VisitText(t *parser.Text) {
-	v.currentSOC = append(v.currentSOC, Text(*t))
+	v.currentSOC = append(v.currentSOC, Text(t.Text))
 }
 
 func (v *MakeGenVisitor) VisitLink(l *parser.Link) {
 	v.currentSOC = append(v.currentSOC, Link{
-		Name: stringRenderableFromTextRich(l.Name),
-		Href: l.Href,
+		Name:  v.stringRenderableFromTextRich(l.Name),
+		Href:  l.Href,
+		Title: l.Title,
 	})
 }
 
 func (v *MakeGenVisitor) VisitSidenote(s *parser.Sidenote) {
 	v.currentSOC = append(v.currentSOC, Sidenote{
-		Word:    stringRenderableFromTextRich(s.Word),
-		Content: stringRenderableFromTextRich(s.Content),
+		Word:    v.stringRenderableFromTextRich(s.Word),
+		Content: v.stringRenderableFromTextRich(s.Content),
+	})
+}
+
+func (v *MakeGenVisitor) VisitFootnote(f *parser.Footnote) {
+	v.currentSOC = append(v.currentSOC, FootnoteRef{
+		Number: f.Number,
+		Use:    f.Use,
 	})
 }
 
 func (v *MakeGenVisitor) VisitAmpSpecial(a *parser.AmpSpecial) {
-	v.currentSOC = append(v.currentSOC, getAmpSpecial(string(*a)))
+	v.currentSOC = append(v.currentSOC, getAmpSpecial(a.Text))
 }
 
 func (v *MakeGenVisitor) VisitEmphasis(e *parser.Emphasis) {
-	v.currentSOC = append(v.currentSOC, Emphasis{stringRenderableFromTextRich(parser.TextRich(*e))})
+	v.currentSOC = append(v.currentSOC, Emphasis{v.stringRenderableFromTextRich(e.Content)})
 }
 
 func (v *MakeGenVisitor) VisitStrong(e *parser.Strong) {
-	v.currentSOC = append(v.currentSOC, Strong{stringRenderableFromTextRich(parser.TextRich(*e))})
+	v.currentSOC = append(v.currentSOC, Strong{v.stringRenderableFromTextRich(e.Content)})
 }
 
 func (v *MakeGenVisitor) VisitEmphasisStrong(e *parser.EmphasisStrong) {
-	v.currentSOC = append(v.currentSOC, EmphasisStrong{stringRenderableFromTextRich(parser.TextRich(*e))})
+	v.currentSOC = append(v.currentSOC, EmphasisStrong{v.stringRenderableFromTextRich(e.Content)})
+}
+
+func (v *MakeGenVisitor) VisitEnquoteSingle(e *parser.EnquoteSingle) {
+	_, marks := QuotationMarksFor(v.TemplateData.Lang)
+	v.currentSOC = append(v.currentSOC, EnquoteSingle{v.stringRenderableFromTextRich(e.Content), marks})
 }
 
 func (v *MakeGenVisitor) VisitEnquoteDouble(e *parser.EnquoteDouble) {
-	v.currentSOC = append(v.currentSOC, EnquoteDouble{stringRenderableFromTextRich(parser.TextRich(*e))})
+	marks, _ := QuotationMarksFor(v.TemplateData.Lang)
+	v.currentSOC = append(v.currentSOC, EnquoteDouble{v.stringRenderableFromTextRich(e.Content), marks})
 }
 
 func (v *MakeGenVisitor) VisitEnquoteAngled(e *parser.EnquoteAngled) {
-	v.currentSOC = append(v.currentSOC, EnquoteAngled{stringRenderableFromTextRich(parser.TextRich(*e))})
+	v.currentSOC = append(v.currentSOC, EnquoteAngled{v.stringRenderableFromTextRich(e.Content)})
 }
 
 func (v *MakeGenVisitor) VisitLinkify(l *parser.Linkify) {
 	v.currentSOC = append(v.currentSOC, Link{
-		Name: StringOnlyContent{Text(*l)},
-		Href: string(*l),
+		Name: StringOnlyContent{Text(l.Text)},
+		Href: l.Text,
 	})
 }
 
 func (v *MakeGenVisitor) VisitMarker(m *parser.Marker) {
 	v.currentSOC = append(v.currentSOC, Marker{
-		stringRenderableFromTextRich(parser.TextRich(*m)),
+		v.stringRenderableFromTextRich(m.Content),
+	})
+}
+
+func (v *MakeGenVisitor) VisitSpan(s *parser.Span) {
+	v.currentSOC = append(v.currentSOC, Span{
+		Attributes: Attributes(s.Attributes),
+		Content:    v.stringRenderableFromTextRich(s.Content),
 	})
 }
 
+func (v *MakeGenVisitor) VisitRuby(r *parser.Ruby) {
+	v.currentSOC = append(v.currentSOC, rubyFromParser(r)...)
+}
+
+// rubyFromParser makes a Ruby for each annotated character (or word).
+func rubyFromParser(r *parser.Ruby) (soc StringOnlyContent) {
+	for i, kanji := range r.Kanji {
+		soc = append(soc, Ruby{
+			Kanji:    StringOnlyContent{Text(kanji)},
+			Furigana: StringOnlyContent{Text(r.Furigana[i])},
+		})
+	}
+	return soc
+}
+
 func (v *MakeGenVisitor) VisitMono(m *parser.Mono) {
-	v.currentSOC = append(v.currentSOC, Mono(*m))
+	v.currentSOC = append(v.currentSOC, Mono(m.Text))
+}
+
+func (v *MakeGenVisitor) VisitSuperscript(s *parser.Superscript) {
+	v.currentSOC = append(v.currentSOC, Superscript(s.Text))
+}
+
+func (v *MakeGenVisitor) VisitSubscript(s *parser.Subscript) {
+	v.currentSOC = append(v.currentSOC, Subscript(s.Text))
+}
+
+func (v *MakeGenVisitor) VisitKbd(k *parser.Kbd) {
+	v.currentSOC = append(v.currentSOC, Kbd(k.Text))
+}
+
+func (v *MakeGenVisitor) VisitAbbreviation(a *parser.Abbreviation) {
+	v.currentSOC = append(v.currentSOC, Abbreviation{
+		Abbr:  a.Abbr,
+		Title: a.Title,
+	})
+}
+
+func (v *MakeGenVisitor) VisitMath(m *parser.Math) {
+	v.currentSOC = append(v.currentSOC, v.mathFromParser(m))
+}
+
+// mathFromParser converts m to MathML, invalid math is reported and rendered
+// as its source.
+func (v *MakeGenVisitor) mathFromParser(m *parser.Math) Math {
+	math, err := newMath(m)
+	if err != nil {
+		v.Errors = errors.Join(v.Errors, diagnostic.At(m.Location(), "invalid-math", fmt.Errorf("math %q: %w", m.TeX, err)))
+	}
+	return math
 }
 
 func (v *MakeGenVisitor) VisitStrikethrough(s *parser.Strikethrough) {
 	v.currentSOC = append(v.currentSOC, Strikethrough{
-		stringRenderableFromTextRich(parser.TextRich(*s)),
+		v.stringRenderableFromTextRich(s.Content),
 	})
 }
 
@@ -814,18 +1281,90 @@ func (v *MakeGenVisitor) LeaveParagraph(p *parser.Paragraph) {
 }
 
 func (v *MakeGenVisitor) VisitBlockQuote(b *parser.BlockQuote) {
-	v.currentContainer.Append(Blockquote{
-		QuoteText: stringRenderableFromTextRich(b.QuoteText),
-		Author:    stringRenderableFromTextSimple(b.Author),
-		Source:    stringRenderableFromTextRich(b.Source),
-	})
+	bb := &blockquoteBuilder{
+		parentContainer: v.currentContainer,
+		blockquote: Blockquote{
+			Author: stringRenderableFromTextSimple(b.Author),
+			Source: v.stringRenderableFromTextRich(b.Source),
+		},
+	}
+	v.blockquotes = v.blockquotes.Push(bb)
+	v.currentContainer = &bb.blockquote
+}
+
+func (v *MakeGenVisitor) LeaveBlockQuote(b *parser.BlockQuote) {
+	var bb *blockquoteBuilder
+	v.blockquotes, bb = v.blockquotes.Pop()
+	bb.parentContainer.Append(bb.blockquote)
+	v.currentContainer = bb.parentContainer
 }
 
 func (v *MakeGenVisitor) VisitCodeBlock(c *parser.CodeBlock) {
-	v.currentContainer.Append(CodeBlock{
+	label, lines := highlight.Highlight(c.Attributes["Lang"], c.Lines)
+	start := 1
+	if s, ok := c.Attributes["start"]; ok {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			v.Errors = errors.Join(v.Errors, diagnostic.At(c.Location(), "invalid-code-block-attribute", fmt.Errorf("code block: invalid value for start: %q", s)))
+		} else {
+			start = n
+		}
+	}
+	highlighted := map[int]bool{}
+	if hl, ok := c.Attributes["hl"]; ok {
+		var err error
+		highlighted, err = parseLineRanges(hl, len(lines))
+		if err != nil {
+			v.Errors = errors.Join(v.Errors, diagnostic.At(c.Location(), "invalid-code-block-attribute", fmt.Errorf("code block: invalid value for hl: %w", err)))
+		}
+	}
+	_, noNumber := c.Attributes["nonumber"]
+	codeBlock := CodeBlock{
 		Attributes: Attributes(c.Attributes),
-		Lines:      c.Lines,
-	})
+		Label:      label,
+		File:       c.Attributes["file"],
+		NoNumber:   noNumber,
+	}
+	for i, line := range lines {
+		codeBlock.Lines = append(codeBlock.Lines, CodeLine{
+			Number:      start + i,
+			Highlighted: highlighted[i+1],
+			Content:     line,
+		})
+	}
+	v.currentContainer.Append(codeBlock)
+}
+
+// parseLineRanges parses a comma separated list of line numbers and line
+// ranges, like 3-5,9, into the set of contained line numbers.
+// Line numbers start at 1 and must not exceed lineCount.
+func parseLineRanges(spec string, lineCount int) (map[int]bool, error) {
+	lines := map[int]bool{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		from, to, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(from)
+		if err != nil {
+			return lines, fmt.Errorf("not a line number or range: %q", part)
+		}
+		last := first
+		if isRange {
+			last, err = strconv.Atoi(to)
+			if err != nil {
+				return lines, fmt.Errorf("not a line number or range: %q", part)
+			}
+		}
+		if first < 1 || last < first {
+			return lines, fmt.Errorf("invalid line range: %q", part)
+		}
+		if last > lineCount {
+			return lines, fmt.Errorf("line %d out of range, code block has %d lines", last, lineCount)
+		}
+		for l := first; l <= last; l++ {
+			lines[l] = true
+		}
+	}
+	return lines, nil
 }
 
 func (v *MakeGenVisitor) VisitHorizontalRule(h *parser.HorizontalRule) {
@@ -835,36 +1374,146 @@ func (v *MakeGenVisitor) VisitHorizontalRule(h *parser.HorizontalRule) {
 // @todo: bad name, since it can also be a video now
 func (v *MakeGenVisitor) VisitImage(i *parser.Image) {
 	// @todo: we need to keep this synchronized with the one in markup.go
-	switch filepath.Ext(i.Name) {
+	switch ext := filepath.Ext(i.Name); ext {
 	default:
-		panic("unreachable")
+		v.Errors = errors.Join(v.Errors, diagnostic.At(i.Location(), "unsupported-media", fmt.Errorf("unrecognized file extension: %q", ext)))
 	case ".jpg", ".jpeg", ".jxl", ".avif", ".webp", ".png":
 		v.currentContainer.Append(Image{
-			Name:  strings.TrimSuffix(filepath.Base(i.Name), filepath.Ext(i.Name)),
-			Alt:   stringRenderableFromTextSimple(i.Alt),
-			Title: stringRenderableFromTextSimple(i.Title),
+			Attributes: Attributes(i.Attributes),
+			Name:       strings.TrimSuffix(filepath.Base(i.Name), filepath.Ext(i.Name)),
+			Alt:        stringRenderableFromTextSimple(i.Alt),
+			Title:      stringRenderableFromTextSimple(i.Title),
 		})
 	case ".mp4", ".mkv", ".webm":
 		v.currentContainer.Append(Video{
-			Name:  strings.TrimSuffix(filepath.Base(i.Name), filepath.Ext(i.Name)),
-			Alt:   stringRenderableFromTextSimple(i.Alt),
-			Title: stringRenderableFromTextSimple(i.Title),
+			Attributes: Attributes(i.Attributes),
+			Name:       strings.TrimSuffix(filepath.Base(i.Name), filepath.Ext(i.Name)),
+			Alt:        stringRenderableFromTextSimple(i.Alt),
+			Title:      stringRenderableFromTextSimple(i.Title),
 		})
 	}
 }
 
-func (v *MakeGenVisitor) LeaveSection(s *parser.Section) {
-	switch s.Level {
+func (v *MakeGenVisitor) VisitTable(t *parser.Table) {
+	makeRow := func(cells []parser.TextRich) (row []TableCell) {
+		for i, c := range cells {
+			row = append(row, TableCell{
+				Align:   alignmentName(t.Alignments[i]),
+				Content: v.stringRenderableFromTextRich(c),
+			})
+		}
+		return row
+	}
+	table := Table{
+		Attributes: Attributes(t.Attributes),
+		Caption:    t.Attributes["caption"],
+		Header:     makeRow(t.Header),
+	}
+	for _, r := range t.Rows {
+		table.Rows = append(table.Rows, makeRow(r))
+	}
+	v.currentContainer.Append(table)
+}
+
+func (v *MakeGenVisitor) LeaveTable(t *parser.Table) {
+}
+
+func (v *MakeGenVisitor) VisitDefinitionList(d *parser.DefinitionList) {
+	var list DefinitionList
+	for _, def := range d.Definitions {
+		definition := Definition{
+			Term: v.stringRenderableFromTextRich(def.Term),
+		}
+		for _, e := range def.Explanations {
+			definition.Explanations = append(definition.Explanations, v.stringRenderableFromTextRich(e))
+		}
+		list.Definitions = append(list.Definitions, definition)
+	}
+	v.currentContainer.Append(list)
+}
+
+func (v *MakeGenVisitor) LeaveDefinitionList(d *parser.DefinitionList) {
+}
+
+func alignmentName(a parser.Alignment) string {
+	switch a {
 	default:
-		panic(fmt.Errorf("invalid section level: %d", s.Level))
-	case 1:
-		v.TemplateData.Sections = append(v.TemplateData.Sections, *v.currentSection1)
-		v.currentSection1 = nil
+		return ""
+	case parser.AlignLeft:
+		return "left"
+	case parser.AlignCenter:
+		return "center"
+	case parser.AlignRight:
+		return "right"
+	}
+}
+
+func (v *MakeGenVisitor) VisitList(l *parser.List) {
+	v.lists = v.lists.Push(&listBuilder{
+		parentContainer: v.currentContainer,
+		list: List{
+			Ordered: l.Ordered,
+			Start:   l.Start,
+		},
+	})
+}
+
+func (v *MakeGenVisitor) LeaveList(l *parser.List) {
+	var lb *listBuilder
+	v.lists, lb = v.lists.Pop()
+	lb.parentContainer.Append(lb.list)
+	v.currentContainer = lb.parentContainer
+}
+
+func (v *MakeGenVisitor) VisitListItem(i *parser.ListItem) {
+	lb := v.lists.Peek()
+	lb.currentItem = &ListItem{
+		Task:    i.Task,
+		Checked: i.Checked,
+	}
+	v.currentContainer = lb.currentItem
+}
+
+func (v *MakeGenVisitor) LeaveListItem(i *parser.ListItem) {
+	lb := v.lists.Peek()
+	lb.list.Items = append(lb.list.Items, *lb.currentItem)
+	lb.currentItem = nil
+	v.currentContainer = lb.parentContainer
+}
+
+func (v *MakeGenVisitor) VisitAdmonition(a *parser.Admonition) {
+	ab := &admonitionBuilder{
+		parentContainer: v.currentContainer,
+		admonition: Admonition{
+			Type:        a.Type,
+			Collapsible: a.Collapsible,
+			Open:        a.Open,
+		},
+	}
+	if len(a.Title) > 0 {
+		ab.admonition.Title = stringRenderableFromTextSimple(a.Title)
+	}
+	v.admonitions = v.admonitions.Push(ab)
+	v.currentContainer = &ab.admonition
+}
+
+func (v *MakeGenVisitor) LeaveAdmonition(a *parser.Admonition) {
+	var ab *admonitionBuilder
+	v.admonitions, ab = v.admonitions.Pop()
+	ab.parentContainer.Append(ab.admonition)
+	v.currentContainer = ab.parentContainer
+}
+
+func (v *MakeGenVisitor) LeaveSection(s *parser.Section) {
+	var section *Section
+	v.sections, section = v.sections.Pop()
+	if len(v.sections) > 0 {
+		parent := v.sections.Peek()
+		parent.Content = append(parent.Content, *section)
+		v.currentContainer = parent
+	} else {
+		v.TemplateData.Sections = append(v.TemplateData.Sections, *section)
 		v.currentContainer = nil
-	case 2:
-		v.currentSection1.Content = append(v.currentSection1.Content, *v.currentSection2)
-		v.currentSection2 = nil
-		v.currentContainer = v.currentSection1
 	}
 }
 
@@ -888,6 +1537,7 @@ type (
 	HtmlState   func(v *MakeGenVisitor, h *parser.Html, entering bool)
 	HtmlInvalid struct {
 		nestingCount int
+		parentState  HtmlState
 	}
 	HtmlAbstract struct {
 		content []Renderable
@@ -945,7 +1595,11 @@ func (i *HtmlInvalid) htmlInvalid(v *MakeGenVisitor, h *parser.Html, entering bo
 	} else {
 		i.nestingCount--
 		if i.nestingCount == 0 {
-			v.htmlState = v.htmlTopLevel
+			if i.parentState != nil {
+				v.htmlState = i.parentState
+			} else {
+				v.htmlState = v.htmlTopLevel
+			}
 		}
 	}
 }
@@ -954,33 +1608,33 @@ func (r *HtmlRelevantBox) htmlRelevantBox(v *MakeGenVisitor, h *parser.Html, ent
 	if entering {
 		switch h.Name {
 		default:
-			v.Errors = errors.Join(v.Errors, fmt.Errorf("%s: %w", h.Name, ErrInvalidHtmlPos))
+			v.Errors = errors.Join(v.Errors, diagnostic.At(h.Location(), "invalid-html", fmt.Errorf("%s: %w", h.Name, ErrInvalidHtmlPos)))
 		case "Relevant":
 			href, ok := h.Attributes["href"]
 			if !ok {
-				v.Errors = errors.Join(v.Errors, errors.New("relevant item missing its href attribute"))
+				v.Errors = errors.Join(v.Errors, diagnostic.At(h.Location(), "invalid-html", errors.New("relevant item missing its href attribute")))
 			}
 			date, ok := h.Attributes["date"]
 			var parsedDate time.Time
 			if !ok {
-				v.Errors = errors.Join(v.Errors, errors.New("relevant item missing its date attribute"))
+				v.Errors = errors.Join(v.Errors, diagnostic.At(h.Location(), "invalid-html", errors.New("relevant item missing its date attribute")))
 			} else {
 				var err error
 				parsedDate, err = time.Parse("2006-01-02", date)
 				if err != nil {
-					v.Errors = errors.Join(v.Errors, fmt.Errorf("relevant item invalid value for date attribute: %w", err))
+					v.Errors = errors.Join(v.Errors, diagnostic.At(h.Location(), "invalid-html", fmt.Errorf("relevant item invalid value for date attribute: %w", err)))
 				}
 			}
 			title, ok := h.Attributes["title"]
 			var parsedTitle StringRenderable
 			if !ok {
-				v.Errors = errors.Join(v.Errors, errors.New("relevant item missing its title attribute"))
+				v.Errors = errors.Join(v.Errors, diagnostic.At(h.Location(), "invalid-html", errors.New("relevant item missing its title attribute")))
 			} else {
 				p, err := parseStringAsTextRich(title)
 				if err != nil {
-					v.Errors = errors.Join(v.Errors, fmt.Errorf("invalid value for title: %w", err))
+					v.Errors = errors.Join(v.Errors, diagnostic.At(h.Location(), "invalid-html", fmt.Errorf("invalid value for title: %w", err)))
 				} else {
-					parsedTitle = stringRenderableFromTextRich(p)
+					parsedTitle = v.stringRenderableFromTextRich(p)
 				}
 			}
 			r.currentItem = &ReadingItem{
@@ -1006,13 +1660,13 @@ func (r *HtmlRelevantBox) htmlRelevantItem(v *MakeGenVisitor, h *parser.Html, en
 			name, ok := h.Attributes["name"]
 			var parsedName StringRenderable
 			if !ok {
-				v.Errors = errors.Join(v.Errors, errors.New("relevant item's author is missing its name attribute"))
+				v.Errors = errors.Join(v.Errors, diagnostic.At(h.Location(), "invalid-html", errors.New("relevant item's author is missing its name attribute")))
 			} else {
 				p, err := parseStringAsTextRich(name)
 				if err != nil {
-					v.Errors = errors.Join(v.Errors, fmt.Errorf("invalid value for name: %w", err))
+					v.Errors = errors.Join(v.Errors, diagnostic.At(h.Location(), "invalid-html", fmt.Errorf("invalid value for name: %w", err)))
 				} else {
-					parsedName = stringRenderableFromTextRich(p)
+					parsedName = v.stringRenderableFromTextRich(p)
 				}
 			}
 			r.currentItem.AuthorLink = href
@@ -1031,7 +1685,7 @@ func (r *HtmlRelevantBox) htmlRelevantItem(v *MakeGenVisitor, h *parser.Html, en
 func (r *HtmlRelevantBox) htmlRelevantItemAuthor(v *MakeGenVisitor, h *parser.Html, entering bool) {
 	if entering {
 		// invalid
-		v.Errors = errors.Join(v.Errors, fmt.Errorf("<RelevantItem><Author> cannot contain any content: %s", h.Name))
+		v.Errors = errors.Join(v.Errors, diagnostic.At(h.Location(), "invalid-html", fmt.Errorf("<RelevantItem><Author> cannot contain any content: %s", h.Name)))
 	} else {
 		v.htmlState = r.htmlRelevantItem
 	}
@@ -1040,7 +1694,7 @@ func (r *HtmlRelevantBox) htmlRelevantItemAuthor(v *MakeGenVisitor, h *parser.Ht
 func (r *HtmlRelevantBox) htmlRelevantItemAbstract(v *MakeGenVisitor, h *parser.Html, entering bool) {
 	if entering {
 		// invalid
-		v.Errors = errors.Join(v.Errors, fmt.Errorf("<RelevantItem><Abstract> cannot contain any child html elements: %s", h.Name))
+		v.Errors = errors.Join(v.Errors, diagnostic.At(h.Location(), "invalid-html", fmt.Errorf("<RelevantItem><Abstract> cannot contain any child html elements: %s", h.Name)))
 	} else {
 		v.htmlState = r.htmlRelevantItem
 	}
@@ -1050,7 +1704,7 @@ func (v *MakeGenVisitor) htmlTopLevel(_ *MakeGenVisitor, h *parser.Html, enterin
 	if entering {
 		switch h.Name {
 		default:
-			v.Errors = errors.Join(v.Errors, fmt.Errorf("%s: %w", h.Name, ErrInvalidHtmlPos))
+			v.Errors = errors.Join(v.Errors, diagnostic.At(h.Location(), "invalid-html", fmt.Errorf("%s: %w", h.Name, ErrInvalidHtmlPos)))
 			i := &HtmlInvalid{nestingCount: 1}
 			v.currentContainer = i
 			v.htmlState = i.htmlInvalid
@@ -1063,9 +1717,9 @@ func (v *MakeGenVisitor) htmlTopLevel(_ *MakeGenVisitor, h *parser.Html, enterin
 			if customHeading, ok := h.Attributes["title"]; ok {
 				p, err := parseStringAsTextRich(customHeading)
 				if err != nil {
-					v.Errors = errors.Join(v.Errors, fmt.Errorf("invalid value for heading: %w", err))
+					v.Errors = errors.Join(v.Errors, diagnostic.At(h.Location(), "invalid-html", fmt.Errorf("invalid value for heading: %w", err)))
 				} else {
-					heading = stringRenderableFromTextRich(p)
+					heading = v.stringRenderableFromTextRich(p)
 				}
 			}
 			r := &HtmlRelevantBox{
@@ -1090,12 +1744,12 @@ func (v *MakeGenVisitor) htmlTopLevel(_ *MakeGenVisitor, h *parser.Html, enterin
 			if furiAttr, ok := h.Attributes["furi"]; ok {
 				furiRich, err := parseStringAsTextRich(furiAttr)
 				if err != nil {
-					v.Errors = errors.Join(v.Errors, fmt.Errorf("invalid value for furi: %w", err))
+					v.Errors = errors.Join(v.Errors, diagnostic.At(h.Location(), "invalid-html", fmt.Errorf("invalid value for furi: %w", err)))
 				} else {
-					furi = stringRenderableFromTextRich(furiRich)
+					furi = v.stringRenderableFromTextRich(furiRich)
 				}
 			} else {
-				v.Errors = errors.Join(v.Errors, errors.New("ruby element missing its furi attribute"))
+				v.Errors = errors.Join(v.Errors, diagnostic.At(h.Location(), "invalid-html", errors.New("ruby element missing its furi attribute")))
 			}
 			r := &HtmlRuby{
 				parentSOC: v.currentSOC,
@@ -1106,14 +1760,16 @@ func (v *MakeGenVisitor) htmlTopLevel(_ *MakeGenVisitor, h *parser.Html, enterin
 		}
 	} else {
 		// invalid
-		panic("html state confused")
+		v.Errors = errors.Join(v.Errors, diagnostic.At(h.Location(), "invalid-html", fmt.Errorf("%s: closing tag without a matching opening tag", h.Name)))
 	}
 }
 
 func (a *HtmlAbstract) htmlAbstract(v *MakeGenVisitor, h *parser.Html, entering bool) {
 	if entering {
 		// invalid
-		v.Errors = errors.Join(v.Errors, fmt.Errorf("<Abstract> cannot contain any child html elements: %s", h.Name))
+		v.Errors = errors.Join(v.Errors, diagnostic.At(h.Location(), "invalid-html", fmt.Errorf("<Abstract> cannot contain any child html elements: %s", h.Name)))
+		i := &HtmlInvalid{nestingCount: 1, parentState: a.htmlAbstract}
+		v.htmlState = i.htmlInvalid
 	} else {
 		v.currentContainer = nil
 		v.Errors = errors.Join(v.Errors, a.err)
@@ -1124,7 +1780,9 @@ func (a *HtmlAbstract) htmlAbstract(v *MakeGenVisitor, h *parser.Html, entering
 
 func (n *HtmlNote) htmlNote(v *MakeGenVisitor, h *parser.Html, entering bool) {
 	if entering {
-		v.Errors = errors.Join(v.Errors, fmt.Errorf("<Ruby> cannot contain any child html elements: %s", h.Name))
+		v.Errors = errors.Join(v.Errors, diagnostic.At(h.Location(), "invalid-html", fmt.Errorf("<Note> cannot contain any child html elements: %s", h.Name)))
+		i := &HtmlInvalid{nestingCount: 1, parentState: n.htmlNote}
+		v.htmlState = i.htmlInvalid
 	} else {
 		v.Errors = errors.Join(v.Errors, n.err)
 		n.parentContainer.Append(n.noteItem)
@@ -1135,7 +1793,9 @@ func (n *HtmlNote) htmlNote(v *MakeGenVisitor, h *parser.Html, entering bool) {
 
 func (r *HtmlRuby) htmlRuby(v *MakeGenVisitor, h *parser.Html, entering bool) {
 	if entering {
-		v.Errors = errors.Join(v.Errors, fmt.Errorf("<Ruby> cannot contain any child html elements: %s", h.Name))
+		v.Errors = errors.Join(v.Errors, diagnostic.At(h.Location(), "invalid-html", fmt.Errorf("<Ruby> cannot contain any child html elements: %s", h.Name)))
+		i := &HtmlInvalid{nestingCount: 1, parentState: r.htmlRuby}
+		v.htmlState = i.htmlInvalid
 	} else {
 		v.Errors = errors.Join(v.Errors, r.err)
 		r.parentSOC = append(r.parentSOC, Ruby{
@@ -1148,25 +1808,53 @@ func (r *HtmlRuby) htmlRuby(v *MakeGenVisitor, h *parser.Html, entering bool) {
 }
 
 func (v *MakeGenVisitor) LeaveBlog(b *parser.Blog) {
+	for _, note := range b.Endnotes {
+		footnote := Footnote{
+			Number: note.Number,
+			Uses:   note.Uses,
+		}
+		for _, p := range note.Paragraphs {
+			footnote.Content = append(footnote.Content, Paragraph{Content: v.stringRenderableFromTextRich(p)})
+		}
+		v.TemplateData.Footnotes = append(v.TemplateData.Footnotes, footnote)
+	}
 }
 
-func (v *MakeQuotesVisitor) VisitBlockQuote(b *parser.BlockQuote) {
-	text := stringRenderableFromTextRich(b.QuoteText)
-	author := stringRenderableFromTextSimple(b.Author)
-	source := stringRenderableFromTextRich(b.Source)
-	hashID := sha256.New()
-	hashID.Write([]byte(text.Text()))
-	hashID.Write([]byte(author.Text()))
-	hashID.Write([]byte(source.Text()))
-	v.currentContainer.Append(Blockquote{
-		Attributes: Attributes{
+func (v *MakeQuotesVisitor) LeaveBlockQuote(b *parser.BlockQuote) {
+	if len(v.blockquotes) == 1 { // only top level quotes are collected, nested ones are part of them
+		quote := &v.blockquotes.Peek().blockquote
+		hashID := sha256.New()
+		hashID.Write([]byte(quoteText(quote.Content)))
+		hashID.Write([]byte(quote.Author.Text()))
+		hashID.Write([]byte(quote.Source.Text()))
+		quote.Attributes = Attributes{
 			"id":    base64.StdEncoding.EncodeToString(hashID.Sum(nil)),
 			"class": "quote",
-		},
-		QuoteText: text,
-		Author:    author,
-		Source:    source,
-	})
+		}
+	}
+	v.MakeGenVisitor.LeaveBlockQuote(b)
+}
+
+// quoteText is the text of all paragraphs in a quote, including those of nested quotes.
+// The text of a single paragraph quote is just that paragraph's text, which keeps the ids of such quotes stable.
+func quoteText(content []Renderable) string {
+	var b strings.Builder
+	for _, r := range content {
+		var text string
+		switch e := r.(type) {
+		default:
+			continue
+		case Paragraph:
+			text = e.Content.Text()
+		case Blockquote:
+			text = quoteText(e.Content)
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(text)
+	}
+	return b.String()
 }
 
 func stringFromTextSimple(t parser.TextSimple) string {
@@ -1176,9 +1864,9 @@ func stringFromTextSimple(t parser.TextSimple) string {
 		default:
 			panic(fmt.Errorf("%T cannot be converted to string", e))
 		case *parser.Text:
-			b.WriteString(string(*e))
+			b.WriteString(e.Text)
 		case *parser.AmpSpecial:
-			b.WriteString(string(*e))
+			b.WriteString(e.Text)
 		}
 	}
 	return b.String()
@@ -1191,54 +1879,84 @@ func stringRenderableFromTextSimple(t parser.TextSimple) StringOnlyContent {
 		default:
 			panic(fmt.Errorf("%T cannot be converted to StringRenderable", e))
 		case *parser.Text:
-			soc = append(soc, Text(*e))
+			soc = append(soc, Text(e.Text))
 		case *parser.AmpSpecial:
-			soc = append(soc, getAmpSpecial(string(*e)))
+			soc = append(soc, getAmpSpecial(e.Text))
 		}
 	}
 	return soc
 }
 
-func stringRenderableFromTextRich(t parser.TextRich) StringOnlyContent {
+func (v *MakeGenVisitor) stringRenderableFromTextRich(t parser.TextRich) StringOnlyContent {
 	var soc StringOnlyContent
 	for _, n := range t {
 		switch e := n.(type) {
 		default:
 			panic(fmt.Errorf("%T cannot be converted to StringRenderable", e))
 		case *parser.Text:
-			soc = append(soc, Text(*e))
+			soc = append(soc, Text(e.Text))
 		case *parser.AmpSpecial:
-			soc = append(soc, getAmpSpecial(string(*e)))
+			soc = append(soc, getAmpSpecial(e.Text))
 		case *parser.Emphasis:
-			soc = append(soc, Emphasis{stringRenderableFromTextRich(parser.TextRich(*e))})
+			soc = append(soc, Emphasis{v.stringRenderableFromTextRich(e.Content)})
 		case *parser.Strong:
-			soc = append(soc, Strong{stringRenderableFromTextRich(parser.TextRich(*e))})
+			soc = append(soc, Strong{v.stringRenderableFromTextRich(e.Content)})
 		case *parser.EmphasisStrong:
-			soc = append(soc, EmphasisStrong{stringRenderableFromTextRich(parser.TextRich(*e))})
+			soc = append(soc, EmphasisStrong{v.stringRenderableFromTextRich(e.Content)})
 		case *parser.Link:
 			soc = append(soc, Link{
-				Name: stringRenderableFromTextRich(e.Name),
-				Href: e.Href,
+				Name:  v.stringRenderableFromTextRich(e.Name),
+				Href:  e.Href,
+				Title: e.Title,
 			})
 		case *parser.Sidenote:
 			soc = append(soc, Sidenote{
-				Word:    stringRenderableFromTextRich(e.Word),
-				Content: stringRenderableFromTextRich(e.Content),
+				Word:    v.stringRenderableFromTextRich(e.Word),
+				Content: v.stringRenderableFromTextRich(e.Content),
+			})
+		case *parser.Footnote:
+			soc = append(soc, FootnoteRef{
+				Number: e.Number,
+				Use:    e.Use,
 			})
 		case *parser.Strikethrough:
-			soc = append(soc, Strikethrough{stringRenderableFromTextRich(parser.TextRich(*e))})
+			soc = append(soc, Strikethrough{v.stringRenderableFromTextRich(e.Content)})
 		case *parser.Marker:
-			soc = append(soc, Marker{stringRenderableFromTextRich(parser.TextRich(*e))})
+			soc = append(soc, Marker{v.stringRenderableFromTextRich(e.Content)})
+		case *parser.Span:
+			soc = append(soc, Span{
+				Attributes: Attributes(e.Attributes),
+				Content:    v.stringRenderableFromTextRich(e.Content),
+			})
+		case *parser.Ruby:
+			soc = append(soc, rubyFromParser(e)...)
 		case *parser.Mono:
-			soc = append(soc, Mono(*e))
+			soc = append(soc, Mono(e.Text))
+		case *parser.Superscript:
+			soc = append(soc, Superscript(e.Text))
+		case *parser.Subscript:
+			soc = append(soc, Subscript(e.Text))
+		case *parser.Kbd:
+			soc = append(soc, Kbd(e.Text))
+		case *parser.Abbreviation:
+			soc = append(soc, Abbreviation{
+				Abbr:  e.Abbr,
+				Title: e.Title,
+			})
+		case *parser.Math:
+			soc = append(soc, v.mathFromParser(e))
 		case *parser.Linkify:
 			soc = append(soc, Link{
-				Href: string(*e),
+				Href: e.Text,
 			})
+		case *parser.EnquoteSingle:
+			_, marks := QuotationMarksFor(v.TemplateData.Lang)
+			soc = append(soc, EnquoteSingle{v.stringRenderableFromTextRich(e.Content), marks})
 		case *parser.EnquoteDouble:
-			soc = append(soc, EnquoteDouble{stringRenderableFromTextRich(parser.TextRich(*e))})
+			marks, _ := QuotationMarksFor(v.TemplateData.Lang)
+			soc = append(soc, EnquoteDouble{v.stringRenderableFromTextRich(e.Content), marks})
 		case *parser.EnquoteAngled:
-			soc = append(soc, EnquoteAngled{stringRenderableFromTextRich(parser.TextRich(*e))})
+			soc = append(soc, EnquoteAngled{v.stringRenderableFromTextRich(e.Content)})
 		case *parser.LineBreak:
 			soc = append(soc, LineBreak{})
 		}
@@ -1288,9 +2006,9 @@ func dateFromTextSimple(t parser.TextSimple) (date time.Time, err error) {
 	if !ok {
 		return date, fmt.Errorf("cannot convert to date: %s", t)
 	}
-	date, err = time.Parse(time.RFC3339, string(*dateStr))
+	date, err = time.Parse(time.RFC3339, dateStr.Text)
 	if err != nil {
-		date, err = time.Parse("2006-01-02", string(*dateStr))
+		date, err = time.Parse("2006-01-02", dateStr.Text)
 	}
 	return date, err
 }
@@ -1300,7 +2018,7 @@ func intFromTextSimple(t parser.TextSimple) (int, error) {
 	if !ok {
 		return 0, fmt.Errorf("cannot convert to int: %s", t)
 	}
-	i, err := strconv.Atoi(string(*intStr))
+	i, err := strconv.Atoi(intStr.Text)
 	return i, err
 }
 
@@ -1309,9 +2027,9 @@ func boolFromTextSimple(t parser.TextSimple) (bool, error) {
 	if !ok {
 		return false, fmt.Errorf("cannot convert to bool: %s", t)
 	}
-	switch string(*boolStr) {
+	switch boolStr.Text {
 	default:
-		return false, fmt.Errorf("not a boolean: %v", boolStr)
+		return false, fmt.Errorf("not a boolean: %v", boolStr.Text)
 	case "false":
 		return false, nil
 	case "true":
@@ -1321,5 +2039,5 @@ func boolFromTextSimple(t parser.TextSimple) (bool, error) {
 
 func parseStringAsTextRich(s string) (parser.TextRich, error) {
 	// @todo:
-	return parser.TextRich{AsRef(parser.Text(s))}, nil
+	return parser.TextRich{&parser.Text{Text: s}}, nil
 }
@@ -1,12 +1,17 @@
 package page_test
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
 	"testing"
 
 	"github.com/go-test/deep"
 	//"github.com/kr/pretty"
 
 	"github.com/cvanloo/blog-go/markup"
+	"github.com/cvanloo/blog-go/markup/lexer"
+	"github.com/cvanloo/blog-go/markup/parser"
 	"github.com/cvanloo/blog-go/page"
 )
 
@@ -25,3 +30,586 @@ func TestGenMakeTemplateData(t *testing.T) {
 	}
 	//t.Logf("%# v", pretty.Formatter(genBlog))
 }
+
+// text is a single text node, like the parser makes for plain text.
+func text(s string) parser.TextRich {
+	return parser.TextRich{&parser.Text{Text: s}}
+}
+
+// newBlog makes a blog in the language with the mandatory meta keys and a
+// single section holding the content.
+func newBlog(lang string, content ...parser.Node) *parser.Blog {
+	return &parser.Blog{
+		Meta: parser.Meta{
+			"url-path": {parser.TextSimple(text("test"))},
+			"author":   {parser.TextSimple(text("Colin"))},
+			"title":    {parser.TextSimple(text("Test"))},
+			"lang":     {parser.TextSimple(text(lang))},
+		},
+		Sections: []*parser.Section{
+			{
+				Level:   1,
+				Heading: text("test"),
+				Content: content,
+			},
+		},
+	}
+}
+
+// gen makes the template data of the blog, the test fails if that fails.
+func gen(t *testing.T, blog *parser.Blog) page.Post {
+	t.Helper()
+	post := page.Post{}
+	makeGen := &page.MakeGenVisitor{
+		TemplateData: &post,
+	}
+	blog.Accept(makeGen)
+	if makeGen.Errors != nil {
+		t.Error(makeGen.Errors)
+	}
+	return post
+}
+
+// genPost makes the template data of a blog, see newBlog.
+func genPost(t *testing.T, lang string, content ...parser.Node) page.Post {
+	t.Helper()
+	return gen(t, newBlog(lang, content...))
+}
+
+// render renders the i-th content of the section of a post made by genPost.
+func render(t *testing.T, post page.Post, i int) string {
+	t.Helper()
+	html, err := post.Sections[0].Content[i].Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(html))
+}
+
+// genSource lexes and parses the content of a single section, resolves its
+// references and makes the template data, the test fails if any of that fails.
+func genSource(t *testing.T, content string) page.Post {
+	t.Helper()
+	lx := lexer.New()
+	err := lx.LexSource("test.md", "---\nurl-path: test\nauthor: Colin\ntitle: Test\nlang: en\n---\n\n# test\n\n"+content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blog, err := parser.Parse(lx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refFixer := &parser.FixReferencesVisitor{}
+	blog.Accept(refFixer)
+	if refFixer.Errors != nil {
+		t.Fatal(refFixer.Errors)
+	}
+	for _, warning := range blog.Warnings {
+		t.Error(warning)
+	}
+	return gen(t, blog)
+}
+
+func TestGenTableOfContentsDepth(t *testing.T) {
+	blog := newBlog("en",
+		&parser.Section{
+			Level:   2,
+			Heading: text("two"),
+			Content: []parser.Node{
+				&parser.Section{
+					Level:   3,
+					Heading: text("three"),
+					Content: []parser.Node{
+						&parser.Section{
+							Level:   4,
+							Heading: text("four"),
+						},
+					},
+				},
+			},
+		},
+	)
+	blog.Meta["toc-depth"] = []parser.TextSimple{parser.TextSimple(text("3"))}
+	post := gen(t, blog)
+	expected := page.TableOfContents{
+		MaxDepth: 3,
+		Sections: []page.TOCSection{
+			{
+				ID:      "test",
+				Heading: page.StringOnlyContent{page.Text("test")},
+				NextLevel: []page.TOCSection{
+					{
+						ID:      "two",
+						Heading: page.StringOnlyContent{page.Text("two")},
+						NextLevel: []page.TOCSection{
+							{
+								ID:      "three",
+								Heading: page.StringOnlyContent{page.Text("three")},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if diff := deep.Equal(post.TOC, expected); diff != nil {
+		t.Error(diff)
+	}
+	four := post.Sections[0].Content[0].(page.Section).Content[0].(page.Section).Content[0].(page.Section)
+	if four.HeadingLevel() != 5 {
+		t.Errorf("expected level 4 section to be rendered as h5, got: h%d", four.HeadingLevel())
+	}
+}
+
+func TestGenTableOfContentsInvalidDepth(t *testing.T) {
+	for _, depth := range []string{"0", "7", "-1", "two"} {
+		blog := newBlog("en")
+		blog.Meta["toc-depth"] = []parser.TextSimple{parser.TextSimple(text(depth))}
+		post := page.Post{}
+		makeGen := &page.MakeGenVisitor{
+			TemplateData: &post,
+		}
+		blog.Accept(makeGen)
+		if makeGen.Errors == nil {
+			t.Errorf("toc-depth %q: expected an error", depth)
+		}
+		if post.TOC.MaxDepth != page.DefaultTOCDepth {
+			t.Errorf("toc-depth %q: expected the default depth %d, got: %d", depth, page.DefaultTOCDepth, post.TOC.MaxDepth)
+		}
+	}
+}
+
+func TestGenCodeBlockAttributes(t *testing.T) {
+	genCodeBlock := func(attrs parser.Attributes) (page.CodeBlock, error) {
+		post := page.Post{}
+		makeGen := &page.MakeGenVisitor{
+			TemplateData: &post,
+		}
+		newBlog("en", &parser.CodeBlock{
+			Attributes: attrs,
+			Lines:      []string{"a", "b", "c"},
+		}).Accept(makeGen)
+		return post.Sections[0].Content[0].(page.CodeBlock), makeGen.Errors
+	}
+
+	codeBlock, err := genCodeBlock(parser.Attributes{"hl": "1,2-3", "start": "120", "file": "main.go", "nonumber": ""})
+	if err != nil {
+		t.Error(err)
+	}
+	expected := page.CodeBlock{
+		Attributes: page.Attributes{"hl": "1,2-3", "start": "120", "file": "main.go", "nonumber": ""},
+		File:       "main.go",
+		NoNumber:   true,
+		Lines: []page.CodeLine{
+			{Number: 120, Highlighted: true, Content: "a"},
+			{Number: 121, Highlighted: true, Content: "b"},
+			{Number: 122, Highlighted: true, Content: "c"},
+		},
+	}
+	if diff := deep.Equal(codeBlock, expected); diff != nil {
+		t.Error(diff)
+	}
+
+	for _, attrs := range []parser.Attributes{
+		{"hl": "4"},
+		{"hl": "3-2"},
+		{"hl": "0"},
+		{"hl": "x"},
+		{"start": "-1"},
+	} {
+		if _, err := genCodeBlock(attrs); err == nil {
+			t.Errorf("expected an error for code block attributes %v", attrs)
+		}
+	}
+}
+
+func TestGenLists(t *testing.T) {
+	post := genSource(t, "- one\n- two\n\n  ```go\n  x := 1\n  ```\n- three\n  continued\n\n3. [ ]\n4. [x] done\n")
+	if len(post.Sections[0].Content) != 2 {
+		t.Fatalf("expected an unordered and an ordered list, got %d blocks", len(post.Sections[0].Content))
+	}
+	unordered := render(t, post, 0)
+	for _, expected := range []string{
+		"<ul>",
+		"<li>one</li>",
+		`<li>two<div class="code-block">`,
+		`<span class="line-number" data-line="1">x := <span class="hl-number">1</span></span>`,
+		"<li>three\ncontinued</li>",
+	} {
+		if !strings.Contains(unordered, expected) {
+			t.Errorf("expected list to contain %s, got: %s", expected, unordered)
+		}
+	}
+	ordered := render(t, post, 1)
+	for _, expected := range []string{
+		`<ol start="3">`,
+		`<li class="task-list-item"><input type="checkbox" disabled> </li>`,
+		`<li class="task-list-item"><input type="checkbox" disabled checked> done`,
+	} {
+		if !strings.Contains(ordered, expected) {
+			t.Errorf("expected list to contain %s, got: %s", expected, ordered)
+		}
+	}
+}
+
+func TestGenFootnotes(t *testing.T) {
+	blog := newBlog("en",
+		&parser.Paragraph{
+			Content: []parser.Node{
+				&parser.Text{Text: "A claim"},
+				&parser.Footnote{Ref: "a", Number: 1, Use: 1},
+				&parser.Text{Text: " and again"},
+				&parser.Footnote{Ref: "a", Number: 1, Use: 2},
+			},
+		},
+	)
+	blog.Endnotes = []*parser.Endnote{
+		{Ref: "a", Number: 1, Uses: 2, Paragraphs: []parser.TextRich{text("First."), text("Second.")}},
+	}
+	post := gen(t, blog)
+	expected := page.Footnotes{
+		{
+			Number: 1,
+			Uses:   2,
+			Content: []page.Renderable{
+				page.Paragraph{Content: page.StringOnlyContent{page.Text("First.")}},
+				page.Paragraph{Content: page.StringOnlyContent{page.Text("Second.")}},
+			},
+		},
+	}
+	if diff := deep.Equal(post.Footnotes, expected); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(post.Footnotes[0].BackRefs(), []string{"footnote-1-ref-1", "footnote-1-ref-2"}); diff != nil {
+		t.Error(diff)
+	}
+	ref := `A claim<sup class="footnote-ref" id="footnote-1-ref-1"><a href="#footnote-1" role="doc-noteref">1</a></sup>`
+	if paragraph := render(t, post, 0); !strings.Contains(paragraph, ref) {
+		t.Errorf("expected paragraph to contain %s, got: %s", ref, paragraph)
+	}
+}
+
+func TestGenUndefinedFootnote(t *testing.T) {
+	// the missing definition is reported while resolving references, the
+	// generator must not report it a second time
+	if _, err := genSourceErrors(t, "A claim [^a].\n"); err != nil {
+		t.Errorf("expected no errors, got: %v", err)
+	}
+}
+
+func TestGenNestedFootnotes(t *testing.T) {
+	post := genSource(t, `*em [^b]*, **strong [^c]** and a word[^s].
+
+[^b]: Note b [^n].
+
+[^c]: Note c.
+
+[^s]: A sidenote [^d].
+
+[^d]: Note d.
+
+[^n]: Nested in b.
+`)
+	if len(post.Footnotes) != 4 {
+		t.Fatalf("expected 4 footnotes, got: %d", len(post.Footnotes))
+	}
+	paragraph := render(t, post, 0)
+	for _, expected := range []string{
+		`<em>em<sup class="footnote-ref" id="footnote-1-ref-1"><a href="#footnote-1" role="doc-noteref">1</a></sup></em>`,
+		`<strong>strong<sup class="footnote-ref" id="footnote-3-ref-1"><a href="#footnote-3" role="doc-noteref">3</a></sup></strong>`,
+		`A sidenote<sup class="footnote-ref" id="footnote-4-ref-1"><a href="#footnote-4" role="doc-noteref">4</a></sup>`,
+	} {
+		if !strings.Contains(paragraph, expected) {
+			t.Errorf("expected paragraph to contain %s, got: %s", expected, paragraph)
+		}
+	}
+	note, err := post.Footnotes[0].Content[0].Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nested := `<a href="#footnote-2" role="doc-noteref">2</a>`
+	if !strings.Contains(string(note), nested) {
+		t.Errorf("expected footnote to contain %s, got: %s", nested, note)
+	}
+}
+
+func TestGenEnquoteLanguage(t *testing.T) {
+	testCases := []struct {
+		lang, expected string
+	}{
+		{"en", "<p>&ldquo;a &lsquo;b&rsquo;&rdquo;</p>"},
+		{"de-CH", "<p>&laquo;a &lsaquo;b&rsaquo;&raquo;</p>"},
+		{"de", "<p>&bdquo;a &sbquo;b&lsquo;&ldquo;</p>"},
+		{"ja", "<p>「a 『b』」</p>"},
+		{"tlh", "<p>&ldquo;a &lsquo;b&rsquo;&rdquo;</p>"},
+	}
+	for _, testCase := range testCases {
+		post := genPost(t, testCase.lang,
+			&parser.Paragraph{
+				Content: []parser.Node{
+					&parser.EnquoteDouble{Content: parser.TextRich{
+						&parser.Text{Text: "a "},
+						&parser.EnquoteSingle{Content: text("b")},
+					}},
+				},
+			},
+		)
+		if paragraph := render(t, post, 0); paragraph != testCase.expected {
+			t.Errorf("%s: expected %s, got: %s", testCase.lang, testCase.expected, paragraph)
+		}
+	}
+}
+
+func TestGenAttributes(t *testing.T) {
+	post := genPost(t, "en",
+		&parser.Paragraph{
+			Attributes: parser.Attributes{"id": "intro", "class": "lead", "onclick": "alert(1)", "data-Bad": "x"},
+			Content: []parser.Node{
+				&parser.Span{
+					Attributes: parser.Attributes{"lang": "ja", "data-reading": `"kanji"`},
+					Content:    text("漢字"),
+				},
+			},
+		},
+	)
+	expected := `<p id="intro" class="lead"><span lang="ja" data-reading="&#34;kanji&#34;">漢字</span></p>`
+	if paragraph := render(t, post, 0); paragraph != expected {
+		t.Errorf("expected %s, got: %s", expected, paragraph)
+	}
+}
+
+func TestGenTableAttributes(t *testing.T) {
+	post := genPost(t, "en",
+		&parser.Table{
+			Attributes: parser.Attributes{"id": "t1", "class": "wide", "lang": "ja", "caption": "Cap"},
+			Alignments: []parser.Alignment{parser.AlignDefault},
+			Header:     []parser.TextRich{text("A")},
+		},
+	)
+	expected := `<div id="t1" class="table wide" lang="ja">`
+	if table := render(t, post, 0); !strings.HasPrefix(table, expected) {
+		t.Errorf("expected table to start with %s, got: %s", expected, table)
+	}
+}
+
+func TestGenRuby(t *testing.T) {
+	post := genPost(t, "ja",
+		&parser.Paragraph{
+			Content: []parser.Node{
+				&parser.Ruby{Kanji: []string{"漢", "字"}, Furigana: []string{"かん", "じ"}},
+			},
+		},
+	)
+	expected := `<p><ruby><rb>漢</rb><rp>(</rp><rt>かん</rt><rp>)</rp></ruby><ruby><rb>字</rb><rp>(</rp><rt>じ</rt><rp>)</rp></ruby></p>`
+	if paragraph := render(t, post, 0); paragraph != expected {
+		t.Errorf("expected %s, got: %s", expected, paragraph)
+	}
+}
+
+func TestGenScriptsKbdAndAbbreviations(t *testing.T) {
+	post := genPost(t, "en",
+		&parser.Paragraph{
+			Content: []parser.Node{
+				&parser.Text{Text: "H"},
+				&parser.Subscript{Text: "2"},
+				&parser.Text{Text: "O, 2"},
+				&parser.Superscript{Text: "10"},
+				&parser.Text{Text: ", "},
+				&parser.Kbd{Text: "<"},
+				&parser.Text{Text: ", "},
+				&parser.Abbreviation{Abbr: "HTML", Title: `"HyperText" Markup Language`},
+				&parser.Text{Text: ", x"},
+				&parser.Superscript{Text: "<b>"},
+				&parser.Subscript{Text: "&"},
+				&parser.Text{Text: ", "},
+				&parser.Abbreviation{Abbr: "R&D", Title: "Research & Development"},
+			},
+		},
+	)
+	expected := `<p>H<sub>2</sub>O, 2<sup>10</sup>, <kbd>&lt;</kbd>, <abbr title="&#34;HyperText&#34; Markup Language">HTML</abbr>` +
+		`, x<sup>&lt;b&gt;</sup><sub>&amp;</sub>, <abbr title="Research &amp; Development">R&amp;D</abbr></p>`
+	if paragraph := render(t, post, 0); paragraph != expected {
+		t.Errorf("expected %s, got: %s", expected, paragraph)
+	}
+}
+
+func TestGenAdmonitions(t *testing.T) {
+	post := genPost(t, "en",
+		&parser.Admonition{
+			Type: "warning",
+			Content: []parser.Node{
+				&parser.Paragraph{Content: text("Careful.")},
+			},
+		},
+		&parser.Admonition{
+			Type:        "tip",
+			Title:       parser.TextSimple(text("Did you know?")),
+			Collapsible: true,
+			Open:        true,
+			Content: []parser.Node{
+				&parser.Paragraph{Content: text("Cats sleep a lot.")},
+			},
+		},
+	)
+	expected := []string{
+		`<div class="note note-warning"><p class="title"><strong style="text-transform: uppercase;">warning</strong></p><p>Careful.</p>
+</div>`,
+		`<details class="note note-tip" open><summary class="title"><strong>Did you know?</strong></summary><p>Cats sleep a lot.</p>
+</details>`,
+	}
+	for i, expected := range expected {
+		if admonition := render(t, post, i); admonition != expected {
+			t.Errorf("expected %s, got: %s", expected, admonition)
+		}
+	}
+}
+
+func TestGenQuotes(t *testing.T) {
+	blog := newBlog("en",
+		&parser.BlockQuote{
+			Content: []parser.Node{
+				&parser.Paragraph{Content: text("Elea acta est.\n")},
+			},
+			Author: parser.TextSimple(text("Caesar")),
+		},
+		&parser.BlockQuote{
+			Content: []parser.Node{
+				&parser.Paragraph{Content: text("Outer.")},
+				&parser.BlockQuote{
+					Content: []parser.Node{
+						&parser.Paragraph{Content: text("Inner.")},
+					},
+				},
+			},
+		},
+	)
+	post := page.Post{}
+	makeQuotes := &page.MakeQuotesVisitor{
+		MakeGenVisitor: page.MakeGenVisitor{
+			TemplateData: &post,
+		},
+	}
+	blog.Accept(makeQuotes)
+	if makeQuotes.Errors != nil {
+		t.Error(makeQuotes.Errors)
+	}
+	content := post.Sections[0].Content
+	if len(content) != 2 {
+		t.Fatalf("expected two quotes, got: %d", len(content))
+	}
+	// the id of a single paragraph quote is derived from its text, author and source, just as it always has been
+	hashID := sha256.Sum256([]byte("Elea acta est.\n" + "Caesar"))
+	expectedID := base64.StdEncoding.EncodeToString(hashID[:])
+	single := content[0].(page.Blockquote)
+	if single.Attributes["id"] != expectedID {
+		t.Errorf("expected id %s, got: %s", expectedID, single.Attributes["id"])
+	}
+	nested := content[1].(page.Blockquote)
+	if len(nested.Content) != 2 {
+		t.Fatalf("expected a paragraph and a nested quote, got: %v", nested.Content)
+	}
+	inner := nested.Content[1].(page.Blockquote)
+	if _, ok := inner.Attributes["id"]; ok {
+		t.Error("nested quotes must not have an id of their own")
+	}
+	html, err := nested.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(html), "<blockquote><p>Outer.</p>") || !strings.Contains(string(html), "<blockquote><p>Inner.</p>") {
+		t.Errorf("expected nested blockquotes, got: %s", html)
+	}
+}
+
+func TestGenErrorLocations(t *testing.T) {
+	lx := lexer.New()
+	err := lx.LexSource("errors.md", `
+---
+url-path: errors
+title: Errors
+title: Errors, again
+author: Colin
+---
+
+# Errors
+
+`+"```go {hl=9}"+`
+func main() {}
+`+"```"+`
+
+| Formula |
+|---------|
+| $\frac{1}$ |
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blog, err := parser.Parse(lx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := page.Post{}
+	makeGen := &page.MakeGenVisitor{
+		TemplateData: &post,
+	}
+	blog.Accept(makeGen)
+	if makeGen.Errors == nil {
+		t.Fatal("expected errors")
+	}
+	errs := strings.Split(makeGen.Errors.Error(), "\n")
+	expected := []string{
+		"errors.md:5:1: multiple definitions of meta key: title",
+		"errors.md:1:1: missing mandatory meta key: lang",
+		"errors.md:11:1: code block: invalid value for hl: line 9 out of range, code block has 1 lines",
+		`errors.md:17:4: math "\\frac{1}": \frac denominator: missing argument`,
+	}
+	if diff := deep.Equal(errs, expected); diff != nil {
+		t.Error(diff)
+	}
+}
+
+// genSourceErrors lexes and parses the content of a single section like
+// genSource, but returns the errors of making the template data instead of
+// failing the test.
+func genSourceErrors(t *testing.T, content string) (page.Post, error) {
+	t.Helper()
+	lx := lexer.New()
+	err := lx.LexSource("test.md", "---\nurl-path: test\nauthor: Colin\ntitle: Test\nlang: en\n---\n\n# test\n\n"+content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blog, err := parser.Parse(lx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := page.Post{}
+	makeGen := &page.MakeGenVisitor{
+		TemplateData: &post,
+	}
+	blog.Accept(makeGen)
+	return post, makeGen.Errors
+}
+
+func TestGenUnsupportedMedia(t *testing.T) {
+	_, err := genSourceErrors(t, "![alt](foo.gif)\n")
+	expected := `test.md:10:1: unrecognized file extension: ".gif"`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %s, got: %v", expected, err)
+	}
+}
+
+func TestGenHtmlInNote(t *testing.T) {
+	post, err := genSourceErrors(t, `<Note type="info">
+See <Ruby furi="かん">漢</Ruby>.
+</Note>
+
+After the note.
+`)
+	expected := "test.md:11:6: <Note> cannot contain any child html elements: Ruby"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %s, got: %v", expected, err)
+	}
+	if paragraph := render(t, post, 1); !strings.Contains(paragraph, "After the note.") {
+		t.Errorf("expected the paragraph after the note, got: %s", paragraph)
+	}
+}